@@ -0,0 +1,117 @@
+// Account management tool, registering the account, rotating its key or changing its passphrase
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"arkhive.dev/launcher/internal/configloader"
+	"arkhive.dev/launcher/internal/folder"
+	"arkhive.dev/launcher/internal/network"
+	"arkhive.dev/launcher/pkg/encryption"
+	"github.com/sirupsen/logrus"
+	"golang.org/x/term"
+)
+
+// Name of the application whose configuration is loaded
+const APPLICATION_NAME = "arkhive"
+
+func main() {
+	// Parsing the command line arguments, the positional ones are the command and its arguments
+	configurationFilePath := flag.String("config", "", "Configuration file path")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s [-config file] register <username> <email> | rotate | passphrase\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	configuration, err := configloader.LoadConfiguration(APPLICATION_NAME, *configurationFilePath)
+	if err != nil {
+		logrus.Errorf("%+v", err)
+		os.Exit(1)
+	}
+	if err = unlockAccountKey(configuration); err != nil {
+		logrus.Errorf("%+v", err)
+		os.Exit(1)
+	}
+	networkEngine, err := network.NewNetworkEngine(configuration)
+	if err != nil {
+		logrus.Errorf("%+v", err)
+		os.Exit(1)
+	}
+	waitGroup := sync.WaitGroup{}
+	waitGroup.Add(1)
+	networkEngine.Initialize(&waitGroup)
+
+	ctx := context.Background()
+	switch {
+	case flag.NArg() == 3 && flag.Arg(0) == "register":
+		err = networkEngine.Register(ctx, flag.Arg(1), flag.Arg(2))
+	case flag.NArg() == 1 && flag.Arg(0) == "rotate":
+		err = networkEngine.RotateAccountKey(ctx)
+	case flag.NArg() == 1 && flag.Arg(0) == "passphrase":
+		if err = changePassphrase(ctx, networkEngine); err == nil {
+			logrus.Info("Private key passphrase changed")
+			return
+		}
+	default:
+		flag.Usage()
+		os.Exit(2)
+	}
+	if err != nil {
+		logrus.Errorf("%+v", err)
+		os.Exit(1)
+	}
+	account := networkEngine.GetAccount()
+	logrus.Infof("Certificate of %s <%s> issued", account.Username, account.Email)
+}
+
+// Read a passphrase from the terminal without echoing it
+func readPassphrase(prompt string) (passphrase string, err error) {
+	fmt.Fprint(os.Stderr, prompt)
+	var passphraseBytes []byte
+	passphraseBytes, err = term.ReadPassword(int(os.Stdin.Fd()))
+	fmt.Fprintln(os.Stderr)
+	return string(passphraseBytes), err
+}
+
+// Ask the passphrase of an encrypted private key missing from the OS keyring, storing it
+func unlockAccountKey(configuration configloader.Config) (err error) {
+	privateKeyBytes, err := os.ReadFile(filepath.Join(configuration.BasePath, folder.SYSTEM, network.PRIVATE_KEY_FILE))
+	if os.IsNotExist(err) || (err == nil && !encryption.IsEncryptedPrivateKey(privateKeyBytes)) {
+		return nil
+	} else if err != nil {
+		return
+	}
+	var passphrase string
+	if passphrase, err = network.ReadAccountPassphrase(); err != nil || passphrase != "" {
+		return
+	}
+	if passphrase, err = readPassphrase("Private key passphrase: "); err != nil {
+		return
+	}
+	if _, err = encryption.ParsePrivateKeyWithPassphrase(privateKeyBytes, passphrase); err != nil {
+		return
+	}
+	return network.StoreAccountPassphrase(passphrase)
+}
+
+// Ask the new passphrase twice, encrypting the private key with it
+func changePassphrase(ctx context.Context, networkEngine *network.NetworkEngine) (err error) {
+	var passphrase, confirmation string
+	if passphrase, err = readPassphrase("New private key passphrase (empty to store it plaintext): "); err != nil {
+		return
+	}
+	if confirmation, err = readPassphrase("Confirm the passphrase: "); err != nil {
+		return
+	}
+	if passphrase != confirmation {
+		return errors.New("the passphrases don't match")
+	}
+	return networkEngine.ChangeAccountPassphrase(ctx, passphrase)
+}
@@ -7,7 +7,8 @@ import (
 
 	"arkhive.dev/launcher/internal/configloader"
 	"arkhive.dev/launcher/internal/database"
-	"arkhive.dev/launcher/internal/database/delegate"
+	"arkhive.dev/launcher/internal/database/delegate/sqlite"
+	"arkhive.dev/launcher/internal/database/importer"
 	"arkhive.dev/launcher/internal/engine"
 	"arkhive.dev/launcher/internal/gui"
 	"arkhive.dev/launcher/internal/launcher"
@@ -110,17 +111,26 @@ func logBuildInformation() {
 func runEngines(configuration configloader.Config) {
 	var engines []engine.ApplicationEngine = make([]engine.ApplicationEngine, EnginesCount)
 	// The application entities data
-	engines[Database] = database.NewDatabase(&delegate.DatabaseDelegate().BasePath)
+	databaseDelegate := &sqlite.SQLite{BasePath: configuration.BasePath}
+	engines[Database] = database.NewDatabase(databaseDelegate, []importer.Importer{
+		importer.NewEncryptedImporter(configuration.BasePath),
+		importer.NewPlain(configuration.BasePath),
+	})
 	// The handler of the communication
-	engines[Network], _ = network.NewNetworkEngine()
+	networkEngine, err := network.NewNetworkEngine(configuration)
+	if err != nil {
+		logrus.Errorf("%+v", err)
+		return
+	}
+	engines[Network] = networkEngine
 	// The operative systems and hardware adapter
-	engines[System], _ = system.NewSystemEngine()
+	engines[System], _ = system.NewSystemEngine(databaseDelegate, networkEngine, configuration)
 	// The data scraper
 	engines[Search], _ = search.NewSearchEngine()
 	// The engine to persist large amount of unscrepable
-	engines[Storage], _ = storage.NewStorageEngine()
+	engines[Storage], _ = storage.NewStorageEngine(databaseDelegate, networkEngine, configuration)
 	// The interface with the emulation side
-	engines[Launcher], _ = launcher.NewLauncherEngine()
+	engines[Launcher], _ = launcher.NewLauncherEngine(databaseDelegate, configuration)
 
 	guiHandler := gui.QtHandler{}
 
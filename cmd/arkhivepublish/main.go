@@ -0,0 +1,52 @@
+// Curators tool to publish the network files, like db.honey and undertow.tow, to a Storj bucket
+package main
+
+import (
+	"flag"
+	"net/url"
+	"os"
+
+	"arkhive.dev/launcher/internal/network/resources"
+	"github.com/sirupsen/logrus"
+)
+
+func main() {
+	// Parsing the command line arguments, the positional ones are the sj:// destination URLs
+	access := flag.String("access", os.Getenv("STORJ_ACCESS"), "Serialized Storj access grant")
+	sourcePath := flag.String("path", ".", "Folder containing the files to publish")
+	flag.Parse()
+
+	if *access == "" || flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	failed := false
+	for _, argument := range flag.Args() {
+		if err := publish(*access, *sourcePath, argument); err != nil {
+			logrus.Errorf("%s: %+v", argument, err)
+			failed = true
+		}
+	}
+	if failed {
+		os.Exit(1)
+	}
+}
+
+// Upload the file named as the destination object from the source folder
+func publish(access string, sourcePath string, destination string) (err error) {
+	var destinationURL *url.URL
+	if destinationURL, err = url.Parse(destination); err != nil {
+		return
+	}
+	handler := &resources.StorjResource{
+		URL:    *destinationURL,
+		Access: access,
+	}
+	resource := resources.NewResource(handler, sourcePath, []string{})
+	if err = handler.Upload(resource); err != nil {
+		return
+	}
+	logrus.Infof("%s: Published %d bytes", destination, resource.Available)
+	return
+}
@@ -0,0 +1,54 @@
+// Test signing endpoint of the account registration requests, for offline setups
+package main
+
+import (
+	"crypto/rsa"
+	"flag"
+	"net/http"
+	"os"
+
+	"arkhive.dev/launcher/internal/network"
+	"arkhive.dev/launcher/pkg/encryption"
+	"github.com/sirupsen/logrus"
+)
+
+func main() {
+	// Parsing the command line arguments
+	keyPath := flag.String("key", "undertow.key", "Undertow private key PEM file, generated if missing")
+	passphrase := flag.String("passphrase", os.Getenv("UNDERTOW_PASSPHRASE"), "Passphrase encrypting the undertow private key, plaintext if empty")
+	address := flag.String("listen", "localhost:8080", "Address of the signing endpoint")
+	flag.Parse()
+
+	undertowPrivateKey, err := loadUndertowKey(*keyPath, *passphrase)
+	if err != nil {
+		logrus.Errorf("%+v", err)
+		os.Exit(1)
+	}
+	logrus.Infof("Signing registration requests on http://%s/", *address)
+	if err = http.ListenAndServe(*address, network.NewCertificateSigner(undertowPrivateKey)); err != nil {
+		logrus.Errorf("%+v", err)
+		os.Exit(1)
+	}
+}
+
+// Read the undertow private key or generate it, writing its public key aside with the .pub extension
+func loadUndertowKey(keyPath string, passphrase string) (privateKey *rsa.PrivateKey, err error) {
+	if privateKey, err = network.ReadAccountPrivateKeyFile(keyPath, passphrase); !os.IsNotExist(err) {
+		return
+	}
+	if privateKey, err = encryption.GeneratePairKey(network.ACCOUNT_KEY_BITS); err != nil {
+		return
+	}
+	if err = network.WriteAccountPrivateKeyFile(keyPath, privateKey, passphrase); err != nil {
+		return
+	}
+	var publicKeyBytes []byte
+	if publicKeyBytes, err = encryption.ExportPublicKey(&privateKey.PublicKey); err != nil {
+		return
+	}
+	if err = os.WriteFile(keyPath+".pub", publicKeyBytes, 0644); err != nil {
+		return
+	}
+	logrus.Infof("Generated the undertow key %s", keyPath)
+	return
+}
@@ -0,0 +1,82 @@
+// Curators tool to create the signed undertow bundle, published with arkhivepublish
+package main
+
+import (
+	"crypto/rsa"
+	"flag"
+	"os"
+	"strings"
+
+	"arkhive.dev/launcher/internal/network"
+	"arkhive.dev/launcher/internal/undertow"
+	"github.com/sirupsen/logrus"
+)
+
+func main() {
+	// Parsing the command line arguments
+	keyPath := flag.String("key", "undertow.key", "Root private key PEM file")
+	previousKeyPath := flag.String("previous-key", "", "Previous root private key PEM file, signing the root key rotation")
+	previousBundlePath := flag.String("previous-bundle", "", "Published bundle file, whose rotations chain is extended by the root key rotation")
+	passphrase := flag.String("passphrase", os.Getenv("UNDERTOW_PASSPHRASE"), "Passphrase encrypting the root private keys, plaintext if empty")
+	version := flag.Int64("version", 0, "Bundle version, greater than the published one")
+	bootstrapPeers := flag.String("peers", "", "Comma separated host:port addresses of the bootstrap peers")
+	catalogs := flag.String("catalogs", "", "Comma separated URLs of the catalog databases")
+	outputPath := flag.String("out", undertow.DEFAULT_PATH, "Bundle file to create")
+	flag.Parse()
+
+	if *version <= 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	if err := createBundle(*keyPath, *previousKeyPath, *previousBundlePath, *passphrase, *version, splitList(*bootstrapPeers), splitList(*catalogs), *outputPath); err != nil {
+		logrus.Errorf("%+v", err)
+		os.Exit(1)
+	}
+}
+
+// Sign the bundle with the root key, and with the previous root key when rotating it
+func createBundle(keyPath string, previousKeyPath string, previousBundlePath string, passphrase string, version int64, bootstrapPeers []string, catalogs []string, outputPath string) (err error) {
+	var rootPrivateKey *rsa.PrivateKey
+	if rootPrivateKey, err = network.ReadAccountPrivateKeyFile(keyPath, passphrase); err != nil {
+		return
+	}
+	var bundle *undertow.Bundle
+	if bundle, err = undertow.NewBundle(version, &rootPrivateKey.PublicKey, bootstrapPeers, catalogs); err != nil {
+		return
+	}
+	if err = bundle.SignWith(rootPrivateKey); err != nil {
+		return
+	}
+	if previousKeyPath != "" {
+		var previousRootPrivateKey *rsa.PrivateKey
+		if previousRootPrivateKey, err = network.ReadAccountPrivateKeyFile(previousKeyPath, passphrase); err != nil {
+			return
+		}
+		var previousRotations []undertow.Rotation
+		if previousBundlePath != "" {
+			var previousBundle *undertow.Bundle
+			if previousBundle, err = undertow.ReadBundleFile(previousBundlePath); err != nil {
+				return
+			}
+			previousRotations = previousBundle.Rotations
+		}
+		if err = bundle.RotateFrom(previousRootPrivateKey, previousRotations); err != nil {
+			return
+		}
+	}
+	if err = bundle.WriteFile(outputPath); err != nil {
+		return
+	}
+	logrus.Infof("Created the undertow bundle %s version %d", outputPath, version)
+	return
+}
+
+func splitList(list string) (values []string) {
+	values = []string{}
+	for _, value := range strings.Split(list, ",") {
+		if value = strings.TrimSpace(value); value != "" {
+			values = append(values, value)
+		}
+	}
+	return
+}
@@ -0,0 +1,221 @@
+/*
+Extraction of the game, core, plugin and tool archives.
+
+The zip, 7z, rar and tar (plain, gzip, bzip2 or xz compressed) archives are extracted
+natively, the other formats are passed to the 7z executable when it's available.
+*/
+package archive
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+var ErrUnsupportedFormat = errors.New("unsupported archive format")
+var ErrUnsafePath = errors.New("archive entry outside the destination folder")
+var ErrSizeLimit = errors.New("archive content exceeds the size limit")
+var ErrEntryNotFound = errors.New("entry not found in the archive")
+
+type Options struct {
+	// Slash separated path of the file or folder to extract alone, everything is extracted if empty
+	Entry string
+	// Maximum extracted size in bytes, unlimited if 0
+	MaxSize int64
+	// Handler of the extraction progress, total is 0 when the archive doesn't declare its size
+	ProgressHandler func(extracted int64, total int64)
+	// Executable extracting the formats not supported natively, the 7z one if empty
+	FallbackPath string
+}
+
+// Extensions of the natively extracted archives
+var nativeExtensions = []string{".zip", ".7z", ".rar", ".tar", ".tar.gz", ".tgz", ".tar.bz2", ".tbz2", ".tar.xz", ".txz"}
+
+// Whether the file name has the extension of a natively extracted archive
+func IsArchive(fileName string) bool {
+	fileName = strings.ToLower(fileName)
+	for _, extension := range nativeExtensions {
+		if strings.HasSuffix(fileName, extension) {
+			return true
+		}
+	}
+	return false
+}
+
+// An archive entry, opened only when extracted
+type entry struct {
+	name  string
+	isDir bool
+	mode  os.FileMode
+	size  int64
+	open  func() (io.ReadCloser, error)
+}
+
+// Archive format reader, calling the visitor for every entry in order
+type walker interface {
+	// Total uncompressed size declared by the archive, 0 if unknown
+	total() int64
+	walk(visitor func(entry *entry) error) error
+	io.Closer
+}
+
+/*
+Extract the archive into the destination folder.
+
+The entries escaping the destination folder are rejected and the links are skipped.
+When an entry is selected, only the entry and its content are extracted, keeping their
+path inside the archive. The files written so far are removed when the extraction fails.
+*/
+func Extract(archivePath string, destinationPath string, options Options) (err error) {
+	var reader walker
+	if reader, err = openArchive(archivePath); errors.Is(err, ErrUnsupportedFormat) {
+		return extractFallback(archivePath, destinationPath, options)
+	} else if err != nil {
+		return
+	}
+	defer reader.Close()
+	if err = os.MkdirAll(destinationPath, 0755); err != nil {
+		return
+	}
+	extraction := &extraction{
+		destinationPath: destinationPath,
+		options:         options,
+		total:           reader.total(),
+	}
+	if err = reader.walk(extraction.extract); err != nil {
+		for _, filePath := range extraction.written {
+			os.Remove(filePath)
+		}
+		return fmt.Errorf("%s: %w", filepath.Base(archivePath), err)
+	}
+	if options.Entry != "" && !extraction.found {
+		return fmt.Errorf("%s: %w: %s", filepath.Base(archivePath), ErrEntryNotFound, options.Entry)
+	}
+	return
+}
+
+// Signatures of the natively extracted formats
+var (
+	zipSignature   = []byte("PK\x03\x04")
+	emptyZip       = []byte("PK\x05\x06")
+	sevenZip       = []byte("7z\xBC\xAF\x27\x1C")
+	rarSignature   = []byte("Rar!\x1A\x07")
+	gzipSignature  = []byte("\x1F\x8B")
+	bzip2Signature = []byte("BZh")
+	xzSignature    = []byte("\xFD7zXZ\x00")
+)
+
+// Open the archive with the reader of its format, detected from its signature
+func openArchive(archivePath string) (reader walker, err error) {
+	var file *os.File
+	if file, err = os.Open(archivePath); err != nil {
+		return
+	}
+	header := make([]byte, 8)
+	headerSize, _ := io.ReadFull(file, header)
+	header = header[:headerSize]
+	file.Close()
+	lowerPath := strings.ToLower(archivePath)
+	isTar := strings.HasSuffix(lowerPath, ".tar") || strings.Contains(path.Base(lowerPath), ".tar.") ||
+		strings.HasSuffix(lowerPath, ".tgz") || strings.HasSuffix(lowerPath, ".tbz2") || strings.HasSuffix(lowerPath, ".txz")
+	switch {
+	case bytes.HasPrefix(header, zipSignature) || bytes.HasPrefix(header, emptyZip):
+		return openZip(archivePath)
+	case bytes.HasPrefix(header, sevenZip):
+		return openSevenZip(archivePath)
+	case bytes.HasPrefix(header, rarSignature):
+		return openRar(archivePath)
+	case isTar && bytes.HasPrefix(header, gzipSignature):
+		return openTar(archivePath, gzipCompression)
+	case isTar && bytes.HasPrefix(header, bzip2Signature):
+		return openTar(archivePath, bzip2Compression)
+	case isTar && bytes.HasPrefix(header, xzSignature):
+		return openTar(archivePath, xzCompression)
+	case isTar:
+		return openTar(archivePath, noCompression)
+	}
+	return nil, ErrUnsupportedFormat
+}
+
+// State of an archive extraction
+type extraction struct {
+	destinationPath string
+	options         Options
+	total           int64
+	extracted       int64
+	// Whether the selected entry was found
+	found bool
+	// Paths of the extracted files, removed if the extraction fails
+	written []string
+}
+
+// Extract the entry if selected, checking its path and the size limit
+func (extraction *extraction) extract(entry *entry) (err error) {
+	name := strings.Trim(strings.ReplaceAll(entry.name, "\\", "/"), "/")
+	if name == "" {
+		return
+	}
+	if selected := strings.Trim(extraction.options.Entry, "/"); selected != "" {
+		if name != selected && !strings.HasPrefix(name, selected+"/") {
+			return
+		}
+		extraction.found = true
+	}
+	relativePath := filepath.FromSlash(name)
+	if !filepath.IsLocal(relativePath) {
+		return fmt.Errorf("%w: %s", ErrUnsafePath, entry.name)
+	}
+	entryPath := filepath.Join(extraction.destinationPath, relativePath)
+	if entry.isDir {
+		return os.MkdirAll(entryPath, 0755)
+	}
+	if !entry.mode.IsRegular() {
+		// Links may point outside the destination folder
+		return
+	}
+	if extraction.options.MaxSize > 0 && extraction.extracted+entry.size > extraction.options.MaxSize {
+		return ErrSizeLimit
+	}
+	if err = os.MkdirAll(filepath.Dir(entryPath), 0755); err != nil {
+		return
+	}
+	var reader io.ReadCloser
+	if reader, err = entry.open(); err != nil {
+		return
+	}
+	defer reader.Close()
+	var file *os.File
+	if file, err = os.OpenFile(entryPath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, entry.mode.Perm()|0600); err != nil {
+		return
+	}
+	extraction.written = append(extraction.written, entryPath)
+	if _, err = io.Copy(file, &progressReader{reader, extraction}); err != nil {
+		file.Close()
+		return
+	}
+	return file.Close()
+}
+
+// Reader counting the extracted bytes, enforcing the size limit on the actual content
+type progressReader struct {
+	reader     io.Reader
+	extraction *extraction
+}
+
+func (progressReader *progressReader) Read(buffer []byte) (count int, err error) {
+	count, err = progressReader.reader.Read(buffer)
+	extraction := progressReader.extraction
+	extraction.extracted += int64(count)
+	if extraction.options.MaxSize > 0 && extraction.extracted > extraction.options.MaxSize {
+		return count, ErrSizeLimit
+	}
+	if count > 0 && extraction.options.ProgressHandler != nil {
+		extraction.options.ProgressHandler(extraction.extracted, extraction.total)
+	}
+	return
+}
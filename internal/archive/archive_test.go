@@ -0,0 +1,170 @@
+package archive_test
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"testing"
+
+	"arkhive.dev/launcher/internal/archive"
+	"github.com/stretchr/testify/assert"
+	"github.com/ulikunitz/xz"
+)
+
+var testFiles = map[string]string{
+	"Collection/smw/smw.sfc": "rom",
+	"readme.txt":             "readme",
+}
+
+func writeZip(t *testing.T, files map[string]string) string {
+	archivePath := filepath.Join(t.TempDir(), "test.zip")
+	file, err := os.Create(archivePath)
+	assert.Nil(t, err)
+	writer := zip.NewWriter(file)
+	for _, name := range sortedNames(files) {
+		fileWriter, err := writer.Create(name)
+		assert.Nil(t, err)
+		_, err = fileWriter.Write([]byte(files[name]))
+		assert.Nil(t, err)
+	}
+	assert.Nil(t, writer.Close())
+	assert.Nil(t, file.Close())
+	return archivePath
+}
+
+func writeTar(t *testing.T, name string, compress func(io.Writer) io.WriteCloser, files map[string]string) string {
+	archivePath := filepath.Join(t.TempDir(), name)
+	file, err := os.Create(archivePath)
+	assert.Nil(t, err)
+	compressor := compress(file)
+	writer := tar.NewWriter(compressor)
+	for _, name := range sortedNames(files) {
+		assert.Nil(t, writer.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: int64(len(files[name])), Typeflag: tar.TypeReg}))
+		_, err = writer.Write([]byte(files[name]))
+		assert.Nil(t, err)
+	}
+	assert.Nil(t, writer.Close())
+	assert.Nil(t, compressor.Close())
+	assert.Nil(t, file.Close())
+	return archivePath
+}
+
+func sortedNames(files map[string]string) (names []string) {
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return
+}
+
+func assertFiles(t *testing.T, destinationPath string, files map[string]string) {
+	extracted := map[string]string{}
+	filepath.WalkDir(destinationPath, func(filePath string, entry os.DirEntry, err error) error {
+		assert.Nil(t, err)
+		if entry.IsDir() {
+			return nil
+		}
+		data, err := os.ReadFile(filePath)
+		assert.Nil(t, err)
+		relativePath, _ := filepath.Rel(destinationPath, filePath)
+		extracted[filepath.ToSlash(relativePath)] = string(data)
+		return nil
+	})
+	assert.Equal(t, files, extracted)
+}
+
+func TestExtract(t *testing.T) {
+	archives := map[string]string{
+		"zip": writeZip(t, testFiles),
+		"7z":  filepath.Join("testdata", "collection.7z"),
+		"tar.gz": writeTar(t, "test.tar.gz", func(writer io.Writer) io.WriteCloser {
+			return gzip.NewWriter(writer)
+		}, testFiles),
+		"tar.xz": writeTar(t, "test.tar.xz", func(writer io.Writer) io.WriteCloser {
+			compressor, err := xz.NewWriter(writer)
+			assert.Nil(t, err)
+			return compressor
+		}, testFiles),
+	}
+	for format, archivePath := range archives {
+		t.Run(format, func(t *testing.T) {
+			assert.True(t, archive.IsArchive(archivePath))
+			destinationPath := t.TempDir()
+			var extracted int64
+			err := archive.Extract(archivePath, destinationPath, archive.Options{
+				ProgressHandler: func(current int64, total int64) { extracted = current },
+			})
+			assert.Nil(t, err)
+			assertFiles(t, destinationPath, testFiles)
+			assert.Equal(t, int64(len("rom")+len("readme")), extracted)
+		})
+	}
+}
+
+func TestExtractEntry(t *testing.T) {
+	for _, archivePath := range []string{writeZip(t, testFiles), filepath.Join("testdata", "collection.7z")} {
+		destinationPath := t.TempDir()
+		assert.Nil(t, archive.Extract(archivePath, destinationPath, archive.Options{Entry: "Collection/smw"}))
+		assertFiles(t, destinationPath, map[string]string{"Collection/smw/smw.sfc": "rom"})
+
+		err := archive.Extract(archivePath, t.TempDir(), archive.Options{Entry: "Collection/other"})
+		assert.ErrorIs(t, err, archive.ErrEntryNotFound)
+	}
+}
+
+func TestExtractUnsafePath(t *testing.T) {
+	destinationPath := filepath.Join(t.TempDir(), "destination")
+	archivePath := writeZip(t, map[string]string{"../evil.txt": "evil"})
+
+	err := archive.Extract(archivePath, destinationPath, archive.Options{})
+	assert.ErrorIs(t, err, archive.ErrUnsafePath)
+	_, err = os.Stat(filepath.Join(filepath.Dir(destinationPath), "evil.txt"))
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestExtractSizeLimit(t *testing.T) {
+	archivePath := writeZip(t, testFiles)
+
+	destinationPath := t.TempDir()
+	err := archive.Extract(archivePath, destinationPath, archive.Options{MaxSize: 5})
+	assert.ErrorIs(t, err, archive.ErrSizeLimit)
+	// The files extracted before the limit are removed
+	assertFiles(t, destinationPath, map[string]string{})
+	assert.Nil(t, archive.Extract(archivePath, t.TempDir(), archive.Options{MaxSize: 9}))
+}
+
+func TestExtractUnsupportedFormat(t *testing.T) {
+	archivePath := filepath.Join(t.TempDir(), "test.arj")
+	assert.Nil(t, os.WriteFile(archivePath, []byte("not an archive"), 0644))
+
+	assert.False(t, archive.IsArchive(archivePath))
+	err := archive.Extract(archivePath, t.TempDir(), archive.Options{FallbackPath: filepath.Join(t.TempDir(), "7z")})
+	assert.ErrorIs(t, err, archive.ErrUnsupportedFormat)
+}
+
+func TestExtractFallbackSizeLimit(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the fake 7z executable is a shell script")
+	}
+	// The fake executable writes a 4 bytes file in the -o destination
+	executablePath := filepath.Join(t.TempDir(), "7z")
+	script := "#!/bin/sh\nfor argument; do case $argument in -o*) printf rom1 > \"${argument#-o}/game.sfc\";; esac; done\n"
+	assert.Nil(t, os.WriteFile(executablePath, []byte(script), 0755))
+	archivePath := filepath.Join(t.TempDir(), "test.arj")
+	assert.Nil(t, os.WriteFile(archivePath, []byte("not an archive"), 0644))
+	destinationPath := t.TempDir()
+	assert.Nil(t, os.WriteFile(filepath.Join(destinationPath, "existing.bin"), make([]byte, 64), 0644))
+
+	assert.Nil(t, archive.Extract(archivePath, destinationPath, archive.Options{FallbackPath: executablePath, MaxSize: 4}))
+	// The files written by the executable are removed, the other ones are kept
+	destinationPath = t.TempDir()
+	assert.Nil(t, os.WriteFile(filepath.Join(destinationPath, "existing.bin"), []byte("kept"), 0644))
+	err := archive.Extract(archivePath, destinationPath, archive.Options{FallbackPath: executablePath, MaxSize: 3})
+	assert.ErrorIs(t, err, archive.ErrSizeLimit)
+	assertFiles(t, destinationPath, map[string]string{"existing.bin": "kept"})
+}
@@ -0,0 +1,102 @@
+package archive
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"arkhive.dev/launcher/internal/osconstants"
+)
+
+/*
+Extract the archive with the 7z executable.
+
+The executable rejects the entries escaping the destination folder, the size limit is
+checked once the archive is extracted on the files it wrote, so an archive exceeding it,
+like a zip bomb, is fully written to disk before being rejected.
+*/
+func extractFallback(archivePath string, destinationPath string, options Options) (err error) {
+	executablePath := options.FallbackPath
+	if executablePath == "" {
+		executablePath = osconstants.SEVENZ_EXE_PATH
+	}
+	if _, err = os.Stat(executablePath); err != nil {
+		return fmt.Errorf("%s: %w", filepath.Base(archivePath), ErrUnsupportedFormat)
+	}
+	existingFiles, err := listFileInfos(destinationPath)
+	if err != nil {
+		return
+	}
+	arguments := []string{"x", "-y", archivePath, "-o" + destinationPath}
+	if entry := strings.Trim(options.Entry, "/"); entry != "" {
+		arguments = append(arguments, entry, entry+"/*", "-r-")
+	}
+	if output, err := exec.Command(executablePath, arguments...).CombinedOutput(); err != nil {
+		removeWrittenFiles(destinationPath, existingFiles)
+		return fmt.Errorf("%s: %w: %s", filepath.Base(archivePath), err, strings.TrimSpace(string(output)))
+	}
+	if options.Entry != "" {
+		if _, err = os.Stat(filepath.Join(destinationPath, filepath.FromSlash(strings.Trim(options.Entry, "/")))); err != nil {
+			return fmt.Errorf("%s: %w: %s", filepath.Base(archivePath), ErrEntryNotFound, options.Entry)
+		}
+	}
+	var writtenFiles map[string]os.FileInfo
+	if writtenFiles, err = listWrittenFiles(destinationPath, existingFiles); err != nil {
+		return
+	}
+	var extracted int64
+	for _, info := range writtenFiles {
+		extracted += info.Size()
+	}
+	if options.MaxSize > 0 && extracted > options.MaxSize {
+		removeWrittenFiles(destinationPath, existingFiles)
+		return ErrSizeLimit
+	}
+	if options.ProgressHandler != nil {
+		options.ProgressHandler(extracted, extracted)
+	}
+	return
+}
+
+// List the files written by the executable, the destination could hold other files
+func listWrittenFiles(folderPath string, existingFiles map[string]os.FileInfo) (writtenFiles map[string]os.FileInfo, err error) {
+	if writtenFiles, err = listFileInfos(folderPath); err != nil {
+		return
+	}
+	for filePath, info := range writtenFiles {
+		if existingInfo, ok := existingFiles[filePath]; ok && existingInfo.Size() == info.Size() && existingInfo.ModTime().Equal(info.ModTime()) {
+			delete(writtenFiles, filePath)
+		}
+	}
+	return
+}
+
+// Remove the files written by a failed extraction
+func removeWrittenFiles(folderPath string, existingFiles map[string]os.FileInfo) {
+	writtenFiles, _ := listWrittenFiles(folderPath, existingFiles)
+	for filePath := range writtenFiles {
+		os.Remove(filePath)
+	}
+}
+
+// List the files of the folder with their info, an empty list if the folder is missing
+func listFileInfos(folderPath string) (fileInfos map[string]os.FileInfo, err error) {
+	fileInfos = map[string]os.FileInfo{}
+	err = filepath.WalkDir(folderPath, func(filePath string, entry os.DirEntry, err error) error {
+		if os.IsNotExist(err) && filePath == folderPath {
+			return filepath.SkipAll
+		}
+		if err != nil || entry.IsDir() {
+			return err
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		fileInfos[filePath] = info
+		return nil
+	})
+	return
+}
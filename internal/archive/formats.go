@@ -0,0 +1,185 @@
+package archive
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/bzip2"
+	"compress/gzip"
+	"errors"
+	"io"
+	"os"
+
+	"github.com/bodgit/sevenzip"
+	"github.com/nwaples/rardecode"
+	"github.com/ulikunitz/xz"
+)
+
+type zipWalker struct {
+	*zip.ReadCloser
+}
+
+func openZip(archivePath string) (walker, error) {
+	reader, err := zip.OpenReader(archivePath)
+	if err != nil {
+		return nil, err
+	}
+	return zipWalker{reader}, nil
+}
+
+func (reader zipWalker) total() (total int64) {
+	for _, file := range reader.File {
+		total += int64(file.UncompressedSize64)
+	}
+	return
+}
+
+func (reader zipWalker) walk(visitor func(entry *entry) error) error {
+	for _, file := range reader.File {
+		if err := visitor(&entry{
+			name:  file.Name,
+			isDir: file.FileInfo().IsDir(),
+			mode:  file.Mode(),
+			size:  int64(file.UncompressedSize64),
+			open:  file.Open,
+		}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type sevenZipWalker struct {
+	*sevenzip.ReadCloser
+}
+
+func openSevenZip(archivePath string) (walker, error) {
+	reader, err := sevenzip.OpenReader(archivePath)
+	if err != nil {
+		return nil, err
+	}
+	return sevenZipWalker{reader}, nil
+}
+
+func (reader sevenZipWalker) total() (total int64) {
+	for _, file := range reader.File {
+		total += int64(file.UncompressedSize)
+	}
+	return
+}
+
+func (reader sevenZipWalker) walk(visitor func(entry *entry) error) error {
+	// Files are visited in order, reading every solid block once
+	for _, file := range reader.File {
+		if err := visitor(&entry{
+			name:  file.Name,
+			isDir: file.FileInfo().IsDir(),
+			mode:  file.Mode(),
+			size:  int64(file.UncompressedSize),
+			open:  file.Open,
+		}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type rarWalker struct {
+	*rardecode.ReadCloser
+}
+
+func openRar(archivePath string) (walker, error) {
+	reader, err := rardecode.OpenReader(archivePath, "")
+	if err != nil {
+		return nil, err
+	}
+	return rarWalker{reader}, nil
+}
+
+// The rar headers are read while extracting
+func (reader rarWalker) total() int64 {
+	return 0
+}
+
+func (reader rarWalker) walk(visitor func(entry *entry) error) error {
+	for {
+		header, err := reader.Next()
+		if errors.Is(err, io.EOF) {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		if err = visitor(&entry{
+			name:  header.Name,
+			isDir: header.IsDir,
+			mode:  header.Mode(),
+			size:  header.UnPackedSize,
+			open:  func() (io.ReadCloser, error) { return io.NopCloser(reader), nil },
+		}); err != nil {
+			return err
+		}
+	}
+}
+
+type tarCompression int
+
+const (
+	noCompression tarCompression = iota
+	gzipCompression
+	bzip2Compression
+	xzCompression
+)
+
+type tarWalker struct {
+	file   *os.File
+	reader *tar.Reader
+}
+
+func openTar(archivePath string, compression tarCompression) (walker, error) {
+	file, err := os.Open(archivePath)
+	if err != nil {
+		return nil, err
+	}
+	var reader io.Reader = file
+	switch compression {
+	case gzipCompression:
+		reader, err = gzip.NewReader(file)
+	case bzip2Compression:
+		reader = bzip2.NewReader(file)
+	case xzCompression:
+		reader, err = xz.NewReader(file)
+	}
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	return &tarWalker{file, tar.NewReader(reader)}, nil
+}
+
+// The tar headers are read while extracting
+func (reader *tarWalker) total() int64 {
+	return 0
+}
+
+func (reader *tarWalker) walk(visitor func(entry *entry) error) error {
+	for {
+		header, err := reader.reader.Next()
+		if errors.Is(err, io.EOF) {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		if err = visitor(&entry{
+			name:  header.Name,
+			isDir: header.Typeflag == tar.TypeDir,
+			mode:  header.FileInfo().Mode(),
+			size:  header.Size,
+			open:  func() (io.ReadCloser, error) { return io.NopCloser(reader.reader), nil },
+		}); err != nil {
+			return err
+		}
+	}
+}
+
+func (reader *tarWalker) Close() error {
+	return reader.file.Close()
+}
@@ -2,3 +2,9 @@ package buildbot
 
 const BUILDBOT_URL_SCHEME = "http"
 const BUILDBOT_URL_HOST = "buildbot.libretro.com"
+
+// Default base URL of the buildbot, replaceable with a mirror
+const DEFAULT_URL = BUILDBOT_URL_SCHEME + "://" + BUILDBOT_URL_HOST
+
+// Name of the cached buildbot index, inside the system folder
+const INDEX_CACHE_FILE = "buildbot.json"
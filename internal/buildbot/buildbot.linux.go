@@ -1,5 +0,0 @@
-// +build linux
-
-package buildbot
-
-const BUILDBOT_UPDATE_URL_PATH = "/nightly/linux/x86_64/latest/"
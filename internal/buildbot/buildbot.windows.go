@@ -1,5 +0,0 @@
-// +build windows
-
-package buildbot
-
-const BUILDBOT_UPDATE_URL_PATH = "/nightly/windows/x86_64/latest/"
@@ -0,0 +1,223 @@
+package buildbot
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Maximum size of the buildbot index response
+const INDEX_SIZE_LIMIT = 16 * 1024 * 1024
+
+var ErrUnexpectedFormat = errors.New("unexpected buildbot index format")
+var ErrIndexUnavailable = errors.New("buildbot index not available")
+
+// A file or folder of a buildbot folder listing
+type Item struct {
+	// Absolute path of the item on the buildbot, ending with a slash for the folders
+	Href string `json:"href"`
+	// Modification time in milliseconds since the epoch
+	Time int64 `json:"time"`
+	// Size in bytes, nil for the folders
+	Size *int64 `json:"size"`
+}
+
+// The modification time of the item
+func (item *Item) GetModTime() time.Time {
+	return time.UnixMilli(item.Time).UTC()
+}
+
+// Whether the item is a folder
+func (item *Item) IsFolder() bool {
+	return strings.HasSuffix(item.Href, "/")
+}
+
+// The listing of a buildbot folder
+type Index struct {
+	Path  string `json:"path"`
+	Items []Item `json:"items"`
+	// Time the index was downloaded
+	FetchedAt time.Time `json:"fetched_at"`
+	// Whether the index is read from the cache as the buildbot wasn't reachable
+	Cached bool `json:"-"`
+}
+
+// Find the file of the index with the name
+func (index *Index) Find(name string) (item Item, ok bool) {
+	for _, item = range index.Items {
+		if !item.IsFolder() && path.Base(item.Href) == name {
+			return item, true
+		}
+	}
+	return Item{}, false
+}
+
+// Folder listing request of the h5ai file indexer run by the buildbot
+type indexRequest struct {
+	Action string           `json:"action"`
+	Items  indexRequestPath `json:"items"`
+}
+
+type indexRequestPath struct {
+	Href string `json:"href"`
+	What int    `json:"what"`
+}
+
+/*
+Client of the libretro buildbot, listing the folder of the nightly builds.
+
+The last downloaded index of every folder is cached to the cache path and returned
+when the buildbot is unreachable or its response can't be parsed, so the cores stay
+available offline.
+*/
+type Client struct {
+	BaseURL    url.URL
+	HTTPClient *http.Client
+	// Index cache file, not cached if empty
+	CachePath string
+}
+
+// Create the client of the buildbot at the base URL
+func NewClient(baseURL string, httpClient *http.Client, cachePath string) (client *Client, err error) {
+	var parsedURL *url.URL
+	if parsedURL, err = url.Parse(baseURL); err != nil {
+		return
+	}
+	if parsedURL.Scheme == "" || parsedURL.Host == "" {
+		return nil, fmt.Errorf("invalid buildbot URL %q", baseURL)
+	}
+	parsedURL.Path = strings.TrimSuffix(parsedURL.Path, "/")
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	return &Client{BaseURL: *parsedURL, HTTPClient: httpClient, CachePath: cachePath}, nil
+}
+
+// The URL of the item file
+func (client *Client) GetURL(item *Item) url.URL {
+	itemURL := client.BaseURL
+	itemURL.Path = client.BaseURL.Path + item.Href
+	return itemURL
+}
+
+/*
+Get the listing of the buildbot folder, caching it.
+
+The cached index of the same folder is returned when the request fails, failing with
+ErrIndexUnavailable if there is none.
+*/
+func (client *Client) GetIndex(folderPath string) (index Index, err error) {
+	if index, err = client.fetchIndex(folderPath); err == nil {
+		if cacheErr := client.writeCache(&index); cacheErr != nil {
+			logrus.Errorf("%+v", cacheErr)
+		}
+		return
+	}
+	logrus.Warnf("Buildbot index request failed, reading the cached index: %+v", err)
+	requestErr := err
+	var cache map[string]Index
+	cache, err = client.readCache()
+	cachedIndex, ok := cache[folderPath]
+	if err != nil || !ok {
+		return index, fmt.Errorf("%w: %s: %w", ErrIndexUnavailable, folderPath, requestErr)
+	}
+	cachedIndex.Cached = true
+	return cachedIndex, nil
+}
+
+func (client *Client) fetchIndex(folderPath string) (index Index, err error) {
+	var requestBody []byte
+	if requestBody, err = json.Marshal(indexRequest{Action: "get", Items: indexRequestPath{Href: folderPath, What: 1}}); err != nil {
+		return
+	}
+	requestURL := client.BaseURL
+	requestURL.Path = client.BaseURL.Path + folderPath
+	var response *http.Response
+	if response, err = client.HTTPClient.Post(requestURL.String(), "application/json", bytes.NewReader(requestBody)); err != nil {
+		return
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return index, fmt.Errorf("buildbot index request failed with status %s", response.Status)
+	}
+	var data []byte
+	if data, err = io.ReadAll(io.LimitReader(response.Body, INDEX_SIZE_LIMIT)); err != nil {
+		return
+	}
+	if index, err = parseIndex(data, folderPath); err != nil {
+		return
+	}
+	index.FetchedAt = time.Now().UTC()
+	return
+}
+
+// Parse the h5ai listing, keeping the items inside the folder
+func parseIndex(data []byte, folderPath string) (index Index, err error) {
+	var response struct {
+		Items *[]Item `json:"items"`
+	}
+	if err = json.Unmarshal(data, &response); err != nil {
+		return index, fmt.Errorf("%w: %v", ErrUnexpectedFormat, err)
+	}
+	if response.Items == nil {
+		return index, fmt.Errorf("%w: no items", ErrUnexpectedFormat)
+	}
+	index.Path = folderPath
+	for _, item := range *response.Items {
+		if item.Href == "" {
+			return index, fmt.Errorf("%w: item without href", ErrUnexpectedFormat)
+		}
+		if strings.HasPrefix(item.Href, folderPath) && item.Href != folderPath {
+			index.Items = append(index.Items, item)
+		}
+	}
+	return
+}
+
+// Read the cached indexes by folder path
+func (client *Client) readCache() (cache map[string]Index, err error) {
+	if client.CachePath == "" {
+		return nil, os.ErrNotExist
+	}
+	var data []byte
+	if data, err = os.ReadFile(client.CachePath); err != nil {
+		return
+	}
+	err = json.Unmarshal(data, &cache)
+	return
+}
+
+// Replace the cached index of the folder, keeping the other folders ones
+func (client *Client) writeCache(index *Index) (err error) {
+	if client.CachePath == "" {
+		return
+	}
+	cache, readErr := client.readCache()
+	if readErr != nil {
+		cache = map[string]Index{}
+	}
+	cache[index.Path] = *index
+	var data []byte
+	if data, err = json.Marshal(cache); err != nil {
+		return
+	}
+	if err = os.MkdirAll(filepath.Dir(client.CachePath), 0755); err != nil {
+		return
+	}
+	temporaryPath := client.CachePath + ".part"
+	if err = os.WriteFile(temporaryPath, data, 0644); err != nil {
+		return
+	}
+	return os.Rename(temporaryPath, client.CachePath)
+}
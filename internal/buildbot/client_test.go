@@ -0,0 +1,96 @@
+package buildbot_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"arkhive.dev/launcher/internal/buildbot"
+	"github.com/stretchr/testify/assert"
+)
+
+const testIndexPath = "/nightly/linux/x86_64/latest/"
+
+const testIndex = `{"items": [
+	{"href": "/nightly/linux/x86_64/", "time": 1700000000000, "size": null, "managed": true},
+	{"href": "/nightly/linux/x86_64/latest/", "time": 1700000000000, "size": null, "managed": true},
+	{"href": "/nightly/linux/x86_64/latest/snes9x_libretro.so.zip", "time": 1700000000000, "size": 1024},
+	{"href": "/nightly/linux/x86_64/latest/mgba_libretro.so.zip", "time": 1700000001000, "size": 2048}
+]}`
+
+// Buildbot stand-in answering the index requests with the response
+func newTestBuildbot(t *testing.T, response *string) *httptest.Server {
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		var body map[string]interface{}
+		assert.Nil(t, json.NewDecoder(request.Body).Decode(&body))
+		assert.Equal(t, http.MethodPost, request.Method)
+		assert.Equal(t, testIndexPath, request.URL.Path)
+		assert.Equal(t, "get", body["action"])
+		assert.Equal(t, testIndexPath, body["items"].(map[string]interface{})["href"])
+		writer.Write([]byte(*response))
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestGetIndex(t *testing.T) {
+	response := testIndex
+	server := newTestBuildbot(t, &response)
+	client, err := buildbot.NewClient(server.URL+"/", nil, filepath.Join(t.TempDir(), buildbot.INDEX_CACHE_FILE))
+	assert.Nil(t, err)
+
+	index, err := client.GetIndex(testIndexPath)
+	assert.Nil(t, err)
+	assert.False(t, index.Cached)
+	assert.Len(t, index.Items, 2)
+	item, ok := index.Find("snes9x_libretro.so.zip")
+	assert.True(t, ok)
+	assert.Equal(t, int64(1024), *item.Size)
+	assert.Equal(t, int64(1700000000), item.GetModTime().Unix())
+	itemURL := client.GetURL(&item)
+	assert.Equal(t, server.URL+"/nightly/linux/x86_64/latest/snes9x_libretro.so.zip", itemURL.String())
+	_, ok = index.Find("latest")
+	assert.False(t, ok)
+}
+
+func TestGetIndexOffline(t *testing.T) {
+	response := testIndex
+	server := newTestBuildbot(t, &response)
+	cachePath := filepath.Join(t.TempDir(), buildbot.INDEX_CACHE_FILE)
+	client, err := buildbot.NewClient(server.URL, nil, cachePath)
+	assert.Nil(t, err)
+	_, err = client.GetIndex(testIndexPath)
+	assert.Nil(t, err)
+
+	// The changed format and the unreachable buildbot fall back to the cache
+	response = `{"files": ["snes9x_libretro.so.zip"]}`
+	index, err := client.GetIndex(testIndexPath)
+	assert.Nil(t, err)
+	assert.True(t, index.Cached)
+	assert.Len(t, index.Items, 2)
+	server.Close()
+	index, err = client.GetIndex(testIndexPath)
+	assert.Nil(t, err)
+	assert.True(t, index.Cached)
+
+	_, err = client.GetIndex("/nightly/linux/armv7-neon-hf/latest/")
+	assert.ErrorIs(t, err, buildbot.ErrIndexUnavailable)
+}
+
+func TestGetIndexUnexpectedFormat(t *testing.T) {
+	for _, response := range []string{`<html></html>`, `{"files": []}`, `{"items": [{"time": 1}]}`, `{"items": [{"href": "/a", "time": "yesterday"}]}`} {
+		server := newTestBuildbot(t, &response)
+		client, err := buildbot.NewClient(server.URL, nil, "")
+		assert.Nil(t, err)
+		_, err = client.GetIndex(testIndexPath)
+		assert.ErrorIs(t, err, buildbot.ErrIndexUnavailable, response)
+		assert.ErrorIs(t, err, buildbot.ErrUnexpectedFormat, response)
+	}
+}
+
+func TestNewClientInvalidURL(t *testing.T) {
+	_, err := buildbot.NewClient("buildbot.libretro.com", nil, "")
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,81 @@
+package buildbot
+
+import (
+	"errors"
+	"fmt"
+	"runtime"
+	"strings"
+)
+
+var ErrUnsupportedPlatform = errors.New("platform not supported by the buildbot")
+
+// Extension of the core files by operating system
+var coreExtensions = map[string]string{
+	"linux":   "so",
+	"freebsd": "so",
+	"windows": "dll",
+	"darwin":  "dylib",
+}
+
+// Buildbot folder of the builds by operating system and architecture
+var platformPaths = map[string]string{
+	"linux/amd64":   "linux/x86_64",
+	"linux/386":     "linux/x86",
+	"linux/arm64":   "linux/aarch64",
+	"linux/arm":     "linux/armv7-neon-hf",
+	"windows/amd64": "windows/x86_64",
+	"windows/386":   "windows/x86",
+	"darwin/amd64":  "apple/osx/x86_64",
+	"darwin/arm64":  "apple/osx/arm64",
+}
+
+// A buildbot target, the builds folder and the core files extension
+type Platform struct {
+	// Folder of the platform builds, like linux/x86_64
+	Path          string
+	CoreExtension string
+}
+
+// The platform of the operating system and architecture, as named by GOOS and GOARCH
+func GetPlatform(goos string, goarch string) (platform Platform, err error) {
+	var ok bool
+	if platform.Path, ok = platformPaths[goos+"/"+goarch]; !ok {
+		return platform, fmt.Errorf("%w: %s/%s", ErrUnsupportedPlatform, goos, goarch)
+	}
+	platform.CoreExtension = coreExtensions[goos]
+	return
+}
+
+/*
+The platform arkHive runs on.
+
+The override is a buildbot folder, like linux/armhf, replacing the detected one for the
+targets sharing the architecture name, as the ARMv6 boards.
+*/
+func DetectPlatform(override string) (platform Platform, err error) {
+	override = strings.Trim(override, "/")
+	if override == "" {
+		return GetPlatform(runtime.GOOS, runtime.GOARCH)
+	}
+	var ok bool
+	if platform.CoreExtension, ok = coreExtensions[runtime.GOOS]; !ok {
+		return platform, fmt.Errorf("%w: %s", ErrUnsupportedPlatform, runtime.GOOS)
+	}
+	platform.Path = override
+	return
+}
+
+// The extension of the core files of the running operating system
+func GetCoreExtension() string {
+	return coreExtensions[runtime.GOOS]
+}
+
+// The buildbot folder of the platform nightly cores
+func (platform *Platform) GetNightlyCoresPath() string {
+	return "/nightly/" + platform.Path + "/latest/"
+}
+
+// The buildbot folder of the platform cores of the RetroArch stable version
+func (platform *Platform) GetStableCoresPath(version string) string {
+	return "/stable/" + version + "/" + platform.Path + "/latest/"
+}
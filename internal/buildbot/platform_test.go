@@ -0,0 +1,42 @@
+package buildbot_test
+
+import (
+	"runtime"
+	"testing"
+
+	"arkhive.dev/launcher/internal/buildbot"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetPlatform(t *testing.T) {
+	platform, err := buildbot.GetPlatform("linux", "arm64")
+	assert.Nil(t, err)
+	assert.Equal(t, buildbot.Platform{Path: "linux/aarch64", CoreExtension: "so"}, platform)
+	assert.Equal(t, "/nightly/linux/aarch64/latest/", platform.GetNightlyCoresPath())
+	assert.Equal(t, "/stable/1.19.1/linux/aarch64/latest/", platform.GetStableCoresPath("1.19.1"))
+
+	platform, err = buildbot.GetPlatform("linux", "arm")
+	assert.Nil(t, err)
+	assert.Equal(t, "linux/armv7-neon-hf", platform.Path)
+	platform, err = buildbot.GetPlatform("windows", "amd64")
+	assert.Nil(t, err)
+	assert.Equal(t, buildbot.Platform{Path: "windows/x86_64", CoreExtension: "dll"}, platform)
+	platform, err = buildbot.GetPlatform("darwin", "arm64")
+	assert.Nil(t, err)
+	assert.Equal(t, buildbot.Platform{Path: "apple/osx/arm64", CoreExtension: "dylib"}, platform)
+
+	_, err = buildbot.GetPlatform("linux", "riscv64")
+	assert.ErrorIs(t, err, buildbot.ErrUnsupportedPlatform)
+}
+
+func TestDetectPlatform(t *testing.T) {
+	platform, err := buildbot.DetectPlatform("/linux/armhf/")
+	assert.Nil(t, err)
+	assert.Equal(t, "linux/armhf", platform.Path)
+	assert.Equal(t, buildbot.GetCoreExtension(), platform.CoreExtension)
+
+	detectedPlatform, err := buildbot.DetectPlatform("")
+	expectedPlatform, expectedErr := buildbot.GetPlatform(runtime.GOOS, runtime.GOARCH)
+	assert.Equal(t, expectedErr, err)
+	assert.Equal(t, expectedPlatform, detectedPlatform)
+}
@@ -5,22 +5,90 @@ in YAML format.
 package configloader
 
 import (
+	"fmt"
 	"path/filepath"
+	"time"
 
+	"arkhive.dev/launcher/internal/buildbot"
+	"arkhive.dev/launcher/internal/osconstants"
+	"arkhive.dev/launcher/internal/undertow"
 	"github.com/sirupsen/logrus"
 	"github.com/spf13/viper"
 )
 
+// Handling of the games whose console misses a required BIOS
+const (
+	// Refuse to launch the game
+	MISSING_BIOS_REFUSE = "refuse"
+	// Launch the game, logging the missing BIOS
+	MISSING_BIOS_WARN = "warn"
+)
+
 // Structure to bind application parameters
 type Config struct {
 	LogLevel string `mapstructure:"LOG_LEVEL"` // logrus library log level to be assigned
 	BasePath string `mapstructure:"BASE_PATH"` // application base path
+
+	TorrentSeedRatio       float64  `mapstructure:"TORRENT_SEED_RATIO"`       // uploaded/downloaded ratio to reach before stopping seeding
+	BandwidthLimit         int64    `mapstructure:"BANDWIDTH_LIMIT"`          // global download bandwidth in KiB/s, 0 for unlimited
+	ResourceBandwidthLimit int64    `mapstructure:"RESOURCE_BANDWIDTH_LIMIT"` // per-resource download bandwidth in KiB/s, 0 for unlimited
+	LowPriorityWindows     []string `mapstructure:"LOW_PRIORITY_WINDOWS"`     // "HH:MM-HH:MM" daily windows allowing background downloads, always allowed if empty
+
+	HTTPTimeout      time.Duration `mapstructure:"HTTP_TIMEOUT"`       // HTTP connection and response headers timeout
+	HTTPProxyURL     string        `mapstructure:"HTTP_PROXY_URL"`     // HTTP proxy URL, environment proxy settings are used if empty
+	HTTPRootCAs      []string      `mapstructure:"HTTP_ROOT_CAS"`      // PEM files of additional trusted root certificate authorities
+	HTTPUserAgent    string        `mapstructure:"HTTP_USER_AGENT"`    // HTTP user agent, arkHive and its build version if empty
+	HTTPMaxRedirects int           `mapstructure:"HTTP_MAX_REDIRECTS"` // maximum number of followed HTTP redirects
+
+	RegistrationURL string `mapstructure:"REGISTRATION_URL"` // account certificate signing endpoint
+
+	UndertowURL string `mapstructure:"UNDERTOW_URL"` // URL of the undertow bundle describing the network
+	StorjAccess string `mapstructure:"STORJ_ACCESS"` // serialized Storj access grant of the sj:// resources
+
+	FriendListenAddress string `mapstructure:"FRIEND_LISTEN_ADDRESS"` // address accepting the friends network connections
+
+	LANDiscoveryAddress string `mapstructure:"LAN_DISCOVERY_ADDRESS"` // UDP address receiving the LAN peers announcements
+	LANBroadcastAddress string `mapstructure:"LAN_BROADCAST_ADDRESS"` // UDP address the LAN announcements are sent to
+	LANShareAddress     string `mapstructure:"LAN_SHARE_ADDRESS"`     // address serving the game packages to the LAN peers
+
+	RetroArchPath     string `mapstructure:"RETROARCH_PATH"`      // RetroArch executable running the games
+	MissingBiosPolicy string `mapstructure:"MISSING_BIOS_POLICY"` // "refuse" or "warn" launching a game whose console misses a required BIOS
+	BuildbotURL       string `mapstructure:"BUILDBOT_URL"`        // base URL of the libretro buildbot or of a mirror
+	BuildbotPlatform  string `mapstructure:"BUILDBOT_PLATFORM"`   // buildbot folder of the cores, like linux/armhf, detected if empty
+
+	PreparationConcurrency int `mapstructure:"PREPARATION_CONCURRENCY"` // cores, plugins and tools prepared at the same time
+	PreparationRetries     int `mapstructure:"PREPARATION_RETRIES"`     // retries of a failed core, plugin or tool preparation
+
+	ExtractionSizeLimit int64 `mapstructure:"EXTRACTION_SIZE_LIMIT"` // maximum extracted size of a game package, core, plugin or tool archive in MiB, 0 for unlimited
 }
 
 // Initialize default parameters values
 func initDefaultConfiguration() {
 	viper.SetDefault("LOG_LEVEL", "debug")
 	viper.SetDefault("BASE_PATH", ".")
+	viper.SetDefault("TORRENT_SEED_RATIO", 1.0)
+	viper.SetDefault("BANDWIDTH_LIMIT", 0)
+	viper.SetDefault("RESOURCE_BANDWIDTH_LIMIT", 0)
+	viper.SetDefault("LOW_PRIORITY_WINDOWS", []string{})
+	viper.SetDefault("HTTP_TIMEOUT", 30*time.Second)
+	viper.SetDefault("HTTP_PROXY_URL", "")
+	viper.SetDefault("HTTP_ROOT_CAS", []string{})
+	viper.SetDefault("HTTP_USER_AGENT", "")
+	viper.SetDefault("HTTP_MAX_REDIRECTS", 10)
+	viper.SetDefault("REGISTRATION_URL", "")
+	viper.SetDefault("UNDERTOW_URL", undertow.DEFAULT_SCHEME+"://"+undertow.DEFAULT_HOST+"/"+undertow.DEFAULT_PATH)
+	viper.SetDefault("STORJ_ACCESS", undertow.DEFAULT_ACCESS)
+	viper.SetDefault("FRIEND_LISTEN_ADDRESS", ":6464")
+	viper.SetDefault("LAN_DISCOVERY_ADDRESS", ":6465")
+	viper.SetDefault("LAN_BROADCAST_ADDRESS", "255.255.255.255:6465")
+	viper.SetDefault("LAN_SHARE_ADDRESS", ":6466")
+	viper.SetDefault("RETROARCH_PATH", osconstants.RETROARCH_EXE_PATH)
+	viper.SetDefault("MISSING_BIOS_POLICY", MISSING_BIOS_REFUSE)
+	viper.SetDefault("BUILDBOT_URL", buildbot.DEFAULT_URL)
+	viper.SetDefault("BUILDBOT_PLATFORM", "")
+	viper.SetDefault("PREPARATION_CONCURRENCY", 2)
+	viper.SetDefault("PREPARATION_RETRIES", 2)
+	viper.SetDefault("EXTRACTION_SIZE_LIMIT", 64*1024)
 }
 
 // Load configuration from env file
@@ -53,7 +121,15 @@ func LoadConfiguration(applicationName string, configurationFilePath string) (co
 	if configError := viper.ReadInConfig(); configError != nil {
 		logrus.Warn(configError.Error())
 	}
-	err = viper.Unmarshal(&config)
+	if err = viper.Unmarshal(&config); err != nil {
+		return
+	}
+	if config.MissingBiosPolicy != MISSING_BIOS_REFUSE && config.MissingBiosPolicy != MISSING_BIOS_WARN {
+		return config, fmt.Errorf("invalid MISSING_BIOS_POLICY %q, expected %q or %q", config.MissingBiosPolicy, MISSING_BIOS_REFUSE, MISSING_BIOS_WARN)
+	}
+	if viper.GetString("ACCOUNT_PASSPHRASE") != "" {
+		logrus.Warn("ACCOUNT_PASSPHRASE is ignored, the passphrase is read from the OS keyring")
+	}
 
 	return
 }
@@ -30,3 +30,35 @@ func TestLoadEnvironmentVariablesConfiguration(t *testing.T) {
 		t.Errorf("Default log level is \"%s\", not \"%s\"", configuration.LogLevel, "LOG_LEVEL")
 	}
 }
+
+// Test bandwidth configuration loading from environment variables
+func TestLoadBandwidthConfiguration(t *testing.T) {
+	os.Setenv("BANDWIDTH_LIMIT", "512")
+	os.Setenv("LOW_PRIORITY_WINDOWS", "01:00-07:00,22:00-23:30")
+	defer os.Unsetenv("BANDWIDTH_LIMIT")
+	defer os.Unsetenv("LOW_PRIORITY_WINDOWS")
+
+	configuration, err := configloader.LoadConfiguration("unexistent", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if configuration.BandwidthLimit != 512 {
+		t.Errorf("Bandwidth limit is %d, not %d", configuration.BandwidthLimit, 512)
+	}
+	if configuration.ResourceBandwidthLimit != 0 {
+		t.Errorf("Default resource bandwidth limit is %d, not %d", configuration.ResourceBandwidthLimit, 0)
+	}
+	if len(configuration.LowPriorityWindows) != 2 || configuration.LowPriorityWindows[1] != "22:00-23:30" {
+		t.Errorf("Low priority windows are %v", configuration.LowPriorityWindows)
+	}
+}
+
+// Test the rejection of an unknown missing BIOS policy
+func TestLoadInvalidMissingBiosPolicy(t *testing.T) {
+	os.Setenv("MISSING_BIOS_POLICY", "ignore")
+	defer os.Unsetenv("MISSING_BIOS_POLICY")
+
+	if _, err := configloader.LoadConfiguration("unexistent", ""); err == nil {
+		t.Error("Invalid missing BIOS policy accepted")
+	}
+}
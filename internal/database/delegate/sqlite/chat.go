@@ -8,3 +8,15 @@ type Chat struct {
 	Message   string    `gorm:"not null"`
 	Received  bool      `gorm:"not null"`
 }
+
+func (d *SQLite) StoreChat(chat *Chat) error {
+	return d.create(chat)
+}
+
+// Get the messages exchanged with the user, from the oldest
+func (d *SQLite) GetChatsByUser(user *User) (entity []Chat, err error) {
+	if result := d.database.Where("user_id = ?", user.Id).Order("timestamp").Find(&entity); result.Error != nil {
+		err = result.Error
+	}
+	return
+}
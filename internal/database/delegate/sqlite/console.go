@@ -13,6 +13,8 @@ type Console struct {
 	SingleFile           bool   `gorm:"not null"`
 	LanguageVariableName sql.NullString
 	IsEmbedded           bool `gorm:"not null"`
+	// RetroArch stable version the core is pinned to, the nightly core if not valid
+	CoreVersion sql.NullString
 }
 
 func (d *SQLite) storeImportedConsole(importedEntity importer.Console) (err error) {
@@ -21,6 +23,11 @@ func (d *SQLite) storeImportedConsole(importedEntity importer.Console) (err erro
 		languageVariableName.Valid = true
 		languageVariableName.String = *importedEntity.LanguageVariableName
 	}
+	coreVersion := sql.NullString{}
+	if importedEntity.CoreVersion != nil {
+		coreVersion.Valid = true
+		coreVersion.String = *importedEntity.CoreVersion
+	}
 	entity := Console{
 		importedEntity.Slug,
 		importedEntity.CoreLocation,
@@ -28,6 +35,7 @@ func (d *SQLite) storeImportedConsole(importedEntity importer.Console) (err erro
 		importedEntity.SingleFile,
 		languageVariableName,
 		importedEntity.IsEmbedded,
+		coreVersion,
 	}
 
 	if err = d.create(&entity); err != nil {
@@ -69,7 +77,11 @@ func (d *SQLite) GetConsoles() (entity []Console, err error) {
 	return
 }
 
-func (d *SQLite) GetConsoleByConsolePlugin(consolePlugin *ConsolePlugin) (model Console, err error) {
-	err = d.database.Model(consolePlugin).Association("Console").Find(&model)
+func (d *SQLite) GetConsoleByConsolePlugin(consolePlugin *ConsolePlugin) (Console, error) {
+	return d.GetConsole(consolePlugin.ConsoleID)
+}
+
+func (d *SQLite) GetConsole(slug string) (entity Console, err error) {
+	err = d.first(&entity, "slug = ?", slug)
 	return
 }
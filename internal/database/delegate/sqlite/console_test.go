@@ -41,6 +41,11 @@ func storeImportedConsoleTestProthotype(t *testing.T, flags ConsoleTestFlags) {
 				Destination:    &destination,
 				CollectionPath: &collectionPath,
 			}},
+			Hashes: []importer.ConsolePluginHash{{
+				Path:     "Path",
+				Sha256:   "Sha256",
+				Required: true,
+			}},
 		})
 	}
 	var fileTypes []importer.ConsoleFileType
@@ -124,6 +129,26 @@ func storeImportedConsoleTestProthotype(t *testing.T, flags ConsoleTestFlags) {
 		}
 	}
 
+	if flags.InsertPlugins {
+		consolePlugins, err := s.GetConsolePluginsByConsole(&sqlite.Console{Slug: "Slug"})
+		assert.Nil(t, err)
+		if assert.Len(t, consolePlugins, 1) {
+			consolePluginsFiles, err := s.GetConsolePluginsFilesByConsolePlugin(&consolePlugins[0])
+			assert.Nil(t, err)
+			assert.Len(t, consolePluginsFiles, 1)
+			consolePluginHashes, err := s.GetConsolePluginHashesByConsolePlugin(&consolePlugins[0])
+			assert.Nil(t, err)
+			if assert.Len(t, consolePluginHashes, 1) {
+				assert.Equal(t, "Path", consolePluginHashes[0].Path)
+				assert.Equal(t, "Sha256", consolePluginHashes[0].Sha256)
+				assert.True(t, consolePluginHashes[0].Required)
+			}
+			console, err := s.GetConsoleByConsolePlugin(&consolePlugins[0])
+			assert.Nil(t, err)
+			assert.Equal(t, "Slug", console.Slug)
+		}
+	}
+
 	if entities, err := s.GetConsoleFileTypes(); err != nil || (len(entities) == 0 && flags.InsertFileTypes) {
 		t.Log(err)
 		t.Fail()
@@ -31,3 +31,11 @@ func (d *SQLite) GetConsoleConfigs() (entity []ConsoleConfig, err error) {
 	}
 	return
 }
+
+func (d *SQLite) GetConsoleConfigsByConsole(console *Console) (entity []ConsoleConfig, err error) {
+	if result := d.database.Where("console_id = ?", console.Slug).Find(&entity); result.Error != nil {
+		err = result.Error
+		return
+	}
+	return
+}
@@ -2,6 +2,13 @@ package sqlite
 
 import "arkhive.dev/launcher/internal/database/importer"
 
+// Actions of the console file types
+const (
+	FILE_TYPE_RUNNABLE = "runnable"
+	FILE_TYPE_KEEP     = "keep"
+	FILE_TYPE_RENAME   = "rename"
+)
+
 type ConsoleFileType struct {
 	ConsoleID string `gorm:"not null"`
 	FileType  string `gorm:"not null"`
@@ -29,3 +36,11 @@ func (d *SQLite) GetConsoleFileTypes() (entity []ConsoleFileType, err error) {
 	}
 	return
 }
+
+func (d *SQLite) GetConsoleFileTypesByConsole(console *Console) (entity []ConsoleFileType, err error) {
+	if result := d.database.Where("console_id = ?", console.Slug).Find(&entity); result.Error != nil {
+		err = result.Error
+		return
+	}
+	return
+}
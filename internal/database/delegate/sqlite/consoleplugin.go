@@ -24,6 +24,12 @@ func (d *SQLite) storeImportedConsolePlugin(consoleId string, importedEntity imp
 		}
 	}
 
+	for _, hash := range importedEntity.Hashes {
+		if err = d.storeImportedConsolePluginHash(entity.Id, hash); err != nil {
+			return
+		}
+	}
+
 	return
 }
 
@@ -36,6 +42,8 @@ func (d *SQLite) GetConsolePlugins() (entity []ConsolePlugin, err error) {
 }
 
 func (d *SQLite) GetConsolePluginsByConsole(console *Console) (entity []ConsolePlugin, err error) {
-	err = d.database.Model(console).Association("ConsolePlugins").Find(&entity)
+	if result := d.database.Where("console_id = ?", console.Slug).Find(&entity); result.Error != nil {
+		err = result.Error
+	}
 	return
 }
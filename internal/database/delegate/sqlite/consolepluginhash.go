@@ -0,0 +1,28 @@
+package sqlite
+
+import "arkhive.dev/launcher/internal/database/importer"
+
+// The expected checksum of a console plugin file, like a BIOS
+type ConsolePluginHash struct {
+	ConsolePluginID uint   `gorm:"not null"`
+	Path            string `gorm:"not null"`
+	Sha256          string `gorm:"not null"`
+	Required        bool   `gorm:"not null"`
+}
+
+func (d *SQLite) storeImportedConsolePluginHash(consolePluginId uint, importedEntity importer.ConsolePluginHash) (err error) {
+	entity := ConsolePluginHash{
+		ConsolePluginID: consolePluginId,
+		Path:            importedEntity.Path,
+		Sha256:          importedEntity.Sha256,
+		Required:        importedEntity.Required,
+	}
+	return d.create(&entity)
+}
+
+func (d *SQLite) GetConsolePluginHashesByConsolePlugin(consolePlugin *ConsolePlugin) (entity []ConsolePluginHash, err error) {
+	if result := d.database.Where("console_plugin_id = ?", consolePlugin.Id).Find(&entity); result.Error != nil {
+		err = result.Error
+	}
+	return
+}
@@ -47,6 +47,8 @@ func (d *SQLite) GetConsolePluginsFiles() (entity []ConsolePluginsFile, err erro
 }
 
 func (d *SQLite) GetConsolePluginsFilesByConsolePlugin(consolePlugin *ConsolePlugin) (entity []ConsolePluginsFile, err error) {
-	err = d.database.Model(consolePlugin).Association("ConsolePluginsFiles").Find(&entity)
+	if result := d.database.Where("console_plugin_id = ?", consolePlugin.Id).Find(&entity); result.Error != nil {
+		err = result.Error
+	}
 	return
 }
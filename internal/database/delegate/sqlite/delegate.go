@@ -3,17 +3,21 @@ package sqlite
 import (
 	"database/sql"
 	"errors"
+	"fmt"
 	"os"
 	"path/filepath"
 
 	"arkhive.dev/launcher/internal/database/importer"
-	"gorm.io/driver/sqlite"
+	"github.com/glebarez/sqlite"
 	"gorm.io/gorm"
 	"gorm.io/gorm/clause"
 )
 
 const DatabasePath = "data.sqllite3"
 
+// Time a connection waits for the database lock held by the concurrent ones
+const BusyTimeoutMilliseconds = 5000
+
 type SQLite struct {
 	database *gorm.DB
 	BasePath string
@@ -24,7 +28,7 @@ func (s *SQLite) Open() (err error) {
 	if err = os.MkdirAll(filepath.Dir(databasePath), 0755); err != nil {
 		return
 	}
-	dialector := sqlite.Open(databasePath)
+	dialector := sqlite.Open(fmt.Sprintf("%s?_pragma=busy_timeout(%d)", databasePath, BusyTimeoutMilliseconds))
 	if s.database, err = gorm.Open(dialector, &gorm.Config{
 		DisableForeignKeyConstraintWhenMigrating: true,
 	}); err != nil {
@@ -40,9 +44,10 @@ func (d *SQLite) Migrate() (err error) {
 	return d.database.AutoMigrate(&User{},
 		&Chat{}, &Tool{}, &Console{}, &Game{},
 		&ToolFilesType{}, &ConsoleFileType{}, &ConsoleLanguage{},
-		&ConsolePlugin{}, &ConsolePluginsFile{},
+		&ConsolePlugin{}, &ConsolePluginsFile{}, &ConsolePluginHash{},
 		&ConsoleConfig{}, &GameDisk{}, &GameAdditionalFile{},
-		&GameConfig{}, &UserVariable{})
+		&GameConfig{}, &UserVariable{}, &InstalledGame{}, &InstalledGameFile{},
+		&InstalledCore{}, &InstalledTool{})
 }
 
 func (d *SQLite) Close() (err error) {
@@ -76,7 +81,7 @@ func (d *SQLite) createOrUpdate(value interface{}) error {
 }
 
 func (d *SQLite) first(dest interface{}, conds ...interface{}) error {
-	if result := d.database.First(dest, conds); result.Error != nil {
+	if result := d.database.First(dest, conds...); result.Error != nil {
 		return result.Error
 	}
 	return nil
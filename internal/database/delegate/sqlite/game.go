@@ -74,3 +74,8 @@ func (d *SQLite) GetGames() (entity []Game, err error) {
 	}
 	return
 }
+
+func (d *SQLite) GetGame(slug string) (entity Game, err error) {
+	err = d.first(&entity, "slug = ?", slug)
+	return
+}
@@ -29,3 +29,11 @@ func (d *SQLite) GetGameAdditionalFiles() (entity []GameAdditionalFile, err erro
 	}
 	return
 }
+
+func (d *SQLite) GetGameAdditionalFilesByGame(game *Game) (entity []GameAdditionalFile, err error) {
+	if result := d.database.Where("game_id = ?", game.Slug).Find(&entity); result.Error != nil {
+		err = result.Error
+		return
+	}
+	return
+}
@@ -31,3 +31,11 @@ func (d *SQLite) GetGameConfigs() (entity []GameConfig, err error) {
 	}
 	return
 }
+
+func (d *SQLite) GetGameConfigsByGame(game *Game) (entity []GameConfig, err error) {
+	if result := d.database.Where("game_id = ?", game.Slug).Find(&entity); result.Error != nil {
+		err = result.Error
+		return
+	}
+	return
+}
@@ -12,6 +12,7 @@ type GameDisk struct {
 	Url            string `gorm:"not null"`
 	Image          sql.NullString
 	CollectionPath sql.NullString
+	Sha256         sql.NullString
 }
 
 func (d *SQLite) storeImportedGameDisk(slug string, importedEntity importer.GameDisk) (err error) {
@@ -25,12 +26,18 @@ func (d *SQLite) storeImportedGameDisk(slug string, importedEntity importer.Game
 		collectionPath.Valid = true
 		collectionPath.String = *importedEntity.CollectionPath
 	}
+	sha256 := sql.NullString{}
+	if importedEntity.Sha256 != nil {
+		sha256.Valid = true
+		sha256.String = *importedEntity.Sha256
+	}
 	entity := GameDisk{
 		GameID:         slug,
 		DiskNumber:     importedEntity.DiskNumber,
 		Url:            importedEntity.Url,
 		Image:          image,
 		CollectionPath: collectionPath,
+		Sha256:         sha256,
 	}
 
 	if err = d.create(&entity); err != nil {
@@ -47,3 +54,11 @@ func (d *SQLite) GetGameDisks() (entity []GameDisk, err error) {
 	}
 	return
 }
+
+func (d *SQLite) GetGameDisksByGame(game *Game) (entity []GameDisk, err error) {
+	if result := d.database.Where("game_id = ?", game.Slug).Order("disk_number").Find(&entity); result.Error != nil {
+		err = result.Error
+		return
+	}
+	return
+}
@@ -0,0 +1,70 @@
+package sqlite
+
+import (
+	"time"
+)
+
+// A core build of the buildbot
+type CoreBuild struct {
+	// RetroArch stable version of the build, empty for the nightly builds
+	Version string
+	// Modification time and size of the build archive on the buildbot
+	BuildTime time.Time
+	Size      int64
+	// Hex SHA-256 checksum of the core file
+	Sha256 string
+}
+
+// Whether the build is set, the previous build is not until the core is updated
+func (build *CoreBuild) IsValid() bool {
+	return build.Sha256 != ""
+}
+
+// A core installed in the cores folder, keeping the build it replaced for the rollback
+type InstalledCore struct {
+	CoreLocation string    `gorm:"primaryKey"`
+	Build        CoreBuild `gorm:"embedded"`
+	Previous     CoreBuild `gorm:"embedded;embeddedPrefix:previous_"`
+	// Build time of the build rolled back from, skipped by the updates
+	RolledBackBuildTime time.Time
+	InstallDate         time.Time `gorm:"not null"`
+}
+
+// A tool installed in the tools folder
+type InstalledTool struct {
+	ToolID string `gorm:"primaryKey"`
+	// URL the tool was downloaded from
+	Url string `gorm:"not null"`
+	// Last modification time and size of the downloaded file reported by the server
+	ModTime time.Time
+	Size    int64
+	// Hex SHA-256 checksum of the downloaded file
+	Sha256      string    `gorm:"not null"`
+	InstallDate time.Time `gorm:"not null"`
+}
+
+// Store the install state of the core, replacing the previous one
+func (d *SQLite) StoreInstalledCore(installedCore *InstalledCore) error {
+	if result := d.database.Save(installedCore); result.Error != nil {
+		return result.Error
+	}
+	return nil
+}
+
+func (d *SQLite) GetInstalledCore(coreLocation string) (entity InstalledCore, err error) {
+	err = d.first(&entity, "core_location = ?", coreLocation)
+	return
+}
+
+// Store the install state of the tool, replacing the previous one
+func (d *SQLite) StoreInstalledTool(installedTool *InstalledTool) error {
+	if result := d.database.Save(installedTool); result.Error != nil {
+		return result.Error
+	}
+	return nil
+}
+
+func (d *SQLite) GetInstalledTool(tool *Tool) (entity InstalledTool, err error) {
+	err = d.first(&entity, "tool_id = ?", tool.Slug)
+	return
+}
@@ -0,0 +1,62 @@
+package sqlite
+
+import (
+	"database/sql"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// A game installed in the games folder
+type InstalledGame struct {
+	GameID string `gorm:"primaryKey"`
+	Path   string `gorm:"not null"`
+	// Total size in bytes of the installed files
+	Size int64 `gorm:"not null"`
+	// Hash of the catalog entry the game was installed from
+	CatalogVersion string              `gorm:"not null"`
+	InstallDate    time.Time           `gorm:"not null"`
+	Files          []InstalledGameFile `gorm:"foreignKey:GameID;references:GameID"`
+}
+
+// A file of an installed game
+type InstalledGameFile struct {
+	GameID string `gorm:"primaryKey"`
+	// Slash separated path relative to the game folder
+	Path string `gorm:"primaryKey"`
+	// Disk the file comes from, not valid for the additional files
+	DiskNumber sql.NullInt64
+	Size       int64  `gorm:"not null"`
+	Sha256     string `gorm:"not null"`
+}
+
+// Store the install state of the game and its files, replacing the previous ones
+func (d *SQLite) StoreInstalledGame(installedGame *InstalledGame) error {
+	return d.database.Transaction(func(transaction *gorm.DB) error {
+		if result := transaction.Where("game_id = ?", installedGame.GameID).Delete(&InstalledGameFile{}); result.Error != nil {
+			return result.Error
+		}
+		if result := transaction.Where("game_id = ?", installedGame.GameID).Delete(&InstalledGame{}); result.Error != nil {
+			return result.Error
+		}
+		if result := transaction.Create(installedGame); result.Error != nil {
+			return result.Error
+		}
+		return nil
+	})
+}
+
+func (d *SQLite) GetInstalledGame(game *Game) (entity InstalledGame, err error) {
+	if result := d.database.Preload("Files").First(&entity, "game_id = ?", game.Slug); result.Error != nil {
+		err = result.Error
+	}
+	return
+}
+
+func (d *SQLite) GetInstalledGames() (entity []InstalledGame, err error) {
+	if result := d.database.Find(&entity); result.Error != nil {
+		err = result.Error
+		return
+	}
+	return
+}
@@ -1,7 +1,9 @@
 package sqlite
 
 import (
+	"crypto/sha256"
 	"database/sql"
+	"encoding/hex"
 	"time"
 )
 
@@ -14,3 +16,43 @@ type User struct {
 	LastSeenOnline  time.Time `gorm:"not null"`
 	HashedPublicKey string    `gorm:"unique"`
 }
+
+// Hash identifying the user public key
+func HashPublicKey(publicKey []byte) string {
+	hash := sha256.Sum256(publicKey)
+	return hex.EncodeToString(hash[:])
+}
+
+// Store a new user or update the stored one with the same public key
+func (d *SQLite) StoreUser(user *User) (err error) {
+	user.HashedPublicKey = HashPublicKey(user.PublicKey)
+	var storedUser User
+	if err = d.first(&storedUser, "hashed_public_key = ?", user.HashedPublicKey); err == nil {
+		user.Id = storedUser.Id
+		if result := d.database.Save(user); result.Error != nil {
+			return result.Error
+		}
+		return
+	}
+	return d.create(user)
+}
+
+func (d *SQLite) GetUserByPublicKey(publicKey []byte) (entity User, err error) {
+	err = d.first(&entity, "hashed_public_key = ?", HashPublicKey(publicKey))
+	return
+}
+
+func (d *SQLite) GetFriends() (entity []User, err error) {
+	if result := d.database.Where("is_friend = ?", true).Find(&entity); result.Error != nil {
+		err = result.Error
+	}
+	return
+}
+
+// Update the last time the user has been seen online
+func (d *SQLite) SetUserLastSeenOnline(user *User, lastSeenOnline time.Time) error {
+	if result := d.database.Model(user).Update("last_seen_online", lastSeenOnline); result.Error != nil {
+		return result.Error
+	}
+	return nil
+}
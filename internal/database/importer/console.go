@@ -2,9 +2,20 @@ package importer
 
 import (
 	"errors"
+	"fmt"
+	"path/filepath"
+	"regexp"
 	"strconv"
+	"strings"
+
+	"arkhive.dev/launcher/internal/plugins"
 )
 
+// RetroArch stable version the console core can be pinned to
+var coreVersionPattern = regexp.MustCompile(`^\d+\.\d+\.\d+$`)
+
+var sha256Pattern = regexp.MustCompile(`^[0-9a-fA-F]{64}$`)
+
 var consoleConfigLevels = []string{
 	"config",
 	"win_config",
@@ -20,9 +31,20 @@ type ConsolePluginsFile struct {
 	CollectionPath *string
 }
 
+// The expected checksum of a plugin file, like a BIOS
+type ConsolePluginHash struct {
+	// Path of the file inside the RetroArch system directory
+	Path string
+	// Hex SHA-256 checksum
+	Sha256 string
+	// Whether the games of the console can't run without the file
+	Required bool
+}
+
 type ConsolePlugin struct {
-	Type  string
-	Files []ConsolePluginsFile
+	Type   string
+	Files  []ConsolePluginsFile
+	Hashes []ConsolePluginHash
 }
 
 type ConsoleLanguage struct {
@@ -48,6 +70,7 @@ type Console struct {
 	SingleFile           bool
 	IsEmbedded           bool
 	LanguageVariableName *string
+	CoreVersion          *string
 	Plugins              []ConsolePlugin
 	FileTypes            []ConsoleFileType
 	Configs              []ConsoleConfig
@@ -95,39 +118,60 @@ func PlainDatabaseToConsole(slug string, json interface{}) (console Console, err
 	return
 }
 
+// Read the console plugins, failing on the unknown types and on the invalid destinations
 func PlainConsolePluginToObject(console *Console, consolePluginsObject map[string]interface{}) (err error) {
 	for pluginKey, pluginValue := range consolePluginsObject {
 		var consolePlugin ConsolePlugin
-		consolePlugin, err = ConsolePluginFromJSON(pluginKey)
-		console.Plugins = append(console.Plugins, consolePlugin)
-		consolePluginObject := pluginValue.(map[string]interface{})
+		if consolePlugin, err = ConsolePluginFromJSON(pluginKey); err != nil {
+			return
+		}
+		consolePluginObject, ok := pluginValue.(map[string]interface{})
+		if !ok {
+			return fmt.Errorf("cannot parse the %s console plugin", pluginKey)
+		}
+		if consolePluginHashes, ok := consolePluginObject["hashes"]; ok {
+			if consolePlugin.Hashes, err = ConsolePluginHashesFromJSON(pluginKey, consolePluginHashes); err != nil {
+				return
+			}
+		}
 		if len(consolePluginObject) > 0 {
 			consolePluginCollectionPath := consolePluginObject["collection_path"]
 			consolePluginDestination := consolePluginObject["destination"]
-			consolePluginFilesArray := consolePluginObject["files"].([]interface{})
+			consolePluginFilesArray, ok := consolePluginObject["files"].([]interface{})
+			if !ok && consolePluginObject["files"] != nil {
+				consolePluginFilesArray = []interface{}{consolePluginObject["files"]}
+			}
 			for fileIndex := 0; fileIndex < len(consolePluginFilesArray); fileIndex++ {
 				var consolePluginCollectionPathValue interface{}
-				if consolePluginCollectionPathObject, ok := consolePluginCollectionPath.([]interface{}); ok {
+				if consolePluginCollectionPathObject, ok := consolePluginCollectionPath.([]interface{}); ok && fileIndex < len(consolePluginCollectionPathObject) {
 					consolePluginCollectionPathValue = consolePluginCollectionPathObject[fileIndex]
 				} else {
 					consolePluginCollectionPathValue = consolePluginCollectionPath
 				}
 				var consolePluginDestinationValue interface{}
-				if consolePluginDestinationObject, ok := consolePluginDestination.([]interface{}); ok {
+				if consolePluginDestinationObject, ok := consolePluginDestination.([]interface{}); ok && fileIndex < len(consolePluginDestinationObject) {
 					consolePluginDestinationValue = consolePluginDestinationObject[fileIndex]
 				} else {
 					consolePluginDestinationValue = consolePluginDestination
 				}
+				consolePluginFile, ok := consolePluginFilesArray[fileIndex].(string)
+				if !ok {
+					return fmt.Errorf("cannot parse the files of the %s console plugin", pluginKey)
+				}
 				var consolePluginsFile ConsolePluginsFile
 				if consolePluginsFile, err = ConsolePluginsFileFromJSON(
 					consolePluginCollectionPathValue,
 					consolePluginDestinationValue,
-					consolePluginFilesArray[fileIndex].(string)); err != nil {
+					consolePluginFile); err != nil {
+					return
+				}
+				if err = checkConsolePluginsFile(&consolePlugin, &consolePluginsFile); err != nil {
 					return
 				}
 				consolePlugin.Files = append(consolePlugin.Files, consolePluginsFile)
 			}
 		}
+		console.Plugins = append(console.Plugins, consolePlugin)
 	}
 	return
 }
@@ -216,6 +260,15 @@ func ConsoleFromJSON(slug string, json map[string]interface{}) (instance Console
 	if value, ok := json["is_embedded"]; ok {
 		isEmbedded = value.(bool)
 	}
+	var coreVersion *string
+	if value, ok := json["core_version"]; ok {
+		coreVersionValue, ok := value.(string)
+		if !ok || !coreVersionPattern.MatchString(coreVersionValue) {
+			err = errors.New("cannot parse core_version")
+			return
+		}
+		coreVersion = &coreVersionValue
+	}
 
 	instance = Console{
 		slug,
@@ -224,6 +277,7 @@ func ConsoleFromJSON(slug string, json map[string]interface{}) (instance Console
 		singleFile,
 		isEmbedded,
 		languageVariableName,
+		coreVersion,
 		[]ConsolePlugin{},
 		[]ConsoleFileType{},
 		[]ConsoleConfig{},
@@ -267,13 +321,68 @@ func ConsoleLanguageFromJSON(languageID uint, name string) (instance ConsoleLang
 }
 
 func ConsolePluginFromJSON(typeString string) (instance ConsolePlugin, err error) {
+	if _, err = plugins.Get(typeString); err != nil {
+		return
+	}
 	instance = ConsolePlugin{
 		typeString,
 		[]ConsolePluginsFile{},
+		[]ConsolePluginHash{},
 	}
 	return
 }
 
+/*
+Read the expected checksums of the plugin files, a JSON array of objects with the path
+of the file in the system directory, its SHA-256 checksum and, optionally, whether it's
+required, as by default.
+*/
+func ConsolePluginHashesFromJSON(typeString string, json interface{}) (instances []ConsolePluginHash, err error) {
+	var pluginType plugins.Type
+	if pluginType, err = plugins.Get(typeString); err != nil {
+		return
+	}
+	if !pluginType.Verified {
+		return nil, fmt.Errorf("the %s console plugin files are not verified", typeString)
+	}
+	hashesArray, ok := json.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("cannot parse the hashes of the %s console plugin", typeString)
+	}
+	for _, hashValue := range hashesArray {
+		hashObject, ok := hashValue.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("cannot parse the hashes of the %s console plugin", typeString)
+		}
+		instance := ConsolePluginHash{Required: true}
+		instance.Path, _ = hashObject["path"].(string)
+		instance.Sha256, _ = hashObject["sha256"].(string)
+		if required, ok := hashObject["required"]; ok {
+			if instance.Required, ok = required.(bool); !ok {
+				return nil, fmt.Errorf("cannot parse required of the %s console plugin file %q", typeString, instance.Path)
+			}
+		}
+		if instance.Path == "" || !filepath.IsLocal(filepath.FromSlash(instance.Path)) {
+			return nil, fmt.Errorf("invalid %s console plugin file path %q", typeString, instance.Path)
+		}
+		if !sha256Pattern.MatchString(instance.Sha256) {
+			return nil, fmt.Errorf("cannot parse the sha256 of %s", instance.Path)
+		}
+		instance.Sha256 = strings.ToLower(instance.Sha256)
+		instances = append(instances, instance)
+	}
+	return
+}
+
+// Check the destination of the file follows the rules of the plugin type
+func checkConsolePluginsFile(consolePlugin *ConsolePlugin, consolePluginsFile *ConsolePluginsFile) (err error) {
+	var pluginType plugins.Type
+	if pluginType, err = plugins.Get(consolePlugin.Type); err != nil {
+		return
+	}
+	return pluginType.CheckDestination(consolePluginsFile.Destination)
+}
+
 func ConsolePluginsFileFromJSON(jsonCollectionPath interface{}, jsonDestination interface{}, jsonFile string) (instance ConsolePluginsFile, err error) {
 	var destination *string = nil
 	if destinationObject, ok := jsonDestination.(string); ok {
@@ -1,8 +1,10 @@
 package importer
 
 import (
+	"strings"
 	"testing"
 
+	"arkhive.dev/launcher/internal/plugins"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -82,7 +84,7 @@ func TestPlainDatabaseToConsole(t *testing.T) {
 			"variable_name": "variable_name",
 		},
 		"plugins": map[string]interface{}{
-			"plugin": map[string]interface{}{
+			"bios": map[string]interface{}{
 				"collection_path": []interface{}{"collection_path"},
 				"destination":     []interface{}{"destination"},
 				"files":           []interface{}{"files"},
@@ -131,5 +133,121 @@ func TestPlainDatabaseToConsole(t *testing.T) {
 
 	assert.NotNil(t, entity.LanguageVariableName)
 	assert.Equal(t, "variable_name", *entity.LanguageVariableName)
-	assert.Len(t, entity.Plugins, 1)
+	if assert.Len(t, entity.Plugins, 1) {
+		assert.Len(t, entity.Plugins[0].Files, 1)
+	}
+}
+
+func TestPlainDatabaseToConsoleCoreVersion(t *testing.T) {
+	json := map[string]interface{}{
+		"name":          "name",
+		"core_location": "core_location",
+		"core_version":  "1.19.1",
+		"file_types": map[string]interface{}{
+			"action0": []interface{}{"file_type0"},
+		},
+	}
+	entity, err := PlainDatabaseToConsole("consoleSlug", json)
+	assert.Nil(t, err)
+	if assert.NotNil(t, entity.CoreVersion) {
+		assert.Equal(t, "1.19.1", *entity.CoreVersion)
+	}
+
+	json["core_version"] = "latest"
+	_, err = PlainDatabaseToConsole("consoleSlug", json)
+	if assert.NotNil(t, err) {
+		assert.Contains(t, err.Error(), "cannot parse core_version")
+	}
+}
+
+func TestPlainDatabaseToConsolePlugins(t *testing.T) {
+	json := map[string]interface{}{
+		"name":          "name",
+		"core_location": "core_location",
+		"file_types": map[string]interface{}{
+			"action0": []interface{}{"file_type0"},
+		},
+		"plugins": map[string]interface{}{
+			"shaders": map[string]interface{}{
+				"files": "https://example.com/shaders.zip",
+			},
+			"remaps": map[string]interface{}{
+				"destination": "Snes9x",
+				"files":       []interface{}{"https://example.com/a.rmp", "https://example.com/b.rmp"},
+			},
+		},
+	}
+	entity, err := PlainDatabaseToConsole("consoleSlug", json)
+	assert.Nil(t, err)
+	if assert.Len(t, entity.Plugins, 2) {
+		for _, plugin := range entity.Plugins {
+			if plugin.Type == "remaps" {
+				assert.Len(t, plugin.Files, 2)
+				assert.Equal(t, "Snes9x", *plugin.Files[1].Destination)
+			} else {
+				assert.Equal(t, "shaders", plugin.Type)
+				assert.Len(t, plugin.Files, 1)
+			}
+		}
+	}
+
+	json["plugins"] = map[string]interface{}{"textures": map[string]interface{}{}}
+	_, err = PlainDatabaseToConsole("consoleSlug", json)
+	assert.ErrorIs(t, err, plugins.ErrUnknownType)
+	json["plugins"] = map[string]interface{}{"remaps": map[string]interface{}{"files": "https://example.com/a.rmp"}}
+	_, err = PlainDatabaseToConsole("consoleSlug", json)
+	assert.ErrorIs(t, err, plugins.ErrInvalidDestination)
+	json["plugins"] = map[string]interface{}{"overlays": map[string]interface{}{"destination": "../cores", "files": "https://example.com/a.zip"}}
+	_, err = PlainDatabaseToConsole("consoleSlug", json)
+	assert.ErrorIs(t, err, plugins.ErrInvalidDestination)
+}
+
+func TestPlainDatabaseToConsolePluginHashes(t *testing.T) {
+	sha256 := strings.Repeat("AB", 32)
+	json := map[string]interface{}{
+		"name":          "name",
+		"core_location": "core_location",
+		"file_types": map[string]interface{}{
+			"action0": []interface{}{"file_type0"},
+		},
+		"plugins": map[string]interface{}{
+			"bios": map[string]interface{}{
+				"files":       "https://example.com/bios.zip",
+				"destination": "system",
+				"hashes": []interface{}{
+					map[string]interface{}{"path": "scph5501.bin", "sha256": sha256},
+					map[string]interface{}{"path": "psx/scph5500.bin", "sha256": sha256, "required": false},
+				},
+			},
+		},
+	}
+	entity, err := PlainDatabaseToConsole("consoleSlug", json)
+	assert.Nil(t, err)
+	if assert.Len(t, entity.Plugins, 1) {
+		assert.Equal(t, []ConsolePluginHash{
+			{Path: "scph5501.bin", Sha256: strings.ToLower(sha256), Required: true},
+			{Path: "psx/scph5500.bin", Sha256: strings.ToLower(sha256), Required: false},
+		}, entity.Plugins[0].Hashes)
+	}
+
+	json["plugins"] = map[string]interface{}{"bios": map[string]interface{}{
+		"files":       "https://example.com/bios.zip",
+		"destination": "system",
+		"hashes":      []interface{}{map[string]interface{}{"path": "../bios.bin", "sha256": sha256}},
+	}}
+	_, err = PlainDatabaseToConsole("consoleSlug", json)
+	assert.NotNil(t, err)
+	json["plugins"] = map[string]interface{}{"bios": map[string]interface{}{
+		"files":       "https://example.com/bios.zip",
+		"destination": "system",
+		"hashes":      []interface{}{map[string]interface{}{"path": "bios.bin", "sha256": "md5"}},
+	}}
+	_, err = PlainDatabaseToConsole("consoleSlug", json)
+	assert.NotNil(t, err)
+	json["plugins"] = map[string]interface{}{"shaders": map[string]interface{}{
+		"files":  "https://example.com/shaders.zip",
+		"hashes": []interface{}{map[string]interface{}{"path": "crt.glslp", "sha256": sha256}},
+	}}
+	_, err = PlainDatabaseToConsole("consoleSlug", json)
+	assert.NotNil(t, err)
 }
@@ -22,6 +22,7 @@ type GameDisk struct {
 	Url            string
 	Image          *string
 	CollectionPath *string
+	Sha256         *string
 }
 
 type Game struct {
@@ -56,14 +57,18 @@ func PlainDatabaseToGame(slug string, json interface{}) (game Game, err error) {
 		for diskNumber := 0; diskNumber < len(urls); diskNumber++ {
 			var disk GameDisk
 			diskImage := entityObject["disk_image"].([]interface{})[diskNumber]
-			if disk, err = GameDiskFromJSON(uint(diskNumber), urls[diskNumber].(string), diskImage, collectionPath); err != nil {
+			var sha256 interface{}
+			if sha256Objects, ok := entityObject["sha256"].([]interface{}); ok && diskNumber < len(sha256Objects) {
+				sha256 = sha256Objects[diskNumber]
+			}
+			if disk, err = GameDiskFromJSON(uint(diskNumber), urls[diskNumber].(string), diskImage, collectionPath, sha256); err != nil {
 				return
 			}
 			game.Disks = append(game.Disks, disk)
 		}
 	} else {
 		var disk GameDisk
-		if disk, err = GameDiskFromJSON(0, entityObject["url"].(string), nil, collectionPath); err != nil {
+		if disk, err = GameDiskFromJSON(0, entityObject["url"].(string), nil, collectionPath, entityObject["sha256"]); err != nil {
 			return
 		}
 		game.Disks = append(game.Disks, disk)
@@ -118,7 +123,7 @@ func GameFromJSON(slug string, data map[string]interface{}) (instance Game, err
 	return
 }
 
-func GameDiskFromJSON(diskNumber uint, jsonUrl string, jsonDiskImage interface{}, jsonCollectionPath interface{}) (instance GameDisk, err error) {
+func GameDiskFromJSON(diskNumber uint, jsonUrl string, jsonDiskImage interface{}, jsonCollectionPath interface{}, jsonSha256 interface{}) (instance GameDisk, err error) {
 	var image *string
 	if imageObject, ok := jsonDiskImage.(string); ok {
 		image = &imageObject
@@ -127,11 +132,16 @@ func GameDiskFromJSON(diskNumber uint, jsonUrl string, jsonDiskImage interface{}
 	if collectionPathObject, ok := jsonCollectionPath.(string); ok {
 		collectionPath = &collectionPathObject
 	}
+	var sha256 *string
+	if sha256Object, ok := jsonSha256.(string); ok {
+		sha256 = &sha256Object
+	}
 	instance = GameDisk{
 		diskNumber,
 		jsonUrl,
 		image,
 		collectionPath,
+		sha256,
 	}
 	return
 }
@@ -5,6 +5,7 @@ import (
 	"sync"
 
 	"arkhive.dev/launcher/internal/gui"
+	"github.com/sirupsen/logrus"
 )
 
 type Controller struct {
@@ -31,4 +32,18 @@ func (controller *Controller) Initialize() {
 
 	controller.coreThreadsInitializationGroup.Wait()
 	controller.guiHandler.NotifyStarted()
+	go controller.prepare()
+}
+
+// Run the preparation of the preparing engines in order, then notify the ready state
+func (controller *Controller) prepare() {
+	for _, engine := range controller.engines {
+		if preparingEngine, ok := engine.(PreparingEngine); ok {
+			if err := preparingEngine.Prepare(controller.guiHandler.NotifyPreparationProgress); err != nil {
+				logrus.Error("Engine preparation failed")
+				logrus.Errorf("%+v", err)
+			}
+		}
+	}
+	controller.guiHandler.NotifyReady()
 }
@@ -10,12 +10,27 @@ import (
 
 type MockHandler struct {
 	IsStarted bool
+	Progress  [][2]int
+	// Closed once the preparation ends, if set
+	Ready chan struct{}
 }
 
 func (mockHandler *MockHandler) NotifyStarted() {
 	mockHandler.IsStarted = true
 }
 
+func (mockHandler *MockHandler) NotifyPreparationProgress(completed int, total int) {
+	mockHandler.Progress = append(mockHandler.Progress, [2]int{completed, total})
+}
+
+func (mockHandler *MockHandler) NotifyReady() {
+	if mockHandler.Ready != nil {
+		close(mockHandler.Ready)
+	}
+}
+
+func (mockHandler *MockHandler) NotifyDiskChanged(gameSlug string, diskNumber uint, image string) {}
+
 func TestInitializeNoEngines(t *testing.T) {
 	engines := make([]engine.ApplicationEngine, 0)
 	handler := MockHandler{}
@@ -42,3 +57,17 @@ func TestInitialize(t *testing.T) {
 	}
 	assert.True(t, handler.IsStarted, "The mock GUI not notifies the start")
 }
+
+func TestInitializePreparingEngine(t *testing.T) {
+	preparingEngine := &MockPreparingEngine{Jobs: 3}
+	engines := []engine.ApplicationEngine{&MockEngine{}, preparingEngine}
+	handler := MockHandler{Ready: make(chan struct{})}
+
+	controller := engine.NewController(engines, &handler)
+	controller.Initialize()
+	<-handler.Ready
+
+	assert.True(t, handler.IsStarted)
+	assert.True(t, preparingEngine.Prepared)
+	assert.Equal(t, [][2]int{{1, 3}, {2, 3}, {3, 3}}, handler.Progress)
+}
@@ -5,3 +5,10 @@ import "sync"
 type ApplicationEngine interface {
 	Initialize(waitGroup *sync.WaitGroup)
 }
+
+// An engine going on preparing in background once initialized, like the system engine downloading the cores
+type PreparingEngine interface {
+	ApplicationEngine
+	// Prepare the engine, notifying the ended and the total preparation jobs
+	Prepare(progressHandler func(completed int, total int)) error
+}
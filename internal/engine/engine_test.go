@@ -16,3 +16,17 @@ func (mockEngine *MockEngine) Initialize(waitGroup *sync.WaitGroup) {
 	mockEngine.Started = true
 	waitGroup.Done()
 }
+
+type MockPreparingEngine struct {
+	MockEngine
+	Jobs     int
+	Prepared bool
+}
+
+func (mockPreparingEngine *MockPreparingEngine) Prepare(progressHandler func(completed int, total int)) error {
+	for job := 1; job <= mockPreparingEngine.Jobs; job++ {
+		progressHandler(job, mockPreparingEngine.Jobs)
+	}
+	mockPreparingEngine.Prepared = true
+	return nil
+}
@@ -0,0 +1,72 @@
+package folder
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// Move the folder entries into the destination folder, merging the existing folders
+func MoveFolderContent(sourcePath string, destinationPath string) (err error) {
+	if err = os.MkdirAll(destinationPath, 0755); err != nil {
+		return
+	}
+	var entries []os.DirEntry
+	if entries, err = os.ReadDir(sourcePath); err != nil {
+		return
+	}
+	for _, entry := range entries {
+		sourceEntryPath := filepath.Join(sourcePath, entry.Name())
+		destinationEntryPath := filepath.Join(destinationPath, entry.Name())
+		if destinationInfo, statErr := os.Stat(destinationEntryPath); statErr == nil {
+			if entry.IsDir() && destinationInfo.IsDir() {
+				if err = MoveFolderContent(sourceEntryPath, destinationEntryPath); err != nil {
+					return
+				}
+				continue
+			}
+			if err = os.RemoveAll(destinationEntryPath); err != nil {
+				return
+			}
+		}
+		if err = os.Rename(sourceEntryPath, destinationEntryPath); err != nil {
+			return
+		}
+	}
+	return
+}
+
+// Copy the folder content into the destination folder
+func CopyFolder(sourcePath string, destinationPath string) error {
+	return filepath.WalkDir(sourcePath, func(filePath string, entry os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		relativePath, err := filepath.Rel(sourcePath, filePath)
+		if err != nil {
+			return err
+		}
+		if entry.IsDir() {
+			return os.MkdirAll(filepath.Join(destinationPath, relativePath), 0755)
+		}
+		return CopyFile(filePath, filepath.Join(destinationPath, relativePath))
+	})
+}
+
+// Copy the file into the destination, never linking it so that the copy could be altered alone
+func CopyFile(sourcePath string, destinationPath string) (err error) {
+	var source *os.File
+	if source, err = os.Open(sourcePath); err != nil {
+		return
+	}
+	defer source.Close()
+	var destination *os.File
+	if destination, err = os.Create(destinationPath); err != nil {
+		return
+	}
+	if _, err = io.Copy(destination, source); err != nil {
+		destination.Close()
+		return
+	}
+	return destination.Close()
+}
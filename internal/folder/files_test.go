@@ -0,0 +1,34 @@
+package folder_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"arkhive.dev/launcher/internal/folder"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCopyAndMoveFolderContent(t *testing.T) {
+	sourcePath := t.TempDir()
+	assert.Nil(t, os.MkdirAll(filepath.Join(sourcePath, "saves"), 0755))
+	assert.Nil(t, os.WriteFile(filepath.Join(sourcePath, "saves", "game.srm"), []byte("save"), 0644))
+
+	copyPath := filepath.Join(t.TempDir(), "copy")
+	assert.Nil(t, folder.CopyFolder(sourcePath, copyPath))
+	data, err := os.ReadFile(filepath.Join(copyPath, "saves", "game.srm"))
+	assert.Nil(t, err)
+	assert.Equal(t, "save", string(data))
+
+	destinationPath := t.TempDir()
+	assert.Nil(t, os.MkdirAll(filepath.Join(destinationPath, "saves"), 0755))
+	assert.Nil(t, os.WriteFile(filepath.Join(destinationPath, "saves", "other.srm"), []byte("other"), 0644))
+	assert.Nil(t, folder.MoveFolderContent(copyPath, destinationPath))
+	entries, err := os.ReadDir(filepath.Join(destinationPath, "saves"))
+	assert.Nil(t, err)
+	assert.Len(t, entries, 2)
+	_, err = os.Stat(filepath.Join(copyPath, "saves", "game.srm"))
+	assert.True(t, os.IsNotExist(err))
+	_, err = os.Stat(filepath.Join(sourcePath, "saves", "game.srm"))
+	assert.Nil(t, err)
+}
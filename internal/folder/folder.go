@@ -6,3 +6,6 @@ const TOOLS = "tools"
 const TEMP = "temp"
 const PLUGIN = "plugin"
 const ROMS = "games"
+const PACKAGES = "packages"
+const SAVES = "saves"
+const FRIEND_SAVES = "friendsaves"
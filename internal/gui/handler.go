@@ -2,4 +2,10 @@ package gui
 
 type Handler interface {
 	NotifyStarted()
+	// Notify the progress of the background preparation, like the cores downloads
+	NotifyPreparationProgress(completed int, total int)
+	// Notify the background preparation ended, the games can run
+	NotifyReady()
+	// Notify the disk inserted in the tray of the running multiple disks game, with its image URL
+	NotifyDiskChanged(gameSlug string, diskNumber uint, image string)
 }
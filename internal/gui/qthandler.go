@@ -3,3 +3,9 @@ package gui
 type QtHandler struct{}
 
 func (QtHandler *QtHandler) NotifyStarted() {}
+
+func (QtHandler *QtHandler) NotifyPreparationProgress(completed int, total int) {}
+
+func (QtHandler *QtHandler) NotifyReady() {}
+
+func (QtHandler *QtHandler) NotifyDiskChanged(gameSlug string, diskNumber uint, image string) {}
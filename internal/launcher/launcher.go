@@ -1,16 +1,478 @@
 package launcher
 
 import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
 	"sync"
+
+	"arkhive.dev/launcher/internal/buildbot"
+	"arkhive.dev/launcher/internal/configloader"
+	"arkhive.dev/launcher/internal/database/delegate/sqlite"
+	"arkhive.dev/launcher/internal/folder"
+	"arkhive.dev/launcher/internal/network"
+	"arkhive.dev/launcher/internal/storage"
+	"arkhive.dev/launcher/internal/system"
+	"github.com/BurntSushi/toml"
+	"github.com/sirupsen/logrus"
+)
+
+// Folder of the per-game RetroArch configuration overrides, inside the system folder
+const GAME_CONFIG_FOLDER = "config"
+
+// Handling of the games whose console misses a required BIOS
+const (
+	// Refuse to launch the game
+	MISSING_BIOS_REFUSE = configloader.MISSING_BIOS_REFUSE
+	// Launch the game, logging the missing BIOS
+	MISSING_BIOS_WARN = configloader.MISSING_BIOS_WARN
 )
 
+// RetroArch hotkeys swapping the disks of the multiple disks games
+const (
+	DISK_EJECT_KEY = "f9"
+	DISK_NEXT_KEY  = "f10"
+	DISK_PREV_KEY  = "f11"
+)
+
+/*
+RetroArch log line reporting the disk inserted in the tray, numbered from 1, like
+"[Disc]: Setting disc 2 of 3 in tray".
+
+RetroArch writes it only with the verbose logging, enabled for the multiple disks games.
+The disk tracking depends on the wording of the RetroArch log and stops working if it changes.
+*/
+var diskInsertedPattern = regexp.MustCompile(`(?i)setting dis[ck] (\d+) of \d+ in tray`)
+
+var ErrGameRunning = errors.New("a game is already running")
+var ErrRomNotFound = errors.New("no runnable file in the game folder")
+
+type LaunchOptions struct {
+	// Netplay session to host or join, nil to play alone
+	Netplay *network.NetplaySession
+	// Handler of the RetroArch log lines, called besides the application log
+	LogHandler func(line string)
+	// Handler of the disk inserted in the tray, called when RetroArch swaps the disks
+	DiskHandler func(disk GameDiskImage)
+}
+
+// A disk of the game, with the image shown while it's in the tray
+type GameDiskImage struct {
+	DiskNumber uint
+	// URL of the disk image, empty if the catalog has none
+	Image string
+}
+
+// A running RetroArch process
+type GameProcess struct {
+	GameSlug  string
+	Arguments []string
+	// Disks of the game in playlist order, empty for the single disk games
+	Disks       []GameDiskImage
+	command     *exec.Cmd
+	logs        sync.WaitGroup
+	done        chan struct{}
+	exitCode    int
+	err         error
+	currentDisk int
+	lock        sync.Mutex
+}
+
+// Wait for RetroArch to exit, returning its exit code
+func (process *GameProcess) Wait() (exitCode int, err error) {
+	<-process.done
+	return process.exitCode, process.err
+}
+
+// Terminate RetroArch
+func (process *GameProcess) Stop() error {
+	return process.command.Process.Kill()
+}
+
+// The disk in the tray, the first one until RetroArch swaps them
+func (process *GameProcess) GetCurrentDisk() (disk GameDiskImage, ok bool) {
+	process.lock.Lock()
+	defer process.lock.Unlock()
+	if len(process.Disks) == 0 {
+		return
+	}
+	return process.Disks[process.currentDisk], true
+}
+
+// Track the disk swaps reported by the RetroArch log
+func (process *GameProcess) handleLogLine(line string, options *LaunchOptions) {
+	if options.LogHandler != nil {
+		options.LogHandler(line)
+	}
+	match := diskInsertedPattern.FindStringSubmatch(line)
+	if match == nil {
+		return
+	}
+	diskIndex, err := strconv.Atoi(match[1])
+	if err != nil || diskIndex < 1 || diskIndex > len(process.Disks) {
+		return
+	}
+	process.lock.Lock()
+	process.currentDisk = diskIndex - 1
+	disk := process.Disks[process.currentDisk]
+	process.lock.Unlock()
+	logrus.Infof("%s: Disk %d inserted", process.GameSlug, disk.DiskNumber)
+	if options.DiskHandler != nil {
+		options.DiskHandler(disk)
+	}
+}
+
 type LauncherEngine struct {
+	databaseEngine    *sqlite.SQLite
+	retroArchPath     string
+	basePath          string
+	buildbotPlatform  string
+	missingBiosPolicy string
+	running           *GameProcess
+	lock              sync.Mutex
 }
 
-func NewLauncherEngine() (instance *LauncherEngine, err error) {
-	instance = &LauncherEngine{}
+func NewLauncherEngine(databaseEngine *sqlite.SQLite, configuration configloader.Config) (instance *LauncherEngine, err error) {
+	instance = &LauncherEngine{
+		databaseEngine:    databaseEngine,
+		retroArchPath:     configuration.RetroArchPath,
+		basePath:          configuration.BasePath,
+		buildbotPlatform:  configuration.BuildbotPlatform,
+		missingBiosPolicy: configuration.MissingBiosPolicy,
+	}
 	return
 }
 
 func (launcherEngine *LauncherEngine) Initialize(waitGroup *sync.WaitGroup) {
+	defer waitGroup.Done()
+	if err := os.MkdirAll(launcherEngine.getGameConfigPath(), 0755); err != nil {
+		panic(err)
+	}
+}
+
+/*
+Launch the game through RetroArch.
+
+The console core is loaded with the RetroArch system configuration, appending the
+console and game configuration override, and runs the game executable or the runnable
+file of the game folder. The game saves are backed up first and RetroArch writes them
+in the game saves folder. The RetroArch logs are streamed to the application log.
+*/
+func (launcherEngine *LauncherEngine) Launch(gameSlug string, options LaunchOptions) (process *GameProcess, err error) {
+	launcherEngine.lock.Lock()
+	defer launcherEngine.lock.Unlock()
+	if launcherEngine.running != nil {
+		return nil, ErrGameRunning
+	}
+	var arguments []string
+	var disks []GameDiskImage
+	if arguments, disks, err = launcherEngine.getArguments(gameSlug, options.Netplay); err != nil {
+		return
+	}
+	if _, err = launcherEngine.BackupSaves(gameSlug); err != nil {
+		return nil, fmt.Errorf("cannot back up the saves: %w", err)
+	}
+	process = &GameProcess{
+		GameSlug:  gameSlug,
+		Arguments: arguments,
+		Disks:     disks,
+		command:   exec.Command(launcherEngine.retroArchPath, arguments...),
+		done:      make(chan struct{}),
+	}
+	var stdout, stderr io.ReadCloser
+	if stdout, err = process.command.StdoutPipe(); err != nil {
+		return nil, err
+	}
+	if stderr, err = process.command.StderrPipe(); err != nil {
+		return nil, err
+	}
+	logrus.Infof("Launching %s: %s %s", gameSlug, launcherEngine.retroArchPath, strings.Join(arguments, " "))
+	if err = process.command.Start(); err != nil {
+		return nil, err
+	}
+	logHandler := func(line string) { process.handleLogLine(line, &options) }
+	process.logs.Add(2)
+	go streamLog(&process.logs, stdout, logHandler)
+	go streamLog(&process.logs, stderr, logHandler)
+	launcherEngine.running = process
+	go launcherEngine.waitProcess(process)
+	return
+}
+
+// The game currently running, nil if none
+func (launcherEngine *LauncherEngine) GetRunningGame() *GameProcess {
+	launcherEngine.lock.Lock()
+	defer launcherEngine.lock.Unlock()
+	return launcherEngine.running
+}
+
+func (launcherEngine *LauncherEngine) waitProcess(process *GameProcess) {
+	process.logs.Wait()
+	err := process.command.Wait()
+	var exitError *exec.ExitError
+	if errors.As(err, &exitError) {
+		err = nil
+	}
+	process.exitCode = process.command.ProcessState.ExitCode()
+	process.err = err
+	if process.exitCode == 0 {
+		logrus.Infof("%s: RetroArch exited", process.GameSlug)
+	} else {
+		logrus.Warnf("%s: RetroArch exited with status %d", process.GameSlug, process.exitCode)
+	}
+	launcherEngine.lock.Lock()
+	launcherEngine.running = nil
+	launcherEngine.lock.Unlock()
+	close(process.done)
+}
+
+func streamLog(waitGroup *sync.WaitGroup, reader io.Reader, logHandler func(line string)) {
+	defer waitGroup.Done()
+	scanner := bufio.NewScanner(reader)
+	for scanner.Scan() {
+		logrus.Debugf("RetroArch: %s", scanner.Text())
+		logHandler(scanner.Text())
+	}
+}
+
+// Check the required BIOS files of the console, refusing the launch if missing unless the policy is to warn
+func (launcherEngine *LauncherEngine) checkBios(console *sqlite.Console) (err error) {
+	var report system.BiosReport
+	if report, err = system.CheckBios(launcherEngine.databaseEngine, filepath.Join(launcherEngine.basePath, folder.SYSTEM), console); err != nil {
+		return
+	}
+	if err = report.CheckRequired(); err != nil && launcherEngine.missingBiosPolicy == MISSING_BIOS_WARN {
+		logrus.Warnf("%+v", err)
+		return nil
+	}
+	return
+}
+
+/*
+Build the RetroArch command line of the game, writing its configuration override.
+
+The multiple disks games run their disks playlist, returning the disks in order.
+*/
+func (launcherEngine *LauncherEngine) getArguments(gameSlug string, netplay *network.NetplaySession) (arguments []string, disks []GameDiskImage, err error) {
+	var game sqlite.Game
+	if game, err = launcherEngine.databaseEngine.GetGame(gameSlug); err != nil {
+		return
+	}
+	var console sqlite.Console
+	if console, err = launcherEngine.databaseEngine.GetConsole(game.ConsoleID); err != nil {
+		return
+	}
+	var platform buildbot.Platform
+	if platform, err = buildbot.DetectPlatform(launcherEngine.buildbotPlatform); err != nil {
+		return nil, nil, fmt.Errorf("core of the %s console not available: %w", console.Slug, err)
+	}
+	corePath := filepath.Join(launcherEngine.basePath, system.GetCorePath(&console, &platform))
+	if _, err = os.Stat(corePath); err != nil {
+		return nil, nil, fmt.Errorf("core of the %s console not available: %w", console.Slug, err)
+	}
+	if err = launcherEngine.checkBios(&console); err != nil {
+		return
+	}
+	var romPath string
+	if romPath, err = launcherEngine.getRomPath(&game, &console); err != nil {
+		return
+	}
+	if strings.EqualFold(filepath.Ext(romPath), "."+storage.PLAYLIST_EXTENSION) {
+		if disks, err = launcherEngine.getGameDisks(&game); err != nil {
+			return
+		}
+	}
+	var configPath string
+	if configPath, err = launcherEngine.writeGameConfig(&game, &console, netplay, len(disks) > 1); err != nil {
+		return
+	}
+	arguments = []string{
+		"-L", corePath,
+		"--config", filepath.Join(launcherEngine.basePath, system.GetDefaultConfigPath()),
+		"--appendconfig", configPath,
+	}
+	if netplay != nil {
+		arguments = append(arguments, netplay.GetArguments()...)
+	}
+	return append(arguments, romPath), disks, nil
+}
+
+// The folder the game is installed in
+func (launcherEngine *LauncherEngine) GetGamePath(game *sqlite.Game) string {
+	return filepath.Join(launcherEngine.basePath, folder.ROMS, game.Slug)
+}
+
+// The disks of the game in order, with their images
+func (launcherEngine *LauncherEngine) GetGameDisks(gameSlug string) (disks []GameDiskImage, err error) {
+	var game sqlite.Game
+	if game, err = launcherEngine.databaseEngine.GetGame(gameSlug); err != nil {
+		return
+	}
+	return launcherEngine.getGameDisks(&game)
+}
+
+func (launcherEngine *LauncherEngine) getGameDisks(game *sqlite.Game) (disks []GameDiskImage, err error) {
+	var gameDisks []sqlite.GameDisk
+	if gameDisks, err = launcherEngine.databaseEngine.GetGameDisksByGame(game); err != nil {
+		return
+	}
+	for _, gameDisk := range gameDisks {
+		disks = append(disks, GameDiskImage{DiskNumber: gameDisk.DiskNumber, Image: gameDisk.Image.String})
+	}
+	return
+}
+
+// Resolve the game executable, the disks playlist or the first runnable file of the game folder
+func (launcherEngine *LauncherEngine) getRomPath(game *sqlite.Game, console *sqlite.Console) (romPath string, err error) {
+	gamePath := launcherEngine.GetGamePath(game)
+	if game.Executable.Valid && game.Executable.String != "" {
+		executable := filepath.FromSlash(game.Executable.String)
+		if !filepath.IsLocal(executable) {
+			return "", fmt.Errorf("invalid game executable %q", game.Executable.String)
+		}
+		romPath = filepath.Join(gamePath, executable)
+		_, err = os.Stat(romPath)
+		return
+	}
+	romPath = filepath.Join(gamePath, storage.GetPlaylistName(game))
+	if _, err = os.Stat(romPath); err == nil {
+		return
+	}
+	var fileTypes []sqlite.ConsoleFileType
+	if fileTypes, err = launcherEngine.databaseEngine.GetConsoleFileTypesByConsole(console); err != nil {
+		return
+	}
+	runnableExtensions := map[string]bool{}
+	for _, fileType := range fileTypes {
+		if fileType.Action == sqlite.FILE_TYPE_RUNNABLE {
+			runnableExtensions[normalizeExtension(fileType.FileType)] = true
+		}
+	}
+	var candidates []string
+	err = filepath.WalkDir(gamePath, func(filePath string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !entry.Type().IsRegular() {
+			return nil
+		}
+		if len(runnableExtensions) == 0 || runnableExtensions[normalizeExtension(filepath.Ext(filePath))] {
+			candidates = append(candidates, filePath)
+		}
+		return nil
+	})
+	if err != nil {
+		return
+	}
+	if len(candidates) == 0 {
+		return "", ErrRomNotFound
+	}
+	sort.Strings(candidates)
+	return candidates[0], nil
+}
+
+func normalizeExtension(extension string) string {
+	return strings.ToLower(strings.TrimPrefix(extension, "."))
+}
+
+func (launcherEngine *LauncherEngine) getGameConfigPath() string {
+	return filepath.Join(launcherEngine.basePath, folder.SYSTEM, GAME_CONFIG_FOLDER)
+}
+
+/*
+Write the RetroArch configuration override of the game and its core options.
+
+The console configurations of the running operative system are applied first, then
+the game ones, the game saves folders, the disk swap hotkeys for the multiple disks
+games and the netplay session ones.
+*/
+func (launcherEngine *LauncherEngine) writeGameConfig(game *sqlite.Game, console *sqlite.Console, netplay *network.NetplaySession, multipleDisks bool) (configPath string, err error) {
+	var consoleConfigs []sqlite.ConsoleConfig
+	if consoleConfigs, err = launcherEngine.databaseEngine.GetConsoleConfigsByConsole(console); err != nil {
+		return
+	}
+	var gameConfigs []sqlite.GameConfig
+	if gameConfigs, err = launcherEngine.databaseEngine.GetGameConfigsByGame(game); err != nil {
+		return
+	}
+	settings := map[string]interface{}{}
+	coreOptions := map[string]interface{}{}
+	for _, level := range getConfigLevels() {
+		for _, consoleConfig := range consoleConfigs {
+			if consoleConfig.Level != level {
+				continue
+			}
+			if strings.HasSuffix(level, "core_config") {
+				coreOptions[consoleConfig.Name] = consoleConfig.Value
+			} else {
+				settings[consoleConfig.Name] = consoleConfig.Value
+			}
+		}
+	}
+	for _, gameConfig := range gameConfigs {
+		settings[gameConfig.Name] = gameConfig.Value
+	}
+	savesPath := launcherEngine.GetSavesPath(game.Slug)
+	for setting, saveFolder := range map[string]string{"savefile_directory": SAVE_FILES_FOLDER, "savestate_directory": SAVE_STATES_FOLDER} {
+		saveFolderPath := filepath.Join(savesPath, saveFolder)
+		if err = os.MkdirAll(saveFolderPath, 0755); err != nil {
+			return
+		}
+		settings[setting] = saveFolderPath
+	}
+	if multipleDisks {
+		settings["input_disk_eject_toggle"] = DISK_EJECT_KEY
+		settings["input_disk_next"] = DISK_NEXT_KEY
+		settings["input_disk_prev"] = DISK_PREV_KEY
+		// The disk swaps are only logged verbosely, on the output read by the launcher
+		settings["log_verbosity"] = true
+		settings["log_to_file"] = false
+	}
+	if netplay != nil {
+		for name, value := range netplay.GetConfig() {
+			settings[name] = value
+		}
+	}
+	configFolderPath := launcherEngine.getGameConfigPath()
+	if err = os.MkdirAll(configFolderPath, 0755); err != nil {
+		return
+	}
+	if len(coreOptions) > 0 {
+		coreOptionsPath := filepath.Join(configFolderPath, game.Slug+".opt")
+		if err = writeConfigFile(coreOptionsPath, coreOptions); err != nil {
+			return
+		}
+		settings["core_options_path"] = coreOptionsPath
+	}
+	configPath = filepath.Join(configFolderPath, game.Slug+".cfg")
+	err = writeConfigFile(configPath, settings)
+	return
+}
+
+// The console configuration levels applied on the running operative system, in order
+func getConfigLevels() []string {
+	platformPrefix := "linux_"
+	if runtime.GOOS == "windows" {
+		platformPrefix = "win_"
+	}
+	return []string{"config", platformPrefix + "config", "core_config", platformPrefix + "core_config"}
+}
+
+func writeConfigFile(configPath string, settings map[string]interface{}) (err error) {
+	var file *os.File
+	if file, err = os.Create(configPath); err != nil {
+		return
+	}
+	defer file.Close()
+	return toml.NewEncoder(file).Encode(settings)
 }
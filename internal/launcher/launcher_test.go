@@ -0,0 +1,240 @@
+package launcher_test
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"testing"
+
+	"arkhive.dev/launcher/internal/buildbot"
+	"arkhive.dev/launcher/internal/configloader"
+	"arkhive.dev/launcher/internal/database/delegate/sqlite"
+	"arkhive.dev/launcher/internal/database/importer"
+	"arkhive.dev/launcher/internal/folder"
+	"arkhive.dev/launcher/internal/launcher"
+	"arkhive.dev/launcher/internal/network"
+	"arkhive.dev/launcher/internal/plugins"
+	"arkhive.dev/launcher/internal/system"
+	"github.com/stretchr/testify/assert"
+)
+
+/*
+Fake RetroArch printing its arguments and the appended configuration, then exiting with
+the status of the ROM file. Playlists are swapped to their second disk.
+*/
+const fakeRetroArchScript = `#!/bin/sh
+echo "arguments: $*"
+while [ $# -gt 1 ]; do
+	if [ "$1" = "--appendconfig" ]; then cat "$2"; fi
+	shift
+done
+if [ "${1##*.}" = "m3u" ]; then
+	echo "[Disc]: Setting disc 2 of 2 in tray." >&2
+	exit 0
+fi
+exit $(cat "$1")
+`
+
+func newTestLauncherEngine(t *testing.T, executable *string, disks ...importer.GameDisk) (*launcher.LauncherEngine, configloader.Config) {
+	return newCustomTestLauncherEngine(t, nil, executable, disks...)
+}
+
+// Create the test launcher engine, customizing the configuration and the console before storing them
+func newCustomTestLauncherEngine(t *testing.T, customize func(configuration *configloader.Config, console *importer.Console), executable *string, disks ...importer.GameDisk) (*launcher.LauncherEngine, configloader.Config) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the fake RetroArch is a shell script")
+	}
+	basePath := t.TempDir()
+	retroArchPath := filepath.Join(basePath, "retroarch")
+	assert.Nil(t, os.WriteFile(retroArchPath, []byte(fakeRetroArchScript), 0755))
+	configuration := configloader.Config{BasePath: basePath, RetroArchPath: retroArchPath}
+
+	database := &sqlite.SQLite{BasePath: basePath}
+	assert.Nil(t, database.Open())
+	assert.Nil(t, database.Migrate())
+	t.Cleanup(func() { database.Close() })
+	console := importer.Console{
+		Slug:         "snes",
+		CoreLocation: "snes9x_libretro",
+		Name:         "Super Nintendo",
+		SingleFile:   true,
+		FileTypes:    []importer.ConsoleFileType{{FileType: "sfc", Action: sqlite.FILE_TYPE_RUNNABLE}},
+		Configs: []importer.ConsoleConfig{
+			{Name: "video_scale_integer", Value: "true", Level: "config"},
+			{Name: "snes9x_overclock", Value: "disabled", Level: "core_config"},
+		},
+	}
+	if customize != nil {
+		customize(&configuration, &console)
+	}
+	game := importer.Game{
+		Slug:        "super_mario_world",
+		Name:        "Super Mario World",
+		ConsoleSlug: "snes",
+		Executable:  executable,
+		Disks:       disks,
+		Configs:     []importer.GameConfig{{Name: "video_scale_integer", Value: "false"}},
+	}
+	assert.Nil(t, database.StoreImported([]importer.Console{console}, []importer.Game{game}, []importer.Tool{}))
+
+	platform, err := buildbot.DetectPlatform(configuration.BuildbotPlatform)
+	assert.Nil(t, err)
+	corePath := filepath.Join(basePath, system.GetCorePath(&sqlite.Console{CoreLocation: console.CoreLocation}, &platform))
+	assert.Nil(t, os.MkdirAll(filepath.Dir(corePath), 0755))
+	assert.Nil(t, os.WriteFile(corePath, []byte("core"), 0644))
+	gamePath := filepath.Join(basePath, folder.ROMS, game.Slug)
+	assert.Nil(t, os.MkdirAll(gamePath, 0755))
+	assert.Nil(t, os.WriteFile(filepath.Join(gamePath, "readme.txt"), []byte("1"), 0644))
+	assert.Nil(t, os.WriteFile(filepath.Join(gamePath, "smw.sfc"), []byte("0"), 0644))
+	assert.Nil(t, os.WriteFile(filepath.Join(gamePath, "broken.sfc.bak"), []byte("2"), 0644))
+
+	launcherEngine, err := launcher.NewLauncherEngine(database, configuration)
+	assert.Nil(t, err)
+	waitGroup := sync.WaitGroup{}
+	waitGroup.Add(1)
+	launcherEngine.Initialize(&waitGroup)
+	waitGroup.Wait()
+	return launcherEngine, configuration
+}
+
+// Collect the log lines streamed from both the RetroArch outputs
+type testLogs struct {
+	lines []string
+	lock  sync.Mutex
+}
+
+func (logs *testLogs) handle(line string) {
+	logs.lock.Lock()
+	defer logs.lock.Unlock()
+	logs.lines = append(logs.lines, line)
+}
+
+func (logs *testLogs) String() string {
+	logs.lock.Lock()
+	defer logs.lock.Unlock()
+	return strings.Join(logs.lines, "\n")
+}
+
+func TestLaunch(t *testing.T) {
+	launcherEngine, configuration := newTestLauncherEngine(t, nil)
+	logs := testLogs{}
+	process, err := launcherEngine.Launch("super_mario_world", launcher.LaunchOptions{LogHandler: logs.handle})
+	assert.Nil(t, err)
+	_, err = launcherEngine.Launch("super_mario_world", launcher.LaunchOptions{})
+	assert.Equal(t, launcher.ErrGameRunning, err)
+
+	exitCode, err := process.Wait()
+	assert.Nil(t, err)
+	assert.Equal(t, 0, exitCode)
+	assert.Nil(t, launcherEngine.GetRunningGame())
+	assert.Equal(t, "-L", process.Arguments[0])
+	assert.Equal(t, filepath.Join(configuration.BasePath, folder.ROMS, "super_mario_world", "smw.sfc"), process.Arguments[len(process.Arguments)-1])
+	output := logs.String()
+	assert.Contains(t, output, "--appendconfig")
+	assert.Contains(t, output, `video_scale_integer = "false"`)
+	assert.Contains(t, output, "core_options_path")
+	coreOptions, err := os.ReadFile(filepath.Join(configuration.BasePath, folder.SYSTEM, launcher.GAME_CONFIG_FOLDER, "super_mario_world.opt"))
+	assert.Nil(t, err)
+	assert.Contains(t, string(coreOptions), `snes9x_overclock = "disabled"`)
+}
+
+func TestLaunchMissingBios(t *testing.T) {
+	addBios := func(configuration *configloader.Config, console *importer.Console) {
+		console.Plugins = []importer.ConsolePlugin{{
+			Type:   plugins.BIOS,
+			Hashes: []importer.ConsolePluginHash{{Path: "snes/bios.bin", Sha256: strings.Repeat("0", 64), Required: true}},
+		}}
+	}
+	launcherEngine, _ := newCustomTestLauncherEngine(t, addBios, nil)
+	_, err := launcherEngine.Launch("super_mario_world", launcher.LaunchOptions{})
+	assert.ErrorIs(t, err, system.ErrMissingBios)
+	assert.Nil(t, launcherEngine.GetRunningGame())
+
+	launcherEngine, _ = newCustomTestLauncherEngine(t, func(configuration *configloader.Config, console *importer.Console) {
+		addBios(configuration, console)
+		configuration.MissingBiosPolicy = launcher.MISSING_BIOS_WARN
+	}, nil)
+	process, err := launcherEngine.Launch("super_mario_world", launcher.LaunchOptions{})
+	assert.Nil(t, err)
+	exitCode, err := process.Wait()
+	assert.Nil(t, err)
+	assert.Equal(t, 0, exitCode)
+}
+
+func TestLaunchExecutableExitStatus(t *testing.T) {
+	executable := "readme.txt"
+	launcherEngine, _ := newTestLauncherEngine(t, &executable)
+	process, err := launcherEngine.Launch("super_mario_world", launcher.LaunchOptions{})
+	assert.Nil(t, err)
+	exitCode, err := process.Wait()
+	assert.Nil(t, err)
+	assert.Equal(t, 1, exitCode)
+}
+
+func TestLaunchExecutableOutsideGame(t *testing.T) {
+	executable := "../../retroarch"
+	launcherEngine, _ := newTestLauncherEngine(t, &executable)
+	_, err := launcherEngine.Launch("super_mario_world", launcher.LaunchOptions{})
+	assert.NotNil(t, err)
+}
+
+func TestLaunchNetplay(t *testing.T) {
+	launcherEngine, _ := newTestLauncherEngine(t, nil)
+	logs := testLogs{}
+	process, err := launcherEngine.Launch("super_mario_world", launcher.LaunchOptions{
+		Netplay: &network.NetplaySession{
+			Host:     "192.168.1.2",
+			Port:     network.NETPLAY_DEFAULT_PORT,
+			Password: "secret",
+			Nickname: "bob",
+		},
+		LogHandler: logs.handle,
+	})
+	assert.Nil(t, err)
+	_, err = process.Wait()
+	assert.Nil(t, err)
+	assert.Contains(t, process.Arguments, "--connect")
+	assert.Contains(t, logs.String(), `netplay_password = "secret"`)
+}
+
+func TestLaunchUnknownGame(t *testing.T) {
+	launcherEngine, _ := newTestLauncherEngine(t, nil)
+	_, err := launcherEngine.Launch("unknown", launcher.LaunchOptions{})
+	assert.NotNil(t, err)
+}
+
+func TestLaunchPlaylist(t *testing.T) {
+	firstImage, secondImage := "https://example.com/disc1.png", "https://example.com/disc2.png"
+	launcherEngine, configuration := newTestLauncherEngine(t, nil,
+		importer.GameDisk{DiskNumber: 0, Url: "https://example.com/disc1.zip", Image: &firstImage},
+		importer.GameDisk{DiskNumber: 1, Url: "https://example.com/disc2.zip", Image: &secondImage},
+	)
+	playlistPath := filepath.Join(configuration.BasePath, folder.ROMS, "super_mario_world", "super_mario_world.m3u")
+	assert.Nil(t, os.WriteFile(playlistPath, []byte("smw.sfc\nsmw.sfc\n"), 0644))
+
+	disks, err := launcherEngine.GetGameDisks("super_mario_world")
+	assert.Nil(t, err)
+	assert.Equal(t, []launcher.GameDiskImage{{DiskNumber: 0, Image: firstImage}, {DiskNumber: 1, Image: secondImage}}, disks)
+
+	logs := testLogs{}
+	insertedDisks := make(chan launcher.GameDiskImage, 1)
+	process, err := launcherEngine.Launch("super_mario_world", launcher.LaunchOptions{
+		LogHandler:  logs.handle,
+		DiskHandler: func(disk launcher.GameDiskImage) { insertedDisks <- disk },
+	})
+	assert.Nil(t, err)
+	currentDisk, ok := process.GetCurrentDisk()
+	assert.True(t, ok)
+	assert.Equal(t, uint(0), currentDisk.DiskNumber)
+	exitCode, err := process.Wait()
+	assert.Nil(t, err)
+	assert.Equal(t, 0, exitCode)
+	assert.Equal(t, playlistPath, process.Arguments[len(process.Arguments)-1])
+	assert.Contains(t, logs.String(), `input_disk_next = "`+launcher.DISK_NEXT_KEY+`"`)
+	assert.Contains(t, logs.String(), "log_verbosity = true")
+	assert.Equal(t, secondImage, (<-insertedDisks).Image)
+	currentDisk, _ = process.GetCurrentDisk()
+	assert.Equal(t, uint(1), currentDisk.DiskNumber)
+}
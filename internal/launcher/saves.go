@@ -0,0 +1,314 @@
+package launcher
+
+import (
+	"archive/zip"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"arkhive.dev/launcher/internal/archive"
+	"arkhive.dev/launcher/internal/folder"
+	"github.com/sirupsen/logrus"
+)
+
+// Folders of the game saves, inside the game saves folder
+const (
+	SAVE_FILES_FOLDER   = "savefiles"
+	SAVE_STATES_FOLDER  = "savestates"
+	SAVE_BACKUPS_FOLDER = "backups"
+)
+
+// Number of save backups kept for every game
+const SAVE_BACKUPS_COUNT = 10
+
+// Maximum extracted size of an imported saves archive
+const SAVE_IMPORT_SIZE_LIMIT = 512 * 1024 * 1024
+
+const saveBackupTimeLayout = "20060102-150405.000000"
+
+var ErrInvalidSave = errors.New("invalid save name")
+
+type SaveType int
+
+const (
+	SAVE_FILE SaveType = iota
+	SAVE_STATE
+)
+
+// A save file or savestate of a game
+type Save struct {
+	// Slash separated path relative to the game saves folder
+	Name    string
+	Type    SaveType
+	Size    int64
+	ModTime time.Time
+}
+
+// A copy of the game saves taken before a launch, an import or a deletion
+type SaveBackup struct {
+	Name string
+	Date time.Time
+}
+
+// The folder of the game save files, savestates and save backups
+func (launcherEngine *LauncherEngine) GetSavesPath(gameSlug string) string {
+	return filepath.Join(launcherEngine.basePath, folder.SAVES, gameSlug)
+}
+
+// List the save files and savestates of the game
+func (launcherEngine *LauncherEngine) ListSaves(gameSlug string) (saves []Save, err error) {
+	savesPath := launcherEngine.GetSavesPath(gameSlug)
+	for saveType, saveFolder := range []string{SAVE_FILES_FOLDER, SAVE_STATES_FOLDER} {
+		err = filepath.WalkDir(filepath.Join(savesPath, saveFolder), func(filePath string, entry os.DirEntry, err error) error {
+			if errors.Is(err, os.ErrNotExist) {
+				return filepath.SkipDir
+			} else if err != nil || entry.IsDir() {
+				return err
+			}
+			info, err := entry.Info()
+			if err != nil {
+				return err
+			}
+			relativePath, err := filepath.Rel(savesPath, filePath)
+			if err != nil {
+				return err
+			}
+			saves = append(saves, Save{
+				Name:    filepath.ToSlash(relativePath),
+				Type:    SaveType(saveType),
+				Size:    info.Size(),
+				ModTime: info.ModTime(),
+			})
+			return nil
+		})
+		if err != nil {
+			return
+		}
+	}
+	return
+}
+
+// Write the save files and savestates of the game in a zip archive
+func (launcherEngine *LauncherEngine) ExportSaves(gameSlug string, archivePath string) (err error) {
+	var saves []Save
+	if saves, err = launcherEngine.ListSaves(gameSlug); err != nil {
+		return
+	}
+	var file *os.File
+	if file, err = os.Create(archivePath); err != nil {
+		return
+	}
+	defer file.Close()
+	writer := zip.NewWriter(file)
+	for _, save := range saves {
+		if err = addZipFile(writer, filepath.Join(launcherEngine.GetSavesPath(gameSlug), filepath.FromSlash(save.Name)), save.Name); err != nil {
+			return
+		}
+	}
+	if err = writer.Close(); err != nil {
+		return
+	}
+	return file.Close()
+}
+
+func addZipFile(writer *zip.Writer, filePath string, name string) (err error) {
+	var file *os.File
+	if file, err = os.Open(filePath); err != nil {
+		return
+	}
+	defer file.Close()
+	var fileWriter io.Writer
+	if fileWriter, err = writer.Create(name); err != nil {
+		return
+	}
+	_, err = io.Copy(fileWriter, file)
+	return
+}
+
+/*
+Import the saves archive exported by arkHive, replacing the game saves with the same name.
+
+The current saves are backed up first. Only the save files and savestates folders of the
+archive are imported.
+*/
+func (launcherEngine *LauncherEngine) ImportSaves(gameSlug string, archivePath string) (err error) {
+	if err = launcherEngine.checkNotRunning(gameSlug); err != nil {
+		return
+	}
+	tempPath := filepath.Join(launcherEngine.basePath, folder.TEMP)
+	if err = os.MkdirAll(tempPath, 0755); err != nil {
+		return
+	}
+	var extractionPath string
+	if extractionPath, err = os.MkdirTemp(tempPath, "saves"); err != nil {
+		return
+	}
+	defer os.RemoveAll(extractionPath)
+	if err = archive.Extract(archivePath, extractionPath, archive.Options{MaxSize: SAVE_IMPORT_SIZE_LIMIT}); err != nil {
+		return
+	}
+	var entries []os.DirEntry
+	if entries, err = os.ReadDir(extractionPath); err != nil {
+		return
+	}
+	for _, entry := range entries {
+		if !entry.IsDir() || (entry.Name() != SAVE_FILES_FOLDER && entry.Name() != SAVE_STATES_FOLDER) {
+			return fmt.Errorf("%w: %s", ErrInvalidSave, entry.Name())
+		}
+	}
+	if _, err = launcherEngine.BackupSaves(gameSlug); err != nil {
+		return
+	}
+	savesPath := launcherEngine.GetSavesPath(gameSlug)
+	for _, entry := range entries {
+		if err = folder.CopyFolder(filepath.Join(extractionPath, entry.Name()), filepath.Join(savesPath, entry.Name())); err != nil {
+			return
+		}
+	}
+	logrus.Infof("%s: Saves imported", gameSlug)
+	return
+}
+
+// Delete the save file or savestate of the game, backing up the saves first
+func (launcherEngine *LauncherEngine) DeleteSave(gameSlug string, name string) (err error) {
+	if err = launcherEngine.checkNotRunning(gameSlug); err != nil {
+		return
+	}
+	name = path.Clean(name)
+	if err = checkSaveName(name); err != nil {
+		return
+	}
+	savePath := filepath.Join(launcherEngine.GetSavesPath(gameSlug), filepath.FromSlash(name))
+	if _, err = os.Stat(savePath); err != nil {
+		return
+	}
+	if _, err = launcherEngine.BackupSaves(gameSlug); err != nil {
+		return
+	}
+	return os.Remove(savePath)
+}
+
+/*
+Copy the save files and savestates of the game in a new backup, removing the oldest
+backups beyond the kept count. No backup is taken when the game has no saves.
+*/
+func (launcherEngine *LauncherEngine) BackupSaves(gameSlug string) (backup SaveBackup, err error) {
+	var saves []Save
+	if saves, err = launcherEngine.ListSaves(gameSlug); err != nil || len(saves) == 0 {
+		return
+	}
+	backup.Date = time.Now().UTC()
+	backup.Name = backup.Date.Format(saveBackupTimeLayout)
+	savesPath := launcherEngine.GetSavesPath(gameSlug)
+	backupPath := filepath.Join(savesPath, SAVE_BACKUPS_FOLDER, backup.Name)
+	for _, save := range saves {
+		destinationPath := filepath.Join(backupPath, filepath.FromSlash(save.Name))
+		if err = os.MkdirAll(filepath.Dir(destinationPath), 0755); err != nil {
+			return
+		}
+		if err = folder.CopyFile(filepath.Join(savesPath, filepath.FromSlash(save.Name)), destinationPath); err != nil {
+			return
+		}
+	}
+	var backups []SaveBackup
+	if backups, err = launcherEngine.ListSaveBackups(gameSlug); err != nil {
+		return
+	}
+	for len(backups) > SAVE_BACKUPS_COUNT {
+		if err = os.RemoveAll(filepath.Join(savesPath, SAVE_BACKUPS_FOLDER, backups[0].Name)); err != nil {
+			return
+		}
+		backups = backups[1:]
+	}
+	return
+}
+
+// List the save backups of the game, from the oldest
+func (launcherEngine *LauncherEngine) ListSaveBackups(gameSlug string) (backups []SaveBackup, err error) {
+	var entries []os.DirEntry
+	entries, err = os.ReadDir(filepath.Join(launcherEngine.GetSavesPath(gameSlug), SAVE_BACKUPS_FOLDER))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return
+	}
+	for _, entry := range entries {
+		date, parseErr := time.Parse(saveBackupTimeLayout, entry.Name())
+		if !entry.IsDir() || parseErr != nil {
+			continue
+		}
+		backups = append(backups, SaveBackup{Name: entry.Name(), Date: date})
+	}
+	sort.Slice(backups, func(i, j int) bool {
+		return backups[i].Date.Before(backups[j].Date)
+	})
+	return
+}
+
+/*
+Replace the game saves with the backup ones, backing up the current saves first.
+
+The backup is copied aside before, as backing up the current saves may remove it when
+it's the oldest one.
+*/
+func (launcherEngine *LauncherEngine) RestoreSaveBackup(gameSlug string, name string) (err error) {
+	if err = launcherEngine.checkNotRunning(gameSlug); err != nil {
+		return
+	}
+	if _, err = time.Parse(saveBackupTimeLayout, name); err != nil {
+		return fmt.Errorf("%w: %s", ErrInvalidSave, name)
+	}
+	savesPath := launcherEngine.GetSavesPath(gameSlug)
+	backupPath := filepath.Join(savesPath, SAVE_BACKUPS_FOLDER, name)
+	if _, err = os.Stat(backupPath); err != nil {
+		return
+	}
+	// The temporary folder name is not a backup one, so it's never listed nor removed as a backup
+	var restorePath string
+	if restorePath, err = os.MkdirTemp(filepath.Join(savesPath, SAVE_BACKUPS_FOLDER), "restore-"); err != nil {
+		return
+	}
+	defer os.RemoveAll(restorePath)
+	if err = folder.CopyFolder(backupPath, restorePath); err != nil {
+		return
+	}
+	if _, err = launcherEngine.BackupSaves(gameSlug); err != nil {
+		return
+	}
+	for _, saveFolder := range []string{SAVE_FILES_FOLDER, SAVE_STATES_FOLDER} {
+		if err = os.RemoveAll(filepath.Join(savesPath, saveFolder)); err != nil {
+			return
+		}
+		// The backup has no folder when the game had no saves of its type
+		if _, err = os.Stat(filepath.Join(restorePath, saveFolder)); errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err = folder.CopyFolder(filepath.Join(restorePath, saveFolder), filepath.Join(savesPath, saveFolder)); err != nil {
+			return
+		}
+	}
+	return nil
+}
+
+// Fail if the name is not a file inside the save files or savestates folders
+func checkSaveName(name string) error {
+	saveFolder, _, _ := strings.Cut(name, "/")
+	if path.Clean(name) != name || !filepath.IsLocal(filepath.FromSlash(name)) || (saveFolder != SAVE_FILES_FOLDER && saveFolder != SAVE_STATES_FOLDER) || saveFolder == name {
+		return fmt.Errorf("%w: %s", ErrInvalidSave, name)
+	}
+	return nil
+}
+
+// Fail if the game is running, as RetroArch may write its saves
+func (launcherEngine *LauncherEngine) checkNotRunning(gameSlug string) error {
+	if process := launcherEngine.GetRunningGame(); process != nil && process.GameSlug == gameSlug {
+		return ErrGameRunning
+	}
+	return nil
+}
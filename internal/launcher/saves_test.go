@@ -0,0 +1,121 @@
+package launcher_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"arkhive.dev/launcher/internal/launcher"
+	"github.com/stretchr/testify/assert"
+)
+
+func writeTestSave(t *testing.T, launcherEngine *launcher.LauncherEngine, name string, data string) {
+	savePath := filepath.Join(launcherEngine.GetSavesPath("super_mario_world"), filepath.FromSlash(name))
+	assert.Nil(t, os.MkdirAll(filepath.Dir(savePath), 0755))
+	assert.Nil(t, os.WriteFile(savePath, []byte(data), 0644))
+}
+
+func TestLaunchSaves(t *testing.T) {
+	launcherEngine, _ := newTestLauncherEngine(t, nil)
+	logs := testLogs{}
+	process, err := launcherEngine.Launch("super_mario_world", launcher.LaunchOptions{LogHandler: logs.handle})
+	assert.Nil(t, err)
+	_, err = process.Wait()
+	assert.Nil(t, err)
+	savesPath := launcherEngine.GetSavesPath("super_mario_world")
+	assert.Contains(t, logs.String(), filepath.Join(savesPath, launcher.SAVE_FILES_FOLDER))
+	assert.Contains(t, logs.String(), filepath.Join(savesPath, launcher.SAVE_STATES_FOLDER))
+	backups, err := launcherEngine.ListSaveBackups("super_mario_world")
+	assert.Nil(t, err)
+	assert.Empty(t, backups)
+
+	writeTestSave(t, launcherEngine, "savefiles/smw.srm", "save")
+	process, err = launcherEngine.Launch("super_mario_world", launcher.LaunchOptions{})
+	assert.Nil(t, err)
+	_, err = process.Wait()
+	assert.Nil(t, err)
+	backups, err = launcherEngine.ListSaveBackups("super_mario_world")
+	assert.Nil(t, err)
+	if assert.Len(t, backups, 1) {
+		backup, err := os.ReadFile(filepath.Join(savesPath, launcher.SAVE_BACKUPS_FOLDER, backups[0].Name, "savefiles", "smw.srm"))
+		assert.Nil(t, err)
+		assert.Equal(t, "save", string(backup))
+	}
+}
+
+func TestSaveBackupsCount(t *testing.T) {
+	launcherEngine, _ := newTestLauncherEngine(t, nil)
+	writeTestSave(t, launcherEngine, "savestates/smw.state", "state")
+	for i := 0; i < launcher.SAVE_BACKUPS_COUNT+2; i++ {
+		_, err := launcherEngine.BackupSaves("super_mario_world")
+		assert.Nil(t, err)
+	}
+	backups, err := launcherEngine.ListSaveBackups("super_mario_world")
+	assert.Nil(t, err)
+	assert.Len(t, backups, launcher.SAVE_BACKUPS_COUNT)
+}
+
+func TestRestoreOldestSaveBackup(t *testing.T) {
+	launcherEngine, _ := newTestLauncherEngine(t, nil)
+	writeTestSave(t, launcherEngine, "savefiles/smw.srm", "first")
+	_, err := launcherEngine.BackupSaves("super_mario_world")
+	assert.Nil(t, err)
+	writeTestSave(t, launcherEngine, "savefiles/smw.srm", "last")
+	for i := 1; i < launcher.SAVE_BACKUPS_COUNT; i++ {
+		_, err = launcherEngine.BackupSaves("super_mario_world")
+		assert.Nil(t, err)
+	}
+	backups, err := launcherEngine.ListSaveBackups("super_mario_world")
+	assert.Nil(t, err)
+	assert.Len(t, backups, launcher.SAVE_BACKUPS_COUNT)
+
+	// Backing up the current saves removes the restored backup, the oldest one
+	assert.Nil(t, launcherEngine.RestoreSaveBackup("super_mario_world", backups[0].Name))
+	save, err := os.ReadFile(filepath.Join(launcherEngine.GetSavesPath("super_mario_world"), "savefiles", "smw.srm"))
+	assert.Nil(t, err)
+	assert.Equal(t, "first", string(save))
+	backups, err = launcherEngine.ListSaveBackups("super_mario_world")
+	assert.Nil(t, err)
+	assert.Len(t, backups, launcher.SAVE_BACKUPS_COUNT)
+}
+
+func TestExportImportSaves(t *testing.T) {
+	launcherEngine, _ := newTestLauncherEngine(t, nil)
+	writeTestSave(t, launcherEngine, "savefiles/smw.srm", "save")
+	writeTestSave(t, launcherEngine, "savestates/smw.state1", "state")
+	archivePath := filepath.Join(t.TempDir(), "saves.zip")
+	assert.Nil(t, launcherEngine.ExportSaves("super_mario_world", archivePath))
+
+	assert.Nil(t, launcherEngine.DeleteSave("super_mario_world", "savestates/smw.state1"))
+	writeTestSave(t, launcherEngine, "savefiles/smw.srm", "overwritten")
+	saves, err := launcherEngine.ListSaves("super_mario_world")
+	assert.Nil(t, err)
+	assert.Len(t, saves, 1)
+
+	assert.Nil(t, launcherEngine.ImportSaves("super_mario_world", archivePath))
+	saves, err = launcherEngine.ListSaves("super_mario_world")
+	assert.Nil(t, err)
+	if assert.Len(t, saves, 2) {
+		assert.Equal(t, "savefiles/smw.srm", saves[0].Name)
+		assert.Equal(t, launcher.SAVE_FILE, saves[0].Type)
+		assert.Equal(t, int64(len("save")), saves[0].Size)
+		assert.Equal(t, "savestates/smw.state1", saves[1].Name)
+		assert.Equal(t, launcher.SAVE_STATE, saves[1].Type)
+	}
+	// The deletion and the import are backed up
+	backups, err := launcherEngine.ListSaveBackups("super_mario_world")
+	assert.Nil(t, err)
+	assert.Len(t, backups, 2)
+
+	assert.Nil(t, launcherEngine.RestoreSaveBackup("super_mario_world", backups[1].Name))
+	save, err := os.ReadFile(filepath.Join(launcherEngine.GetSavesPath("super_mario_world"), "savefiles", "smw.srm"))
+	assert.Nil(t, err)
+	assert.Equal(t, "overwritten", string(save))
+}
+
+func TestDeleteSaveInvalidName(t *testing.T) {
+	launcherEngine, _ := newTestLauncherEngine(t, nil)
+	for _, name := range []string{"../../games/super_mario_world/smw.sfc", "backups", "savefiles", "other/smw.srm"} {
+		assert.ErrorIs(t, launcherEngine.DeleteSave("super_mario_world", name), launcher.ErrInvalidSave)
+	}
+}
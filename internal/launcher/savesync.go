@@ -0,0 +1,589 @@
+package launcher
+
+import (
+	"bytes"
+	"context"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"arkhive.dev/launcher/internal/network/resources"
+	"arkhive.dev/launcher/pkg/encryption"
+	"github.com/sirupsen/logrus"
+)
+
+// File of the last synchronized saves versions, inside the game saves folder
+const SAVE_SYNC_STATE_FILE = "sync.json"
+
+// Name of the saves manifest object, inside the game objects of the backend
+const SAVE_MANIFEST_OBJECT = "manifest"
+
+var ErrSaveNotInConflict = errors.New("the save is not in conflict")
+var ErrSaveManifestRollback = errors.New("the saves manifest is older than the last synchronized one")
+
+/*
+Storage of the encrypted save objects, addressed by slash separated keys.
+
+Reading a missing object fails with os.ErrNotExist.
+*/
+type SaveSyncBackend interface {
+	Read(key string) ([]byte, error)
+	Write(key string, data []byte) error
+	Delete(key string) error
+}
+
+// The saves synchronization of the account through a backend
+type SaveSync struct {
+	Backend SaveSyncBackend
+	// Account key encrypting the objects, shared by the devices of the account
+	PrivateKey *rsa.PrivateKey
+	// Name of the device, shown in the conflicts
+	Device string
+}
+
+// A version of a save, the zero version if the save doesn't exist
+type SaveVersion struct {
+	// Hex SHA-256 checksum of the save
+	Hash    string    `json:"hash"`
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"mod_time"`
+	// Device that wrote the version, set only for the remote versions
+	Device string `json:"device,omitempty"`
+}
+
+// Whether the version is a deleted or never written save
+func (version *SaveVersion) IsDeleted() bool {
+	return version.Hash == ""
+}
+
+// A save changed both locally and remotely since the last synchronization
+type SaveConflict struct {
+	Name   string
+	Local  SaveVersion
+	Remote SaveVersion
+}
+
+type SaveVersionChoice int
+
+const (
+	KEEP_LOCAL_SAVE SaveVersionChoice = iota
+	KEEP_REMOTE_SAVE
+)
+
+// Outcome of a saves synchronization, listing the save names of every change
+type SaveSyncReport struct {
+	Uploaded      []string
+	Downloaded    []string
+	DeletedLocal  []string
+	DeletedRemote []string
+	// Saves left untouched until a version is chosen
+	Conflicts []SaveConflict
+}
+
+// The game saves versions of the backend, encrypted in the manifest object
+type saveManifest struct {
+	// Increased on every write, so that a previous manifest can't be served again
+	Version uint64                 `json:"version"`
+	Saves   map[string]SaveVersion `json:"saves"`
+}
+
+// The saves versions and the manifest version of the last synchronization, stored in the sync file
+type saveSyncState struct {
+	ManifestVersion uint64                 `json:"manifest_version"`
+	Saves           map[string]SaveVersion `json:"saves"`
+}
+
+/*
+The manifest signed with the account key. The envelope is encrypted with the public
+key, so the sign proves the manifest was written by a device of the account.
+*/
+type signedSaveManifest struct {
+	Manifest []byte `json:"manifest"`
+	Sign     []byte `json:"sign"`
+}
+
+/*
+Synchronize the game saves with the backend.
+
+Every save is compared by checksum with its version of the last synchronization: the
+saves changed only locally are uploaded, the ones changed only remotely are downloaded,
+backing up the local saves first, and the deletions are propagated the same way. The
+saves changed on both sides are reported as conflicts, resolved choosing a version with
+ResolveSaveConflict. The checksum of the last synchronization is reused while the size
+and the modification time of the save are unchanged.
+*/
+func (launcherEngine *LauncherEngine) SyncSaves(gameSlug string, saveSync *SaveSync) (report SaveSyncReport, err error) {
+	if err = launcherEngine.checkNotRunning(gameSlug); err != nil {
+		return
+	}
+	var state saveSyncState
+	if state, err = launcherEngine.readSaveSyncState(gameSlug); err != nil {
+		return
+	}
+	var local map[string]SaveVersion
+	if local, err = launcherEngine.getLocalSaveVersions(gameSlug, state.Saves); err != nil {
+		return
+	}
+	var manifest saveManifest
+	if manifest, err = saveSync.readManifest(gameSlug, state.ManifestVersion); err != nil {
+		return
+	}
+	state.ManifestVersion = manifest.Version
+	names := map[string]bool{}
+	for _, versions := range []map[string]SaveVersion{local, manifest.Saves, state.Saves} {
+		for name := range versions {
+			names[name] = true
+		}
+	}
+	var sortedNames []string
+	for name := range names {
+		sortedNames = append(sortedNames, name)
+	}
+	sort.Strings(sortedNames)
+
+	backedUp := false
+	manifestChanged := false
+	var replacedHashes []string
+	for _, name := range sortedNames {
+		localVersion, remoteVersion, syncedVersion := local[name], manifest.Saves[name], state.Saves[name]
+		switch {
+		case localVersion.Hash == remoteVersion.Hash:
+			syncedVersion = localVersion
+		case remoteVersion.Hash == syncedVersion.Hash:
+			if localVersion.IsDeleted() {
+				delete(manifest.Saves, name)
+				report.DeletedRemote = append(report.DeletedRemote, name)
+			} else {
+				if err = launcherEngine.uploadSave(gameSlug, saveSync, name, localVersion); err != nil {
+					return
+				}
+				manifest.Saves[name] = SaveVersion{Hash: localVersion.Hash, Size: localVersion.Size, ModTime: localVersion.ModTime, Device: saveSync.Device}
+				report.Uploaded = append(report.Uploaded, name)
+			}
+			manifestChanged = true
+			replacedHashes = append(replacedHashes, remoteVersion.Hash)
+			syncedVersion = localVersion
+		case localVersion.Hash == syncedVersion.Hash:
+			if !backedUp {
+				if _, err = launcherEngine.BackupSaves(gameSlug); err != nil {
+					return
+				}
+				backedUp = true
+			}
+			if remoteVersion.IsDeleted() {
+				if err = os.Remove(filepath.Join(launcherEngine.GetSavesPath(gameSlug), filepath.FromSlash(name))); err != nil {
+					return
+				}
+				report.DeletedLocal = append(report.DeletedLocal, name)
+			} else {
+				if err = launcherEngine.downloadSave(gameSlug, saveSync, name, remoteVersion); err != nil {
+					return
+				}
+				report.Downloaded = append(report.Downloaded, name)
+			}
+			syncedVersion = remoteVersion
+		default:
+			report.Conflicts = append(report.Conflicts, SaveConflict{Name: name, Local: localVersion, Remote: remoteVersion})
+			continue
+		}
+		setSyncedVersion(state.Saves, name, syncedVersion)
+	}
+	if manifestChanged {
+		if state.ManifestVersion, err = saveSync.writeManifest(gameSlug, manifest); err != nil {
+			return
+		}
+		saveSync.deleteUnreferencedObjects(gameSlug, manifest, replacedHashes)
+	}
+	if err = launcherEngine.writeSaveSyncState(gameSlug, state); err != nil {
+		return
+	}
+	logrus.Infof("%s: Saves synchronized, %d uploaded, %d downloaded, %d conflicts", gameSlug,
+		len(report.Uploaded)+len(report.DeletedRemote), len(report.Downloaded)+len(report.DeletedLocal), len(report.Conflicts))
+	return
+}
+
+/*
+Resolve the conflict of the save keeping the chosen version on both sides.
+
+The remote version replaces the local one after backing up the local saves, the local
+version replaces the remote one. Fails with ErrSaveNotInConflict if the save is not
+changed on both sides since the last synchronization.
+*/
+func (launcherEngine *LauncherEngine) ResolveSaveConflict(gameSlug string, saveSync *SaveSync, name string, choice SaveVersionChoice) (err error) {
+	if err = launcherEngine.checkNotRunning(gameSlug); err != nil {
+		return
+	}
+	if err = checkSaveName(name); err != nil {
+		return
+	}
+	var state saveSyncState
+	if state, err = launcherEngine.readSaveSyncState(gameSlug); err != nil {
+		return
+	}
+	var local map[string]SaveVersion
+	if local, err = launcherEngine.getLocalSaveVersions(gameSlug, state.Saves); err != nil {
+		return
+	}
+	var manifest saveManifest
+	if manifest, err = saveSync.readManifest(gameSlug, state.ManifestVersion); err != nil {
+		return
+	}
+	state.ManifestVersion = manifest.Version
+	localVersion, remoteVersion, syncedVersion := local[name], manifest.Saves[name], state.Saves[name]
+	if localVersion.Hash == remoteVersion.Hash || localVersion.Hash == syncedVersion.Hash || remoteVersion.Hash == syncedVersion.Hash {
+		return fmt.Errorf("%w: %s", ErrSaveNotInConflict, name)
+	}
+	keptVersion := remoteVersion
+	switch choice {
+	case KEEP_LOCAL_SAVE:
+		keptVersion = localVersion
+		if localVersion.IsDeleted() {
+			delete(manifest.Saves, name)
+		} else {
+			if err = launcherEngine.uploadSave(gameSlug, saveSync, name, localVersion); err != nil {
+				return
+			}
+			manifest.Saves[name] = SaveVersion{Hash: localVersion.Hash, Size: localVersion.Size, ModTime: localVersion.ModTime, Device: saveSync.Device}
+		}
+		if state.ManifestVersion, err = saveSync.writeManifest(gameSlug, manifest); err != nil {
+			return
+		}
+		saveSync.deleteUnreferencedObjects(gameSlug, manifest, []string{remoteVersion.Hash})
+	case KEEP_REMOTE_SAVE:
+		if _, err = launcherEngine.BackupSaves(gameSlug); err != nil {
+			return
+		}
+		if remoteVersion.IsDeleted() {
+			err = os.Remove(filepath.Join(launcherEngine.GetSavesPath(gameSlug), filepath.FromSlash(name)))
+		} else {
+			err = launcherEngine.downloadSave(gameSlug, saveSync, name, remoteVersion)
+		}
+		if err != nil {
+			return
+		}
+	default:
+		return fmt.Errorf("unknown save version choice %d", choice)
+	}
+	setSyncedVersion(state.Saves, name, keptVersion)
+	if err = launcherEngine.writeSaveSyncState(gameSlug, state); err != nil {
+		return
+	}
+	logrus.Infof("%s: Save %s conflict resolved", gameSlug, name)
+	return
+}
+
+// The versions of the local saves, hashing the saves changed since the last synchronization
+func (launcherEngine *LauncherEngine) getLocalSaveVersions(gameSlug string, state map[string]SaveVersion) (versions map[string]SaveVersion, err error) {
+	var saves []Save
+	if saves, err = launcherEngine.ListSaves(gameSlug); err != nil {
+		return
+	}
+	versions = map[string]SaveVersion{}
+	for _, save := range saves {
+		version := SaveVersion{Size: save.Size, ModTime: save.ModTime.UTC()}
+		if synced, ok := state[save.Name]; ok && synced.Size == version.Size && synced.ModTime.Equal(version.ModTime) {
+			version.Hash = synced.Hash
+		} else if version.Hash, err = resources.FileSha256(filepath.Join(launcherEngine.GetSavesPath(gameSlug), filepath.FromSlash(save.Name))); err != nil {
+			return
+		}
+		versions[save.Name] = version
+	}
+	return
+}
+
+func (launcherEngine *LauncherEngine) uploadSave(gameSlug string, saveSync *SaveSync, name string, version SaveVersion) (err error) {
+	var data []byte
+	if data, err = os.ReadFile(filepath.Join(launcherEngine.GetSavesPath(gameSlug), filepath.FromSlash(name))); err != nil {
+		return
+	}
+	if hash := sha256.Sum256(data); hex.EncodeToString(hash[:]) != version.Hash {
+		return fmt.Errorf("the save %s changed while synchronizing", name)
+	}
+	return saveSync.writeObject(path.Join(gameSlug, version.Hash), data)
+}
+
+// Download the remote version of the save, keeping its modification time
+func (launcherEngine *LauncherEngine) downloadSave(gameSlug string, saveSync *SaveSync, name string, version SaveVersion) (err error) {
+	var data []byte
+	if data, err = saveSync.readObject(path.Join(gameSlug, version.Hash)); err != nil {
+		return
+	}
+	if hash := sha256.Sum256(data); hex.EncodeToString(hash[:]) != version.Hash {
+		return fmt.Errorf("checksum mismatch of the remote save %s", name)
+	}
+	savePath := filepath.Join(launcherEngine.GetSavesPath(gameSlug), filepath.FromSlash(name))
+	if err = os.MkdirAll(filepath.Dir(savePath), 0755); err != nil {
+		return
+	}
+	if err = os.WriteFile(savePath, data, 0644); err != nil {
+		return
+	}
+	return os.Chtimes(savePath, version.ModTime, version.ModTime)
+}
+
+// Record the version both sides have, as written locally
+func setSyncedVersion(state map[string]SaveVersion, name string, version SaveVersion) {
+	if version.IsDeleted() {
+		delete(state, name)
+		return
+	}
+	version.Device = ""
+	state[name] = version
+}
+
+func (launcherEngine *LauncherEngine) readSaveSyncState(gameSlug string) (state saveSyncState, err error) {
+	var data []byte
+	data, err = os.ReadFile(filepath.Join(launcherEngine.GetSavesPath(gameSlug), SAVE_SYNC_STATE_FILE))
+	if errors.Is(err, os.ErrNotExist) {
+		err = nil
+	} else if err != nil {
+		return
+	} else if err = json.Unmarshal(data, &state); err != nil {
+		return
+	}
+	if state.Saves == nil {
+		state.Saves = map[string]SaveVersion{}
+	}
+	return
+}
+
+func (launcherEngine *LauncherEngine) writeSaveSyncState(gameSlug string, state saveSyncState) (err error) {
+	var data []byte
+	if data, err = json.Marshal(state); err != nil {
+		return
+	}
+	savesPath := launcherEngine.GetSavesPath(gameSlug)
+	if err = os.MkdirAll(savesPath, 0755); err != nil {
+		return
+	}
+	return os.WriteFile(filepath.Join(savesPath, SAVE_SYNC_STATE_FILE), data, 0644)
+}
+
+/*
+Read the game saves manifest, empty if the game was never synchronized.
+
+Fails with ErrSaveManifestRollback when the manifest is older than the last synchronized
+version, or missing after a synchronization, as the backend could serve a previous one.
+*/
+func (saveSync *SaveSync) readManifest(gameSlug string, lastVersion uint64) (manifest saveManifest, err error) {
+	var data []byte
+	data, err = saveSync.readObject(path.Join(gameSlug, SAVE_MANIFEST_OBJECT))
+	if errors.Is(err, os.ErrNotExist) && lastVersion == 0 {
+		return saveManifest{Saves: map[string]SaveVersion{}}, nil
+	} else if errors.Is(err, os.ErrNotExist) {
+		return manifest, fmt.Errorf("%w: the manifest is missing", ErrSaveManifestRollback)
+	} else if err != nil {
+		return
+	}
+	var signedManifest signedSaveManifest
+	if err = json.Unmarshal(data, &signedManifest); err != nil {
+		return
+	}
+	if len(signedManifest.Sign) == 0 {
+		return manifest, errors.New("the saves manifest is not signed")
+	}
+	if err = encryption.Verify(&saveSync.PrivateKey.PublicKey, signedManifest.Manifest, signedManifest.Sign); err != nil {
+		return manifest, fmt.Errorf("invalid sign of the saves manifest: %w", err)
+	}
+	if err = json.Unmarshal(signedManifest.Manifest, &manifest); err != nil {
+		return
+	}
+	if manifest.Version < lastVersion {
+		return manifest, fmt.Errorf("%w: version %d instead of %d", ErrSaveManifestRollback, manifest.Version, lastVersion)
+	}
+	if manifest.Saves == nil {
+		manifest.Saves = map[string]SaveVersion{}
+	}
+	for name, version := range manifest.Saves {
+		if err = checkSaveName(name); err != nil {
+			return
+		}
+		if hash, hashErr := hex.DecodeString(version.Hash); hashErr != nil || len(hash) != sha256.Size {
+			return manifest, fmt.Errorf("invalid checksum of the remote save %s", name)
+		}
+	}
+	return
+}
+
+// Write the manifest with the next version, returning it
+func (saveSync *SaveSync) writeManifest(gameSlug string, manifest saveManifest) (version uint64, err error) {
+	manifest.Version++
+	var signedManifest signedSaveManifest
+	if signedManifest.Manifest, err = json.Marshal(manifest); err != nil {
+		return
+	}
+	if signedManifest.Sign, err = encryption.Sign(saveSync.PrivateKey, signedManifest.Manifest); err != nil {
+		return
+	}
+	var data []byte
+	if data, err = json.Marshal(signedManifest); err != nil {
+		return
+	}
+	if err = saveSync.writeObject(path.Join(gameSlug, SAVE_MANIFEST_OBJECT), data); err != nil {
+		return
+	}
+	return manifest.Version, nil
+}
+
+// Delete the objects of the replaced versions no longer in the manifest, logging the failures
+func (saveSync *SaveSync) deleteUnreferencedObjects(gameSlug string, manifest saveManifest, hashes []string) {
+	referenced := map[string]bool{}
+	for _, version := range manifest.Saves {
+		referenced[version.Hash] = true
+	}
+	for _, hash := range hashes {
+		if hash == "" || referenced[hash] {
+			continue
+		}
+		if err := saveSync.Backend.Delete(path.Join(gameSlug, hash)); err != nil && !errors.Is(err, os.ErrNotExist) {
+			logrus.Errorf("%+v", err)
+		}
+	}
+}
+
+func (saveSync *SaveSync) readObject(key string) (data []byte, err error) {
+	var envelope []byte
+	if envelope, err = saveSync.Backend.Read(key); err != nil {
+		return
+	}
+	return encryption.DecryptEnvelope(saveSync.PrivateKey, envelope)
+}
+
+func (saveSync *SaveSync) writeObject(key string, data []byte) (err error) {
+	var envelope []byte
+	if envelope, err = encryption.EncryptEnvelope(&saveSync.PrivateKey.PublicKey, data); err != nil {
+		return
+	}
+	return saveSync.Backend.Write(key, envelope)
+}
+
+// Backend storing the save objects as files of a local or network folder
+type FolderSaveSyncBackend struct {
+	Path string
+}
+
+func (backend *FolderSaveSyncBackend) Read(key string) ([]byte, error) {
+	objectPath, err := backend.getObjectPath(key)
+	if err != nil {
+		return nil, err
+	}
+	return os.ReadFile(objectPath)
+}
+
+// Write the object to a temporary file renamed once complete
+func (backend *FolderSaveSyncBackend) Write(key string, data []byte) (err error) {
+	var objectPath string
+	if objectPath, err = backend.getObjectPath(key); err != nil {
+		return
+	}
+	if err = os.MkdirAll(filepath.Dir(objectPath), 0755); err != nil {
+		return
+	}
+	temporaryPath := objectPath + ".part"
+	if err = os.WriteFile(temporaryPath, data, 0644); err != nil {
+		return
+	}
+	return os.Rename(temporaryPath, objectPath)
+}
+
+func (backend *FolderSaveSyncBackend) Delete(key string) error {
+	objectPath, err := backend.getObjectPath(key)
+	if err != nil {
+		return err
+	}
+	return os.Remove(objectPath)
+}
+
+func (backend *FolderSaveSyncBackend) getObjectPath(key string) (string, error) {
+	if !filepath.IsLocal(filepath.FromSlash(key)) {
+		return "", fmt.Errorf("invalid save object key %q", key)
+	}
+	return filepath.Join(backend.Path, filepath.FromSlash(key)), nil
+}
+
+// Backend storing the save objects in a Storj bucket, under the key prefix
+type StorjSaveSyncBackend struct {
+	Bucket string
+	Prefix string
+	Access string
+	// Project opener, the uplink library is used when not set
+	OpenProject resources.StorjProjectOpener
+}
+
+// Create the Storj backend of the sj://bucket/prefix URL
+func NewStorjSaveSyncBackend(rawURL string, access string) (backend *StorjSaveSyncBackend, err error) {
+	var storjURL *url.URL
+	if storjURL, err = url.Parse(rawURL); err != nil {
+		return
+	}
+	if storjURL.Scheme != "sj" || storjURL.Host == "" {
+		return nil, fmt.Errorf("invalid Storj saves URL %q", rawURL)
+	}
+	return &StorjSaveSyncBackend{
+		Bucket: storjURL.Host,
+		Prefix: strings.Trim(storjURL.Path, "/"),
+		Access: access,
+	}, nil
+}
+
+func (backend *StorjSaveSyncBackend) Read(key string) (data []byte, err error) {
+	ctx := context.Background()
+	var project resources.StorjProject
+	if project, err = backend.openProject(ctx); err != nil {
+		return
+	}
+	defer project.Close()
+	var download io.ReadCloser
+	if download, err = project.DownloadObject(ctx, backend.Bucket, path.Join(backend.Prefix, key)); err != nil {
+		return
+	}
+	defer download.Close()
+	return io.ReadAll(download)
+}
+
+func (backend *StorjSaveSyncBackend) Write(key string, data []byte) (err error) {
+	ctx := context.Background()
+	var project resources.StorjProject
+	if project, err = backend.openProject(ctx); err != nil {
+		return
+	}
+	defer project.Close()
+	var upload resources.StorjUpload
+	if upload, err = project.UploadObject(ctx, backend.Bucket, path.Join(backend.Prefix, key)); err != nil {
+		return
+	}
+	if _, err = io.Copy(upload, bytes.NewReader(data)); err != nil {
+		upload.Abort()
+		return
+	}
+	return upload.Commit()
+}
+
+func (backend *StorjSaveSyncBackend) Delete(key string) (err error) {
+	ctx := context.Background()
+	var project resources.StorjProject
+	if project, err = backend.openProject(ctx); err != nil {
+		return
+	}
+	defer project.Close()
+	return project.DeleteObject(ctx, backend.Bucket, path.Join(backend.Prefix, key))
+}
+
+func (backend *StorjSaveSyncBackend) openProject(ctx context.Context) (resources.StorjProject, error) {
+	openProject := backend.OpenProject
+	if openProject == nil {
+		openProject = resources.OpenUplinkProject
+	}
+	return openProject(ctx, backend.Access)
+}
@@ -0,0 +1,190 @@
+package launcher_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"arkhive.dev/launcher/internal/launcher"
+	"arkhive.dev/launcher/pkg/encryption"
+	"github.com/stretchr/testify/assert"
+)
+
+// Two devices of the same account synchronizing their saves through a folder
+func newTestSaveSyncDevices(t *testing.T) (desktop *launcher.LauncherEngine, desktopSync *launcher.SaveSync, laptop *launcher.LauncherEngine, laptopSync *launcher.SaveSync) {
+	privateKey, err := encryption.GeneratePairKey(encryption.MIN_KEY_BITS)
+	assert.Nil(t, err)
+	backend := &launcher.FolderSaveSyncBackend{Path: t.TempDir()}
+	desktop, _ = newTestLauncherEngine(t, nil)
+	laptop, _ = newTestLauncherEngine(t, nil)
+	desktopSync = &launcher.SaveSync{Backend: backend, PrivateKey: privateKey, Device: "desktop"}
+	laptopSync = &launcher.SaveSync{Backend: backend, PrivateKey: privateKey, Device: "laptop"}
+	return
+}
+
+func readTestSave(t *testing.T, launcherEngine *launcher.LauncherEngine, name string) string {
+	data, err := os.ReadFile(filepath.Join(launcherEngine.GetSavesPath("super_mario_world"), filepath.FromSlash(name)))
+	assert.Nil(t, err)
+	return string(data)
+}
+
+func TestSyncSaves(t *testing.T) {
+	desktop, desktopSync, laptop, laptopSync := newTestSaveSyncDevices(t)
+	writeTestSave(t, desktop, "savefiles/smw.srm", "desktop save")
+	report, err := desktop.SyncSaves("super_mario_world", desktopSync)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"savefiles/smw.srm"}, report.Uploaded)
+	backend := desktopSync.Backend.(*launcher.FolderSaveSyncBackend)
+	filepath.WalkDir(backend.Path, func(filePath string, entry os.DirEntry, err error) error {
+		if err == nil && !entry.IsDir() {
+			data, _ := os.ReadFile(filePath)
+			assert.False(t, bytes.Contains(data, []byte("desktop save")))
+			assert.False(t, bytes.Contains(data, []byte("smw.srm")))
+		}
+		return err
+	})
+
+	report, err = laptop.SyncSaves("super_mario_world", laptopSync)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"savefiles/smw.srm"}, report.Downloaded)
+	assert.Equal(t, "desktop save", readTestSave(t, laptop, "savefiles/smw.srm"))
+
+	// Unchanged saves are left alone
+	report, err = laptop.SyncSaves("super_mario_world", laptopSync)
+	assert.Nil(t, err)
+	assert.Equal(t, launcher.SaveSyncReport{}, report)
+
+	writeTestSave(t, laptop, "savestates/smw.state", "laptop state")
+	assert.Nil(t, laptop.DeleteSave("super_mario_world", "savefiles/smw.srm"))
+	report, err = laptop.SyncSaves("super_mario_world", laptopSync)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"savestates/smw.state"}, report.Uploaded)
+	assert.Equal(t, []string{"savefiles/smw.srm"}, report.DeletedRemote)
+
+	report, err = desktop.SyncSaves("super_mario_world", desktopSync)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"savestates/smw.state"}, report.Downloaded)
+	assert.Equal(t, []string{"savefiles/smw.srm"}, report.DeletedLocal)
+	saves, err := desktop.ListSaves("super_mario_world")
+	assert.Nil(t, err)
+	if assert.Len(t, saves, 1) {
+		assert.Equal(t, "savestates/smw.state", saves[0].Name)
+	}
+	// The deleted save is kept in the backup taken before the download
+	backups, err := desktop.ListSaveBackups("super_mario_world")
+	assert.Nil(t, err)
+	assert.Len(t, backups, 1)
+}
+
+func TestSyncSavesConflict(t *testing.T) {
+	desktop, desktopSync, laptop, laptopSync := newTestSaveSyncDevices(t)
+	writeTestSave(t, desktop, "savefiles/smw.srm", "desktop save")
+	writeTestSave(t, laptop, "savefiles/smw.srm", "laptop save")
+	_, err := desktop.SyncSaves("super_mario_world", desktopSync)
+	assert.Nil(t, err)
+
+	report, err := laptop.SyncSaves("super_mario_world", laptopSync)
+	assert.Nil(t, err)
+	if assert.Len(t, report.Conflicts, 1) {
+		conflict := report.Conflicts[0]
+		assert.Equal(t, "savefiles/smw.srm", conflict.Name)
+		assert.Equal(t, int64(len("laptop save")), conflict.Local.Size)
+		assert.Equal(t, "desktop", conflict.Remote.Device)
+		assert.NotEqual(t, conflict.Local.Hash, conflict.Remote.Hash)
+	}
+	assert.Equal(t, "laptop save", readTestSave(t, laptop, "savefiles/smw.srm"))
+
+	assert.Nil(t, laptop.ResolveSaveConflict("super_mario_world", laptopSync, "savefiles/smw.srm", launcher.KEEP_REMOTE_SAVE))
+	assert.Equal(t, "desktop save", readTestSave(t, laptop, "savefiles/smw.srm"))
+	backups, err := laptop.ListSaveBackups("super_mario_world")
+	assert.Nil(t, err)
+	assert.Len(t, backups, 1)
+	err = laptop.ResolveSaveConflict("super_mario_world", laptopSync, "savefiles/smw.srm", launcher.KEEP_LOCAL_SAVE)
+	assert.ErrorIs(t, err, launcher.ErrSaveNotInConflict)
+	report, err = laptop.SyncSaves("super_mario_world", laptopSync)
+	assert.Nil(t, err)
+	assert.Equal(t, launcher.SaveSyncReport{}, report)
+
+	// Both sides change again, the local version is kept
+	writeTestSave(t, desktop, "savefiles/smw.srm", "desktop save 2")
+	_, err = desktop.SyncSaves("super_mario_world", desktopSync)
+	assert.Nil(t, err)
+	writeTestSave(t, laptop, "savefiles/smw.srm", "laptop save 2")
+	report, err = laptop.SyncSaves("super_mario_world", laptopSync)
+	assert.Nil(t, err)
+	assert.Len(t, report.Conflicts, 1)
+	assert.Nil(t, laptop.ResolveSaveConflict("super_mario_world", laptopSync, "savefiles/smw.srm", launcher.KEEP_LOCAL_SAVE))
+	report, err = desktop.SyncSaves("super_mario_world", desktopSync)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"savefiles/smw.srm"}, report.Downloaded)
+	assert.Equal(t, "laptop save 2", readTestSave(t, desktop, "savefiles/smw.srm"))
+	// Only the manifest and the kept version are stored
+	entries, err := os.ReadDir(filepath.Join(desktopSync.Backend.(*launcher.FolderSaveSyncBackend).Path, "super_mario_world"))
+	assert.Nil(t, err)
+	assert.Len(t, entries, 2)
+}
+
+func TestSyncSavesWrongKey(t *testing.T) {
+	desktop, desktopSync, laptop, _ := newTestSaveSyncDevices(t)
+	writeTestSave(t, desktop, "savefiles/smw.srm", "desktop save")
+	_, err := desktop.SyncSaves("super_mario_world", desktopSync)
+	assert.Nil(t, err)
+
+	otherKey, err := encryption.GeneratePairKey(encryption.MIN_KEY_BITS)
+	assert.Nil(t, err)
+	_, err = laptop.SyncSaves("super_mario_world", &launcher.SaveSync{Backend: desktopSync.Backend, PrivateKey: otherKey})
+	assert.ErrorIs(t, err, encryption.ErrInvalidEnvelope)
+}
+
+func TestSyncSavesForgedManifest(t *testing.T) {
+	desktop, desktopSync, _, _ := newTestSaveSyncDevices(t)
+	writeTestSave(t, desktop, "savefiles/smw.srm", "desktop save")
+
+	// The public key is enough to encrypt a manifest, but not to sign it
+	envelope, err := encryption.EncryptEnvelope(&desktopSync.PrivateKey.PublicKey, []byte(`{"saves":{}}`))
+	assert.Nil(t, err)
+	assert.Nil(t, desktopSync.Backend.Write("super_mario_world/manifest", envelope))
+	_, err = desktop.SyncSaves("super_mario_world", desktopSync)
+	assert.NotNil(t, err)
+
+	otherKey, err := encryption.GeneratePairKey(encryption.MIN_KEY_BITS)
+	assert.Nil(t, err)
+	manifest := []byte(`{"saves":{}}`)
+	sign, err := encryption.Sign(otherKey, manifest)
+	assert.Nil(t, err)
+	data, err := json.Marshal(map[string][]byte{"manifest": manifest, "sign": sign})
+	assert.Nil(t, err)
+	envelope, err = encryption.EncryptEnvelope(&desktopSync.PrivateKey.PublicKey, data)
+	assert.Nil(t, err)
+	assert.Nil(t, desktopSync.Backend.Write("super_mario_world/manifest", envelope))
+	_, err = desktop.SyncSaves("super_mario_world", desktopSync)
+	assert.NotNil(t, err)
+}
+
+func TestSyncSavesManifestRollback(t *testing.T) {
+	desktop, desktopSync, laptop, laptopSync := newTestSaveSyncDevices(t)
+	writeTestSave(t, desktop, "savefiles/smw.srm", "desktop save")
+	_, err := desktop.SyncSaves("super_mario_world", desktopSync)
+	assert.Nil(t, err)
+	previousManifest, err := desktopSync.Backend.Read("super_mario_world/manifest")
+	assert.Nil(t, err)
+	_, err = laptop.SyncSaves("super_mario_world", laptopSync)
+	assert.Nil(t, err)
+	writeTestSave(t, desktop, "savefiles/smw.srm", "desktop save 2")
+	_, err = desktop.SyncSaves("super_mario_world", desktopSync)
+	assert.Nil(t, err)
+	_, err = laptop.SyncSaves("super_mario_world", laptopSync)
+	assert.Nil(t, err)
+
+	// The backend serves the previous manifest, validly signed, again
+	assert.Nil(t, laptopSync.Backend.Write("super_mario_world/manifest", previousManifest))
+	_, err = laptop.SyncSaves("super_mario_world", laptopSync)
+	assert.ErrorIs(t, err, launcher.ErrSaveManifestRollback)
+	assert.Equal(t, "desktop save 2", readTestSave(t, laptop, "savefiles/smw.srm"))
+
+	assert.Nil(t, laptopSync.Backend.Delete("super_mario_world/manifest"))
+	_, err = laptop.SyncSaves("super_mario_world", laptopSync)
+	assert.ErrorIs(t, err, launcher.ErrSaveManifestRollback)
+}
@@ -0,0 +1,239 @@
+package network
+
+import (
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"time"
+
+	"arkhive.dev/launcher/pkg/encryption"
+)
+
+// Name of the account private key file inside the system folder
+const PRIVATE_KEY_FILE = "private.bee"
+
+// Name of the account certificate file inside the system folder
+const CERTIFICATE_FILE = "certificate.bee"
+
+// Size in bits of the generated account keys
+const ACCOUNT_KEY_BITS = 3072
+
+// Permissions of the account private key file, readable only by the owner
+const PRIVATE_KEY_FILE_MODE fs.FileMode = 0600
+
+type CertificateStatus int
+
+const (
+	// No certificate or a certificate not matching the account key
+	INVALID CertificateStatus = iota
+	// Certificate matching the account key, not yet verified against the undertow key
+	AVAILABLE
+	// Certificate without a valid undertow sign
+	UNOFFICIAL
+	// Certificate signed by the undertow key
+	OFFICIAL
+)
+
+/*
+The account certificate, stored as a JSON object in the certificate file:
+
+	{
+	  "username": "Account name.",
+	  "email": "Account email.",
+	  "date": Registration date as Unix time in seconds,
+	  "public_key": "base64url encoding of the account PEM public key.",
+	  "sign": "(optional) base64url encoding of the undertow sign."
+	}
+
+The sign is the RSA-PSS SHA-256 signature, made with the undertow key, of the
+certificate JSON object without the sign key, serialized in the above key order.
+*/
+type AccountCertificate struct {
+	Username  string `json:"username"`
+	Email     string `json:"email"`
+	Date      int64  `json:"date"`
+	PublicKey string `json:"public_key"`
+	Sign      string `json:"sign,omitempty"`
+}
+
+// Create an unsigned certificate of the account public key
+func NewAccountCertificate(username string, email string, date time.Time, publicKey *rsa.PublicKey) (certificate *AccountCertificate, err error) {
+	var publicKeyBytes []byte
+	if publicKeyBytes, err = encryption.ExportPublicKey(publicKey); err != nil {
+		return
+	}
+	certificate = &AccountCertificate{
+		Username:  username,
+		Email:     email,
+		Date:      date.Unix(),
+		PublicKey: base64.URLEncoding.EncodeToString(publicKeyBytes),
+	}
+	return
+}
+
+// Parse and validate the JSON certificate
+func ParseAccountCertificate(jsonCertificateData []byte) (certificate *AccountCertificate, err error) {
+	certificate = &AccountCertificate{}
+	if err = json.Unmarshal(jsonCertificateData, certificate); err != nil {
+		return nil, err
+	}
+	if certificate.Username == "" || certificate.Email == "" || certificate.Date <= 0 {
+		return nil, errors.New("invalid certificate values")
+	}
+	if _, err = certificate.GetPublicKey(); err != nil {
+		return nil, err
+	}
+	return
+}
+
+// Read the certificate file
+func ReadAccountCertificateFile(certificateFilePath string) (certificate *AccountCertificate, err error) {
+	var jsonCertificateData []byte
+	if jsonCertificateData, err = os.ReadFile(certificateFilePath); err != nil {
+		return
+	}
+	return ParseAccountCertificate(jsonCertificateData)
+}
+
+// Write the certificate file
+func (certificate *AccountCertificate) WriteFile(certificateFilePath string) (err error) {
+	var jsonCertificateData []byte
+	if jsonCertificateData, err = json.Marshal(certificate); err != nil {
+		return
+	}
+	return os.WriteFile(certificateFilePath, jsonCertificateData, 0644)
+}
+
+// Get the account public key of the certificate
+func (certificate *AccountCertificate) GetPublicKey() (publicKey *rsa.PublicKey, err error) {
+	var publicKeyBytes []byte
+	if publicKeyBytes, err = base64.URLEncoding.DecodeString(certificate.PublicKey); err != nil {
+		return
+	}
+	return encryption.ParsePublicKey(publicKeyBytes)
+}
+
+// Get the registration date of the certificate
+func (certificate *AccountCertificate) GetRegistrationDate() time.Time {
+	return time.Unix(certificate.Date, 0)
+}
+
+// Get the certificate data covered by the sign
+func (certificate *AccountCertificate) GetSignedData() ([]byte, error) {
+	unsignedCertificate := *certificate
+	unsignedCertificate.Sign = ""
+	return json.Marshal(unsignedCertificate)
+}
+
+// Sign the certificate with the undertow private key
+func (certificate *AccountCertificate) SignWith(undertowPrivateKey *rsa.PrivateKey) (err error) {
+	var signedData []byte
+	if signedData, err = certificate.GetSignedData(); err != nil {
+		return
+	}
+	var sign []byte
+	if sign, err = encryption.Sign(undertowPrivateKey, signedData); err != nil {
+		return
+	}
+	certificate.Sign = base64.URLEncoding.EncodeToString(sign)
+	return
+}
+
+// Verify the certificate sign against the undertow public key
+func (certificate *AccountCertificate) VerifySign(undertowPublicKey *rsa.PublicKey) (err error) {
+	if certificate.Sign == "" {
+		return errors.New("unsigned certificate")
+	}
+	var sign []byte
+	if sign, err = base64.URLEncoding.DecodeString(certificate.Sign); err != nil {
+		return
+	}
+	var signedData []byte
+	if signedData, err = certificate.GetSignedData(); err != nil {
+		return
+	}
+	return encryption.Verify(undertowPublicKey, signedData, sign)
+}
+
+// Evaluate the status of the certificate for the account key. The sign is verified only
+// when the undertow public key is known.
+func EvaluateCertificate(certificate *AccountCertificate, privateKey *rsa.PrivateKey, undertowPublicKey *rsa.PublicKey) CertificateStatus {
+	if certificate == nil || privateKey == nil {
+		return INVALID
+	}
+	publicKey, err := certificate.GetPublicKey()
+	if err != nil || !publicKey.Equal(&privateKey.PublicKey) {
+		return INVALID
+	}
+	if undertowPublicKey == nil {
+		return AVAILABLE
+	}
+	if certificate.VerifySign(undertowPublicKey) != nil {
+		return UNOFFICIAL
+	}
+	return OFFICIAL
+}
+
+/*
+Read the account private key file, restricting its permissions to the owner.
+
+The passphrase decrypts an encrypted key, while a plaintext key is encrypted with it
+and written back, migrating the file.
+*/
+func ReadAccountPrivateKeyFile(privateKeyFilePath string, passphrase string) (privateKey *rsa.PrivateKey, err error) {
+	var fileInfo fs.FileInfo
+	if fileInfo, err = os.Stat(privateKeyFilePath); err != nil {
+		return
+	}
+	if fileInfo.Mode().Perm()&^PRIVATE_KEY_FILE_MODE != 0 {
+		if err = os.Chmod(privateKeyFilePath, PRIVATE_KEY_FILE_MODE); err != nil {
+			return
+		}
+	}
+	var privateKeyBytes []byte
+	if privateKeyBytes, err = os.ReadFile(privateKeyFilePath); err != nil {
+		return
+	}
+	if privateKey, err = encryption.ParsePrivateKeyWithPassphrase(privateKeyBytes, passphrase); err != nil {
+		return
+	}
+	if passphrase != "" && !encryption.IsEncryptedPrivateKey(privateKeyBytes) {
+		if err = WriteAccountPrivateKeyFile(privateKeyFilePath, privateKey, passphrase); err != nil {
+			return nil, fmt.Errorf("cannot encrypt the private key: %w", err)
+		}
+	}
+	return
+}
+
+// Generate a new account private key and write it to the private key file
+func generateAccountPrivateKey(privateKeyFilePath string, passphrase string) (privateKey *rsa.PrivateKey, err error) {
+	if privateKey, err = encryption.GeneratePairKey(ACCOUNT_KEY_BITS); err != nil {
+		return
+	}
+	if err = WriteAccountPrivateKeyFile(privateKeyFilePath, privateKey, passphrase); err != nil {
+		privateKey = nil
+	}
+	return
+}
+
+// Write the private key file readable only by the owner, encrypted if the passphrase is not empty
+func WriteAccountPrivateKeyFile(privateKeyFilePath string, privateKey *rsa.PrivateKey, passphrase string) (err error) {
+	privateKeyBytes := encryption.ExportPrivateKey(privateKey)
+	if passphrase != "" {
+		if privateKeyBytes, err = encryption.ExportEncryptedPrivateKey(privateKey, passphrase); err != nil {
+			return
+		}
+	}
+	if err = os.WriteFile(privateKeyFilePath, privateKeyBytes, PRIVATE_KEY_FILE_MODE); err != nil {
+		return
+	}
+	// WriteFile keeps the permissions of an existing file
+	if err = os.Chmod(privateKeyFilePath, PRIVATE_KEY_FILE_MODE); err != nil {
+		return fmt.Errorf("cannot restrict the private key permissions: %w", err)
+	}
+	return
+}
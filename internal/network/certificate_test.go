@@ -0,0 +1,123 @@
+package network_test
+
+import (
+	"crypto/rsa"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"arkhive.dev/launcher/internal/network"
+	"arkhive.dev/launcher/pkg/encryption"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestCertificate(t *testing.T, publicKey *rsa.PublicKey) *network.AccountCertificate {
+	certificate, err := network.NewAccountCertificate("player", "player@arkhive.dev", time.Unix(1664582400, 0), publicKey)
+	assert.Nil(t, err)
+	return certificate
+}
+
+func TestEvaluateCertificate(t *testing.T) {
+	accountKey, err := encryption.GeneratePairKey(encryption.MIN_KEY_BITS)
+	assert.Nil(t, err)
+	undertowKey, err := encryption.GeneratePairKey(encryption.MIN_KEY_BITS)
+	assert.Nil(t, err)
+	otherKey, err := encryption.GeneratePairKey(encryption.MIN_KEY_BITS)
+	assert.Nil(t, err)
+
+	officialCertificate := newTestCertificate(t, &accountKey.PublicKey)
+	assert.Nil(t, officialCertificate.SignWith(undertowKey))
+	selfSignedCertificate := newTestCertificate(t, &accountKey.PublicKey)
+	assert.Nil(t, selfSignedCertificate.SignWith(accountKey))
+	tamperedCertificate := *officialCertificate
+	tamperedCertificate.Username = "impostor"
+
+	tests := []struct {
+		name              string
+		certificate       *network.AccountCertificate
+		undertowPublicKey *rsa.PublicKey
+		expected          network.CertificateStatus
+	}{
+		{"missing certificate", nil, &undertowKey.PublicKey, network.INVALID},
+		{"other account key", newTestCertificate(t, &otherKey.PublicKey), &undertowKey.PublicKey, network.INVALID},
+		{"undertow key unknown", officialCertificate, nil, network.AVAILABLE},
+		{"unsigned", newTestCertificate(t, &accountKey.PublicKey), &undertowKey.PublicKey, network.UNOFFICIAL},
+		{"self signed", selfSignedCertificate, &undertowKey.PublicKey, network.UNOFFICIAL},
+		{"tampered", &tamperedCertificate, &undertowKey.PublicKey, network.UNOFFICIAL},
+		{"signed by undertow", officialCertificate, &undertowKey.PublicKey, network.OFFICIAL},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			assert.Equal(t, test.expected, network.EvaluateCertificate(test.certificate, accountKey, test.undertowPublicKey))
+		})
+	}
+}
+
+func TestAccountCertificateFile(t *testing.T) {
+	accountKey, err := encryption.GeneratePairKey(encryption.MIN_KEY_BITS)
+	assert.Nil(t, err)
+	certificateFilePath := filepath.Join(t.TempDir(), network.CERTIFICATE_FILE)
+	certificate := newTestCertificate(t, &accountKey.PublicKey)
+	assert.Nil(t, certificate.WriteFile(certificateFilePath))
+
+	readCertificate, err := network.ReadAccountCertificateFile(certificateFilePath)
+	assert.Nil(t, err)
+	assert.Equal(t, certificate, readCertificate)
+	assert.Equal(t, time.Unix(1664582400, 0), readCertificate.GetRegistrationDate())
+	publicKey, err := readCertificate.GetPublicKey()
+	assert.Nil(t, err)
+	assert.True(t, publicKey.Equal(&accountKey.PublicKey))
+}
+
+func TestParseAccountCertificateInvalid(t *testing.T) {
+	for _, invalidCertificate := range []string{
+		``,
+		`{"username": "player", "email": "player@arkhive.dev", "date": 1664582400}`,
+		`{"username": "player", "email": "player@arkhive.dev", "date": 1664582400, "public_key": "invalid"}`,
+		`{"email": "player@arkhive.dev", "date": 1664582400, "public_key": ""}`,
+	} {
+		_, err := network.ParseAccountCertificate([]byte(invalidCertificate))
+		assert.NotNil(t, err, invalidCertificate)
+	}
+	_, err := network.ReadAccountCertificateFile(filepath.Join(t.TempDir(), network.CERTIFICATE_FILE))
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestAccountPrivateKeyFilePermissions(t *testing.T) {
+	accountKey, err := encryption.GeneratePairKey(encryption.MIN_KEY_BITS)
+	assert.Nil(t, err)
+	privateKeyFilePath := filepath.Join(t.TempDir(), network.PRIVATE_KEY_FILE)
+	assert.Nil(t, os.WriteFile(privateKeyFilePath, []byte{}, 0644))
+	assert.Nil(t, network.WriteAccountPrivateKeyFile(privateKeyFilePath, accountKey, ""))
+	fileInfo, err := os.Stat(privateKeyFilePath)
+	assert.Nil(t, err)
+	assert.Equal(t, network.PRIVATE_KEY_FILE_MODE, fileInfo.Mode().Perm())
+
+	assert.Nil(t, os.Chmod(privateKeyFilePath, 0644))
+	readKey, err := network.ReadAccountPrivateKeyFile(privateKeyFilePath, "")
+	assert.Nil(t, err)
+	assert.True(t, readKey.Equal(accountKey))
+	fileInfo, _ = os.Stat(privateKeyFilePath)
+	assert.Equal(t, network.PRIVATE_KEY_FILE_MODE, fileInfo.Mode().Perm())
+}
+
+func TestAccountPrivateKeyFileMigration(t *testing.T) {
+	accountKey, err := encryption.GeneratePairKey(encryption.MIN_KEY_BITS)
+	assert.Nil(t, err)
+	privateKeyFilePath := filepath.Join(t.TempDir(), network.PRIVATE_KEY_FILE)
+	assert.Nil(t, network.WriteAccountPrivateKeyFile(privateKeyFilePath, accountKey, ""))
+
+	readKey, err := network.ReadAccountPrivateKeyFile(privateKeyFilePath, "secret")
+	assert.Nil(t, err)
+	assert.True(t, readKey.Equal(accountKey))
+	privateKeyBytes, err := os.ReadFile(privateKeyFilePath)
+	assert.Nil(t, err)
+	assert.True(t, encryption.IsEncryptedPrivateKey(privateKeyBytes))
+
+	_, err = network.ReadAccountPrivateKeyFile(privateKeyFilePath, "")
+	assert.ErrorIs(t, err, encryption.ErrEncryptedPrivateKey)
+	readKey, err = network.ReadAccountPrivateKeyFile(privateKeyFilePath, "secret")
+	assert.Nil(t, err)
+	assert.True(t, readKey.Equal(accountKey))
+}
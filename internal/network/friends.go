@@ -0,0 +1,610 @@
+package network
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"time"
+
+	"arkhive.dev/launcher/internal/database/delegate/sqlite"
+	"arkhive.dev/launcher/pkg/encryption"
+	"github.com/sirupsen/logrus"
+)
+
+// Interval of the presence announcements to the connected peers
+const PRESENCE_INTERVAL = time.Minute
+
+// Time allowed to the peers to complete the handshake
+const PEER_HANDSHAKE_TIMEOUT = 10 * time.Second
+
+// Maximum size of a peer message, fitting a save object encoded in the encrypted payload
+const MAX_PEER_MESSAGE_SIZE = 2 * FRIEND_SAVE_SIZE_LIMIT
+
+const peerNonceSize = 32
+
+// Types of the peer protocol messages
+const (
+	PEER_HELLO           = "hello"
+	PEER_AUTH            = "auth"
+	PEER_PRESENCE        = "presence"
+	PEER_FRIEND_REQUEST  = "friend_request"
+	PEER_FRIEND_ACCEPT   = "friend_accept"
+	PEER_CHAT            = "chat"
+	PEER_NETPLAY_INVITE  = "netplay_invite"
+	PEER_NETPLAY_ACCEPT  = "netplay_accept"
+	PEER_NETPLAY_DECLINE = "netplay_decline"
+	PEER_SAVE_READ       = "save_read"
+	PEER_SAVE_WRITE      = "save_write"
+	PEER_SAVE_DELETE     = "save_delete"
+	PEER_SAVE_REPLY      = "save_reply"
+)
+
+var ErrNotFriend = errors.New("the user is not a friend")
+var ErrPeerOffline = errors.New("the user is not connected")
+var ErrPeerMessageTooLarge = errors.New("the peer message exceeds the size limit")
+var ErrPeerMessageSequence = errors.New("the peer message is out of sequence")
+
+/*
+Message of the peer protocol, exchanged as a JSON object per message.
+
+After the handshake every message is numbered and signed by the sender together
+with the nonce the recipient sent in its hello, so that it can be neither replayed
+nor moved to another connection or message type.
+*/
+type peerMessage struct {
+	Type      string `json:"type"`
+	PublicKey []byte `json:"public_key,omitempty"`
+	Nonce     []byte `json:"nonce,omitempty"`
+	Name      string `json:"name,omitempty"`
+	Payload   []byte `json:"payload,omitempty"`
+	Sequence  uint64 `json:"sequence,omitempty"`
+	Sign      []byte `json:"sign,omitempty"`
+}
+
+// The data signed by the sender, binding the message to the nonce of the recipient
+func (message peerMessage) getSignedData(nonce []byte) ([]byte, error) {
+	message.Sign = nil
+	return json.Marshal(struct {
+		Nonce   []byte      `json:"nonce"`
+		Message peerMessage `json:"message"`
+	}{nonce, message})
+}
+
+// Chat message, encrypted with the recipient public key in the chat payload
+type chatPayload struct {
+	Message   string    `json:"message"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+type peerConnection struct {
+	connection net.Conn
+	encoder    *json.Encoder
+	decoder    *json.Decoder
+	// Reader of the decoder, limiting the bytes read for every message
+	limitReader *messageLimitReader
+	writeLock   sync.Mutex
+	// PEM public key of the peer account
+	publicKeyBytes []byte
+	publicKey      *rsa.PublicKey
+	// Key of the node signing the messages, set once the handshake is completed
+	privateKey *rsa.PrivateKey
+	// Nonces of the handshake sent by the peer and by the node, signed with the messages
+	peerNonce []byte
+	nodeNonce []byte
+	// Sequence numbers of the last sent and received messages
+	sentSequence     uint64
+	receivedSequence uint64
+}
+
+func (peer *peerConnection) send(message peerMessage) (err error) {
+	peer.writeLock.Lock()
+	defer peer.writeLock.Unlock()
+	if peer.privateKey != nil {
+		message.Sequence = peer.sentSequence + 1
+		var signedData []byte
+		if signedData, err = message.getSignedData(peer.peerNonce); err != nil {
+			return
+		}
+		if message.Sign, err = encryption.Sign(peer.privateKey, signedData); err != nil {
+			return
+		}
+		peer.sentSequence = message.Sequence
+	}
+	return peer.encoder.Encode(message)
+}
+
+// Receive the next message, verifying its sign and sequence once the handshake is completed
+func (peer *peerConnection) receive(messageType string) (message peerMessage, err error) {
+	peer.limitReader.remaining = MAX_PEER_MESSAGE_SIZE
+	if err = peer.decoder.Decode(&message); err != nil {
+		return
+	}
+	if messageType != "" && message.Type != messageType {
+		return message, fmt.Errorf("unexpected %q peer message, expected %q", message.Type, messageType)
+	}
+	if peer.privateKey == nil {
+		return
+	}
+	var signedData []byte
+	if signedData, err = message.getSignedData(peer.nodeNonce); err != nil {
+		return
+	}
+	if err = encryption.Verify(peer.publicKey, signedData, message.Sign); err != nil {
+		return message, fmt.Errorf("invalid %q peer message sign: %w", message.Type, err)
+	}
+	if message.Sequence != peer.receivedSequence+1 {
+		return message, ErrPeerMessageSequence
+	}
+	peer.receivedSequence = message.Sequence
+	return
+}
+
+// Reader failing once the remaining bytes of the message are read
+type messageLimitReader struct {
+	reader    io.Reader
+	remaining int64
+}
+
+func (limitReader *messageLimitReader) Read(buffer []byte) (read int, err error) {
+	if limitReader.remaining <= 0 {
+		return 0, ErrPeerMessageTooLarge
+	}
+	if int64(len(buffer)) > limitReader.remaining {
+		buffer = buffer[:limitReader.remaining]
+	}
+	read, err = limitReader.reader.Read(buffer)
+	limitReader.remaining -= int64(read)
+	return
+}
+
+/*
+Node of the friends network, exchanging presence, friend requests and direct messages
+with the connected peers.
+
+The peers authenticate each other signing the nonce sent by the other side with
+their account key. The direct messages are encrypted with the recipient public key
+and signed with the sender one, then persisted to the chats of the user. The friends
+can store their encrypted save objects on each other's node.
+*/
+type FriendNode struct {
+	privateKey *rsa.PrivateKey
+	// PEM public key of the node account
+	publicKeyBytes []byte
+	name           string
+	database       *sqlite.SQLite
+	listener       net.Listener
+	// Connected peers by hashed public key
+	peers map[string]*peerConnection
+	// Pending friend requests by hashed public key
+	receivedFriendRequests map[string]bool
+	sentFriendRequests     map[string]bool
+	// Netplay sessions hosted for and received from the friends by hashed public key
+	hostedNetplaySessions map[string]*NetplaySession
+	netplayInvites        map[string]*NetplaySession
+	// Pending save object requests by request identifier
+	saveRequests map[string]chan savePayload
+	lock         sync.Mutex
+	closed       chan struct{}
+}
+
+// Start the friends network node of the account, persisting users and chats to the database
+func (networkEngine *NetworkEngine) StartFriendNode(database *sqlite.SQLite) (node *FriendNode, err error) {
+	privateKey := networkEngine.getAccountKey()
+	if !networkEngine.isInitialized() || privateKey == nil {
+		return nil, errors.New("account key not available")
+	}
+	if node, err = NewFriendNode(privateKey, networkEngine.GetAccount().Username, database); err != nil {
+		return
+	}
+	if err = node.Listen(networkEngine.friendListenAddress); err != nil {
+		return nil, err
+	}
+	return
+}
+
+func NewFriendNode(privateKey *rsa.PrivateKey, name string, database *sqlite.SQLite) (node *FriendNode, err error) {
+	var publicKeyBytes []byte
+	if publicKeyBytes, err = encryption.ExportPublicKey(&privateKey.PublicKey); err != nil {
+		return
+	}
+	node = &FriendNode{
+		privateKey:             privateKey,
+		publicKeyBytes:         publicKeyBytes,
+		name:                   name,
+		database:               database,
+		peers:                  map[string]*peerConnection{},
+		receivedFriendRequests: map[string]bool{},
+		sentFriendRequests:     map[string]bool{},
+		hostedNetplaySessions:  map[string]*NetplaySession{},
+		netplayInvites:         map[string]*NetplaySession{},
+		saveRequests:           map[string]chan savePayload{},
+		closed:                 make(chan struct{}),
+	}
+	return
+}
+
+// The PEM public key identifying the node
+func (node *FriendNode) GetPublicKey() []byte {
+	return node.publicKeyBytes
+}
+
+// Accept the peer connections on the address and start announcing the presence
+func (node *FriendNode) Listen(address string) (err error) {
+	if node.listener, err = net.Listen("tcp", address); err != nil {
+		return
+	}
+	go node.acceptPeers()
+	go node.announcePresence()
+	return
+}
+
+// The address the node is listening on
+func (node *FriendNode) Addr() net.Addr {
+	return node.listener.Addr()
+}
+
+// Close the listener and every peer connection
+func (node *FriendNode) Close() {
+	node.lock.Lock()
+	defer node.lock.Unlock()
+	select {
+	case <-node.closed:
+		return
+	default:
+		close(node.closed)
+	}
+	if node.listener != nil {
+		node.listener.Close()
+	}
+	for _, peer := range node.peers {
+		peer.connection.Close()
+	}
+}
+
+// Connect to the peer at the address, returning its public key
+func (node *FriendNode) Connect(ctx context.Context, address string) (publicKey []byte, err error) {
+	var connection net.Conn
+	if connection, err = (&net.Dialer{}).DialContext(ctx, "tcp", address); err != nil {
+		return
+	}
+	var peer *peerConnection
+	if peer, err = node.handshake(connection); err != nil {
+		connection.Close()
+		return
+	}
+	node.addPeer(peer)
+	return peer.publicKeyBytes, nil
+}
+
+// Whether the user with the public key is connected
+func (node *FriendNode) IsOnline(publicKey []byte) bool {
+	return node.getPeer(publicKey) != nil
+}
+
+// Send a friend request to the connected user
+func (node *FriendNode) SendFriendRequest(publicKey []byte) (err error) {
+	peer := node.getPeer(publicKey)
+	if peer == nil {
+		return ErrPeerOffline
+	}
+	if _, err = node.storeUser(publicKey, "", false); err != nil {
+		return
+	}
+	node.lock.Lock()
+	node.sentFriendRequests[sqlite.HashPublicKey(publicKey)] = true
+	node.lock.Unlock()
+	return peer.send(peerMessage{Type: PEER_FRIEND_REQUEST, Name: node.name})
+}
+
+// Get the users whose friend requests are pending
+func (node *FriendNode) GetFriendRequests() (users []sqlite.User, err error) {
+	node.lock.Lock()
+	defer node.lock.Unlock()
+	for _, peer := range node.peers {
+		if !node.receivedFriendRequests[sqlite.HashPublicKey(peer.publicKeyBytes)] {
+			continue
+		}
+		var user sqlite.User
+		if user, err = node.database.GetUserByPublicKey(peer.publicKeyBytes); err != nil {
+			return
+		}
+		users = append(users, user)
+	}
+	return
+}
+
+// Accept the friend request of the connected user
+func (node *FriendNode) AcceptFriendRequest(publicKey []byte) (err error) {
+	hashedPublicKey := sqlite.HashPublicKey(publicKey)
+	node.lock.Lock()
+	requested := node.receivedFriendRequests[hashedPublicKey]
+	node.lock.Unlock()
+	if !requested {
+		return errors.New("no friend request from the user")
+	}
+	peer := node.getPeer(publicKey)
+	if peer == nil {
+		return ErrPeerOffline
+	}
+	if _, err = node.storeUser(publicKey, "", true); err != nil {
+		return
+	}
+	node.lock.Lock()
+	delete(node.receivedFriendRequests, hashedPublicKey)
+	node.lock.Unlock()
+	return peer.send(peerMessage{Type: PEER_FRIEND_ACCEPT, Name: node.name})
+}
+
+// Send an encrypted direct message to the connected friend, persisting it to the chat
+func (node *FriendNode) SendMessage(publicKey []byte, message string) (err error) {
+	var user sqlite.User
+	if user, err = node.database.GetUserByPublicKey(publicKey); err != nil || !user.IsFriend {
+		return ErrNotFriend
+	}
+	peer := node.getPeer(publicKey)
+	if peer == nil {
+		return ErrPeerOffline
+	}
+	chat := sqlite.Chat{
+		UserID:    user.Id,
+		Timestamp: time.Now(),
+		Message:   message,
+		Received:  false,
+	}
+	if err = node.sendEncrypted(peer, PEER_CHAT, chatPayload{chat.Message, chat.Timestamp}); err != nil {
+		return
+	}
+	return node.database.StoreChat(&chat)
+}
+
+// Send the payload encrypted with the peer public key, the message being signed on send
+func (node *FriendNode) sendEncrypted(peer *peerConnection, messageType string, payload interface{}) (err error) {
+	var payloadData []byte
+	if payloadData, err = json.Marshal(payload); err != nil {
+		return
+	}
+	var encryptedPayload []byte
+	if encryptedPayload, err = encryption.EncryptEnvelope(peer.publicKey, payloadData); err != nil {
+		return
+	}
+	return peer.send(peerMessage{Type: messageType, Payload: encryptedPayload})
+}
+
+// Decrypt the message payload, whose sign has been verified on receive
+func (node *FriendNode) receiveEncrypted(peer *peerConnection, message peerMessage, payload interface{}) (err error) {
+	var payloadData []byte
+	if payloadData, err = encryption.DecryptEnvelope(node.privateKey, message.Payload); err != nil {
+		return
+	}
+	return json.Unmarshal(payloadData, payload)
+}
+
+func (node *FriendNode) acceptPeers() {
+	for {
+		connection, err := node.listener.Accept()
+		if err != nil {
+			select {
+			case <-node.closed:
+			default:
+				logrus.Errorf("%+v", err)
+			}
+			return
+		}
+		go func() {
+			peer, err := node.handshake(connection)
+			if err != nil {
+				logrus.Warnf("%s: Peer handshake failed: %+v", connection.RemoteAddr().String(), err)
+				connection.Close()
+				return
+			}
+			node.addPeer(peer)
+		}()
+	}
+}
+
+// Authenticate the peer, proving the possession of the account key to each other
+func (node *FriendNode) handshake(connection net.Conn) (peer *peerConnection, err error) {
+	connection.SetDeadline(time.Now().Add(PEER_HANDSHAKE_TIMEOUT))
+	defer connection.SetDeadline(time.Time{})
+	limitReader := &messageLimitReader{reader: connection}
+	peer = &peerConnection{
+		connection:  connection,
+		encoder:     json.NewEncoder(connection),
+		decoder:     json.NewDecoder(limitReader),
+		limitReader: limitReader,
+	}
+	nonce := make([]byte, peerNonceSize)
+	if _, err = rand.Read(nonce); err != nil {
+		return
+	}
+	if err = peer.send(peerMessage{Type: PEER_HELLO, PublicKey: node.publicKeyBytes, Nonce: nonce}); err != nil {
+		return
+	}
+	var hello peerMessage
+	if hello, err = peer.receive(PEER_HELLO); err != nil {
+		return
+	}
+	if bytes.Equal(hello.PublicKey, node.publicKeyBytes) {
+		return nil, errors.New("connected to the node itself")
+	}
+	if len(hello.Nonce) != peerNonceSize {
+		return nil, errors.New("invalid peer nonce")
+	}
+	if peer.publicKey, err = encryption.ParsePublicKey(hello.PublicKey); err != nil {
+		return
+	}
+	peer.publicKeyBytes = hello.PublicKey
+
+	var sign []byte
+	if sign, err = encryption.Sign(node.privateKey, append(hello.Nonce, node.publicKeyBytes...)); err != nil {
+		return
+	}
+	if err = peer.send(peerMessage{Type: PEER_AUTH, Sign: sign}); err != nil {
+		return
+	}
+	var auth peerMessage
+	if auth, err = peer.receive(PEER_AUTH); err != nil {
+		return
+	}
+	if err = encryption.Verify(peer.publicKey, append(nonce, peer.publicKeyBytes...), auth.Sign); err != nil {
+		return nil, fmt.Errorf("invalid peer authentication: %w", err)
+	}
+	peer.peerNonce = hello.Nonce
+	peer.nodeNonce = nonce
+	peer.privateKey = node.privateKey
+	return
+}
+
+// Register the authenticated peer, replacing a previous connection of the same user
+func (node *FriendNode) addPeer(peer *peerConnection) {
+	hashedPublicKey := sqlite.HashPublicKey(peer.publicKeyBytes)
+	node.lock.Lock()
+	if previousPeer, ok := node.peers[hashedPublicKey]; ok {
+		previousPeer.connection.Close()
+	}
+	node.peers[hashedPublicKey] = peer
+	node.lock.Unlock()
+	node.updatePresence(peer)
+	go node.servePeer(peer)
+}
+
+func (node *FriendNode) getPeer(publicKey []byte) *peerConnection {
+	node.lock.Lock()
+	defer node.lock.Unlock()
+	return node.peers[sqlite.HashPublicKey(publicKey)]
+}
+
+func (node *FriendNode) servePeer(peer *peerConnection) {
+	defer func() {
+		peer.connection.Close()
+		node.lock.Lock()
+		hashedPublicKey := sqlite.HashPublicKey(peer.publicKeyBytes)
+		if node.peers[hashedPublicKey] == peer {
+			delete(node.peers, hashedPublicKey)
+		}
+		node.lock.Unlock()
+	}()
+	for {
+		message, err := peer.receive("")
+		if err != nil {
+			return
+		}
+		if err = node.handlePeerMessage(peer, message); err != nil {
+			logrus.Errorf("%+v", err)
+		}
+	}
+}
+
+func (node *FriendNode) handlePeerMessage(peer *peerConnection, message peerMessage) (err error) {
+	hashedPublicKey := sqlite.HashPublicKey(peer.publicKeyBytes)
+	switch message.Type {
+	case PEER_PRESENCE:
+		node.updatePresence(peer)
+	case PEER_FRIEND_REQUEST:
+		node.lock.Lock()
+		mutualRequest := node.sentFriendRequests[hashedPublicKey]
+		delete(node.sentFriendRequests, hashedPublicKey)
+		node.receivedFriendRequests[hashedPublicKey] = !mutualRequest
+		node.lock.Unlock()
+		if _, err = node.storeUser(peer.publicKeyBytes, message.Name, mutualRequest); err != nil {
+			return
+		}
+		if mutualRequest {
+			return peer.send(peerMessage{Type: PEER_FRIEND_ACCEPT, Name: node.name})
+		}
+	case PEER_FRIEND_ACCEPT:
+		node.lock.Lock()
+		requested := node.sentFriendRequests[hashedPublicKey]
+		delete(node.sentFriendRequests, hashedPublicKey)
+		node.lock.Unlock()
+		if requested {
+			_, err = node.storeUser(peer.publicKeyBytes, message.Name, true)
+		}
+	case PEER_CHAT:
+		return node.receiveMessage(peer, message)
+	case PEER_NETPLAY_INVITE, PEER_NETPLAY_ACCEPT, PEER_NETPLAY_DECLINE:
+		return node.receiveNetplayMessage(peer, message)
+	case PEER_SAVE_READ, PEER_SAVE_WRITE, PEER_SAVE_DELETE:
+		return node.serveSaveRequest(peer, message)
+	case PEER_SAVE_REPLY:
+		return node.receiveSaveReply(peer, message)
+	default:
+		return fmt.Errorf("unknown %q peer message", message.Type)
+	}
+	return
+}
+
+// Decrypt the direct message of a friend, persisting it to the chat
+func (node *FriendNode) receiveMessage(peer *peerConnection, message peerMessage) (err error) {
+	var user sqlite.User
+	if user, err = node.database.GetUserByPublicKey(peer.publicKeyBytes); err != nil || !user.IsFriend {
+		return ErrNotFriend
+	}
+	var payload chatPayload
+	if err = node.receiveEncrypted(peer, message, &payload); err != nil {
+		return
+	}
+	return node.database.StoreChat(&sqlite.Chat{
+		UserID:    user.Id,
+		Timestamp: payload.Timestamp,
+		Message:   payload.Message,
+		Received:  true,
+	})
+}
+
+// Store the user, keeping the stored name and friendship when not given
+func (node *FriendNode) storeUser(publicKey []byte, name string, isFriend bool) (user sqlite.User, err error) {
+	if user, err = node.database.GetUserByPublicKey(publicKey); err != nil {
+		user = sqlite.User{PublicKey: publicKey}
+	}
+	if name != "" {
+		user.Name = sql.NullString{String: name, Valid: true}
+	}
+	user.IsFriend = user.IsFriend || isFriend
+	user.LastSeenOnline = time.Now()
+	err = node.database.StoreUser(&user)
+	return
+}
+
+// Update the last time the known peer user has been seen online
+func (node *FriendNode) updatePresence(peer *peerConnection) {
+	user, err := node.database.GetUserByPublicKey(peer.publicKeyBytes)
+	if err != nil {
+		return
+	}
+	if err = node.database.SetUserLastSeenOnline(&user, time.Now()); err != nil {
+		logrus.Errorf("%+v", err)
+	}
+}
+
+// Periodically tell the connected peers that the node is online
+func (node *FriendNode) announcePresence() {
+	ticker := time.NewTicker(PRESENCE_INTERVAL)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-node.closed:
+			return
+		case <-ticker.C:
+			node.lock.Lock()
+			peers := make([]*peerConnection, 0, len(node.peers))
+			for _, peer := range node.peers {
+				peers = append(peers, peer)
+			}
+			node.lock.Unlock()
+			for _, peer := range peers {
+				if err := peer.send(peerMessage{Type: PEER_PRESENCE}); err != nil {
+					peer.connection.Close()
+				}
+			}
+		}
+	}
+}
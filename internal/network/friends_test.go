@@ -0,0 +1,176 @@
+package network_test
+
+import (
+	"context"
+	"crypto/rsa"
+	"encoding/json"
+	"net"
+	"testing"
+	"time"
+
+	"arkhive.dev/launcher/internal/database/delegate/sqlite"
+	"arkhive.dev/launcher/internal/network"
+	"arkhive.dev/launcher/pkg/encryption"
+	"github.com/stretchr/testify/assert"
+)
+
+type testFriendNode struct {
+	*network.FriendNode
+	database   *sqlite.SQLite
+	privateKey *rsa.PrivateKey
+	name       string
+}
+
+// Start an in-process node listening on the loopback with its own database
+func newTestFriendNode(t *testing.T, name string) testFriendNode {
+	database := &sqlite.SQLite{BasePath: t.TempDir()}
+	assert.Nil(t, database.Open())
+	assert.Nil(t, database.Migrate())
+	t.Cleanup(func() { database.Close() })
+	privateKey, err := encryption.GeneratePairKey(encryption.MIN_KEY_BITS)
+	assert.Nil(t, err)
+	return startTestFriendNode(t, testFriendNode{nil, database, privateKey, name})
+}
+
+func startTestFriendNode(t *testing.T, testNode testFriendNode) testFriendNode {
+	node, err := network.NewFriendNode(testNode.privateKey, testNode.name, testNode.database)
+	assert.Nil(t, err)
+	assert.Nil(t, node.Listen("127.0.0.1:0"))
+	t.Cleanup(node.Close)
+	testNode.FriendNode = node
+	return testNode
+}
+
+// Connect the nodes and make them friends
+func connectTestFriends(t *testing.T, alice testFriendNode, bob testFriendNode) {
+	bobPublicKey, err := alice.Connect(context.Background(), bob.Addr().String())
+	assert.Nil(t, err)
+	assert.Equal(t, bob.GetPublicKey(), bobPublicKey)
+	assert.Eventually(t, func() bool { return bob.IsOnline(alice.GetPublicKey()) }, 5*time.Second, 10*time.Millisecond)
+
+	assert.Nil(t, alice.SendFriendRequest(bobPublicKey))
+	assert.Eventually(t, func() bool {
+		requests, _ := bob.GetFriendRequests()
+		return len(requests) == 1
+	}, 5*time.Second, 10*time.Millisecond)
+	requests, err := bob.GetFriendRequests()
+	assert.Nil(t, err)
+	assert.Equal(t, "alice", requests[0].Name.String)
+	assert.False(t, requests[0].IsFriend)
+
+	assert.Nil(t, bob.AcceptFriendRequest(alice.GetPublicKey()))
+	assert.Eventually(t, func() bool {
+		user, err := alice.database.GetUserByPublicKey(bobPublicKey)
+		return err == nil && user.IsFriend
+	}, 5*time.Second, 10*time.Millisecond)
+}
+
+func TestFriendRequest(t *testing.T) {
+	alice := newTestFriendNode(t, "alice")
+	bob := newTestFriendNode(t, "bob")
+	connectTestFriends(t, alice, bob)
+
+	aliceFriends, err := alice.database.GetFriends()
+	assert.Nil(t, err)
+	assert.Len(t, aliceFriends, 1)
+	assert.Equal(t, "bob", aliceFriends[0].Name.String)
+	bobFriends, err := bob.database.GetFriends()
+	assert.Nil(t, err)
+	assert.Len(t, bobFriends, 1)
+	requests, err := bob.GetFriendRequests()
+	assert.Nil(t, err)
+	assert.Empty(t, requests)
+}
+
+func TestFriendMessages(t *testing.T) {
+	alice := newTestFriendNode(t, "alice")
+	bob := newTestFriendNode(t, "bob")
+	carol := newTestFriendNode(t, "carol")
+	connectTestFriends(t, alice, bob)
+
+	assert.Nil(t, alice.SendMessage(bob.GetPublicKey(), "Ready for a match?"))
+	aliceUser, err := bob.database.GetUserByPublicKey(alice.GetPublicKey())
+	assert.Nil(t, err)
+	assert.Eventually(t, func() bool {
+		chats, _ := bob.database.GetChatsByUser(&aliceUser)
+		return len(chats) == 1
+	}, 5*time.Second, 10*time.Millisecond)
+	chats, err := bob.database.GetChatsByUser(&aliceUser)
+	assert.Nil(t, err)
+	assert.Equal(t, "Ready for a match?", chats[0].Message)
+	assert.True(t, chats[0].Received)
+
+	bobUser, err := alice.database.GetUserByPublicKey(bob.GetPublicKey())
+	assert.Nil(t, err)
+	chats, err = alice.database.GetChatsByUser(&bobUser)
+	assert.Nil(t, err)
+	assert.Len(t, chats, 1)
+	assert.False(t, chats[0].Received)
+
+	_, err = carol.Connect(context.Background(), alice.Addr().String())
+	assert.Nil(t, err)
+	assert.Equal(t, network.ErrNotFriend, carol.SendMessage(alice.GetPublicKey(), "Hello"))
+}
+
+func TestFriendPresence(t *testing.T) {
+	alice := newTestFriendNode(t, "alice")
+	bob := newTestFriendNode(t, "bob")
+	connectTestFriends(t, alice, bob)
+	bobUser, err := alice.database.GetUserByPublicKey(bob.GetPublicKey())
+	assert.Nil(t, err)
+	lastSeenOnline := bobUser.LastSeenOnline
+
+	bob.Close()
+	assert.Eventually(t, func() bool { return !alice.IsOnline(bob.GetPublicKey()) }, 5*time.Second, 10*time.Millisecond)
+	time.Sleep(10 * time.Millisecond)
+
+	restartedBob := startTestFriendNode(t, bob)
+	_, err = restartedBob.Connect(context.Background(), alice.Addr().String())
+	assert.Nil(t, err)
+	assert.Eventually(t, func() bool {
+		user, err := alice.database.GetUserByPublicKey(bob.GetPublicKey())
+		return err == nil && user.LastSeenOnline.After(lastSeenOnline)
+	}, 5*time.Second, 10*time.Millisecond)
+}
+
+// Message of the peer protocol, as sent by a client not signing its messages
+type testPeerMessage struct {
+	Type      string `json:"type"`
+	PublicKey []byte `json:"public_key,omitempty"`
+	Nonce     []byte `json:"nonce,omitempty"`
+	Name      string `json:"name,omitempty"`
+	Sign      []byte `json:"sign,omitempty"`
+}
+
+func TestFriendUnsignedMessage(t *testing.T) {
+	bob := newTestFriendNode(t, "bob")
+	privateKey, err := encryption.GeneratePairKey(encryption.MIN_KEY_BITS)
+	assert.Nil(t, err)
+	publicKey, err := encryption.ExportPublicKey(&privateKey.PublicKey)
+	assert.Nil(t, err)
+
+	connection, err := net.Dial("tcp", bob.Addr().String())
+	assert.Nil(t, err)
+	defer connection.Close()
+	connection.SetDeadline(time.Now().Add(5 * time.Second))
+	encoder := json.NewEncoder(connection)
+	decoder := json.NewDecoder(connection)
+	nonce := make([]byte, 32)
+	assert.Nil(t, encoder.Encode(testPeerMessage{Type: network.PEER_HELLO, PublicKey: publicKey, Nonce: nonce}))
+	var hello, auth testPeerMessage
+	assert.Nil(t, decoder.Decode(&hello))
+	assert.Nil(t, decoder.Decode(&auth))
+	sign, err := encryption.Sign(privateKey, append(hello.Nonce, publicKey...))
+	assert.Nil(t, err)
+	assert.Nil(t, encoder.Encode(testPeerMessage{Type: network.PEER_AUTH, Sign: sign}))
+	assert.Eventually(t, func() bool { return bob.IsOnline(publicKey) }, 5*time.Second, 10*time.Millisecond)
+
+	// The authenticated peer is dropped on the first message without a sign
+	assert.Nil(t, encoder.Encode(testPeerMessage{Type: network.PEER_FRIEND_REQUEST, Name: "mallory"}))
+	var message testPeerMessage
+	assert.NotNil(t, decoder.Decode(&message))
+	assert.Eventually(t, func() bool { return !bob.IsOnline(publicKey) }, 5*time.Second, 10*time.Millisecond)
+	requests, err := bob.GetFriendRequests()
+	assert.Nil(t, err)
+	assert.Empty(t, requests)
+}
@@ -0,0 +1,120 @@
+package network
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"runtime/debug"
+	"time"
+)
+
+// Name used to identify arkHive in the user agent
+const USER_AGENT_PRODUCT = "arkHive"
+
+// Settings of the HTTP client shared by the network handlers
+type HTTPClientOptions struct {
+	// Timeout of the connection, TLS handshake and response headers. The body transfer is not
+	// limited, being bounded by the request context.
+	Timeout time.Duration
+	// Proxy used for every request, the environment variables are used if empty
+	ProxyURL string
+	// PEM files of root certificate authorities trusted along the system ones
+	RootCAFiles []string
+	// User agent of the requests, the arkHive build version is used if empty
+	UserAgent string
+	// Maximum number of redirects followed, no redirects are followed if zero
+	MaxRedirects int
+}
+
+// Create an HTTP client with the given settings
+func NewHTTPClient(options HTTPClientOptions) (client *http.Client, err error) {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = http.ProxyFromEnvironment
+	if options.ProxyURL != "" {
+		var proxyURL *url.URL
+		if proxyURL, err = url.Parse(options.ProxyURL); err != nil {
+			return
+		}
+		transport.Proxy = http.ProxyURL(proxyURL)
+	}
+	if options.Timeout > 0 {
+		transport.DialContext = (&net.Dialer{
+			Timeout:   options.Timeout,
+			KeepAlive: 30 * time.Second,
+		}).DialContext
+		transport.TLSHandshakeTimeout = options.Timeout
+		transport.ResponseHeaderTimeout = options.Timeout
+	}
+	if len(options.RootCAFiles) > 0 {
+		var rootCAs *x509.CertPool
+		if rootCAs, err = loadRootCAs(options.RootCAFiles); err != nil {
+			return
+		}
+		transport.TLSClientConfig = &tls.Config{RootCAs: rootCAs}
+	}
+
+	userAgent := options.UserAgent
+	if userAgent == "" {
+		userAgent = DefaultUserAgent()
+	}
+	maxRedirects := options.MaxRedirects
+	client = &http.Client{
+		Transport: &userAgentTransport{
+			userAgent: userAgent,
+			transport: transport,
+		},
+		CheckRedirect: func(request *http.Request, via []*http.Request) error {
+			if len(via) > maxRedirects {
+				return fmt.Errorf("stopped after %d redirects", maxRedirects)
+			}
+			return nil
+		},
+	}
+	return
+}
+
+// The user agent reporting the arkHive build version
+func DefaultUserAgent() string {
+	version := "(devel)"
+	if buildInfo, ok := debug.ReadBuildInfo(); ok && buildInfo.Main.Version != "" {
+		version = buildInfo.Main.Version
+	}
+	return USER_AGENT_PRODUCT + "/" + version
+}
+
+// Load the system certificate pool extended with the certificates of the PEM files
+func loadRootCAs(rootCAFiles []string) (rootCAs *x509.CertPool, err error) {
+	if rootCAs, err = x509.SystemCertPool(); err != nil || rootCAs == nil {
+		rootCAs = x509.NewCertPool()
+	}
+	for _, rootCAFile := range rootCAFiles {
+		var rootCAData []byte
+		if rootCAData, err = os.ReadFile(rootCAFile); err != nil {
+			return
+		}
+		if !rootCAs.AppendCertsFromPEM(rootCAData) {
+			err = errors.New("no certificates found in " + rootCAFile)
+			return
+		}
+	}
+	return
+}
+
+// Transport setting the user agent on requests without one
+type userAgentTransport struct {
+	userAgent string
+	transport http.RoundTripper
+}
+
+func (userAgentTransport *userAgentTransport) RoundTrip(request *http.Request) (*http.Response, error) {
+	if request.Header.Get("User-Agent") == "" {
+		request = request.Clone(request.Context())
+		request.Header.Set("User-Agent", userAgentTransport.userAgent)
+	}
+	return userAgentTransport.transport.RoundTrip(request)
+}
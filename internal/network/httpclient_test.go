@@ -0,0 +1,62 @@
+package network_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"arkhive.dev/launcher/internal/network"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHTTPClientUserAgent(t *testing.T) {
+	var userAgent string
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		userAgent = request.UserAgent()
+	}))
+	defer server.Close()
+
+	client, err := network.NewHTTPClient(network.HTTPClientOptions{})
+	assert.Nil(t, err)
+	response, err := client.Get(server.URL)
+	assert.Nil(t, err)
+	response.Body.Close()
+	assert.Equal(t, network.DefaultUserAgent(), userAgent)
+
+	client, _ = network.NewHTTPClient(network.HTTPClientOptions{UserAgent: "custom/1.0"})
+	response, err = client.Get(server.URL)
+	assert.Nil(t, err)
+	response.Body.Close()
+	assert.Equal(t, "custom/1.0", userAgent)
+}
+
+func TestHTTPClientMaxRedirects(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		http.Redirect(writer, request, "/loop", http.StatusFound)
+	}))
+	defer server.Close()
+
+	client, _ := network.NewHTTPClient(network.HTTPClientOptions{MaxRedirects: 2})
+	_, err := client.Get(server.URL)
+	assert.NotNil(t, err)
+}
+
+func TestHTTPClientProxy(t *testing.T) {
+	var proxiedURL string
+	proxy := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		proxiedURL = request.URL.String()
+	}))
+	defer proxy.Close()
+
+	client, err := network.NewHTTPClient(network.HTTPClientOptions{ProxyURL: proxy.URL})
+	assert.Nil(t, err)
+	response, err := client.Get("http://arkhive.invalid/catalog.json")
+	assert.Nil(t, err)
+	response.Body.Close()
+	assert.Equal(t, "http://arkhive.invalid/catalog.json", proxiedURL)
+}
+
+func TestHTTPClientRootCAs(t *testing.T) {
+	_, err := network.NewHTTPClient(network.HTTPClientOptions{RootCAFiles: []string{"missing.pem"}})
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,354 @@
+package network
+
+import (
+	"crypto/rsa"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"arkhive.dev/launcher/internal/network/resources"
+	"arkhive.dev/launcher/pkg/encryption"
+	"github.com/sirupsen/logrus"
+)
+
+// Interval of the announcements to the LAN
+const LAN_ANNOUNCE_INTERVAL = 30 * time.Second
+
+// Time after which a silent LAN peer is forgotten
+const LAN_PEER_TIMEOUT = 3 * LAN_ANNOUNCE_INTERVAL
+
+// Maximum clock difference allowed between the announcement timestamp and the receiver
+const LAN_ANNOUNCEMENT_MAX_AGE = 5 * time.Minute
+
+const MAX_LAN_ANNOUNCEMENT_SIZE = 16 * 1024
+
+/*
+Announcement of a LAN peer, broadcast as a JSON object per UDP datagram:
+
+	{
+	  "certificate": Account certificate of the peer, signed by the undertow,
+	  "share_port": TCP port the peer serves its game packages on,
+	  "timestamp": Unix timestamp of the announcement,
+	  "sign": "RSA-PSS SHA-256 signature of the announcement without the sign, made with the account key."
+	}
+*/
+type lanAnnouncement struct {
+	Certificate *AccountCertificate `json:"certificate"`
+	SharePort   int                 `json:"share_port"`
+	Timestamp   int64               `json:"timestamp"`
+	Sign        []byte              `json:"sign,omitempty"`
+}
+
+func (announcement lanAnnouncement) getSignedData() ([]byte, error) {
+	announcement.Sign = nil
+	return json.Marshal(announcement)
+}
+
+// Peer discovered on the LAN
+type LANPeer struct {
+	Certificate *AccountCertificate
+	// Address serving the peer game packages
+	ShareAddress string
+	LastSeen     time.Time
+}
+
+/*
+Node of the LAN discovery, announcing the account to the local network and sharing
+the downloaded game packages with the discovered peers.
+
+Only accounts with an official certificate take part in the discovery: every
+announcement carries the certificate, verified against the undertow key, and is
+signed with the account key. The packages are served by their SHA-256 checksum
+and verified by the downloading peer against the catalog one.
+*/
+type LANNode struct {
+	privateKey        *rsa.PrivateKey
+	certificate       *AccountCertificate
+	undertowPublicKey *rsa.PublicKey
+	share             *lanShare
+	connection        *net.UDPConn
+	broadcastAddress  *net.UDPAddr
+	shareListener     net.Listener
+	shareServer       *http.Server
+	// Discovered peers by certificate public key
+	peers  map[string]LANPeer
+	lock   sync.Mutex
+	closed chan struct{}
+}
+
+// Start the LAN discovery of the account, sharing the downloaded game packages
+func (networkEngine *NetworkEngine) StartLANNode() (node *LANNode, err error) {
+	networkEngine.lanLock.Lock()
+	defer networkEngine.lanLock.Unlock()
+	if networkEngine.lanNode != nil {
+		return networkEngine.lanNode, nil
+	}
+	certificate, certificateStatus := networkEngine.getCertificate()
+	if !networkEngine.isInitialized() || certificateStatus != OFFICIAL {
+		return nil, errors.New("an official account certificate is required to join the LAN")
+	}
+	if err = os.MkdirAll(networkEngine.packagesPath, 0755); err != nil {
+		return
+	}
+	privateKey := networkEngine.getAccountKey()
+	if privateKey == nil {
+		return nil, errors.New("account key not available")
+	}
+	if node, err = NewLANNode(privateKey, certificate, networkEngine.getUndertowPublicKey(), networkEngine.packagesPath); err != nil {
+		return
+	}
+	if err = node.Listen(networkEngine.lanDiscoveryAddress, networkEngine.lanShareAddress, networkEngine.lanBroadcastAddress); err != nil {
+		return nil, err
+	}
+	networkEngine.lanNode = node
+	return
+}
+
+func NewLANNode(privateKey *rsa.PrivateKey, certificate *AccountCertificate, undertowPublicKey *rsa.PublicKey, sharePath string) (node *LANNode, err error) {
+	if undertowPublicKey == nil {
+		return nil, errors.New("undertow file not downloaded")
+	}
+	if EvaluateCertificate(certificate, privateKey, undertowPublicKey) != OFFICIAL {
+		return nil, errors.New("the account certificate is not official")
+	}
+	node = &LANNode{
+		privateKey:        privateKey,
+		certificate:       certificate,
+		undertowPublicKey: undertowPublicKey,
+		share:             newLANShare(sharePath),
+		peers:             map[string]LANPeer{},
+		closed:            make(chan struct{}),
+	}
+	return
+}
+
+// Receive the announcements on the discovery address, serve the packages on the share
+// address and start announcing the account to the broadcast address
+func (node *LANNode) Listen(discoveryAddress string, shareAddress string, broadcastAddress string) (err error) {
+	if node.broadcastAddress, err = net.ResolveUDPAddr("udp4", broadcastAddress); err != nil {
+		return
+	}
+	var udpAddress *net.UDPAddr
+	if udpAddress, err = net.ResolveUDPAddr("udp4", discoveryAddress); err != nil {
+		return
+	}
+	if node.connection, err = net.ListenUDP("udp4", udpAddress); err != nil {
+		return
+	}
+	if node.shareListener, err = net.Listen("tcp4", shareAddress); err != nil {
+		node.connection.Close()
+		return
+	}
+	node.shareServer = &http.Server{Handler: node.share, ReadHeaderTimeout: PEER_HANDSHAKE_TIMEOUT}
+	go func() {
+		if err := node.shareServer.Serve(node.shareListener); err != nil && err != http.ErrServerClosed {
+			logrus.Errorf("%+v", err)
+		}
+	}()
+	go node.receiveAnnouncements()
+	go node.announce()
+	return
+}
+
+// The UDP address receiving the announcements
+func (node *LANNode) Addr() net.Addr {
+	return node.connection.LocalAddr()
+}
+
+// The address serving the game packages
+func (node *LANNode) ShareAddr() net.Addr {
+	return node.shareListener.Addr()
+}
+
+// Stop the discovery and the package sharing
+func (node *LANNode) Close() {
+	node.lock.Lock()
+	defer node.lock.Unlock()
+	select {
+	case <-node.closed:
+		return
+	default:
+		close(node.closed)
+	}
+	if node.connection != nil {
+		node.connection.Close()
+	}
+	if node.shareServer != nil {
+		node.shareServer.Close()
+	}
+}
+
+// The peers announced within the peer timeout
+func (node *LANNode) GetPeers() (peers []LANPeer) {
+	node.lock.Lock()
+	defer node.lock.Unlock()
+	for publicKey, peer := range node.peers {
+		if time.Since(peer.LastSeen) > LAN_PEER_TIMEOUT {
+			delete(node.peers, publicKey)
+			continue
+		}
+		peers = append(peers, peer)
+	}
+	return
+}
+
+// The base URLs of the package shares of the discovered peers
+func (node *LANNode) GetPeerShareURLs() (shareURLs []url.URL) {
+	for _, peer := range node.GetPeers() {
+		shareURLs = append(shareURLs, url.URL{Scheme: "http", Host: peer.ShareAddress})
+	}
+	return
+}
+
+// Broadcast the announcement of the account
+func (node *LANNode) Announce() (err error) {
+	announcement := lanAnnouncement{
+		Certificate: node.certificate,
+		SharePort:   node.ShareAddr().(*net.TCPAddr).Port,
+		Timestamp:   time.Now().Unix(),
+	}
+	var signedData []byte
+	if signedData, err = announcement.getSignedData(); err != nil {
+		return
+	}
+	if announcement.Sign, err = encryption.Sign(node.privateKey, signedData); err != nil {
+		return
+	}
+	var announcementData []byte
+	if announcementData, err = json.Marshal(announcement); err != nil {
+		return
+	}
+	_, err = node.connection.WriteToUDP(announcementData, node.broadcastAddress)
+	return
+}
+
+func (node *LANNode) announce() {
+	ticker := time.NewTicker(LAN_ANNOUNCE_INTERVAL)
+	defer ticker.Stop()
+	for {
+		if err := node.Announce(); err != nil {
+			logrus.Warnf("Cannot announce the account to the LAN: %v", err)
+		}
+		select {
+		case <-node.closed:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (node *LANNode) receiveAnnouncements() {
+	buffer := make([]byte, MAX_LAN_ANNOUNCEMENT_SIZE)
+	for {
+		size, address, err := node.connection.ReadFromUDP(buffer)
+		if err != nil {
+			select {
+			case <-node.closed:
+			default:
+				logrus.Errorf("%+v", err)
+			}
+			return
+		}
+		if err = node.handleAnnouncement(buffer[:size], address); err != nil {
+			logrus.Debugf("%s: Discarded LAN announcement: %v", address.String(), err)
+		}
+	}
+}
+
+// Verify the announcement certificate and sign, storing the announcing peer
+func (node *LANNode) handleAnnouncement(announcementData []byte, address *net.UDPAddr) (err error) {
+	var announcement lanAnnouncement
+	if err = json.Unmarshal(announcementData, &announcement); err != nil {
+		return
+	}
+	if announcement.Certificate == nil {
+		return errors.New("missing certificate")
+	}
+	if announcement.Certificate.PublicKey == node.certificate.PublicKey {
+		return
+	}
+	timestamp := time.Unix(announcement.Timestamp, 0)
+	if age := time.Since(timestamp); age > LAN_ANNOUNCEMENT_MAX_AGE || age < -LAN_ANNOUNCEMENT_MAX_AGE {
+		return fmt.Errorf("announcement timestamp %s out of range", timestamp)
+	}
+	if announcement.SharePort <= 0 || announcement.SharePort > 65535 {
+		return errors.New("invalid share port")
+	}
+	if err = announcement.Certificate.VerifySign(node.undertowPublicKey); err != nil {
+		return
+	}
+	var publicKey *rsa.PublicKey
+	if publicKey, err = announcement.Certificate.GetPublicKey(); err != nil {
+		return
+	}
+	var signedData []byte
+	if signedData, err = announcement.getSignedData(); err != nil {
+		return
+	}
+	if err = encryption.Verify(publicKey, signedData, announcement.Sign); err != nil {
+		return
+	}
+	shareAddress := net.JoinHostPort(address.IP.String(), strconv.Itoa(announcement.SharePort))
+	node.lock.Lock()
+	defer node.lock.Unlock()
+	// A replayed announcement can neither move the peer to another address nor renew it
+	if peer, ok := node.peers[announcement.Certificate.PublicKey]; ok && !timestamp.After(peer.LastSeen) {
+		if peer.ShareAddress != shareAddress {
+			return errors.New("stale announcement")
+		}
+		return
+	}
+	node.peers[announcement.Certificate.PublicKey] = LANPeer{
+		Certificate:  announcement.Certificate,
+		ShareAddress: shareAddress,
+		LastSeen:     timestamp,
+	}
+	return
+}
+
+/*
+Start the download of a game package in the packages folder, where it's shared with the
+LAN peers, verifying it against its catalog SHA-256 checksum.
+
+The package is fetched from the LAN peers when the LAN node is running, otherwise or
+when no peer shares it, it's fetched from its catalog URL.
+*/
+func (networkEngine *NetworkEngine) AddPackageResource(url *url.URL, sha256 string, allowedFiles ...string) (resource *resources.Resource, err error) {
+	var resourceHandler resources.ResourceHandler
+	if resourceHandler, err = networkEngine.newResourceHandler(url); err != nil {
+		return
+	}
+	// Packages without a checksum are never shared
+	packagePath := networkEngine.tempPath
+	if sha256 != "" {
+		packagePath = filepath.Join(networkEngine.packagesPath, strings.ToLower(sha256))
+		peerResource := &resources.PeerResource{
+			URL:      *url,
+			Sha256:   sha256,
+			Client:   networkEngine.httpClient,
+			Fallback: resourceHandler,
+		}
+		networkEngine.lanLock.Lock()
+		if lanNode := networkEngine.lanNode; lanNode != nil {
+			peerResource.Peers = lanNode.GetPeerShareURLs
+		}
+		networkEngine.lanLock.Unlock()
+		resourceHandler = peerResource
+	}
+	if err = os.MkdirAll(packagePath, 0755); err != nil {
+		return
+	}
+	resource = resources.NewResource(resourceHandler, packagePath, allowedFiles)
+	networkEngine.applyBandwidthPolicy(resource, resources.NORMAL_PRIORITY)
+	go resource.Download()
+	return
+}
@@ -0,0 +1,101 @@
+package network_test
+
+import (
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"arkhive.dev/launcher/internal/network"
+	"arkhive.dev/launcher/internal/network/resources"
+	"arkhive.dev/launcher/pkg/encryption"
+	"github.com/stretchr/testify/assert"
+)
+
+// Start an in-process LAN node on the loopback, announcing itself to the broadcast address
+func newTestLANNode(t *testing.T, undertowKey *rsa.PrivateKey, sharePath string, broadcastAddress string) *network.LANNode {
+	accountKey, err := encryption.GeneratePairKey(encryption.MIN_KEY_BITS)
+	assert.Nil(t, err)
+	certificate := newTestCertificate(t, &accountKey.PublicKey)
+	assert.Nil(t, certificate.SignWith(undertowKey))
+	node, err := network.NewLANNode(accountKey, certificate, &undertowKey.PublicKey, sharePath)
+	assert.Nil(t, err)
+	assert.Nil(t, node.Listen("127.0.0.1:0", "127.0.0.1:0", broadcastAddress))
+	t.Cleanup(node.Close)
+	return node
+}
+
+func TestLANPackageSharing(t *testing.T) {
+	undertowKey, err := encryption.GeneratePairKey(encryption.MIN_KEY_BITS)
+	assert.Nil(t, err)
+	bob := newTestLANNode(t, undertowKey, t.TempDir(), "127.0.0.1:9")
+	aliceSharePath := t.TempDir()
+	data := []byte("arkHive game package")
+	hash := sha256.Sum256(data)
+	checksum := hex.EncodeToString(hash[:])
+	assert.Nil(t, os.MkdirAll(filepath.Join(aliceSharePath, checksum), 0755))
+	assert.Nil(t, os.WriteFile(filepath.Join(aliceSharePath, checksum, "game.zip"), data, 0644))
+	// Packages outside their checksum folder are never shared
+	unlistedData := []byte("arkHive unlisted file")
+	unlistedHash := sha256.Sum256(unlistedData)
+	assert.Nil(t, os.WriteFile(filepath.Join(aliceSharePath, "unlisted.zip"), unlistedData, 0644))
+	alice := newTestLANNode(t, undertowKey, aliceSharePath, bob.Addr().String())
+	assert.Eventually(t, func() bool { return len(bob.GetPeers()) == 1 }, 5*time.Second, 10*time.Millisecond)
+	assert.Equal(t, alice.ShareAddr().String(), bob.GetPeers()[0].ShareAddress)
+
+	response, err := http.Get("http://" + alice.ShareAddr().String() + resources.PeerPackagePath(hex.EncodeToString(unlistedHash[:])))
+	assert.Nil(t, err)
+	response.Body.Close()
+	assert.Equal(t, http.StatusNotFound, response.StatusCode)
+
+	destinationPath := t.TempDir()
+	handler := &resources.PeerResource{
+		URL:    url.URL{Scheme: "https", Host: "arkhive.dev", Path: "/game.zip"},
+		Sha256: checksum,
+		Peers:  bob.GetPeerShareURLs,
+	}
+	resource := resources.NewResource(handler, destinationPath, []string{})
+	resource.Download()
+	assert.Equal(t, resources.DOWNLOADED, resource.Status)
+	downloaded, err := os.ReadFile(filepath.Join(destinationPath, "game.zip"))
+	assert.Nil(t, err)
+	assert.Equal(t, data, downloaded)
+
+	handler.Sha256 = "9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08"
+	resource = resources.NewResource(handler, t.TempDir(), []string{})
+	resource.Download()
+	assert.Equal(t, resources.ERROR, resource.Status)
+}
+
+func TestLANRejectsForeignCertificate(t *testing.T) {
+	undertowKey, err := encryption.GeneratePairKey(encryption.MIN_KEY_BITS)
+	assert.Nil(t, err)
+	foreignUndertowKey, err := encryption.GeneratePairKey(encryption.MIN_KEY_BITS)
+	assert.Nil(t, err)
+	bob := newTestLANNode(t, undertowKey, t.TempDir(), "127.0.0.1:9")
+	eve := newTestLANNode(t, foreignUndertowKey, t.TempDir(), bob.Addr().String())
+	alice := newTestLANNode(t, undertowKey, t.TempDir(), bob.Addr().String())
+	assert.Nil(t, eve.Announce())
+
+	assert.Eventually(t, func() bool { return len(bob.GetPeers()) == 1 }, 5*time.Second, 10*time.Millisecond)
+	time.Sleep(50 * time.Millisecond)
+	peers := bob.GetPeers()
+	assert.Len(t, peers, 1)
+	assert.Equal(t, alice.ShareAddr().String(), peers[0].ShareAddress)
+}
+
+func TestLANNodeRequiresOfficialCertificate(t *testing.T) {
+	undertowKey, err := encryption.GeneratePairKey(encryption.MIN_KEY_BITS)
+	assert.Nil(t, err)
+	accountKey, err := encryption.GeneratePairKey(encryption.MIN_KEY_BITS)
+	assert.Nil(t, err)
+	certificate := newTestCertificate(t, &accountKey.PublicKey)
+	assert.Nil(t, certificate.SignWith(accountKey))
+	_, err = network.NewLANNode(accountKey, certificate, &undertowKey.PublicKey, t.TempDir())
+	assert.NotNil(t, err)
+}
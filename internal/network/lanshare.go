@@ -0,0 +1,96 @@
+package network
+
+import (
+	"io/fs"
+	"net/http"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"arkhive.dev/launcher/internal/network/resources"
+	"github.com/sirupsen/logrus"
+)
+
+var sha256Pattern = regexp.MustCompile("^[0-9a-f]{64}$")
+
+type sharedPackage struct {
+	path    string
+	size    int64
+	modTime time.Time
+	sha256  string
+}
+
+/*
+HTTP handler serving the packages of a folder by their SHA-256 checksum.
+
+The server is not authenticated, any host of the LAN could request a package. Only the
+packages downloaded with a catalog checksum are served: they are stored in a subfolder
+named by the checksum, and a file of the subfolder is served only when it matches it.
+*/
+type lanShare struct {
+	path string
+	// Packages by path, hashed again only when their size or modification time change
+	packages map[string]sharedPackage
+	lock     sync.Mutex
+}
+
+func newLANShare(sharePath string) *lanShare {
+	return &lanShare{
+		path:     sharePath,
+		packages: map[string]sharedPackage{},
+	}
+}
+
+func (share *lanShare) ServeHTTP(writer http.ResponseWriter, request *http.Request) {
+	if request.Method != http.MethodGet && request.Method != http.MethodHead {
+		http.Error(writer, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	sha256 := strings.TrimPrefix(request.URL.Path, resources.PeerPackagePath(""))
+	if !sha256Pattern.MatchString(sha256) {
+		http.NotFound(writer, request)
+		return
+	}
+	packagePath := share.find(sha256)
+	if packagePath == "" {
+		http.NotFound(writer, request)
+		return
+	}
+	logrus.Debugf("%s: Sharing the package %s", request.RemoteAddr, filepath.Base(packagePath))
+	http.ServeFile(writer, request, packagePath)
+}
+
+// Find the package with the checksum in its subfolder, hashing the changed files outside the lock
+func (share *lanShare) find(sha256 string) (packagePath string) {
+	filepath.WalkDir(filepath.Join(share.path, sha256), func(filePath string, entry fs.DirEntry, err error) error {
+		if err != nil || !entry.Type().IsRegular() {
+			return nil
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return nil
+		}
+		share.lock.Lock()
+		cached, ok := share.packages[filePath]
+		share.lock.Unlock()
+		if !ok || cached.size != info.Size() || !cached.modTime.Equal(info.ModTime()) {
+			checksum, err := resources.FileSha256(filePath)
+			if err != nil {
+				logrus.Errorf("%+v", err)
+				return nil
+			}
+			cached = sharedPackage{filePath, info.Size(), info.ModTime(), checksum}
+			share.lock.Lock()
+			share.packages[filePath] = cached
+			share.lock.Unlock()
+		}
+		if cached.sha256 == sha256 {
+			packagePath = filePath
+			return filepath.SkipAll
+		}
+		return nil
+	})
+	return
+}
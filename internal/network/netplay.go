@@ -0,0 +1,261 @@
+package network
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+
+	"arkhive.dev/launcher/internal/database/delegate/sqlite"
+	"arkhive.dev/launcher/internal/network/resources"
+)
+
+// Default RetroArch netplay port
+const NETPLAY_DEFAULT_PORT = 55435
+
+// RetroArch hotkey switching between playing and spectating, disabled outside netplay
+const NETPLAY_GAME_WATCH_KEY = "i"
+
+const netplayPasswordSize = 16
+const netplaySessionIDSize = 16
+
+var ErrNetplayMismatch = errors.New("the core or the game differ from the netplay host ones")
+var ErrNoNetplayInvite = errors.New("no netplay invite from the user")
+
+type NetplayStatus int
+
+const (
+	NETPLAY_INVITED NetplayStatus = iota
+	NETPLAY_ACCEPTED
+	NETPLAY_DECLINED
+)
+
+// Netplay session between the node and a friend, hosted by one of them
+type NetplaySession struct {
+	// Random identifier of the session, echoed by the friend answering the invite
+	ID       string
+	GameSlug string
+	// Hex SHA-256 checksums of the core and the game ROM, equal on both sides
+	CoreHash string
+	RomHash  string
+	Hosting  bool
+	// Address of the host, empty when hosting
+	Host string
+	Port int
+	// Password of the session, known only to the friends
+	Password string
+	Nickname string
+	Status   NetplayStatus
+	// Reason of the decline
+	Reason string
+}
+
+// Netplay session parameters, encrypted in the netplay messages payload
+type netplayPayload struct {
+	SessionID string `json:"session_id"`
+	GameSlug  string `json:"game_slug"`
+	CoreHash  string `json:"core_hash"`
+	RomHash   string `json:"rom_hash"`
+	Port      int    `json:"port,omitempty"`
+	Password  string `json:"password,omitempty"`
+	Reason    string `json:"reason,omitempty"`
+}
+
+// Compute the checksums of the core and the game ROM compared by the netplay peers
+func HashNetplayFiles(corePath string, romPath string) (coreHash string, romHash string, err error) {
+	if coreHash, err = resources.FileSha256(corePath); err != nil {
+		return
+	}
+	romHash, err = resources.FileSha256(romPath)
+	return
+}
+
+// The RetroArch command line arguments of the session
+func (session *NetplaySession) GetArguments() (arguments []string) {
+	if session.Hosting {
+		arguments = append(arguments, "--host")
+	} else {
+		arguments = append(arguments, "--connect", session.Host)
+	}
+	return append(arguments, "--port", strconv.Itoa(session.Port), "--nick", session.Nickname)
+}
+
+// The RetroArch configuration override of the session
+func (session *NetplaySession) GetConfig() map[string]interface{} {
+	config := map[string]interface{}{
+		"netplay_nickname":         session.Nickname,
+		"netplay_ip_port":          session.Port,
+		"netplay_password":         session.Password,
+		"input_netplay_game_watch": NETPLAY_GAME_WATCH_KEY,
+	}
+	if !session.Hosting {
+		config["netplay_ip_address"] = session.Host
+	}
+	return config
+}
+
+// Invite the connected friend to the netplay session of the game hosted on the port
+func (node *FriendNode) HostNetplay(publicKey []byte, gameSlug string, coreHash string, romHash string, port int) (session NetplaySession, err error) {
+	var user sqlite.User
+	if user, err = node.database.GetUserByPublicKey(publicKey); err != nil || !user.IsFriend {
+		return session, ErrNotFriend
+	}
+	peer := node.getPeer(publicKey)
+	if peer == nil {
+		return session, ErrPeerOffline
+	}
+	password := make([]byte, netplayPasswordSize)
+	if _, err = rand.Read(password); err != nil {
+		return
+	}
+	sessionID := make([]byte, netplaySessionIDSize)
+	if _, err = rand.Read(sessionID); err != nil {
+		return
+	}
+	session = NetplaySession{
+		ID:       hex.EncodeToString(sessionID),
+		GameSlug: gameSlug,
+		CoreHash: coreHash,
+		RomHash:  romHash,
+		Hosting:  true,
+		Port:     port,
+		Password: hex.EncodeToString(password),
+		Nickname: node.name,
+		Status:   NETPLAY_INVITED,
+	}
+	node.lock.Lock()
+	node.hostedNetplaySessions[sqlite.HashPublicKey(publicKey)] = &session
+	node.lock.Unlock()
+	err = node.sendEncrypted(peer, PEER_NETPLAY_INVITE, netplayPayload{
+		SessionID: session.ID,
+		GameSlug:  gameSlug,
+		CoreHash:  coreHash,
+		RomHash:   romHash,
+		Port:      port,
+		Password:  session.Password,
+	})
+	return
+}
+
+// The netplay session hosted for the friend, accepted once the friend joins it
+func (node *FriendNode) GetHostedNetplaySession(publicKey []byte) (session NetplaySession, ok bool) {
+	node.lock.Lock()
+	defer node.lock.Unlock()
+	var hostedSession *NetplaySession
+	if hostedSession, ok = node.hostedNetplaySessions[sqlite.HashPublicKey(publicKey)]; ok {
+		session = *hostedSession
+	}
+	return
+}
+
+// The pending netplay invite of the friend
+func (node *FriendNode) GetNetplayInvite(publicKey []byte) (session NetplaySession, ok bool) {
+	node.lock.Lock()
+	defer node.lock.Unlock()
+	var invite *NetplaySession
+	if invite, ok = node.netplayInvites[sqlite.HashPublicKey(publicKey)]; ok {
+		session = *invite
+	}
+	return
+}
+
+// Join the netplay session of the friend if the local core and game ROM checksums match the host ones
+func (node *FriendNode) JoinNetplay(publicKey []byte, coreHash string, romHash string) (session NetplaySession, err error) {
+	hashedPublicKey := sqlite.HashPublicKey(publicKey)
+	node.lock.Lock()
+	invite, ok := node.netplayInvites[hashedPublicKey]
+	delete(node.netplayInvites, hashedPublicKey)
+	node.lock.Unlock()
+	if !ok {
+		return session, ErrNoNetplayInvite
+	}
+	peer := node.getPeer(publicKey)
+	if peer == nil {
+		return session, ErrPeerOffline
+	}
+	payload := netplayPayload{SessionID: invite.ID, GameSlug: invite.GameSlug, CoreHash: coreHash, RomHash: romHash}
+	if coreHash != invite.CoreHash || romHash != invite.RomHash {
+		payload.Reason = ErrNetplayMismatch.Error()
+		if err = node.sendEncrypted(peer, PEER_NETPLAY_DECLINE, payload); err != nil {
+			return
+		}
+		return session, ErrNetplayMismatch
+	}
+	if err = node.sendEncrypted(peer, PEER_NETPLAY_ACCEPT, payload); err != nil {
+		return
+	}
+	session = *invite
+	session.Nickname = node.name
+	session.Status = NETPLAY_ACCEPTED
+	return
+}
+
+// Decline the netplay invite of the friend
+func (node *FriendNode) DeclineNetplay(publicKey []byte) (err error) {
+	hashedPublicKey := sqlite.HashPublicKey(publicKey)
+	node.lock.Lock()
+	invite, ok := node.netplayInvites[hashedPublicKey]
+	delete(node.netplayInvites, hashedPublicKey)
+	node.lock.Unlock()
+	if !ok {
+		return ErrNoNetplayInvite
+	}
+	peer := node.getPeer(publicKey)
+	if peer == nil {
+		return ErrPeerOffline
+	}
+	return node.sendEncrypted(peer, PEER_NETPLAY_DECLINE, netplayPayload{SessionID: invite.ID, GameSlug: invite.GameSlug, Reason: "declined"})
+}
+
+func (node *FriendNode) receiveNetplayMessage(peer *peerConnection, message peerMessage) (err error) {
+	var user sqlite.User
+	if user, err = node.database.GetUserByPublicKey(peer.publicKeyBytes); err != nil || !user.IsFriend {
+		return ErrNotFriend
+	}
+	var payload netplayPayload
+	if err = node.receiveEncrypted(peer, message, &payload); err != nil {
+		return
+	}
+	hashedPublicKey := sqlite.HashPublicKey(peer.publicKeyBytes)
+	node.lock.Lock()
+	defer node.lock.Unlock()
+	if message.Type == PEER_NETPLAY_INVITE {
+		if payload.Port <= 0 || payload.Port > 65535 {
+			return fmt.Errorf("invalid netplay port %d", payload.Port)
+		}
+		var host string
+		if host, _, err = net.SplitHostPort(peer.connection.RemoteAddr().String()); err != nil {
+			return
+		}
+		if payload.SessionID == "" {
+			return errors.New("missing netplay session identifier")
+		}
+		node.netplayInvites[hashedPublicKey] = &NetplaySession{
+			ID:       payload.SessionID,
+			GameSlug: payload.GameSlug,
+			CoreHash: payload.CoreHash,
+			RomHash:  payload.RomHash,
+			Host:     host,
+			Port:     payload.Port,
+			Password: payload.Password,
+			Status:   NETPLAY_INVITED,
+		}
+		return
+	}
+	session, ok := node.hostedNetplaySessions[hashedPublicKey]
+	if !ok || session.ID != payload.SessionID || session.GameSlug != payload.GameSlug {
+		return errors.New("no netplay session hosted for the user")
+	}
+	if message.Type == PEER_NETPLAY_ACCEPT && payload.CoreHash == session.CoreHash && payload.RomHash == session.RomHash {
+		session.Status = NETPLAY_ACCEPTED
+		return
+	}
+	session.Status = NETPLAY_DECLINED
+	session.Reason = payload.Reason
+	if message.Type == PEER_NETPLAY_ACCEPT {
+		session.Reason = ErrNetplayMismatch.Error()
+	}
+	return
+}
@@ -0,0 +1,77 @@
+package network_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"arkhive.dev/launcher/internal/network"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHashNetplayFiles(t *testing.T) {
+	corePath := filepath.Join(t.TempDir(), "core.so")
+	romPath := filepath.Join(t.TempDir(), "game.sfc")
+	assert.Nil(t, os.WriteFile(corePath, []byte("core"), 0644))
+	assert.Nil(t, os.WriteFile(romPath, []byte("game"), 0644))
+	coreHash, romHash, err := network.HashNetplayFiles(corePath, romPath)
+	assert.Nil(t, err)
+	assert.Len(t, coreHash, 64)
+	assert.NotEqual(t, coreHash, romHash)
+}
+
+func TestNetplaySession(t *testing.T) {
+	alice := newTestFriendNode(t, "alice")
+	bob := newTestFriendNode(t, "bob")
+	connectTestFriends(t, alice, bob)
+
+	hostedSession, err := alice.HostNetplay(bob.GetPublicKey(), "super_mario_world", "core", "rom", network.NETPLAY_DEFAULT_PORT)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"--host", "--port", "55435", "--nick", "alice"}, hostedSession.GetArguments())
+	assert.Eventually(t, func() bool {
+		_, ok := bob.GetNetplayInvite(alice.GetPublicKey())
+		return ok
+	}, 5*time.Second, 10*time.Millisecond)
+
+	session, err := bob.JoinNetplay(alice.GetPublicKey(), "core", "rom")
+	assert.Nil(t, err)
+	assert.NotEmpty(t, session.ID)
+	assert.Equal(t, hostedSession.ID, session.ID)
+	assert.Equal(t, []string{"--connect", "127.0.0.1", "--port", "55435", "--nick", "bob"}, session.GetArguments())
+	config := session.GetConfig()
+	assert.Equal(t, hostedSession.Password, config["netplay_password"])
+	assert.Equal(t, "127.0.0.1", config["netplay_ip_address"])
+	assert.Equal(t, network.NETPLAY_GAME_WATCH_KEY, config["input_netplay_game_watch"])
+	assert.Eventually(t, func() bool {
+		session, _ := alice.GetHostedNetplaySession(bob.GetPublicKey())
+		return session.Status == network.NETPLAY_ACCEPTED
+	}, 5*time.Second, 10*time.Millisecond)
+}
+
+func TestNetplayMismatch(t *testing.T) {
+	alice := newTestFriendNode(t, "alice")
+	bob := newTestFriendNode(t, "bob")
+	carol := newTestFriendNode(t, "carol")
+	connectTestFriends(t, alice, bob)
+
+	_, err := alice.HostNetplay(bob.GetPublicKey(), "super_mario_world", "core", "rom", network.NETPLAY_DEFAULT_PORT)
+	assert.Nil(t, err)
+	assert.Eventually(t, func() bool {
+		_, ok := bob.GetNetplayInvite(alice.GetPublicKey())
+		return ok
+	}, 5*time.Second, 10*time.Millisecond)
+	_, err = bob.JoinNetplay(alice.GetPublicKey(), "core", "patched rom")
+	assert.Equal(t, network.ErrNetplayMismatch, err)
+	assert.Eventually(t, func() bool {
+		session, _ := alice.GetHostedNetplaySession(bob.GetPublicKey())
+		return session.Status == network.NETPLAY_DECLINED
+	}, 5*time.Second, 10*time.Millisecond)
+	_, err = bob.JoinNetplay(alice.GetPublicKey(), "core", "rom")
+	assert.Equal(t, network.ErrNoNetplayInvite, err)
+
+	_, err = carol.Connect(t.Context(), alice.Addr().String())
+	assert.Nil(t, err)
+	_, err = carol.HostNetplay(alice.GetPublicKey(), "super_mario_world", "core", "rom", network.NETPLAY_DEFAULT_PORT)
+	assert.Equal(t, network.ErrNotFriend, err)
+}
@@ -1,271 +1,382 @@
 package network
 
 import (
-	"bytes"
+	"context"
 	"crypto/rsa"
 	"encoding/base64"
-	"encoding/json"
 	"errors"
+	"net/http"
 	"net/url"
 	"os"
-	"path"
-	"reflect"
+	"path/filepath"
 	"sync"
-	"time"
 
+	"arkhive.dev/launcher/internal/configloader"
 	"arkhive.dev/launcher/internal/folder"
 	"arkhive.dev/launcher/internal/network/models"
 	"arkhive.dev/launcher/internal/network/resources"
+	"arkhive.dev/launcher/internal/undertow"
 	"arkhive.dev/launcher/pkg/encryption"
+	"github.com/anacrolix/torrent"
 	"github.com/sirupsen/logrus"
-)
-
-type CertificateStatus int
-
-const (
-	INVALID CertificateStatus = iota
-	AVAILABLE
-	UNOFFICIAL
-	OFFICIAL
+	"golang.org/x/time/rate"
 )
 
 type NetworkEngine struct {
-	undertowResource  resources.StorjResource
+	undertowURL    *url.URL
+	undertowBundle *undertow.Bundle
+	// Guards the undertow bundle and key and the certificate, updated by the undertow fetch
+	undertowLock sync.Mutex
+	storjAccess  string
+	// Guards the account and its passphrase, updated by the initialization, the rotation and the passphrase change
+	accountLock       sync.Mutex
 	account           models.Account
 	resources         []*resources.Resource
+	certificate       *AccountCertificate
 	certificateStatus CertificateStatus
 	undertowPublicKey *rsa.PublicKey
+	torrentSeedRatio  float64
+	torrentClient     *torrent.Client
+	torrentClientLock sync.Mutex
+	// Limiter shared by every resource, nil if unlimited
+	bandwidthLimiter       *rate.Limiter
+	resourceBandwidthLimit int64
+	lowPrioritySchedule    resources.DownloadSchedule
+	httpClient             *http.Client
+	systemPath             string
+	registrationURL        string
+	accountPassphrase      string
+	tempPath               string
+	friendListenAddress    string
+	packagesPath           string
+	lanDiscoveryAddress    string
+	lanBroadcastAddress    string
+	lanShareAddress        string
+	lanNode                *LANNode
+	lanLock                sync.Mutex
+	// Closed once the account data is read and the undertow bundle is set up
+	initialized chan struct{}
 }
 
-func NewNetworkEngine() (instance *NetworkEngine, err error) {
-	instance = &NetworkEngine{}
+func NewNetworkEngine(configuration configloader.Config) (instance *NetworkEngine, err error) {
+	var lowPrioritySchedule resources.DownloadSchedule
+	if lowPrioritySchedule, err = resources.ParseDownloadSchedule(configuration.LowPriorityWindows); err != nil {
+		return
+	}
+	var undertowURL *url.URL
+	if undertowURL, err = url.Parse(configuration.UndertowURL); err != nil {
+		return
+	}
+	var httpClient *http.Client
+	if httpClient, err = NewHTTPClient(HTTPClientOptions{
+		Timeout:      configuration.HTTPTimeout,
+		ProxyURL:     configuration.HTTPProxyURL,
+		RootCAFiles:  configuration.HTTPRootCAs,
+		UserAgent:    configuration.HTTPUserAgent,
+		MaxRedirects: configuration.HTTPMaxRedirects,
+	}); err != nil {
+		return
+	}
+	instance = &NetworkEngine{
+		httpClient:             httpClient,
+		torrentSeedRatio:       configuration.TorrentSeedRatio,
+		bandwidthLimiter:       resources.NewBandwidthLimiter(configuration.BandwidthLimit),
+		resourceBandwidthLimit: configuration.ResourceBandwidthLimit,
+		lowPrioritySchedule:    lowPrioritySchedule,
+		systemPath:             filepath.Join(configuration.BasePath, folder.SYSTEM),
+		registrationURL:        configuration.RegistrationURL,
+		tempPath:               filepath.Join(configuration.BasePath, folder.TEMP),
+		undertowURL:            undertowURL,
+		storjAccess:            configuration.StorjAccess,
+		friendListenAddress:    configuration.FriendListenAddress,
+		packagesPath:           filepath.Join(configuration.BasePath, folder.PACKAGES),
+		lanDiscoveryAddress:    configuration.LANDiscoveryAddress,
+		lanBroadcastAddress:    configuration.LANBroadcastAddress,
+		lanShareAddress:        configuration.LANShareAddress,
+		initialized:            make(chan struct{}),
+	}
 	return
 }
 
+// The HTTP client shared by the network handlers and the engines HTTP requests
+func (networkEngine *NetworkEngine) HTTPClient() *http.Client {
+	return networkEngine.httpClient
+}
+
 func (networkEngine *NetworkEngine) Initialize(waitGroup *sync.WaitGroup) {
-	if _, err := os.Stat(folder.SYSTEM); os.IsNotExist(err) {
-		if err = os.Mkdir(folder.SYSTEM, 0755); err != nil {
+	defer waitGroup.Done()
+	if _, err := os.Stat(networkEngine.systemPath); os.IsNotExist(err) {
+		if err = os.MkdirAll(networkEngine.systemPath, 0755); err != nil {
 			panic(err)
 		}
 	}
 
-	go networkEngine.importUserCryptoData()
+	// The key generation is slow, the other engines don't wait for it
+	go func() {
+		defer close(networkEngine.initialized)
+		networkEngine.importUserCryptoData()
+		if err := networkEngine.initNetworkProcess(); err != nil {
+			logrus.Errorf("%+v", err)
+		}
+	}()
+}
+
+// Wait for the account data and the undertow bundle, set up in background by Initialize
+func (networkEngine *NetworkEngine) WaitInitialized(ctx context.Context) error {
+	select {
+	case <-networkEngine.initialized:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Whether the background initialization ended
+func (networkEngine *NetworkEngine) isInitialized() bool {
+	select {
+	case <-networkEngine.initialized:
+		return true
+	default:
+		return false
+	}
 }
 
-func (networkEngine NetworkEngine) isUserCertificateAvailable() bool {
-	return networkEngine.certificateStatus != INVALID
+func (networkEngine *NetworkEngine) isUserCertificateAvailable() bool {
+	return networkEngine.GetCertificateStatus() != INVALID
 }
 
-func (networkEngine *NetworkEngine) importUserCryptoData() {
-	var err error
-	privateKeyFilePath := path.Join(folder.SYSTEM, "private.bee")
-	certificateFilePath := path.Join(folder.SYSTEM, "certificate.bee")
-	_, err = os.Stat(privateKeyFilePath)
-	privateKeyFileExists := !os.IsNotExist(err)
-	_, err = os.Stat(certificateFilePath)
-	certificateFileExists := !os.IsNotExist(err)
+// The status of the account certificate
+func (networkEngine *NetworkEngine) GetCertificateStatus() CertificateStatus {
+	networkEngine.undertowLock.Lock()
+	defer networkEngine.undertowLock.Unlock()
+	return networkEngine.certificateStatus
+}
+
+// The account certificate with its status, nil if missing
+func (networkEngine *NetworkEngine) getCertificate() (*AccountCertificate, CertificateStatus) {
+	networkEngine.undertowLock.Lock()
+	defer networkEngine.undertowLock.Unlock()
+	return networkEngine.certificate, networkEngine.certificateStatus
+}
+
+// The root key of the pinned undertow bundle, nil until a bundle is pinned
+func (networkEngine *NetworkEngine) getUndertowPublicKey() *rsa.PublicKey {
+	networkEngine.undertowLock.Lock()
+	defer networkEngine.undertowLock.Unlock()
+	return networkEngine.undertowPublicKey
+}
+
+// The account of the user, without a username until registered
+func (networkEngine *NetworkEngine) GetAccount() models.Account {
+	networkEngine.accountLock.Lock()
+	defer networkEngine.accountLock.Unlock()
+	return networkEngine.account
+}
 
-	if privateKeyFileExists && certificateFileExists {
-		var privateKeyBytes []byte
-		if privateKeyBytes, err = os.ReadFile(privateKeyFilePath); err != nil {
+// The account private key, nil until read or generated
+func (networkEngine *NetworkEngine) getAccountKey() *rsa.PrivateKey {
+	networkEngine.accountLock.Lock()
+	defer networkEngine.accountLock.Unlock()
+	if networkEngine.account.PrivateKey.N == nil {
+		return nil
+	}
+	privateKey := networkEngine.account.PrivateKey
+	return &privateKey
+}
+
+func (networkEngine *NetworkEngine) setAccountKey(privateKey *rsa.PrivateKey) {
+	networkEngine.accountLock.Lock()
+	defer networkEngine.accountLock.Unlock()
+	networkEngine.account.PrivateKey = *privateKey
+	networkEngine.account.PublicKey = privateKey.PublicKey
+}
+
+// The passphrase encrypting the account private key, empty if stored plaintext
+func (networkEngine *NetworkEngine) getAccountPassphrase() string {
+	networkEngine.accountLock.Lock()
+	defer networkEngine.accountLock.Unlock()
+	return networkEngine.accountPassphrase
+}
+
+func (networkEngine *NetworkEngine) setAccountPassphrase(passphrase string) {
+	networkEngine.accountLock.Lock()
+	defer networkEngine.accountLock.Unlock()
+	networkEngine.accountPassphrase = passphrase
+}
+
+func (networkEngine *NetworkEngine) importUserCryptoData() {
+	passphrase, err := ReadAccountPassphrase()
+	if err != nil {
+		logrus.Warn("Cannot read the private key passphrase from the OS keyring")
+		logrus.Errorf("%+v", err)
+	}
+	networkEngine.setAccountPassphrase(passphrase)
+	privateKeyFilePath := filepath.Join(networkEngine.systemPath, PRIVATE_KEY_FILE)
+	privateKey, err := ReadAccountPrivateKeyFile(privateKeyFilePath, passphrase)
+	if errors.Is(err, encryption.ErrEncryptedPrivateKey) {
+		logrus.Error("The private key is encrypted, store its passphrase with the arkhiveaccount passphrase command")
+		return
+	} else if err != nil && !os.IsNotExist(err) {
+		logrus.Error("Cannot decode the private key file content")
+		logrus.Errorf("%+v", err)
+		return
+	}
+	if privateKey != nil && privateKey.N.BitLen() < encryption.MIN_KEY_BITS {
+		logrus.Warnf("The %d bits private key is too weak, generating a new one", privateKey.N.BitLen())
+		if err = os.Rename(privateKeyFilePath, privateKeyFilePath+".weak"); err != nil {
 			logrus.Errorf("%+v", err)
 			return
 		}
-		var privateKey *rsa.PrivateKey
-		if privateKey, err = encryption.ParsePrivateKey(privateKeyBytes); err != nil {
-			logrus.Error("Cannot decode the private key file content")
+		privateKey = nil
+	}
+	if privateKey == nil {
+		if privateKey, err = generateAccountPrivateKey(privateKeyFilePath, passphrase); err != nil {
 			logrus.Errorf("%+v", err)
 			return
 		}
-		networkEngine.account.PrivateKey = *privateKey
-		if readCertificateError := networkEngine.readAccountCertificate(); readCertificateError == nil {
-			networkEngine.certificateStatus = AVAILABLE
-			//networkEngine.UserAccountAvailableEventEmitter.Emit(true)
-			//networkEngine.UserStatusChangedEventEmitter.Emit(true)
-		} else {
-			logrus.Warn("Error reading the user certificate")
-			logrus.Errorf("%+v", err)
-		}
 	}
+	networkEngine.setAccountKey(privateKey)
 
-	if !networkEngine.isUserCertificateAvailable() {
-		var privateKey *rsa.PrivateKey
-		if privateKey, err = encryption.GeneratePairKey(1024); err != nil {
+	if err = networkEngine.readAccountCertificate(); err != nil {
+		if !os.IsNotExist(err) {
+			logrus.Warn("Error reading the user certificate")
 			logrus.Errorf("%+v", err)
-			return
 		}
-		if err = os.WriteFile(privateKeyFilePath, encryption.ExportPrivateKey(privateKey), 0644); err != nil {
+	} else if networkEngine.getUndertowPublicKey() != nil {
+		if err = networkEngine.verifyAccountCertificateSign(); err != nil {
 			logrus.Errorf("%+v", err)
-			return
 		}
-		networkEngine.account.PrivateKey = *privateKey
-		networkEngine.account.PublicKey = privateKey.PublicKey
 	}
+	//networkEngine.UserAccountAvailableEventEmitter.Emit(true)
+	//networkEngine.UserStatusChangedEventEmitter.Emit(true)
 
 	//networkEngine.BootedEventEmitter.Emit(true)
 }
 
-func (networkEngine *NetworkEngine) initNetworkProcess() (err error) {
-	err = networkEngine.addUndertow(&networkEngine.undertowResource, true)
-	return
-}
-
-func (networkEngine NetworkEngine) readAccountCertificate() (err error) {
-	certificateFilePath := path.Join(folder.SYSTEM, "certificate.bee")
-
-	_, err = os.Stat(certificateFilePath)
-	certificateFileExists := !os.IsNotExist(err)
-	if !certificateFileExists {
-		return
-	}
-
-	var jsonCertificateData []byte
-	if jsonCertificateData, err = os.ReadFile(certificateFilePath); err != nil {
-		logrus.Errorf("%+v", err)
-		return
-	}
-	decoder := json.NewDecoder(bytes.NewReader(jsonCertificateData))
-	decoder.UseNumber()
-	var jsonCertificateDocument map[string]interface{}
-	if err = decoder.Decode(&jsonCertificateDocument); err != nil {
-		logrus.Errorf("%+v", err)
-		return
-	}
-	networkEngine.account.Username = jsonCertificateDocument["username"].(string)
-	networkEngine.account.Email = jsonCertificateDocument["email"].(string)
-	var registrationDate int64
-	if registrationDate, err = jsonCertificateDocument["date"].(json.Number).Int64(); err != nil {
+// Read the certificate file and evaluate it against the account key
+func (networkEngine *NetworkEngine) readAccountCertificate() (err error) {
+	var certificate *AccountCertificate
+	if certificate, err = ReadAccountCertificateFile(filepath.Join(networkEngine.systemPath, CERTIFICATE_FILE)); err != nil {
 		return
 	}
-	networkEngine.account.RegistrationDate = time.Unix(registrationDate, 0)
-	var publicKeyBytes []byte
-	if publicKeyBytes, err = base64.URLEncoding.DecodeString(jsonCertificateDocument["date"].(string)); err != nil {
-		return
+	certificateStatus := EvaluateCertificate(certificate, networkEngine.getAccountKey(), networkEngine.getUndertowPublicKey())
+	if certificateStatus == INVALID {
+		return errors.New("the certificate does not match the account key")
 	}
-	var publicKey *rsa.PublicKey
-	if publicKey, err = encryption.ParsePublicKey(publicKeyBytes); err != nil {
+	var sign []byte
+	if sign, err = base64.URLEncoding.DecodeString(certificate.Sign); err != nil {
 		return
 	}
-	networkEngine.account.PublicKey = *publicKey
+	networkEngine.accountLock.Lock()
+	networkEngine.account.Username = certificate.Username
+	networkEngine.account.Email = certificate.Email
+	networkEngine.account.RegistrationDate = certificate.GetRegistrationDate()
+	networkEngine.account.Sign = sign
+	networkEngine.accountLock.Unlock()
+	networkEngine.undertowLock.Lock()
+	networkEngine.certificate = certificate
+	networkEngine.certificateStatus = certificateStatus
+	networkEngine.undertowLock.Unlock()
 	return
 }
 
-func (networkEngine NetworkEngine) verifyAccountCertificateSign() (err error) {
+// Verify the account certificate sign against the undertow public key
+func (networkEngine *NetworkEngine) verifyAccountCertificateSign() (err error) {
+	networkEngine.undertowLock.Lock()
+	defer networkEngine.undertowLock.Unlock()
 	if networkEngine.undertowPublicKey == nil {
 		return errors.New("undertow file not downloaded")
 	}
-	if !networkEngine.isUserCertificateAvailable() {
+	if networkEngine.certificateStatus == INVALID {
 		return errors.New("unextistent certificate file")
 	}
+	networkEngine.certificateStatus = EvaluateCertificate(networkEngine.certificate, networkEngine.getAccountKey(), networkEngine.undertowPublicKey)
+	return
+}
 
-	certificateFilePath := path.Join(folder.SYSTEM, "certificate.bee")
-	_, err = os.Stat(certificateFilePath)
-	certificateFileExists := !os.IsNotExist(err)
-	if !certificateFileExists {
-		return
-	}
-	var jsonCertificateData []byte
-	if jsonCertificateData, err = os.ReadFile(certificateFilePath); err != nil {
-		logrus.Errorf("%+v", err)
-		return
-	}
-	decoder := json.NewDecoder(bytes.NewReader(jsonCertificateData))
-	decoder.UseNumber()
-	var jsonCertificateDocument map[string]interface{}
-	if err = decoder.Decode(&jsonCertificateDocument); err != nil {
-		logrus.Errorf("%+v", err)
-		return
-	}
+// Start the download of a resource
+func (networkEngine *NetworkEngine) AddResource(url *url.URL, path string, allowedFiles ...string) (resource *resources.Resource, err error) {
+	return networkEngine.addResource(resources.NORMAL_PRIORITY, url, path, allowedFiles)
+}
 
-	if signBase64, ok := jsonCertificateDocument["sign"].(string); ok {
-		if networkEngine.account.Sign, err = base64.URLEncoding.DecodeString(signBase64); err != nil {
-			logrus.Errorf("%+v", err)
-			return
-		}
-	}
-	networkEngine.certificateStatus = UNOFFICIAL
+// Start the download of a background resource, like cores, plugins and tools, that is
+// transferred only during the low priority download windows
+func (networkEngine *NetworkEngine) AddLowPriorityResource(url *url.URL, path string, allowedFiles ...string) (resource *resources.Resource, err error) {
+	return networkEngine.addResource(resources.LOW_PRIORITY, url, path, allowedFiles)
+}
 
-	jsonCertificateDocumentDecoded := make(map[string]interface{})
-	var ok bool = true
-	if ok {
-		jsonCertificateDocumentDecoded["username"], ok = jsonCertificateDocument["username"].(string)
-	}
-	if ok {
-		jsonCertificateDocumentDecoded["email"], ok = jsonCertificateDocument["email"].(string)
-	}
-	if jsonCertificateDocumentDecoded["date"], err = jsonCertificateDocument["date"].(json.Number).Int64(); err != nil {
-		ok = false
-	}
-	if ok {
-		jsonCertificateDocumentDecoded["public_key"], ok = jsonCertificateDocument["public_key"].(string)
-	}
-	if !ok {
-		err = errors.New("invalid certificate values")
+func (networkEngine *NetworkEngine) addResource(priority resources.ResourcePriority, url *url.URL, path string, allowedFiles []string) (resource *resources.Resource, err error) {
+	var resourceHandler resources.ResourceHandler
+	if resourceHandler, err = networkEngine.newResourceHandler(url); err != nil {
 		return
 	}
-	var jsonCertificateDocumentDecodedEncrypted []byte
-	if jsonCertificateDocumentDecodedEncrypted, err = encryption.Encrypt(networkEngine.undertowPublicKey, jsonCertificateData); err != nil {
-		if reflect.DeepEqual(networkEngine.account.Sign, jsonCertificateDocumentDecodedEncrypted) {
-			networkEngine.certificateStatus = OFFICIAL
-		}
-	}
+	resource = resources.NewResource(resourceHandler, path, allowedFiles)
+	networkEngine.applyBandwidthPolicy(resource, priority)
+	go resource.Download()
 	return
 }
 
-func (networkEngine *NetworkEngine) AddResource(url *url.URL, path string, allowedFiles ...string) (resource *resources.Resource, err error) {
-	var resourceHandler resources.ResourceHandler
+// Create the handler of the URL scheme
+func (networkEngine *NetworkEngine) newResourceHandler(url *url.URL) (resourceHandler resources.ResourceHandler, err error) {
 	switch url.Scheme {
-	case "http":
+	case "http", "https":
 		resourceHandler = &resources.HTTPResource{
-			URL: *url,
+			URL:    *url,
+			Client: networkEngine.httpClient,
 		}
-	case "https":
-		resourceHandler = &resources.HTTPResource{
+	case "file":
+		resourceHandler = &resources.FileResource{
 			URL: *url,
 		}
-	case "file":
-		err = errors.New("url schema not allowed")
-	case "torrent":
-		err = errors.New("url schema not allowed")
-	case "magnet":
+	case "torrent", "magnet":
+		var client *torrent.Client
+		if client, err = networkEngine.getTorrentClient(); err != nil {
+			return
+		}
+		resourceHandler = &resources.TorrentResource{
+			URL:        *url,
+			Client:     client,
+			HTTPClient: networkEngine.httpClient,
+			SeedRatio:  networkEngine.torrentSeedRatio,
+		}
+	case "sj":
+		resourceHandler = &resources.StorjResource{
+			URL:    *url,
+			Access: networkEngine.storjAccess,
+		}
+	default:
 		err = errors.New("url schema not allowed")
 	}
-	if err == nil {
-		resource = resources.NewResource(resourceHandler, path, allowedFiles)
-		go resource.Download()
-	}
 	return
 }
 
-func (networkEngine *NetworkEngine) addUndertow(storjResource *resources.StorjResource, isMain bool) error {
-	systemPath := folder.SYSTEM
-	resource := resources.NewResource(storjResource, systemPath, []string{})
-	networkEngine.resources = append(networkEngine.resources, resource)
-	//resource.StatusUpdatedEventEmitter.Subscribe(func(resource *resources.Resource) {
-	//	url := resource.Handler.GetURL()
-	//	logrus.Debugf("%s: Undertow status updated %d", url.String(), resource.Status)
-	//})
-	//resource.ProgressUpdatedEventEmitter.Subscribe(func(resource *resources.Resource) {
-	//	url := resource.Handler.GetURL()
-	//	logrus.Debugf("%s: Undertow download progress %d/%d (%d%%)", url.String(), resource.Available, resource.Total, resource.Available*100/resource.Total)
-	//})
-	//resource.AvailableEventEmitter.Subscribe(func(resource *resources.Resource) {
-	//	var (
-	//		undertowPublicKeyBytes []byte
-	//		err                    error
-	//	)
-	//	if undertowPublicKeyBytes, err = os.ReadFile(path.Join(resource.Path, filepath.Base(resource.Handler.GetURL().Path))); err != nil {
-	//		logrus.Errorf("%+v", err)
-	//		return
-	//	}
-	//	if networkEngine.undertowPublicKey, err = encryption.ParsePublicKey(undertowPublicKeyBytes); err != nil {
-	//		logrus.Errorf("%+v", err)
-	//		return
-	//	}
-	//	networkEngine.UserStatusChangedEventEmitter.Emit(true)
-	//	networkEngine.verifyAccountCertificateSign()
-	//})
-	go resource.Download()
+// Apply the configured bandwidth limits and download windows to the resource
+func (networkEngine *NetworkEngine) applyBandwidthPolicy(resource *resources.Resource, priority resources.ResourcePriority) {
+	resource.Priority = priority
+	resource.Schedule = networkEngine.lowPrioritySchedule
+	if networkEngine.bandwidthLimiter != nil {
+		resource.Limiters = append(resource.Limiters, networkEngine.bandwidthLimiter)
+	}
+	if resourceLimiter := resources.NewBandwidthLimiter(networkEngine.resourceBandwidthLimit); resourceLimiter != nil {
+		resource.Limiters = append(resource.Limiters, resourceLimiter)
+	}
+}
 
-	return nil
+// Get the BitTorrent client shared by every torrent resource, starting it on first use
+func (networkEngine *NetworkEngine) getTorrentClient() (client *torrent.Client, err error) {
+	networkEngine.torrentClientLock.Lock()
+	defer networkEngine.torrentClientLock.Unlock()
+	if networkEngine.torrentClient == nil {
+		clientConfig := torrent.NewDefaultClientConfig()
+		clientConfig.DataDir = networkEngine.tempPath
+		clientConfig.Seed = true
+		if networkEngine.bandwidthLimiter != nil {
+			clientConfig.DownloadRateLimiter = networkEngine.bandwidthLimiter
+		}
+		if networkEngine.torrentClient, err = torrent.NewClient(clientConfig); err != nil {
+			return
+		}
+	}
+	client = networkEngine.torrentClient
+	return
 }
@@ -0,0 +1,68 @@
+package network
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+
+	"github.com/sirupsen/logrus"
+	"github.com/zalando/go-keyring"
+)
+
+// Entry of the OS keyring holding the passphrase of the account private key
+const (
+	KEYRING_SERVICE         = "arkhive"
+	KEYRING_PASSPHRASE_USER = "account-passphrase"
+)
+
+// Read the passphrase of the account private key from the OS keyring, empty if not stored
+func ReadAccountPassphrase() (passphrase string, err error) {
+	if passphrase, err = keyring.Get(KEYRING_SERVICE, KEYRING_PASSPHRASE_USER); errors.Is(err, keyring.ErrNotFound) {
+		return "", nil
+	}
+	return
+}
+
+// Store the passphrase of the account private key in the OS keyring, removing it if empty
+func StoreAccountPassphrase(passphrase string) (err error) {
+	if passphrase == "" {
+		if err = keyring.Delete(KEYRING_SERVICE, KEYRING_PASSPHRASE_USER); errors.Is(err, keyring.ErrNotFound) {
+			return nil
+		}
+		return
+	}
+	return keyring.Set(KEYRING_SERVICE, KEYRING_PASSPHRASE_USER, passphrase)
+}
+
+/*
+Encrypt the account private key with the passphrase, or store it plaintext if empty.
+
+The key file is written aside and replaces the current one once the passphrase is
+stored in the OS keyring, which is restored if the replacement fails.
+*/
+func (networkEngine *NetworkEngine) ChangeAccountPassphrase(ctx context.Context, passphrase string) (err error) {
+	if err = networkEngine.WaitInitialized(ctx); err != nil {
+		return
+	}
+	privateKey := networkEngine.getAccountKey()
+	if privateKey == nil {
+		return errors.New("account key not available")
+	}
+	privateKeyFilePath := filepath.Join(networkEngine.systemPath, PRIVATE_KEY_FILE)
+	defer os.Remove(privateKeyFilePath + ".new")
+	if err = WriteAccountPrivateKeyFile(privateKeyFilePath+".new", privateKey, passphrase); err != nil {
+		return
+	}
+	if err = StoreAccountPassphrase(passphrase); err != nil {
+		return
+	}
+	if err = os.Rename(privateKeyFilePath+".new", privateKeyFilePath); err != nil {
+		if restoreErr := StoreAccountPassphrase(networkEngine.getAccountPassphrase()); restoreErr != nil {
+			logrus.Errorf("%+v", restoreErr)
+		}
+		return
+	}
+	networkEngine.setAccountPassphrase(passphrase)
+	return
+}
@@ -0,0 +1,182 @@
+package network
+
+import (
+	"bytes"
+	"context"
+	"crypto/rsa"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"arkhive.dev/launcher/pkg/encryption"
+	"github.com/sirupsen/logrus"
+)
+
+// Maximum size of the registration requests and responses
+const MAX_REGISTRATION_MESSAGE_SIZE = 64 * 1024
+
+/*
+Create the registration request of the account, sent to the signing endpoint.
+
+The request has the certificate format, with the request date and the sign made
+with the account private key itself, proving the possession of the key.
+*/
+func NewRegistrationRequest(username string, email string, privateKey *rsa.PrivateKey) (request *AccountCertificate, err error) {
+	if request, err = NewAccountCertificate(username, email, time.Now(), &privateKey.PublicKey); err != nil {
+		return
+	}
+	if err = request.SignWith(privateKey); err != nil {
+		request = nil
+	}
+	return
+}
+
+/*
+Submit the registration request to the signing endpoint.
+
+The request is POSTed as JSON, the endpoint answers with the certificate, signed by
+the undertow key, or with an error status and message.
+*/
+func SubmitRegistrationRequest(ctx context.Context, client *http.Client, registrationURL string, request *AccountCertificate) (certificate *AccountCertificate, err error) {
+	var requestData []byte
+	if requestData, err = json.Marshal(request); err != nil {
+		return
+	}
+	var httpRequest *http.Request
+	if httpRequest, err = http.NewRequestWithContext(ctx, http.MethodPost, registrationURL, bytes.NewReader(requestData)); err != nil {
+		return
+	}
+	httpRequest.Header.Set("Content-Type", "application/json")
+	var response *http.Response
+	if response, err = client.Do(httpRequest); err != nil {
+		return
+	}
+	defer response.Body.Close()
+	var responseData []byte
+	if responseData, err = io.ReadAll(io.LimitReader(response.Body, MAX_REGISTRATION_MESSAGE_SIZE)); err != nil {
+		return
+	}
+	if response.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("registration refused with status %s: %s", response.Status, strings.TrimSpace(string(responseData)))
+	}
+	return ParseAccountCertificate(responseData)
+}
+
+// Register the account to the signing endpoint, storing the returned certificate
+func (networkEngine *NetworkEngine) Register(ctx context.Context, username string, email string) (err error) {
+	if err = networkEngine.WaitInitialized(ctx); err != nil {
+		return
+	}
+	privateKey := networkEngine.getAccountKey()
+	if privateKey == nil {
+		return errors.New("account key not available")
+	}
+	var certificate *AccountCertificate
+	if certificate, err = networkEngine.requestCertificate(ctx, username, email, privateKey); err != nil {
+		return
+	}
+	if err = certificate.WriteFile(filepath.Join(networkEngine.systemPath, CERTIFICATE_FILE)); err != nil {
+		return
+	}
+	if err = networkEngine.readAccountCertificate(); err != nil {
+		return
+	}
+	//networkEngine.UserAccountAvailableEventEmitter.Emit(true)
+	//networkEngine.UserStatusChangedEventEmitter.Emit(true)
+	return
+}
+
+/*
+Replace the account key with a new one, re-issuing the certificate for the same account.
+
+The new key and certificate are written aside first, then swapped with the current
+files, which are kept with the .old extension and restored if the swap fails, and
+deleted once the new certificate is stored.
+*/
+func (networkEngine *NetworkEngine) RotateAccountKey(ctx context.Context) (err error) {
+	if err = networkEngine.WaitInitialized(ctx); err != nil {
+		return
+	}
+	if certificate, _ := networkEngine.getCertificate(); certificate == nil {
+		return errors.New("no certificate to re-issue")
+	}
+	var privateKey *rsa.PrivateKey
+	if privateKey, err = encryption.GeneratePairKey(ACCOUNT_KEY_BITS); err != nil {
+		return
+	}
+	var certificate *AccountCertificate
+	account := networkEngine.GetAccount()
+	if certificate, err = networkEngine.requestCertificate(ctx, account.Username, account.Email, privateKey); err != nil {
+		return
+	}
+
+	privateKeyFilePath := filepath.Join(networkEngine.systemPath, PRIVATE_KEY_FILE)
+	certificateFilePath := filepath.Join(networkEngine.systemPath, CERTIFICATE_FILE)
+	filePaths := []string{privateKeyFilePath, certificateFilePath}
+	defer func() {
+		for _, filePath := range filePaths {
+			os.Remove(filePath + ".new")
+		}
+	}()
+	if err = WriteAccountPrivateKeyFile(privateKeyFilePath+".new", privateKey, networkEngine.getAccountPassphrase()); err != nil {
+		return
+	}
+	if err = certificate.WriteFile(certificateFilePath + ".new"); err != nil {
+		return
+	}
+	for index, filePath := range filePaths {
+		if err = os.Rename(filePath, filePath+".old"); err == nil {
+			err = os.Rename(filePath+".new", filePath)
+		}
+		if err != nil {
+			restoreAccountFiles(filePaths[:index+1])
+			return
+		}
+	}
+	networkEngine.setAccountKey(privateKey)
+	if err = networkEngine.readAccountCertificate(); err != nil {
+		return
+	}
+	for _, filePath := range filePaths {
+		if removeErr := os.Remove(filePath + ".old"); removeErr != nil {
+			logrus.Errorf("%+v", removeErr)
+		}
+	}
+	return
+}
+
+// Put back the account files moved aside by a failed rotation
+func restoreAccountFiles(filePaths []string) {
+	for _, filePath := range filePaths {
+		if err := os.Rename(filePath+".old", filePath); err != nil && !os.IsNotExist(err) {
+			logrus.Errorf("%+v", err)
+		}
+	}
+}
+
+// Obtain from the signing endpoint the certificate of the account key
+func (networkEngine *NetworkEngine) requestCertificate(ctx context.Context, username string, email string, privateKey *rsa.PrivateKey) (certificate *AccountCertificate, err error) {
+	if networkEngine.registrationURL == "" {
+		return nil, errors.New("no registration endpoint configured")
+	}
+	var request *AccountCertificate
+	if request, err = NewRegistrationRequest(username, email, privateKey); err != nil {
+		return
+	}
+	if certificate, err = SubmitRegistrationRequest(ctx, networkEngine.httpClient, networkEngine.registrationURL, request); err != nil {
+		return
+	}
+	if EvaluateCertificate(certificate, privateKey, nil) == INVALID {
+		return nil, errors.New("the returned certificate does not match the account key")
+	}
+	if certificate.Username != username || certificate.Email != email {
+		return nil, errors.New("the returned certificate does not match the registration request")
+	}
+	return
+}
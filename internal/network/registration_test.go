@@ -0,0 +1,176 @@
+package network_test
+
+import (
+	"context"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"arkhive.dev/launcher/internal/configloader"
+	"arkhive.dev/launcher/internal/folder"
+	"arkhive.dev/launcher/internal/network"
+	"arkhive.dev/launcher/pkg/encryption"
+	"github.com/stretchr/testify/assert"
+	"github.com/zalando/go-keyring"
+)
+
+var mockKeyringOnce sync.Once
+
+// Use an in memory keyring instead of the OS one, shared by the tests
+func mockKeyring() {
+	mockKeyringOnce.Do(keyring.MockInit)
+}
+
+func newInitializedNetworkEngine(t *testing.T, configuration configloader.Config) *network.NetworkEngine {
+	mockKeyring()
+	networkEngine, err := network.NewNetworkEngine(configuration)
+	assert.Nil(t, err)
+	waitGroup := sync.WaitGroup{}
+	waitGroup.Add(1)
+	networkEngine.Initialize(&waitGroup)
+	waitGroup.Wait()
+	assert.Nil(t, networkEngine.WaitInitialized(context.Background()))
+	return networkEngine
+}
+
+func TestRegister(t *testing.T) {
+	undertowKey, err := encryption.GeneratePairKey(encryption.MIN_KEY_BITS)
+	assert.Nil(t, err)
+	signer := httptest.NewServer(network.NewCertificateSigner(undertowKey))
+	defer signer.Close()
+	configuration := configloader.Config{
+		BasePath:        t.TempDir(),
+		RegistrationURL: signer.URL,
+	}
+
+	networkEngine := newInitializedNetworkEngine(t, configuration)
+	assert.Equal(t, network.INVALID, networkEngine.GetCertificateStatus())
+	assert.Nil(t, networkEngine.Register(context.Background(), "player", "player@arkhive.dev"))
+	assert.Equal(t, network.AVAILABLE, networkEngine.GetCertificateStatus())
+
+	certificate, err := network.ReadAccountCertificateFile(filepath.Join(configuration.BasePath, folder.SYSTEM, network.CERTIFICATE_FILE))
+	assert.Nil(t, err)
+	assert.Nil(t, certificate.VerifySign(&undertowKey.PublicKey))
+
+	restartedEngine := newInitializedNetworkEngine(t, configuration)
+	assert.Equal(t, network.AVAILABLE, restartedEngine.GetCertificateStatus())
+	account, registeredAccount := restartedEngine.GetAccount(), networkEngine.GetAccount()
+	assert.Equal(t, "player", account.Username)
+	assert.Equal(t, "player@arkhive.dev", account.Email)
+	assert.True(t, account.PublicKey.Equal(&registeredAccount.PublicKey))
+}
+
+func TestRegisterWithoutEndpoint(t *testing.T) {
+	networkEngine := newInitializedNetworkEngine(t, configloader.Config{BasePath: t.TempDir()})
+	assert.NotNil(t, networkEngine.Register(context.Background(), "player", "player@arkhive.dev"))
+	assert.Equal(t, network.INVALID, networkEngine.GetCertificateStatus())
+}
+
+func TestCertificateSignerRefusesForgedRequest(t *testing.T) {
+	undertowKey, err := encryption.GeneratePairKey(encryption.MIN_KEY_BITS)
+	assert.Nil(t, err)
+	accountKey, err := encryption.GeneratePairKey(encryption.MIN_KEY_BITS)
+	assert.Nil(t, err)
+	signer := httptest.NewServer(network.NewCertificateSigner(undertowKey))
+	defer signer.Close()
+
+	request := newTestCertificate(t, &accountKey.PublicKey)
+	assert.Nil(t, request.SignWith(undertowKey))
+	_, err = network.SubmitRegistrationRequest(context.Background(), signer.Client(), signer.URL, request)
+	assert.NotNil(t, err)
+
+	request, err = network.NewRegistrationRequest("player", "player@arkhive.dev", accountKey)
+	assert.Nil(t, err)
+	certificate, err := network.SubmitRegistrationRequest(context.Background(), signer.Client(), signer.URL, request)
+	assert.Nil(t, err)
+	assert.Equal(t, network.OFFICIAL, network.EvaluateCertificate(certificate, accountKey, &undertowKey.PublicKey))
+}
+
+func TestRotateAccountKey(t *testing.T) {
+	undertowKey, err := encryption.GeneratePairKey(encryption.MIN_KEY_BITS)
+	assert.Nil(t, err)
+	signer := httptest.NewServer(network.NewCertificateSigner(undertowKey))
+	defer signer.Close()
+	configuration := configloader.Config{
+		BasePath:        t.TempDir(),
+		RegistrationURL: signer.URL,
+	}
+	mockKeyring()
+	assert.Nil(t, network.StoreAccountPassphrase("secret"))
+	t.Cleanup(func() { network.StoreAccountPassphrase("") })
+
+	networkEngine := newInitializedNetworkEngine(t, configuration)
+	assert.NotNil(t, networkEngine.RotateAccountKey(context.Background()))
+	assert.Nil(t, networkEngine.Register(context.Background(), "player", "player@arkhive.dev"))
+	previousAccount := networkEngine.GetAccount()
+	assert.Nil(t, networkEngine.RotateAccountKey(context.Background()))
+	assert.Equal(t, network.AVAILABLE, networkEngine.GetCertificateStatus())
+	account := networkEngine.GetAccount()
+	assert.False(t, account.PublicKey.Equal(&previousAccount.PublicKey))
+	assert.Equal(t, "player", account.Username)
+
+	// The previous files are deleted once the new certificate is stored
+	systemPath := filepath.Join(configuration.BasePath, folder.SYSTEM)
+	_, err = os.Stat(filepath.Join(systemPath, network.PRIVATE_KEY_FILE+".old"))
+	assert.ErrorIs(t, err, os.ErrNotExist)
+	_, err = os.Stat(filepath.Join(systemPath, network.CERTIFICATE_FILE+".old"))
+	assert.ErrorIs(t, err, os.ErrNotExist)
+
+	restartedEngine := newInitializedNetworkEngine(t, configuration)
+	assert.Equal(t, network.AVAILABLE, restartedEngine.GetCertificateStatus())
+	restartedAccount := restartedEngine.GetAccount()
+	assert.True(t, restartedAccount.PublicKey.Equal(&account.PublicKey))
+}
+
+func TestRotateAccountKeyRestoresFiles(t *testing.T) {
+	undertowKey, err := encryption.GeneratePairKey(encryption.MIN_KEY_BITS)
+	assert.Nil(t, err)
+	signer := httptest.NewServer(network.NewCertificateSigner(undertowKey))
+	defer signer.Close()
+	configuration := configloader.Config{BasePath: t.TempDir(), RegistrationURL: signer.URL}
+
+	networkEngine := newInitializedNetworkEngine(t, configuration)
+	assert.Nil(t, networkEngine.Register(context.Background(), "player", "player@arkhive.dev"))
+	previousAccount := networkEngine.GetAccount()
+	// The certificate can't be moved aside, failing the swap after the key one
+	systemPath := filepath.Join(configuration.BasePath, folder.SYSTEM)
+	assert.Nil(t, os.MkdirAll(filepath.Join(systemPath, network.CERTIFICATE_FILE+".old", "blocked"), 0755))
+	assert.NotNil(t, networkEngine.RotateAccountKey(context.Background()))
+
+	privateKey, err := network.ReadAccountPrivateKeyFile(filepath.Join(systemPath, network.PRIVATE_KEY_FILE), "")
+	assert.Nil(t, err)
+	assert.True(t, privateKey.PublicKey.Equal(&previousAccount.PublicKey))
+	_, err = os.Stat(filepath.Join(systemPath, network.PRIVATE_KEY_FILE+".new"))
+	assert.True(t, os.IsNotExist(err))
+	restartedEngine := newInitializedNetworkEngine(t, configuration)
+	assert.Equal(t, network.AVAILABLE, restartedEngine.GetCertificateStatus())
+}
+
+func TestChangeAccountPassphrase(t *testing.T) {
+	mockKeyring()
+	t.Cleanup(func() { network.StoreAccountPassphrase("") })
+	configuration := configloader.Config{BasePath: t.TempDir()}
+	networkEngine := newInitializedNetworkEngine(t, configuration)
+	account := networkEngine.GetAccount()
+	privateKeyFilePath := filepath.Join(configuration.BasePath, folder.SYSTEM, network.PRIVATE_KEY_FILE)
+
+	assert.Nil(t, networkEngine.ChangeAccountPassphrase(context.Background(), "secret"))
+	privateKeyBytes, err := os.ReadFile(privateKeyFilePath)
+	assert.Nil(t, err)
+	assert.True(t, encryption.IsEncryptedPrivateKey(privateKeyBytes))
+	passphrase, err := network.ReadAccountPassphrase()
+	assert.Nil(t, err)
+	assert.Equal(t, "secret", passphrase)
+	restartedAccount := newInitializedNetworkEngine(t, configuration).GetAccount()
+	assert.True(t, restartedAccount.PublicKey.Equal(&account.PublicKey))
+
+	assert.Nil(t, networkEngine.ChangeAccountPassphrase(context.Background(), ""))
+	privateKeyBytes, err = os.ReadFile(privateKeyFilePath)
+	assert.Nil(t, err)
+	assert.False(t, encryption.IsEncryptedPrivateKey(privateKeyBytes))
+	passphrase, err = network.ReadAccountPassphrase()
+	assert.Nil(t, err)
+	assert.Empty(t, passphrase)
+}
@@ -0,0 +1,166 @@
+package resources
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// Minimum amount of bytes a bandwidth limiter allows to transfer at once
+const MIN_BANDWIDTH_BURST = 32 * 1024
+
+// How often a paused low priority transfer checks whether a download window is open
+const DOWNLOAD_WINDOW_POLL_INTERVAL = time.Minute
+
+type ResourcePriority int
+
+const (
+	NORMAL_PRIORITY ResourcePriority = iota
+	LOW_PRIORITY
+)
+
+// Daily time window, as offsets from the midnight. The window crosses the midnight
+// when the end precedes the start.
+type DownloadWindow struct {
+	Start time.Duration
+	End   time.Duration
+}
+
+// Parse a window in the "HH:MM-HH:MM" format
+func ParseDownloadWindow(window string) (downloadWindow DownloadWindow, err error) {
+	bounds := strings.Split(strings.TrimSpace(window), "-")
+	if len(bounds) != 2 {
+		err = fmt.Errorf("invalid download window %q", window)
+		return
+	}
+	if downloadWindow.Start, err = parseTimeOfDay(bounds[0]); err != nil {
+		return
+	}
+	downloadWindow.End, err = parseTimeOfDay(bounds[1])
+	return
+}
+
+func parseTimeOfDay(timeOfDay string) (offset time.Duration, err error) {
+	var parsedTime time.Time
+	if parsedTime, err = time.Parse("15:04", strings.TrimSpace(timeOfDay)); err != nil {
+		return
+	}
+	offset = time.Duration(parsedTime.Hour())*time.Hour + time.Duration(parsedTime.Minute())*time.Minute
+	return
+}
+
+// Whether the time is inside the window
+func (downloadWindow DownloadWindow) Contains(instant time.Time) bool {
+	year, month, day := instant.Date()
+	offset := instant.Sub(time.Date(year, month, day, 0, 0, 0, 0, instant.Location()))
+	if downloadWindow.Start <= downloadWindow.End {
+		return offset >= downloadWindow.Start && offset < downloadWindow.End
+	}
+	return offset >= downloadWindow.Start || offset < downloadWindow.End
+}
+
+// The set of windows during which the low priority transfers are allowed. An empty
+// schedule is always open.
+type DownloadSchedule []DownloadWindow
+
+// Parse a list of windows in the "HH:MM-HH:MM" format
+func ParseDownloadSchedule(windows []string) (downloadSchedule DownloadSchedule, err error) {
+	for _, window := range windows {
+		if strings.TrimSpace(window) == "" {
+			continue
+		}
+		var downloadWindow DownloadWindow
+		if downloadWindow, err = ParseDownloadWindow(window); err != nil {
+			return
+		}
+		downloadSchedule = append(downloadSchedule, downloadWindow)
+	}
+	return
+}
+
+// Whether a window of the schedule contains the time
+func (downloadSchedule DownloadSchedule) IsOpen(instant time.Time) bool {
+	if len(downloadSchedule) == 0 {
+		return true
+	}
+	for _, downloadWindow := range downloadSchedule {
+		if downloadWindow.Contains(instant) {
+			return true
+		}
+	}
+	return false
+}
+
+// Block until a window of the schedule is open or the context is done
+func (downloadSchedule DownloadSchedule) WaitOpen(ctx context.Context) error {
+	if downloadSchedule.IsOpen(time.Now()) {
+		return nil
+	}
+	ticker := time.NewTicker(DOWNLOAD_WINDOW_POLL_INTERVAL)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case instant := <-ticker.C:
+			if downloadSchedule.IsOpen(instant) {
+				return nil
+			}
+		}
+	}
+}
+
+// Create a limiter for the bandwidth in KiB/s, nil if the bandwidth is not limited
+func NewBandwidthLimiter(kibPerSecond int64) *rate.Limiter {
+	if kibPerSecond <= 0 {
+		return nil
+	}
+	bytesPerSecond := int(kibPerSecond * 1024)
+	burst := bytesPerSecond
+	if burst < MIN_BANDWIDTH_BURST {
+		burst = MIN_BANDWIDTH_BURST
+	}
+	return rate.NewLimiter(rate.Limit(bytesPerSecond), burst)
+}
+
+// Reader throttled by the resource limiters and, for low priority resources, paused
+// outside the resource schedule
+type limitedReader struct {
+	resource *Resource
+	reader   io.Reader
+}
+
+func (resource *Resource) newLimitedReader(reader io.Reader) io.Reader {
+	if len(resource.Limiters) == 0 && resource.Priority != LOW_PRIORITY {
+		return reader
+	}
+	return &limitedReader{resource, reader}
+}
+
+func (limitedReader *limitedReader) Read(buffer []byte) (readBytes int, err error) {
+	ctx := limitedReader.resource.Context()
+	if limitedReader.resource.Priority == LOW_PRIORITY {
+		if err = limitedReader.resource.Schedule.WaitOpen(ctx); err != nil {
+			return
+		}
+	}
+	for _, limiter := range limitedReader.resource.Limiters {
+		if limiter != nil && len(buffer) > limiter.Burst() {
+			buffer = buffer[:limiter.Burst()]
+		}
+	}
+	readBytes, err = limitedReader.reader.Read(buffer)
+	for _, limiter := range limitedReader.resource.Limiters {
+		if limiter == nil || readBytes == 0 {
+			continue
+		}
+		if waitErr := limiter.WaitN(ctx, readBytes); waitErr != nil {
+			return readBytes, waitErr
+		}
+	}
+	return
+}
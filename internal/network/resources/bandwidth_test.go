@@ -0,0 +1,89 @@
+package resources_test
+
+import (
+	"bytes"
+	"context"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"arkhive.dev/launcher/internal/network/resources"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/time/rate"
+)
+
+func TestParseDownloadWindow(t *testing.T) {
+	window, err := resources.ParseDownloadWindow("01:30-07:00")
+	assert.Nil(t, err)
+	assert.Equal(t, time.Hour+30*time.Minute, window.Start)
+	assert.Equal(t, 7*time.Hour, window.End)
+
+	for _, invalidWindow := range []string{"", "01:30", "1-2-3", "25:00-07:00", "aa:bb-07:00"} {
+		_, err = resources.ParseDownloadWindow(invalidWindow)
+		assert.NotNil(t, err, invalidWindow)
+	}
+}
+
+func TestDownloadWindowContains(t *testing.T) {
+	day := time.Date(2022, 10, 1, 0, 0, 0, 0, time.Local)
+	nightWindow, _ := resources.ParseDownloadWindow("01:00-07:00")
+	assert.True(t, nightWindow.Contains(day.Add(3*time.Hour)))
+	assert.False(t, nightWindow.Contains(day.Add(7*time.Hour)))
+	assert.False(t, nightWindow.Contains(day.Add(23*time.Hour)))
+
+	midnightWindow, _ := resources.ParseDownloadWindow("22:00-02:00")
+	assert.True(t, midnightWindow.Contains(day.Add(23*time.Hour)))
+	assert.True(t, midnightWindow.Contains(day.Add(time.Hour)))
+	assert.False(t, midnightWindow.Contains(day.Add(12*time.Hour)))
+}
+
+func TestDownloadScheduleIsOpen(t *testing.T) {
+	day := time.Date(2022, 10, 1, 0, 0, 0, 0, time.Local)
+	var emptySchedule resources.DownloadSchedule
+	assert.True(t, emptySchedule.IsOpen(day))
+
+	schedule, err := resources.ParseDownloadSchedule([]string{"01:00-07:00", " ", "13:00-14:00"})
+	assert.Nil(t, err)
+	assert.Len(t, schedule, 2)
+	assert.True(t, schedule.IsOpen(day.Add(13*time.Hour+30*time.Minute)))
+	assert.False(t, schedule.IsOpen(day.Add(12*time.Hour)))
+
+	_, err = resources.ParseDownloadSchedule([]string{"01:00-07:00", "invalid"})
+	assert.NotNil(t, err)
+}
+
+func TestDownloadScheduleWaitOpenCanceled(t *testing.T) {
+	now := time.Now()
+	closedWindow := resources.DownloadWindow{
+		Start: time.Duration(now.Hour()+2) % 24 * time.Hour,
+		End:   time.Duration(now.Hour()+3) % 24 * time.Hour,
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	assert.NotNil(t, resources.DownloadSchedule{closedWindow}.WaitOpen(ctx))
+}
+
+func TestNewBandwidthLimiter(t *testing.T) {
+	assert.Nil(t, resources.NewBandwidthLimiter(0))
+	limiter := resources.NewBandwidthLimiter(8)
+	assert.Equal(t, rate.Limit(8*1024), limiter.Limit())
+	assert.Equal(t, resources.MIN_BANDWIDTH_BURST, limiter.Burst())
+}
+
+func TestResourceSaveBandwidthLimited(t *testing.T) {
+	destinationDir := t.TempDir()
+	handler := &resources.HTTPResource{URL: url.URL{Scheme: "http", Host: "localhost", Path: "/game.zip"}}
+	resource := resources.NewResource(handler, destinationDir, []string{})
+	resource.Limiters = []*rate.Limiter{resources.NewBandwidthLimiter(32)}
+	data := bytes.Repeat([]byte{1}, 48*1024)
+
+	start := time.Now()
+	assert.Nil(t, resource.Save(bytes.NewReader(data)))
+	assert.GreaterOrEqual(t, time.Since(start), 400*time.Millisecond)
+	assert.Equal(t, int64(len(data)), resource.Available)
+	saved, err := os.ReadFile(filepath.Join(destinationDir, "game.zip"))
+	assert.Nil(t, err)
+	assert.Equal(t, data, saved)
+}
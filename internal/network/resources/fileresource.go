@@ -0,0 +1,112 @@
+package resources
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Handler of `file:` resources, stored on a local path or on a mounted network share.
+//
+// The file is hard-linked into the resource path when both are on the same file
+// system, otherwise it's copied reporting the progress like the remote handlers.
+// A `file:` URL with an host other than `localhost` is resolved as a UNC path.
+type FileResource struct {
+	URL url.URL
+}
+
+func (fileResource *FileResource) GetURL() url.URL {
+	return fileResource.URL
+}
+
+func (fileResource *FileResource) Download(resource *Resource) {
+	sourcePath := fileResource.getLocalPath()
+	sourceInfo, err := os.Stat(sourcePath)
+	if err != nil {
+		resource.SetStatus(ERROR)
+		logrus.Errorf("%+v", err)
+		return
+	}
+	if sourceInfo.IsDir() {
+		resource.SetStatus(ERROR)
+		logrus.Errorf("%+v", errors.New("file resource is a directory"))
+		return
+	}
+	if resource.Context().Err() != nil {
+		resource.SetStatus(ABORTING)
+		return
+	}
+	resource.SetStatus(DOWNLOADING)
+	resource.SetTotal(sourceInfo.Size())
+
+	destinationPath := path.Join(resource.Path, filepath.Base(fileResource.URL.Path))
+	resource.Files = []string{destinationPath}
+	if destinationInfo, err := os.Stat(destinationPath); err == nil {
+		if os.SameFile(sourceInfo, destinationInfo) {
+			resource.SetProgress(sourceInfo.Size(), 0)
+			resource.SetStatus(DOWNLOADED)
+			return
+		}
+		os.Remove(destinationPath)
+	}
+	if err = os.Link(sourcePath, destinationPath); err == nil {
+		resource.SetProgress(sourceInfo.Size(), 0)
+		resource.SetStatus(DOWNLOADED)
+		return
+	}
+	logrus.Debugf("%s: Cannot hard-link the file, copying it", fileResource.URL.String())
+
+	source, err := os.Open(sourcePath)
+	if err != nil {
+		resource.SetStatus(ERROR)
+		logrus.Errorf("%+v", err)
+		return
+	}
+	defer source.Close()
+	ctx := resource.Context()
+	if err := resource.Save(&contextReader{ctx, source}); err != nil {
+		os.Remove(destinationPath)
+		if ctx.Err() != nil {
+			resource.SetStatus(ABORTING)
+			return
+		}
+		resource.SetStatus(ERROR)
+		logrus.Errorf("%+v", err)
+		return
+	}
+	resource.SetStatus(DOWNLOADED)
+}
+
+// Reader failing once the context is canceled, stopping the copy of the file
+type contextReader struct {
+	ctx    context.Context
+	reader io.Reader
+}
+
+func (contextReader *contextReader) Read(buffer []byte) (int, error) {
+	if err := contextReader.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return contextReader.reader.Read(buffer)
+}
+
+// Convert the URL to the operative system path of the file
+func (fileResource *FileResource) getLocalPath() string {
+	urlPath := fileResource.URL.Path
+	if fileResource.URL.Host != "" && fileResource.URL.Host != "localhost" {
+		return filepath.FromSlash("//" + fileResource.URL.Host + urlPath)
+	}
+	if runtime.GOOS == "windows" {
+		// Drive letter URLs are in the form file:///C:/path
+		urlPath = strings.TrimPrefix(urlPath, "/")
+	}
+	return filepath.FromSlash(urlPath)
+}
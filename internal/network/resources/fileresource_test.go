@@ -0,0 +1,97 @@
+package resources_test
+
+import (
+	"bytes"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"arkhive.dev/launcher/internal/network/resources"
+	"github.com/stretchr/testify/assert"
+)
+
+func newFileResourceURL(t *testing.T, filePath string) url.URL {
+	absolutePath, err := filepath.Abs(filePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return url.URL{
+		Scheme: "file",
+		Path:   filepath.ToSlash(absolutePath),
+	}
+}
+
+func TestFileResourceDownload(t *testing.T) {
+	sharedDir := t.TempDir()
+	data := bytes.Repeat([]byte("arkHive"), 1024)
+	sharedFilePath := filepath.Join(sharedDir, "game.zip")
+	if err := os.WriteFile(sharedFilePath, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	destinationDir := t.TempDir()
+	handler := &resources.FileResource{URL: newFileResourceURL(t, sharedFilePath)}
+	resource := resources.NewResource(handler, destinationDir, []string{})
+	resource.Download()
+
+	assert.Equal(t, resources.DOWNLOADED, resource.Status)
+	assert.Equal(t, int64(len(data)), resource.Total)
+	assert.Equal(t, resource.Total, resource.Available)
+	downloaded, err := os.ReadFile(filepath.Join(destinationDir, "game.zip"))
+	assert.Nil(t, err)
+	assert.Equal(t, data, downloaded)
+	sharedData, err := os.ReadFile(sharedFilePath)
+	assert.Nil(t, err)
+	assert.Equal(t, data, sharedData)
+}
+
+func TestFileResourceSameFile(t *testing.T) {
+	sharedDir := t.TempDir()
+	sharedFilePath := filepath.Join(sharedDir, "game.zip")
+	if err := os.WriteFile(sharedFilePath, []byte("arkHive"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	handler := &resources.FileResource{URL: newFileResourceURL(t, sharedFilePath)}
+	resource := resources.NewResource(handler, sharedDir, []string{})
+	resource.Download()
+
+	assert.Equal(t, resources.DOWNLOADED, resource.Status)
+	sharedData, err := os.ReadFile(sharedFilePath)
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("arkHive"), sharedData)
+}
+
+func TestFileResourceMissingFile(t *testing.T) {
+	handler := &resources.FileResource{URL: newFileResourceURL(t, filepath.Join(t.TempDir(), "missing.zip"))}
+	resource := resources.NewResource(handler, t.TempDir(), []string{})
+	resource.Download()
+
+	assert.Equal(t, resources.ERROR, resource.Status)
+}
+
+func TestFileResourceDirectory(t *testing.T) {
+	handler := &resources.FileResource{URL: newFileResourceURL(t, t.TempDir())}
+	resource := resources.NewResource(handler, t.TempDir(), []string{})
+	resource.Download()
+
+	assert.Equal(t, resources.ERROR, resource.Status)
+}
+
+func TestFileResourceAborted(t *testing.T) {
+	sharedFilePath := filepath.Join(t.TempDir(), "game.zip")
+	if err := os.WriteFile(sharedFilePath, []byte("arkHive"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	destinationDir := t.TempDir()
+	handler := &resources.FileResource{URL: newFileResourceURL(t, sharedFilePath)}
+	resource := resources.NewResource(handler, destinationDir, []string{})
+	resource.Abort()
+	resource.Download()
+
+	assert.Equal(t, resources.ABORTING, resource.GetStatus())
+	_, err := os.Stat(filepath.Join(destinationDir, "game.zip"))
+	assert.ErrorIs(t, err, os.ErrNotExist)
+}
@@ -1,6 +1,8 @@
 package resources
 
 import (
+	"context"
+	"fmt"
 	"net/http"
 	"net/url"
 
@@ -9,6 +11,8 @@ import (
 
 type HTTPResource struct {
 	URL url.URL
+	// Client performing the request, the default one is used when not set
+	Client *http.Client
 }
 
 func (httpResource *HTTPResource) GetURL() url.URL {
@@ -20,12 +24,14 @@ func (httpResource *HTTPResource) Download(resource *Resource) {
 		response *http.Response
 		err      error
 	)
-	if response, err = http.Get(httpResource.URL.String()); err != nil {
+	if response, err = getHTTP(resource.Context(), httpResource.Client, httpResource.URL); err != nil {
 		resource.SetStatus(ERROR)
 		logrus.Errorf("%+v", err)
 		return
 	}
-	resource.Total = response.ContentLength
+	defer response.Body.Close()
+	resource.SetStatus(DOWNLOADING)
+	resource.SetTotal(response.ContentLength)
 	if err := resource.Save(response.Body); err != nil {
 		resource.SetStatus(ERROR)
 		logrus.Errorf("%+v", err)
@@ -33,3 +39,22 @@ func (httpResource *HTTPResource) Download(resource *Resource) {
 	}
 	resource.SetStatus(DOWNLOADED)
 }
+
+// Perform a GET request, failing on non successful status codes
+func getHTTP(ctx context.Context, client *http.Client, url url.URL) (response *http.Response, err error) {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	var request *http.Request
+	if request, err = http.NewRequestWithContext(ctx, http.MethodGet, url.String(), nil); err != nil {
+		return
+	}
+	if response, err = client.Do(request); err != nil {
+		return
+	}
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		response.Body.Close()
+		err = fmt.Errorf("%s: unexpected HTTP status %s", url.String(), response.Status)
+	}
+	return
+}
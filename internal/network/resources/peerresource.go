@@ -0,0 +1,137 @@
+package resources
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+)
+
+var ErrChecksumMismatch = errors.New("the downloaded package does not match its catalog checksum")
+
+// Handler of packages shared by the LAN peers, requested by their catalog SHA-256 checksum.
+//
+// The peers are tried in order until one of them serves a package matching the checksum,
+// falling back to the catalog URL handler when none does. The fallback download is
+// verified against the checksum too, so it must write a single file, like a torrent
+// restricted to the package with the allowed files.
+type PeerResource struct {
+	// Catalog URL of the package, naming the downloaded file
+	URL url.URL
+	// Hex SHA-256 checksum of the package
+	Sha256 string
+	// Base URLs of the peers currently sharing packages
+	Peers func() []url.URL
+	// Client performing the requests, the default one is used when not set
+	Client *http.Client
+	// Handler of the catalog URL, nil to fetch the package only from the peers
+	Fallback ResourceHandler
+}
+
+func (peerResource *PeerResource) GetURL() url.URL {
+	return peerResource.URL
+}
+
+func (peerResource *PeerResource) Download(resource *Resource) {
+	resource.SetStatus(SEARCHING_PEERS)
+	var peers []url.URL
+	if peerResource.Peers != nil {
+		peers = peerResource.Peers()
+	}
+	resource.Peers = len(peers)
+	for _, peer := range peers {
+		if err := peerResource.downloadFrom(resource, peer); err != nil {
+			logrus.Warnf("%s: Cannot fetch the package from %s: %v", peerResource.URL.String(), peer.Host, err)
+			continue
+		}
+		resource.SetStatus(DOWNLOADED)
+		return
+	}
+	if peerResource.Fallback == nil {
+		resource.SetStatus(ERROR)
+		logrus.Errorf("%s: no LAN peer shares the package", peerResource.URL.String())
+		return
+	}
+	peerResource.Fallback.Download(resource)
+	if resource.Status != DOWNLOADED {
+		return
+	}
+	if err := peerResource.verify(resource); err != nil {
+		resource.SetStatus(ERROR)
+		logrus.Errorf("%s: %+v", peerResource.URL.String(), err)
+	}
+}
+
+// The path the package is shared on by a peer
+func PeerPackagePath(sha256 string) string {
+	return "/packages/" + strings.ToLower(sha256)
+}
+
+func (peerResource *PeerResource) downloadFrom(resource *Resource, peer url.URL) (err error) {
+	packageURL := peer.JoinPath(PeerPackagePath(peerResource.Sha256))
+	var response *http.Response
+	if response, err = getHTTP(resource.Context(), peerResource.Client, *packageURL); err != nil {
+		return
+	}
+	defer response.Body.Close()
+	// The package is read up to the size announced by the peer, never past it
+	if response.ContentLength < 0 {
+		return errors.New("package size not announced")
+	}
+	resource.SetStatus(DOWNLOADING)
+	resource.SetTotal(response.ContentLength)
+	resource.Available = 0
+	if err = resource.SaveAs(io.LimitReader(response.Body, response.ContentLength), peerResource.getFileName(resource)); err != nil {
+		return
+	}
+	return peerResource.verify(resource)
+}
+
+// Name of the package file, the allowed file of a collection or the catalog URL one
+func (peerResource *PeerResource) getFileName(resource *Resource) string {
+	if len(resource.AllowedFiles) == 1 {
+		return path.Base(resource.AllowedFiles[0])
+	}
+	return path.Base(peerResource.URL.Path)
+}
+
+// Verify the package written by the handler against the checksum, removing it on mismatch
+func (peerResource *PeerResource) verify(resource *Resource) (err error) {
+	if len(resource.Files) != 1 {
+		return fmt.Errorf("%w: %d files downloaded instead of the package", ErrChecksumMismatch, len(resource.Files))
+	}
+	packagePath := resource.Files[0]
+	var checksum string
+	if checksum, err = FileSha256(packagePath); err != nil {
+		return
+	}
+	if !strings.EqualFold(checksum, peerResource.Sha256) {
+		os.Remove(packagePath)
+		resource.Available = 0
+		return fmt.Errorf("%w: got %s", ErrChecksumMismatch, checksum)
+	}
+	return
+}
+
+// Compute the hex SHA-256 checksum of the file
+func FileSha256(filePath string) (checksum string, err error) {
+	var file *os.File
+	if file, err = os.Open(filePath); err != nil {
+		return
+	}
+	defer file.Close()
+	hash := sha256.New()
+	if _, err = io.Copy(hash, file); err != nil {
+		return
+	}
+	checksum = hex.EncodeToString(hash.Sum(nil))
+	return
+}
@@ -0,0 +1,99 @@
+package resources_test
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"arkhive.dev/launcher/internal/network/resources"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestPeer(t *testing.T, sha256 string, data []byte) url.URL {
+	peer := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		if request.URL.Path != resources.PeerPackagePath(sha256) {
+			http.NotFound(writer, request)
+			return
+		}
+		writer.Write(data)
+	}))
+	t.Cleanup(peer.Close)
+	peerURL, err := url.Parse(peer.URL)
+	assert.Nil(t, err)
+	return *peerURL
+}
+
+func TestPeerResourceDownload(t *testing.T) {
+	data := []byte("arkHive")
+	hash := sha256.Sum256(data)
+	checksum := hex.EncodeToString(hash[:])
+	sharedFilePath := filepath.Join(t.TempDir(), "game.zip")
+	assert.Nil(t, os.WriteFile(sharedFilePath, []byte("catalog"), 0644))
+
+	tamperingPeer := newTestPeer(t, checksum, []byte("tampered"))
+	peer := newTestPeer(t, checksum, data)
+	handler := &resources.PeerResource{
+		URL:      newFileResourceURL(t, sharedFilePath),
+		Sha256:   checksum,
+		Peers:    func() []url.URL { return []url.URL{tamperingPeer, peer} },
+		Fallback: &resources.FileResource{URL: newFileResourceURL(t, sharedFilePath)},
+	}
+	destinationDir := t.TempDir()
+	resource := resources.NewResource(handler, destinationDir, []string{})
+	resource.Download()
+
+	assert.Equal(t, resources.DOWNLOADED, resource.Status)
+	assert.Equal(t, 2, resource.Peers)
+	downloaded, err := os.ReadFile(filepath.Join(destinationDir, "game.zip"))
+	assert.Nil(t, err)
+	assert.Equal(t, data, downloaded)
+}
+
+func TestPeerResourceFallback(t *testing.T) {
+	data := []byte("arkHive")
+	sharedFilePath := filepath.Join(t.TempDir(), "game.zip")
+	assert.Nil(t, os.WriteFile(sharedFilePath, data, 0644))
+	checksum, err := resources.FileSha256(sharedFilePath)
+	assert.Nil(t, err)
+
+	handler := &resources.PeerResource{
+		URL:      newFileResourceURL(t, sharedFilePath),
+		Sha256:   checksum,
+		Fallback: &resources.FileResource{URL: newFileResourceURL(t, sharedFilePath)},
+	}
+	resource := resources.NewResource(handler, t.TempDir(), []string{})
+	resource.Download()
+	assert.Equal(t, resources.DOWNLOADED, resource.Status)
+
+	handler.Sha256 = "9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08"
+	destinationDir := t.TempDir()
+	resource = resources.NewResource(handler, destinationDir, []string{})
+	resource.Download()
+	assert.Equal(t, resources.ERROR, resource.Status)
+	_, err = os.Stat(filepath.Join(destinationDir, "game.zip"))
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestPeerResourceTorrentFallback(t *testing.T) {
+	magnet, collectionFiles := startLocalSeeder(t)
+	hash := sha256.Sum256(collectionFiles["second_game.zip"])
+	leecherDir := t.TempDir()
+	handler := &resources.PeerResource{
+		URL:    magnet,
+		Sha256: hex.EncodeToString(hash[:]),
+		Fallback: &resources.TorrentResource{
+			URL:    magnet,
+			Client: newLocalTorrentClient(t, leecherDir, false),
+		},
+	}
+	resource := resources.NewResource(handler, leecherDir, []string{"second_game.zip"})
+	resource.Download()
+
+	assert.Equal(t, resources.DOWNLOADED, resource.Wait())
+	assert.Equal(t, []string{filepath.Join(leecherDir, TORRENT_COLLECTION_NAME, "second_game.zip")}, resource.Files)
+}
@@ -1,13 +1,16 @@
 package resources
 
 import (
+	"context"
 	"io"
 	"net/url"
 	"os"
 	"path"
 	"path/filepath"
+	"sync"
 
 	"github.com/sirupsen/logrus"
+	"golang.org/x/time/rate"
 )
 
 type ResourceStatus int
@@ -21,6 +24,8 @@ const (
 	TORRENT_DOWNLOADED
 	ABORTING
 	ERROR
+	UPLOADING
+	UPLOADED
 )
 
 type ResourceHandler interface {
@@ -32,21 +37,58 @@ type Resource struct {
 	Handler      ResourceHandler
 	Path         string
 	AllowedFiles []string
-	Total        int64
-	Available    int64
-	Status       ResourceStatus
+	// Paths of the files written by the handler, set once downloaded
+	Files     []string
+	Total     int64
+	Available int64
+	Peers     int
+	Status    ResourceStatus
+	Priority  ResourcePriority
+	// Bandwidth limiters applied to the saved data, like the global and the resource ones
+	Limiters []*rate.Limiter
+	// Windows during which a low priority resource could be transferred
+	Schedule DownloadSchedule
+	context  context.Context
+	cancel   context.CancelFunc
+	// Closed once the download ends
+	done     chan struct{}
+	doneOnce sync.Once
+	// Guards the status and the progress, updated by the handler while being read
+	lock sync.Mutex
 }
 
 func NewResource(resourceHandler ResourceHandler, resourcePath string, allowedFiles []string) *Resource {
+	context, cancel := context.WithCancel(context.Background())
 	return &Resource{
 		Handler:      resourceHandler,
 		Path:         resourcePath,
 		AllowedFiles: allowedFiles,
 		Status:       PENDING,
+		context:      context,
+		cancel:       cancel,
+		done:         make(chan struct{}),
+	}
+}
+
+// The context of the resource transfers, canceled when the resource is aborted
+func (resource *Resource) Context() context.Context {
+	if resource.context == nil {
+		return context.Background()
+	}
+	return resource.context
+}
+
+// Abort the running transfer of the resource
+func (resource *Resource) Abort() {
+	resource.SetStatus(ABORTING)
+	if resource.cancel != nil {
+		resource.cancel()
 	}
 }
 
 func (resource *Resource) SetStatus(status ResourceStatus) {
+	resource.lock.Lock()
+	defer resource.lock.Unlock()
 	resource.Status = status
 	switch resource.Status {
 	case DOWNLOADED:
@@ -59,25 +101,81 @@ func (resource *Resource) SetStatus(status ResourceStatus) {
 	//resource.StatusUpdatedEventEmitter.Emit(resource)
 }
 
+// The status of the resource
+func (resource *Resource) GetStatus() ResourceStatus {
+	resource.lock.Lock()
+	defer resource.lock.Unlock()
+	return resource.Status
+}
+
+// Update the downloaded bytes and the connected peers
+func (resource *Resource) SetProgress(available int64, peers int) {
+	resource.lock.Lock()
+	defer resource.lock.Unlock()
+	resource.Available = available
+	resource.Peers = peers
+}
+
+// Update the total bytes of the resource
+func (resource *Resource) SetTotal(total int64) {
+	resource.lock.Lock()
+	defer resource.lock.Unlock()
+	resource.Total = total
+}
+
+// The downloaded bytes, the total ones and the connected peers
+func (resource *Resource) GetProgress() (available int64, total int64, peers int) {
+	resource.lock.Lock()
+	defer resource.lock.Unlock()
+	return resource.Available, resource.Total, resource.Peers
+}
+
 func (resource *Resource) Write(buffer []byte) (int, error) {
 	bufferSize := len(buffer)
+	resource.lock.Lock()
 	resource.Available += int64(bufferSize)
+	resource.lock.Unlock()
 	//resource.ProgressUpdatedEventEmitter.Emit(resource)
 	return bufferSize, nil
 }
 
 func (resource *Resource) Download() {
+	defer resource.doneOnce.Do(func() {
+		if resource.done != nil {
+			close(resource.done)
+		}
+	})
+	if resource.Priority == LOW_PRIORITY {
+		if err := resource.Schedule.WaitOpen(resource.Context()); err != nil {
+			return
+		}
+	}
 	resource.Handler.Download(resource)
 }
 
+// Wait for the download to end, returning the resulting status
+func (resource *Resource) Wait() ResourceStatus {
+	if resource.done != nil {
+		<-resource.done
+	}
+	return resource.GetStatus()
+}
+
 func (resource *Resource) Save(reader io.Reader) error {
-	out, err := os.Create(path.Join(resource.Path, filepath.Base(resource.Handler.GetURL().Path)))
+	return resource.SaveAs(reader, filepath.Base(resource.Handler.GetURL().Path))
+}
+
+// Save the data in the resource folder with the file name
+func (resource *Resource) SaveAs(reader io.Reader, fileName string) error {
+	outPath := path.Join(resource.Path, fileName)
+	resource.Files = []string{outPath}
+	out, err := os.Create(outPath)
 	if err != nil {
 		logrus.Errorf("%+v", err)
 		return err
 	}
 	defer out.Close()
-	if _, err := io.Copy(out, io.TeeReader(reader, resource)); err != nil {
+	if _, err := io.Copy(out, io.TeeReader(resource.newLimitedReader(reader), resource)); err != nil {
 		logrus.Errorf("%+v", err)
 		return err
 	}
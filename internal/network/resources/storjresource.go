@@ -2,47 +2,71 @@ package resources
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"io"
 	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
 
 	"github.com/sirupsen/logrus"
 	"storj.io/uplink"
 )
 
+// The Storj project operations used by the Storj resources
+type StorjProject interface {
+	// Get the size of an object
+	StatObject(ctx context.Context, bucket string, key string) (size int64, err error)
+	// Start the download of an object
+	DownloadObject(ctx context.Context, bucket string, key string) (io.ReadCloser, error)
+	// Start the upload of an object
+	UploadObject(ctx context.Context, bucket string, key string) (StorjUpload, error)
+	// Delete an object
+	DeleteObject(ctx context.Context, bucket string, key string) error
+	// Release the project resources
+	Close() error
+}
+
+// A running Storj object upload, stored only once committed
+type StorjUpload interface {
+	io.Writer
+	Commit() error
+	Abort() error
+}
+
+// Open the Storj project granted by the serialized access
+type StorjProjectOpener func(ctx context.Context, access string) (StorjProject, error)
+
 type StorjResource struct {
 	URL    url.URL
 	Access string
+	// Project opener, the uplink library is used when not set
+	OpenProject StorjProjectOpener
 }
 
 func (storjResource *StorjResource) GetURL() url.URL {
 	return storjResource.URL
 }
 
-func (storjResource StorjResource) Download(resource *Resource) {
-	userAccess, err := uplink.ParseAccess(storjResource.Access)
-	if err != nil {
-		resource.SetStatus(ERROR)
-		logrus.Errorf("%+v", err)
-		return
-	}
-	project, err := uplink.OpenProject(context.Background(), userAccess)
+func (storjResource *StorjResource) Download(resource *Resource) {
+	ctx := resource.Context()
+	project, err := storjResource.openProject(ctx)
 	if err != nil {
 		resource.SetStatus(ERROR)
 		logrus.Errorf("%+v", err)
 		return
 	}
+	defer project.Close()
 	resource.SetStatus(DOWNLOADING)
-	stat, err := project.StatObject(context.Background(),
-		resource.Handler.GetURL().Host,
-		resource.Handler.GetURL().Path)
-	if err != nil {
+	bucket, key := storjResource.getObjectLocation()
+	if resource.Total, err = project.StatObject(ctx, bucket, key); err != nil {
 		resource.SetStatus(ERROR)
 		logrus.Errorf("%+v", err)
 		return
 	}
-	resource.Total = stat.System.ContentLength
-	download, err := project.DownloadObject(context.Background(),
-		resource.Handler.GetURL().Host,
-		resource.Handler.GetURL().Path, nil)
+	download, err := project.DownloadObject(ctx, bucket, key)
 	if err != nil {
 		resource.SetStatus(ERROR)
 		logrus.Errorf("%+v", err)
@@ -56,3 +80,110 @@ func (storjResource StorjResource) Download(resource *Resource) {
 	}
 	resource.SetStatus(DOWNLOADED)
 }
+
+// Upload the resource file, named as the URL object, from the resource path to the bucket
+func (storjResource *StorjResource) Upload(resource *Resource) (err error) {
+	ctx := resource.Context()
+	var file *os.File
+	if file, err = os.Open(path.Join(resource.Path, filepath.Base(storjResource.URL.Path))); err != nil {
+		resource.SetStatus(ERROR)
+		logrus.Errorf("%+v", err)
+		return
+	}
+	defer file.Close()
+	var fileInfo os.FileInfo
+	if fileInfo, err = file.Stat(); err != nil {
+		resource.SetStatus(ERROR)
+		logrus.Errorf("%+v", err)
+		return
+	}
+	resource.SetTotal(fileInfo.Size())
+
+	var project StorjProject
+	if project, err = storjResource.openProject(ctx); err != nil {
+		resource.SetStatus(ERROR)
+		logrus.Errorf("%+v", err)
+		return
+	}
+	defer project.Close()
+	resource.SetStatus(UPLOADING)
+	bucket, key := storjResource.getObjectLocation()
+	var upload StorjUpload
+	if upload, err = project.UploadObject(ctx, bucket, key); err != nil {
+		resource.SetStatus(ERROR)
+		logrus.Errorf("%+v", err)
+		return
+	}
+	if _, err = io.Copy(upload, io.TeeReader(resource.newLimitedReader(file), resource)); err != nil {
+		upload.Abort()
+		resource.SetStatus(ERROR)
+		logrus.Errorf("%+v", err)
+		return
+	}
+	if err = upload.Commit(); err != nil {
+		resource.SetStatus(ERROR)
+		logrus.Errorf("%+v", err)
+		return
+	}
+	resource.SetStatus(UPLOADED)
+	return
+}
+
+func (storjResource *StorjResource) openProject(ctx context.Context) (StorjProject, error) {
+	openProject := storjResource.OpenProject
+	if openProject == nil {
+		openProject = OpenUplinkProject
+	}
+	return openProject(ctx, storjResource.Access)
+}
+
+// Get the bucket and the object key from the resource URL
+func (storjResource *StorjResource) getObjectLocation() (bucket string, key string) {
+	return storjResource.URL.Host, strings.TrimPrefix(storjResource.URL.Path, "/")
+}
+
+// Open a Storj project through the uplink library
+func OpenUplinkProject(ctx context.Context, access string) (StorjProject, error) {
+	userAccess, err := uplink.ParseAccess(access)
+	if err != nil {
+		return nil, err
+	}
+	project, err := uplink.OpenProject(ctx, userAccess)
+	if err != nil {
+		return nil, err
+	}
+	return &uplinkProject{project}, nil
+}
+
+type uplinkProject struct {
+	project *uplink.Project
+}
+
+func (uplinkProject *uplinkProject) StatObject(ctx context.Context, bucket string, key string) (int64, error) {
+	object, err := uplinkProject.project.StatObject(ctx, bucket, key)
+	if err != nil {
+		return 0, err
+	}
+	return object.System.ContentLength, nil
+}
+
+func (uplinkProject *uplinkProject) DownloadObject(ctx context.Context, bucket string, key string) (io.ReadCloser, error) {
+	download, err := uplinkProject.project.DownloadObject(ctx, bucket, key, nil)
+	if errors.Is(err, uplink.ErrObjectNotFound) {
+		return nil, fmt.Errorf("%w: %w", os.ErrNotExist, err)
+	}
+	return download, err
+}
+
+func (uplinkProject *uplinkProject) UploadObject(ctx context.Context, bucket string, key string) (StorjUpload, error) {
+	return uplinkProject.project.UploadObject(ctx, bucket, key, nil)
+}
+
+func (uplinkProject *uplinkProject) DeleteObject(ctx context.Context, bucket string, key string) error {
+	_, err := uplinkProject.project.DeleteObject(ctx, bucket, key)
+	return err
+}
+
+func (uplinkProject *uplinkProject) Close() error {
+	return uplinkProject.project.Close()
+}
@@ -0,0 +1,176 @@
+package resources_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"arkhive.dev/launcher/internal/network/resources"
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeStorjProject struct {
+	Objects map[string][]byte
+	Closed  bool
+}
+
+func (project *fakeStorjProject) StatObject(ctx context.Context, bucket string, key string) (int64, error) {
+	object, ok := project.Objects[bucket+"/"+key]
+	if !ok {
+		return 0, errors.New("object not found")
+	}
+	return int64(len(object)), nil
+}
+
+func (project *fakeStorjProject) DownloadObject(ctx context.Context, bucket string, key string) (io.ReadCloser, error) {
+	object, ok := project.Objects[bucket+"/"+key]
+	if !ok {
+		return nil, errors.New("object not found")
+	}
+	return &fakeStorjDownload{ctx: ctx, reader: bytes.NewReader(object)}, nil
+}
+
+func (project *fakeStorjProject) UploadObject(ctx context.Context, bucket string, key string) (resources.StorjUpload, error) {
+	return &fakeStorjUpload{project: project, name: bucket + "/" + key}, nil
+}
+
+func (project *fakeStorjProject) DeleteObject(ctx context.Context, bucket string, key string) error {
+	delete(project.Objects, bucket+"/"+key)
+	return nil
+}
+
+func (project *fakeStorjProject) Close() error {
+	project.Closed = true
+	return nil
+}
+
+func (project *fakeStorjProject) Opener() resources.StorjProjectOpener {
+	return func(ctx context.Context, access string) (resources.StorjProject, error) {
+		if access != "access" {
+			return nil, errors.New("invalid access")
+		}
+		return project, nil
+	}
+}
+
+type fakeStorjDownload struct {
+	ctx    context.Context
+	reader io.Reader
+}
+
+func (download *fakeStorjDownload) Read(buffer []byte) (int, error) {
+	if err := download.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return download.reader.Read(buffer)
+}
+
+func (download *fakeStorjDownload) Close() error {
+	return nil
+}
+
+type fakeStorjUpload struct {
+	project *fakeStorjProject
+	name    string
+	buffer  bytes.Buffer
+}
+
+func (upload *fakeStorjUpload) Write(buffer []byte) (int, error) {
+	return upload.buffer.Write(buffer)
+}
+
+func (upload *fakeStorjUpload) Commit() error {
+	upload.project.Objects[upload.name] = upload.buffer.Bytes()
+	return nil
+}
+
+func (upload *fakeStorjUpload) Abort() error {
+	return nil
+}
+
+func newStorjResource(project *fakeStorjProject, access string) *resources.StorjResource {
+	return &resources.StorjResource{
+		URL: url.URL{
+			Scheme: "sj",
+			Host:   "arkhive",
+			Path:   "/undertow.tow",
+		},
+		Access:      access,
+		OpenProject: project.Opener(),
+	}
+}
+
+func TestStorjResourceDownload(t *testing.T) {
+	project := &fakeStorjProject{Objects: map[string][]byte{"arkhive/undertow.tow": []byte("undertow")}}
+	destinationDir := t.TempDir()
+	resource := resources.NewResource(newStorjResource(project, "access"), destinationDir, []string{})
+	resource.Download()
+
+	assert.Equal(t, resources.DOWNLOADED, resource.Status)
+	assert.Equal(t, int64(8), resource.Total)
+	assert.Equal(t, int64(8), resource.Available)
+	assert.True(t, project.Closed)
+	downloaded, err := os.ReadFile(filepath.Join(destinationDir, "undertow.tow"))
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("undertow"), downloaded)
+}
+
+func TestStorjResourceDownloadMissingObject(t *testing.T) {
+	project := &fakeStorjProject{Objects: map[string][]byte{}}
+	resource := resources.NewResource(newStorjResource(project, "access"), t.TempDir(), []string{})
+	resource.Download()
+
+	assert.Equal(t, resources.ERROR, resource.Status)
+	assert.True(t, project.Closed)
+}
+
+func TestStorjResourceDownloadInvalidAccess(t *testing.T) {
+	project := &fakeStorjProject{Objects: map[string][]byte{"arkhive/undertow.tow": []byte("undertow")}}
+	resource := resources.NewResource(newStorjResource(project, "wrong"), t.TempDir(), []string{})
+	resource.Download()
+
+	assert.Equal(t, resources.ERROR, resource.Status)
+}
+
+func TestStorjResourceDownloadAborted(t *testing.T) {
+	project := &fakeStorjProject{Objects: map[string][]byte{"arkhive/undertow.tow": []byte("undertow")}}
+	resource := resources.NewResource(newStorjResource(project, "access"), t.TempDir(), []string{})
+	resource.Abort()
+	resource.Download()
+
+	assert.Equal(t, resources.ERROR, resource.Status)
+	assert.Equal(t, int64(0), resource.Available)
+	assert.True(t, project.Closed)
+}
+
+func TestStorjResourceUpload(t *testing.T) {
+	project := &fakeStorjProject{Objects: map[string][]byte{}}
+	sourceDir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(sourceDir, "undertow.tow"), []byte("undertow"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	handler := newStorjResource(project, "access")
+	resource := resources.NewResource(handler, sourceDir, []string{})
+
+	assert.Nil(t, handler.Upload(resource))
+	assert.Equal(t, resources.UPLOADED, resource.Status)
+	assert.Equal(t, int64(8), resource.Total)
+	assert.Equal(t, int64(8), resource.Available)
+	assert.Equal(t, []byte("undertow"), project.Objects["arkhive/undertow.tow"])
+	assert.True(t, project.Closed)
+}
+
+func TestStorjResourceUploadMissingFile(t *testing.T) {
+	project := &fakeStorjProject{Objects: map[string][]byte{}}
+	handler := newStorjResource(project, "access")
+	resource := resources.NewResource(handler, t.TempDir(), []string{})
+
+	assert.NotNil(t, handler.Upload(resource))
+	assert.Equal(t, resources.ERROR, resource.Status)
+	assert.Empty(t, project.Objects)
+}
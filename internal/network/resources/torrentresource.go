@@ -0,0 +1,184 @@
+package resources
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"time"
+
+	"github.com/anacrolix/torrent"
+	"github.com/anacrolix/torrent/metainfo"
+	"github.com/anacrolix/torrent/storage"
+	"github.com/sirupsen/logrus"
+)
+
+// Interval between two polls of the torrent statistics
+const TORRENT_POLL_INTERVAL = 500 * time.Millisecond
+
+// Handler of BitTorrent resources.
+//
+// The URL could be a `magnet:` link or a `torrent:` URL pointing to the torrent
+// metainfo file. A `torrent:` URL with an host is fetched over HTTPS, while one
+// without host is read from the local file system.
+// Only the files listed in the resource allowed files are downloaded, matching the
+// path relative to the torrent root (the `collection_path` of the catalog); every
+// file is downloaded if the list is empty. The paths of the selected files are set as
+// the resource files.
+// Download returns once the selected files are downloaded and their pieces checked,
+// then the files are seeded in background until SeedRatio times the selected size is
+// uploaded or the resource is aborted.
+type TorrentResource struct {
+	URL    url.URL
+	Client *torrent.Client
+	// Client fetching the remote metainfo files, the default one is used when not set
+	HTTPClient *http.Client
+	SeedRatio  float64
+}
+
+func (torrentResource *TorrentResource) GetURL() url.URL {
+	return torrentResource.URL
+}
+
+func (torrentResource *TorrentResource) Download(resource *Resource) {
+	resource.SetStatus(DOWNLOADING_TORRENT)
+	ctx := resource.Context()
+	spec, err := torrentResource.getTorrentSpec(ctx)
+	if err != nil {
+		resource.SetStatus(ERROR)
+		logrus.Errorf("%+v", err)
+		return
+	}
+	spec.Storage = storage.NewFileOpts(storage.NewFileClientOpts{
+		ClientBaseDir:   resource.Path,
+		PieceCompletion: storage.NewMapPieceCompletion(),
+	})
+	torrentHandle, _, err := torrentResource.Client.AddTorrentSpec(spec)
+	if err != nil {
+		resource.SetStatus(ERROR)
+		logrus.Errorf("%+v", err)
+		return
+	}
+	if !torrentResource.download(ctx, resource, torrentHandle) {
+		torrentHandle.Drop()
+		return
+	}
+	resource.SetStatus(DOWNLOADED)
+	go torrentResource.seed(ctx, torrentHandle, resource.Total)
+}
+
+// Download the selected files of the torrent, returning whether they all completed
+func (torrentResource *TorrentResource) download(ctx context.Context, resource *Resource, torrentHandle *torrent.Torrent) bool {
+	resource.SetStatus(SEARCHING_PEERS)
+	select {
+	case <-torrentHandle.GotInfo():
+	case <-ctx.Done():
+		resource.SetStatus(ABORTING)
+		return false
+	}
+	resource.SetStatus(TORRENT_DOWNLOADED)
+
+	files := selectTorrentFiles(torrentHandle.Files(), resource.AllowedFiles)
+	if len(files) == 0 {
+		resource.SetStatus(ERROR)
+		logrus.Errorf("%+v", errors.New("no torrent files match the allowed files"))
+		return false
+	}
+	var total int64
+	resource.Files = nil
+	for _, file := range files {
+		total += file.Length()
+		file.Download()
+		// The storage writes the files under the torrent name, like Path/<torrent name>/<file>
+		resource.Files = append(resource.Files, filepath.Join(resource.Path, filepath.FromSlash(file.Path())))
+	}
+	resource.SetTotal(total)
+
+	ticker := time.NewTicker(TORRENT_POLL_INTERVAL)
+	defer ticker.Stop()
+	// Only the pieces passing the hash check are counted as completed
+	for completed := int64(0); completed < total; {
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			resource.SetStatus(ABORTING)
+			return false
+		}
+		peers := torrentHandle.Stats().ActivePeers
+		completed = 0
+		for _, file := range files {
+			completed += file.BytesCompleted()
+		}
+		resource.SetProgress(completed, peers)
+		if peers == 0 {
+			resource.SetStatus(SEARCHING_PEERS)
+		} else {
+			resource.SetStatus(DOWNLOADING)
+		}
+	}
+	return true
+}
+
+// Seed the downloaded files until the seed target is uploaded or the context is canceled
+func (torrentResource *TorrentResource) seed(ctx context.Context, torrentHandle *torrent.Torrent, total int64) {
+	defer torrentHandle.Drop()
+	seedTarget := int64(torrentResource.SeedRatio * float64(total))
+	ticker := time.NewTicker(TORRENT_POLL_INTERVAL)
+	defer ticker.Stop()
+	for {
+		if stats := torrentHandle.Stats(); stats.BytesWrittenData.Int64() >= seedTarget {
+			break
+		}
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+	logrus.Debugf("%s: Seeding completed", torrentResource.URL.String())
+}
+
+func (torrentResource *TorrentResource) getTorrentSpec(ctx context.Context) (spec *torrent.TorrentSpec, err error) {
+	if torrentResource.Client == nil {
+		return nil, errors.New("torrent client not available")
+	}
+	switch torrentResource.URL.Scheme {
+	case "magnet":
+		return torrent.TorrentSpecFromMagnetUri(torrentResource.URL.String())
+	case "torrent":
+		var metaInfo *metainfo.MetaInfo
+		if torrentResource.URL.Host == "" {
+			metaInfo, err = metainfo.LoadFromFile(torrentResource.URL.Path)
+		} else {
+			metaInfoURL := torrentResource.URL
+			metaInfoURL.Scheme = "https"
+			var response *http.Response
+			if response, err = getHTTP(ctx, torrentResource.HTTPClient, metaInfoURL); err != nil {
+				return
+			}
+			defer response.Body.Close()
+			metaInfo, err = metainfo.Load(response.Body)
+		}
+		if err != nil {
+			return
+		}
+		return torrent.TorrentSpecFromMetaInfoErr(metaInfo)
+	}
+	return nil, errors.New("url schema not allowed")
+}
+
+func selectTorrentFiles(files []*torrent.File, allowedFiles []string) (selectedFiles []*torrent.File) {
+	if len(allowedFiles) == 0 {
+		return files
+	}
+	for _, file := range files {
+		for _, allowedFile := range allowedFiles {
+			if file.DisplayPath() == allowedFile {
+				selectedFiles = append(selectedFiles, file)
+				break
+			}
+		}
+	}
+	return
+}
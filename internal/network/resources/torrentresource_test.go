@@ -0,0 +1,174 @@
+package resources_test
+
+import (
+	"bytes"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"arkhive.dev/launcher/internal/network/resources"
+	"github.com/anacrolix/torrent"
+	"github.com/anacrolix/torrent/bencode"
+	"github.com/anacrolix/torrent/metainfo"
+	"github.com/anacrolix/torrent/storage"
+	"github.com/stretchr/testify/assert"
+)
+
+const TORRENT_COLLECTION_NAME = "collection"
+
+func newLocalTorrentClient(t *testing.T, dataDir string, seed bool) *torrent.Client {
+	clientConfig := torrent.NewDefaultClientConfig()
+	clientConfig.DataDir = dataDir
+	clientConfig.Seed = seed
+	clientConfig.NoDHT = true
+	clientConfig.DisableTrackers = true
+	clientConfig.NoDefaultPortForwarding = true
+	clientConfig.DisableIPv6 = true
+	clientConfig.ListenHost = func(string) string { return "127.0.0.1" }
+	clientConfig.ListenPort = 0
+	client, err := torrent.NewClient(clientConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { client.Close() })
+	return client
+}
+
+// Create a collection torrent with two packages and start seeding it
+func startLocalSeeder(t *testing.T) (magnet url.URL, collectionFiles map[string][]byte) {
+	seederDir := t.TempDir()
+	collectionPath := filepath.Join(seederDir, TORRENT_COLLECTION_NAME)
+	if err := os.MkdirAll(collectionPath, 0755); err != nil {
+		t.Fatal(err)
+	}
+	collectionFiles = map[string][]byte{
+		"first_game.zip":  bytes.Repeat([]byte{1}, 4*16*1024),
+		"second_game.zip": bytes.Repeat([]byte{2}, 4*16*1024),
+	}
+	for fileName, data := range collectionFiles {
+		if err := os.WriteFile(filepath.Join(collectionPath, fileName), data, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	info := metainfo.Info{PieceLength: 16 * 1024}
+	if err := info.BuildFromFilePath(collectionPath); err != nil {
+		t.Fatal(err)
+	}
+	metaInfo := metainfo.MetaInfo{}
+	var err error
+	if metaInfo.InfoBytes, err = bencode.Marshal(info); err != nil {
+		t.Fatal(err)
+	}
+
+	seeder := newLocalTorrentClient(t, seederDir, true)
+	spec := torrent.TorrentSpecFromMetaInfo(&metaInfo)
+	spec.Storage = storage.NewFileOpts(storage.NewFileClientOpts{
+		ClientBaseDir:   seederDir,
+		PieceCompletion: storage.NewMapPieceCompletion(),
+	})
+	seedingTorrent, _, err := seeder.AddTorrentSpec(spec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	<-seedingTorrent.GotInfo()
+	if err = seedingTorrent.VerifyData(); err != nil {
+		t.Fatal(err)
+	}
+
+	magnetLink := metaInfo.Magnet(nil, &info)
+	magnetLink.Params = url.Values{"x.pe": {seeder.ListenAddrs()[0].String()}}
+	var magnetURL *url.URL
+	if magnetURL, err = url.Parse(magnetLink.String()); err != nil {
+		t.Fatal(err)
+	}
+	return *magnetURL, collectionFiles
+}
+
+func TestTorrentResourceDownloadsOnlyCollectionPath(t *testing.T) {
+	magnet, collectionFiles := startLocalSeeder(t)
+	leecherDir := t.TempDir()
+	handler := &resources.TorrentResource{
+		URL:    magnet,
+		Client: newLocalTorrentClient(t, leecherDir, false),
+	}
+	resource := resources.NewResource(handler, leecherDir, []string{"second_game.zip"})
+	resource.Download()
+
+	assert.Equal(t, resources.DOWNLOADED, resource.Status)
+	assert.Equal(t, int64(len(collectionFiles["second_game.zip"])), resource.Total)
+	assert.Equal(t, resource.Total, resource.Available)
+	downloaded, err := os.ReadFile(filepath.Join(leecherDir, TORRENT_COLLECTION_NAME, "second_game.zip"))
+	assert.Nil(t, err)
+	assert.Equal(t, collectionFiles["second_game.zip"], downloaded)
+	_, err = os.Stat(filepath.Join(leecherDir, TORRENT_COLLECTION_NAME, "first_game.zip"))
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestTorrentResourceUnmatchedCollectionPath(t *testing.T) {
+	magnet, _ := startLocalSeeder(t)
+	leecherDir := t.TempDir()
+	handler := &resources.TorrentResource{
+		URL:    magnet,
+		Client: newLocalTorrentClient(t, leecherDir, false),
+	}
+	resource := resources.NewResource(handler, leecherDir, []string{"missing_game.zip"})
+	resource.Download()
+
+	assert.Equal(t, resources.ERROR, resource.Status)
+}
+
+func TestTorrentResourceWithoutClient(t *testing.T) {
+	handler := &resources.TorrentResource{
+		URL: url.URL{Scheme: "magnet"},
+	}
+	resource := resources.NewResource(handler, t.TempDir(), []string{})
+	resource.Download()
+
+	assert.Equal(t, resources.ERROR, resource.Status)
+}
+
+func TestTorrentResourceSeedsInBackground(t *testing.T) {
+	magnet, _ := startLocalSeeder(t)
+	leecherDir := t.TempDir()
+	handler := &resources.TorrentResource{
+		URL:       magnet,
+		Client:    newLocalTorrentClient(t, leecherDir, true),
+		SeedRatio: 1,
+	}
+	resource := resources.NewResource(handler, leecherDir, []string{"first_game.zip"})
+	finished := make(chan struct{})
+	go func() {
+		resource.Download()
+		close(finished)
+	}()
+	// Nobody downloads from the leecher, the seed target is never reached
+	select {
+	case <-finished:
+	case <-time.After(30 * time.Second):
+		t.Fatal("the download waited for the seeding")
+	}
+	assert.Equal(t, resources.DOWNLOADED, resource.Wait())
+	resource.Abort()
+}
+
+func TestTorrentResourceAbort(t *testing.T) {
+	magnet, _ := startLocalSeeder(t)
+	// Without the seeder address the torrent info is never received
+	magnet.RawQuery = url.Values{"xt": magnet.Query()["xt"]}.Encode()
+	leecherDir := t.TempDir()
+	handler := &resources.TorrentResource{
+		URL:    magnet,
+		Client: newLocalTorrentClient(t, leecherDir, false),
+	}
+	resource := resources.NewResource(handler, leecherDir, []string{})
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		resource.Abort()
+	}()
+	resource.Download()
+
+	assert.Equal(t, resources.ABORTING, resource.Status)
+}
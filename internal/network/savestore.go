@@ -0,0 +1,188 @@
+package network
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"arkhive.dev/launcher/internal/database/delegate/sqlite"
+	"arkhive.dev/launcher/internal/folder"
+)
+
+// Time allowed to the friend to reply to a save object request
+const SAVE_REQUEST_TIMEOUT = 30 * time.Second
+
+// Maximum size of a save object stored for a friend
+const FRIEND_SAVE_SIZE_LIMIT = 64 * 1024 * 1024
+
+// Maximum total size of the save objects stored for a friend
+const FRIEND_SAVES_QUOTA = 512 * 1024 * 1024
+
+const saveRequestIDSize = 16
+
+var ErrSaveRequestTimeout = errors.New("the friend didn't reply to the save request")
+
+// Save object request and reply, encrypted in the save messages payload
+type savePayload struct {
+	RequestID string `json:"request_id"`
+	Key       string `json:"key,omitempty"`
+	Data      []byte `json:"data,omitempty"`
+	NotFound  bool   `json:"not_found,omitempty"`
+	Error     string `json:"error,omitempty"`
+}
+
+/*
+Backend storing the save objects of the account on the node of a friend.
+
+The friend keeps the objects in a folder of the user, the objects are encrypted
+with the account key so the friend can't read them.
+*/
+type FriendSaveSyncBackend struct {
+	node      *FriendNode
+	publicKey []byte
+}
+
+// The saves backend of the friend, connected when the saves are synchronized
+func (node *FriendNode) GetSaveSyncBackend(publicKey []byte) *FriendSaveSyncBackend {
+	return &FriendSaveSyncBackend{node, publicKey}
+}
+
+func (backend *FriendSaveSyncBackend) Read(key string) ([]byte, error) {
+	reply, err := backend.node.requestSave(backend.publicKey, PEER_SAVE_READ, savePayload{Key: key})
+	return reply.Data, err
+}
+
+func (backend *FriendSaveSyncBackend) Write(key string, data []byte) error {
+	if len(data) > FRIEND_SAVE_SIZE_LIMIT {
+		return fmt.Errorf("save object %s exceeds the %d bytes limit", key, FRIEND_SAVE_SIZE_LIMIT)
+	}
+	_, err := backend.node.requestSave(backend.publicKey, PEER_SAVE_WRITE, savePayload{Key: key, Data: data})
+	return err
+}
+
+func (backend *FriendSaveSyncBackend) Delete(key string) error {
+	_, err := backend.node.requestSave(backend.publicKey, PEER_SAVE_DELETE, savePayload{Key: key})
+	return err
+}
+
+// Send the save object request to the friend and wait for the reply
+func (node *FriendNode) requestSave(publicKey []byte, messageType string, payload savePayload) (reply savePayload, err error) {
+	var user sqlite.User
+	if user, err = node.database.GetUserByPublicKey(publicKey); err != nil || !user.IsFriend {
+		return reply, ErrNotFriend
+	}
+	peer := node.getPeer(publicKey)
+	if peer == nil {
+		return reply, ErrPeerOffline
+	}
+	requestID := make([]byte, saveRequestIDSize)
+	if _, err = rand.Read(requestID); err != nil {
+		return
+	}
+	payload.RequestID = hex.EncodeToString(requestID)
+	replies := make(chan savePayload, 1)
+	node.lock.Lock()
+	node.saveRequests[payload.RequestID] = replies
+	node.lock.Unlock()
+	defer func() {
+		node.lock.Lock()
+		delete(node.saveRequests, payload.RequestID)
+		node.lock.Unlock()
+	}()
+	if err = node.sendEncrypted(peer, messageType, payload); err != nil {
+		return
+	}
+	select {
+	case reply = <-replies:
+	case <-time.After(SAVE_REQUEST_TIMEOUT):
+		return reply, ErrSaveRequestTimeout
+	case <-node.closed:
+		return reply, ErrPeerOffline
+	}
+	if reply.NotFound {
+		return reply, fmt.Errorf("save object %s: %w", payload.Key, os.ErrNotExist)
+	} else if reply.Error != "" {
+		return reply, fmt.Errorf("save object %s: %s", payload.Key, reply.Error)
+	}
+	return
+}
+
+// Read, write or delete the save object of the friend, replying with the outcome
+func (node *FriendNode) serveSaveRequest(peer *peerConnection, message peerMessage) (err error) {
+	var user sqlite.User
+	if user, err = node.database.GetUserByPublicKey(peer.publicKeyBytes); err != nil || !user.IsFriend {
+		return ErrNotFriend
+	}
+	var request savePayload
+	if err = node.receiveEncrypted(peer, message, &request); err != nil {
+		return
+	}
+	reply := savePayload{RequestID: request.RequestID}
+	var requestErr error
+	objectPath := filepath.Join(node.database.BasePath, folder.FRIEND_SAVES, user.HashedPublicKey, filepath.FromSlash(request.Key))
+	switch {
+	case !filepath.IsLocal(filepath.FromSlash(request.Key)):
+		requestErr = fmt.Errorf("invalid save object key %q", request.Key)
+	case message.Type == PEER_SAVE_READ:
+		reply.Data, requestErr = os.ReadFile(objectPath)
+	case message.Type == PEER_SAVE_WRITE && len(request.Data) > FRIEND_SAVE_SIZE_LIMIT:
+		requestErr = fmt.Errorf("save object exceeds the %d bytes limit", FRIEND_SAVE_SIZE_LIMIT)
+	case message.Type == PEER_SAVE_WRITE:
+		requestErr = writeFriendSave(filepath.Join(node.database.BasePath, folder.FRIEND_SAVES, user.HashedPublicKey), objectPath, request.Data)
+	case message.Type == PEER_SAVE_DELETE:
+		requestErr = os.Remove(objectPath)
+	}
+	if errors.Is(requestErr, os.ErrNotExist) {
+		reply.NotFound = true
+	} else if requestErr != nil {
+		reply.Error = requestErr.Error()
+	}
+	return node.sendEncrypted(peer, PEER_SAVE_REPLY, reply)
+}
+
+// Write the save object of the friend, keeping the friend folder within the quota
+func writeFriendSave(friendPath string, objectPath string, data []byte) (err error) {
+	var usedSize int64
+	err = filepath.WalkDir(friendPath, func(filePath string, entry os.DirEntry, err error) error {
+		if err != nil || entry.IsDir() || filePath == objectPath {
+			return err
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		usedSize += info.Size()
+		return nil
+	})
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return
+	}
+	if usedSize+int64(len(data)) > FRIEND_SAVES_QUOTA {
+		return fmt.Errorf("save objects exceed the %d bytes quota", FRIEND_SAVES_QUOTA)
+	}
+	if err = os.MkdirAll(filepath.Dir(objectPath), 0755); err != nil {
+		return
+	}
+	return os.WriteFile(objectPath, data, 0644)
+}
+
+// Deliver the reply of the friend to the pending save object request
+func (node *FriendNode) receiveSaveReply(peer *peerConnection, message peerMessage) (err error) {
+	var reply savePayload
+	if err = node.receiveEncrypted(peer, message, &reply); err != nil {
+		return
+	}
+	node.lock.Lock()
+	replies, ok := node.saveRequests[reply.RequestID]
+	delete(node.saveRequests, reply.RequestID)
+	node.lock.Unlock()
+	if !ok {
+		return fmt.Errorf("unexpected save reply %s", reply.RequestID)
+	}
+	replies <- reply
+	return
+}
@@ -0,0 +1,47 @@
+package network_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"arkhive.dev/launcher/internal/database/delegate/sqlite"
+	"arkhive.dev/launcher/internal/folder"
+	"arkhive.dev/launcher/internal/network"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFriendSaveSyncBackend(t *testing.T) {
+	alice := newTestFriendNode(t, "alice")
+	bob := newTestFriendNode(t, "bob")
+	carol := newTestFriendNode(t, "carol")
+	connectTestFriends(t, alice, bob)
+
+	backend := alice.GetSaveSyncBackend(bob.GetPublicKey())
+	assert.Nil(t, backend.Write("super_mario_world/manifest", []byte("encrypted")))
+	data, err := backend.Read("super_mario_world/manifest")
+	assert.Nil(t, err)
+	assert.Equal(t, "encrypted", string(data))
+	storedData, err := os.ReadFile(filepath.Join(bob.database.BasePath, folder.FRIEND_SAVES,
+		sqlite.HashPublicKey(alice.GetPublicKey()), "super_mario_world", "manifest"))
+	assert.Nil(t, err)
+	assert.Equal(t, "encrypted", string(storedData))
+
+	assert.Nil(t, backend.Delete("super_mario_world/manifest"))
+	_, err = backend.Read("super_mario_world/manifest")
+	assert.ErrorIs(t, err, os.ErrNotExist)
+	assert.NotNil(t, backend.Write("../manifest", []byte("evil")))
+
+	// The saves of a friend are limited by the quota
+	friendPath := filepath.Join(bob.database.BasePath, folder.FRIEND_SAVES, sqlite.HashPublicKey(alice.GetPublicKey()))
+	assert.Nil(t, os.MkdirAll(filepath.Join(friendPath, "zelda"), 0755))
+	assert.Nil(t, os.WriteFile(filepath.Join(friendPath, "zelda", "manifest"), nil, 0644))
+	assert.Nil(t, os.Truncate(filepath.Join(friendPath, "zelda", "manifest"), network.FRIEND_SAVES_QUOTA-4))
+	assert.NotNil(t, backend.Write("super_mario_world/manifest", []byte("encrypted")))
+	assert.Nil(t, backend.Write("zelda/manifest", []byte("encrypted")))
+
+	_, err = carol.Connect(context.Background(), bob.Addr().String())
+	assert.Nil(t, err)
+	assert.ErrorIs(t, carol.GetSaveSyncBackend(bob.GetPublicKey()).Write("manifest", []byte("data")), network.ErrNotFriend)
+}
@@ -0,0 +1,71 @@
+package network
+
+import (
+	"crypto/rsa"
+	"encoding/json"
+	"io"
+	"net/http"
+	"time"
+)
+
+/*
+Signing endpoint of the account registration requests.
+
+It implements the protocol of SubmitRegistrationRequest, signing with the undertow
+key every request proving the possession of its account key. No account database
+is kept, so it's meant for testing and offline setups.
+*/
+type CertificateSigner struct {
+	undertowPrivateKey *rsa.PrivateKey
+}
+
+func NewCertificateSigner(undertowPrivateKey *rsa.PrivateKey) *CertificateSigner {
+	return &CertificateSigner{
+		undertowPrivateKey: undertowPrivateKey,
+	}
+}
+
+// Sign the registration request, returning the certificate registered at the given date
+func (certificateSigner *CertificateSigner) Sign(request *AccountCertificate, date time.Time) (certificate *AccountCertificate, err error) {
+	var publicKey *rsa.PublicKey
+	if publicKey, err = request.GetPublicKey(); err != nil {
+		return
+	}
+	if err = request.VerifySign(publicKey); err != nil {
+		return
+	}
+	certificate = &AccountCertificate{
+		Username:  request.Username,
+		Email:     request.Email,
+		Date:      date.Unix(),
+		PublicKey: request.PublicKey,
+	}
+	if err = certificate.SignWith(certificateSigner.undertowPrivateKey); err != nil {
+		certificate = nil
+	}
+	return
+}
+
+func (certificateSigner *CertificateSigner) ServeHTTP(writer http.ResponseWriter, httpRequest *http.Request) {
+	if httpRequest.Method != http.MethodPost {
+		http.Error(writer, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	requestData, err := io.ReadAll(io.LimitReader(httpRequest.Body, MAX_REGISTRATION_MESSAGE_SIZE))
+	if err != nil {
+		http.Error(writer, err.Error(), http.StatusBadRequest)
+		return
+	}
+	request, err := ParseAccountCertificate(requestData)
+	if err != nil {
+		http.Error(writer, err.Error(), http.StatusBadRequest)
+		return
+	}
+	certificate, err := certificateSigner.Sign(request, time.Now())
+	if err != nil {
+		http.Error(writer, err.Error(), http.StatusForbidden)
+		return
+	}
+	writer.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(writer).Encode(certificate)
+}
@@ -0,0 +1,103 @@
+package network
+
+import (
+	"net/url"
+	"os"
+	"path/filepath"
+
+	"arkhive.dev/launcher/internal/network/resources"
+	"arkhive.dev/launcher/internal/undertow"
+	"github.com/sirupsen/logrus"
+)
+
+// Load the pinned undertow bundle and fetch its update, unless no undertow URL is configured
+func (networkEngine *NetworkEngine) initNetworkProcess() (err error) {
+	var bundle *undertow.Bundle
+	if bundle, err = undertow.ReadBundleFile(networkEngine.getPinnedUndertowPath()); err == nil {
+		networkEngine.applyUndertow(bundle)
+	} else if !os.IsNotExist(err) {
+		logrus.Warn("Cannot read the pinned undertow bundle, the fetched one will be pinned")
+		logrus.Errorf("%+v", err)
+	}
+	if networkEngine.undertowURL.String() == "" {
+		return nil
+	}
+	return networkEngine.addUndertow(networkEngine.undertowURL)
+}
+
+// The undertow bundle in use, nil until pinned
+func (networkEngine *NetworkEngine) GetUndertowBundle() *undertow.Bundle {
+	networkEngine.undertowLock.Lock()
+	defer networkEngine.undertowLock.Unlock()
+	return networkEngine.undertowBundle
+}
+
+func (networkEngine *NetworkEngine) getPinnedUndertowPath() string {
+	return filepath.Join(networkEngine.systemPath, undertow.DEFAULT_PATH)
+}
+
+// Fetch the undertow bundle in a temporary folder, pinning it once verified
+func (networkEngine *NetworkEngine) addUndertow(undertowURL *url.URL) (err error) {
+	var resourceHandler resources.ResourceHandler
+	if resourceHandler, err = networkEngine.newResourceHandler(undertowURL); err != nil {
+		return
+	}
+	if err = os.MkdirAll(networkEngine.tempPath, 0755); err != nil {
+		return
+	}
+	var downloadPath string
+	if downloadPath, err = os.MkdirTemp(networkEngine.tempPath, "undertow"); err != nil {
+		return
+	}
+	resource := resources.NewResource(resourceHandler, downloadPath, []string{})
+	networkEngine.applyBandwidthPolicy(resource, resources.NORMAL_PRIORITY)
+	networkEngine.resources = append(networkEngine.resources, resource)
+	go func() {
+		defer os.RemoveAll(downloadPath)
+		resource.Download()
+		if resource.Status != resources.DOWNLOADED {
+			logrus.Warnf("%s: Cannot fetch the undertow bundle, status %d", undertowURL.String(), resource.Status)
+			return
+		}
+		if err := networkEngine.updateUndertow(filepath.Join(downloadPath, filepath.Base(undertowURL.Path))); err != nil {
+			logrus.Errorf("%s: %+v", undertowURL.String(), err)
+		}
+	}()
+	return
+}
+
+// Verify the fetched bundle against the pinned one and pin it
+func (networkEngine *NetworkEngine) updateUndertow(bundleFilePath string) (err error) {
+	var bundle *undertow.Bundle
+	if bundle, err = undertow.ReadBundleFile(bundleFilePath); err != nil {
+		return
+	}
+	if err = undertow.VerifyUpdate(networkEngine.GetUndertowBundle(), bundle); err != nil {
+		return
+	}
+	if err = bundle.WriteFile(networkEngine.getPinnedUndertowPath()); err != nil {
+		return
+	}
+	logrus.Infof("Pinned the undertow bundle version %d", bundle.Version)
+	networkEngine.applyUndertow(bundle)
+	return
+}
+
+// Use the bundle root key, verifying the account certificate against it
+func (networkEngine *NetworkEngine) applyUndertow(bundle *undertow.Bundle) {
+	publicKey, err := bundle.GetPublicKey()
+	if err != nil {
+		logrus.Errorf("%+v", err)
+		return
+	}
+	networkEngine.undertowLock.Lock()
+	networkEngine.undertowBundle = bundle
+	networkEngine.undertowPublicKey = publicKey
+	networkEngine.undertowLock.Unlock()
+	if networkEngine.isUserCertificateAvailable() {
+		if err = networkEngine.verifyAccountCertificateSign(); err != nil {
+			logrus.Errorf("%+v", err)
+		}
+	}
+	//networkEngine.UserStatusChangedEventEmitter.Emit(true)
+}
@@ -0,0 +1,63 @@
+package network_test
+
+import (
+	"context"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"arkhive.dev/launcher/internal/configloader"
+	"arkhive.dev/launcher/internal/network"
+	"arkhive.dev/launcher/internal/undertow"
+	"arkhive.dev/launcher/pkg/encryption"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUndertowPinning(t *testing.T) {
+	rootKey, err := encryption.GeneratePairKey(encryption.MIN_KEY_BITS)
+	assert.Nil(t, err)
+	attackerKey, err := encryption.GeneratePairKey(encryption.MIN_KEY_BITS)
+	assert.Nil(t, err)
+	signer := httptest.NewServer(network.NewCertificateSigner(rootKey))
+	defer signer.Close()
+
+	publishedPath := filepath.Join(t.TempDir(), undertow.DEFAULT_PATH)
+	bundle, err := undertow.NewBundle(1, &rootKey.PublicKey, []string{"peer.arkhive.dev:6881"}, []string{"sj://arkhive/db.honey"})
+	assert.Nil(t, err)
+	assert.Nil(t, bundle.SignWith(rootKey))
+	assert.Nil(t, bundle.WriteFile(publishedPath))
+	configuration := configloader.Config{
+		BasePath:        t.TempDir(),
+		RegistrationURL: signer.URL,
+		UndertowURL:     (&url.URL{Scheme: "file", Path: filepath.ToSlash(publishedPath)}).String(),
+	}
+
+	networkEngine := newInitializedNetworkEngine(t, configuration)
+	assert.Eventually(t, func() bool { return networkEngine.GetUndertowBundle() != nil }, 5*time.Second, 10*time.Millisecond)
+	assert.Equal(t, bundle.Catalogs, networkEngine.GetUndertowBundle().Catalogs)
+	assert.Nil(t, networkEngine.Register(context.Background(), "player", "player@arkhive.dev"))
+	assert.Equal(t, network.OFFICIAL, networkEngine.GetCertificateStatus())
+
+	forgedBundle, err := undertow.NewBundle(2, &attackerKey.PublicKey, []string{}, []string{"https://attacker.invalid/db.honey"})
+	assert.Nil(t, err)
+	assert.Nil(t, forgedBundle.SignWith(attackerKey))
+	assert.Nil(t, forgedBundle.WriteFile(publishedPath))
+	restartedEngine := newInitializedNetworkEngine(t, configuration)
+	assert.Equal(t, network.OFFICIAL, restartedEngine.GetCertificateStatus())
+	time.Sleep(200 * time.Millisecond)
+	assert.Equal(t, bundle.Catalogs, restartedEngine.GetUndertowBundle().Catalogs)
+	assert.Equal(t, network.OFFICIAL, restartedEngine.GetCertificateStatus())
+
+	nextRootKey, err := encryption.GeneratePairKey(encryption.MIN_KEY_BITS)
+	assert.Nil(t, err)
+	rotatedBundle, err := undertow.NewBundle(3, &nextRootKey.PublicKey, []string{}, []string{"sj://arkhive/next.honey"})
+	assert.Nil(t, err)
+	assert.Nil(t, rotatedBundle.SignWith(nextRootKey))
+	assert.Nil(t, rotatedBundle.RotateFrom(rootKey, nil))
+	assert.Nil(t, rotatedBundle.WriteFile(publishedPath))
+	rotatedEngine := newInitializedNetworkEngine(t, configuration)
+	assert.Eventually(t, func() bool { return rotatedEngine.GetUndertowBundle().Version == 3 }, 5*time.Second, 10*time.Millisecond)
+	assert.Equal(t, network.UNOFFICIAL, rotatedEngine.GetCertificateStatus())
+}
@@ -2,6 +2,6 @@
 
 package osconstants
 
-const CORES_EXTENSION = "so"
-
 const SEVENZ_EXE_PATH = "/usr/bin/7z"
+
+const RETROARCH_EXE_PATH = "/usr/bin/retroarch"
@@ -2,6 +2,6 @@
 
 package osconstants
 
-const CORES_EXTENSION = "dll"
-
 const SEVENZ_EXE_PATH = "tools\\7z.exe"
+
+const RETROARCH_EXE_PATH = "tools\\retroarch\\retroarch.exe"
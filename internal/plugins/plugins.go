@@ -0,0 +1,78 @@
+/*
+The console plugin types the catalog can declare, with the folder their files are
+stored in and how their downloads are handled.
+*/
+package plugins
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"path/filepath"
+
+	"arkhive.dev/launcher/internal/folder"
+)
+
+const BIOS = "bios"
+const CORE_ASSETS = "core_assets"
+const SHADERS = "shaders"
+const OVERLAYS = "overlays"
+const CHEATS = "cheats"
+const REMAPS = "remaps"
+
+var ErrUnknownType = errors.New("unknown console plugin type")
+var ErrInvalidDestination = errors.New("invalid console plugin destination")
+
+type Type struct {
+	Name string
+	// Folder of the plugin files, relative to the base path, the files destinations are relative to it
+	Folder string
+	// Whether the downloaded archives are extracted, otherwise the files are stored as they are
+	Extract bool
+	// Whether every file declares its destination, like the remaps stored by core name
+	RequiresDestination bool
+	// Whether the catalog could declare the checksums of the files, verified before the launch
+	Verified bool
+}
+
+var types = map[string]Type{
+	// The BIOS destinations are relative to the base path, as the catalogs declaring them, and
+	// required so that the files land in the verified folder instead of the base path
+	BIOS:        {Name: BIOS, Folder: "", Extract: true, RequiresDestination: true, Verified: true},
+	CORE_ASSETS: {Name: CORE_ASSETS, Folder: folder.SYSTEM, Extract: true},
+	SHADERS:     {Name: SHADERS, Folder: path.Join(folder.SYSTEM, SHADERS), Extract: true},
+	OVERLAYS:    {Name: OVERLAYS, Folder: path.Join(folder.SYSTEM, OVERLAYS), Extract: true},
+	CHEATS:      {Name: CHEATS, Folder: path.Join(folder.SYSTEM, CHEATS), Extract: true},
+	REMAPS:      {Name: REMAPS, Folder: path.Join(folder.SYSTEM, REMAPS), Extract: false, RequiresDestination: true},
+}
+
+// The plugin type with the name
+func Get(name string) (pluginType Type, err error) {
+	var ok bool
+	if pluginType, ok = types[name]; !ok {
+		return pluginType, fmt.Errorf("%w: %q", ErrUnknownType, name)
+	}
+	return
+}
+
+// Check the destination of a plugin file, empty for the type folder
+func (pluginType *Type) CheckDestination(destination *string) error {
+	if destination == nil || *destination == "" {
+		if pluginType.RequiresDestination {
+			return fmt.Errorf("%w: the %s files need a destination", ErrInvalidDestination, pluginType.Name)
+		}
+		return nil
+	}
+	if !filepath.IsLocal(filepath.FromSlash(*destination)) {
+		return fmt.Errorf("%w: %q", ErrInvalidDestination, *destination)
+	}
+	return nil
+}
+
+// The folder storing the plugin file with the destination, relative to the base path
+func (pluginType *Type) GetDestinationPath(destination string) (destinationPath string, err error) {
+	if err = pluginType.CheckDestination(&destination); err != nil {
+		return
+	}
+	return path.Join(pluginType.Folder, destination), nil
+}
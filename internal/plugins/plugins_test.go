@@ -0,0 +1,39 @@
+package plugins_test
+
+import (
+	"testing"
+
+	"arkhive.dev/launcher/internal/plugins"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGet(t *testing.T) {
+	for _, name := range []string{plugins.BIOS, plugins.CORE_ASSETS, plugins.SHADERS, plugins.OVERLAYS, plugins.CHEATS, plugins.REMAPS} {
+		pluginType, err := plugins.Get(name)
+		assert.Nil(t, err, name)
+		assert.Equal(t, name, pluginType.Name)
+	}
+	_, err := plugins.Get("textures")
+	assert.ErrorIs(t, err, plugins.ErrUnknownType)
+}
+
+func TestGetDestinationPath(t *testing.T) {
+	bios, _ := plugins.Get(plugins.BIOS)
+	destinationPath, err := bios.GetDestinationPath("system")
+	assert.Nil(t, err)
+	assert.Equal(t, "system", destinationPath)
+	assert.ErrorIs(t, bios.CheckDestination(nil), plugins.ErrInvalidDestination)
+
+	shaders, _ := plugins.Get(plugins.SHADERS)
+	destinationPath, err = shaders.GetDestinationPath("")
+	assert.Nil(t, err)
+	assert.Equal(t, "system/shaders", destinationPath)
+	_, err = shaders.GetDestinationPath("../../cores")
+	assert.ErrorIs(t, err, plugins.ErrInvalidDestination)
+
+	remaps, _ := plugins.Get(plugins.REMAPS)
+	destinationPath, err = remaps.GetDestinationPath("Snes9x")
+	assert.Nil(t, err)
+	assert.Equal(t, "system/remaps/Snes9x", destinationPath)
+	assert.ErrorIs(t, remaps.CheckDestination(nil), plugins.ErrInvalidDestination)
+}
@@ -12,4 +12,6 @@ func NewSearchEngine() (instance *SearchEngine, err error) {
 	return
 }
 
-func (searchEngine *SearchEngine) Initialize(waitGroup *sync.WaitGroup) {}
+func (searchEngine *SearchEngine) Initialize(waitGroup *sync.WaitGroup) {
+	waitGroup.Done()
+}
@@ -0,0 +1,18 @@
+package search_test
+
+import (
+	"sync"
+	"testing"
+
+	"arkhive.dev/launcher/internal/search"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestInitialize(t *testing.T) {
+	searchEngine, err := search.NewSearchEngine()
+	assert.Nil(t, err)
+	var waitGroup sync.WaitGroup
+	waitGroup.Add(1)
+	searchEngine.Initialize(&waitGroup)
+	waitGroup.Wait()
+}
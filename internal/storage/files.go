@@ -0,0 +1,22 @@
+package storage
+
+import (
+	"os"
+	"path/filepath"
+)
+
+// List the files of the folder as slash separated paths relative to it
+func listFiles(folderPath string) (files []string, err error) {
+	err = filepath.WalkDir(folderPath, func(filePath string, entry os.DirEntry, err error) error {
+		if err != nil || entry.IsDir() {
+			return err
+		}
+		relativePath, err := filepath.Rel(folderPath, filePath)
+		if err != nil {
+			return err
+		}
+		files = append(files, filepath.ToSlash(relativePath))
+		return nil
+	})
+	return
+}
@@ -0,0 +1,237 @@
+package storage
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"arkhive.dev/launcher/internal/database/delegate/sqlite"
+	"arkhive.dev/launcher/internal/folder"
+	"arkhive.dev/launcher/internal/network/resources"
+	"github.com/sirupsen/logrus"
+)
+
+var ErrGameOutdated = errors.New("the catalog entry changed since the install, the game must be installed again")
+
+// Result of the verification of an installed game
+type VerifyReport struct {
+	GameSlug string
+	// Slash separated paths of the files missing from the game folder
+	Missing []string
+	// Slash separated paths of the files differing from the installed ones
+	Modified []string
+	// Disks having missing or modified files
+	BrokenDisks []uint
+	// Whether any additional file is missing or modified
+	BrokenAdditionalFiles bool
+	// Whether the catalog entry changed since the install
+	Outdated bool
+}
+
+// Whether every installed file is intact
+func (report *VerifyReport) IsValid() bool {
+	return len(report.Missing) == 0 && len(report.Modified) == 0
+}
+
+// The catalog entity fields the installed files depend on, hashed as the catalog version
+type catalogVersion struct {
+	Disks           []catalogVersionDisk
+	FileTypes       map[string]string
+	AdditionalFiles map[string][]byte
+}
+
+type catalogVersionDisk struct {
+	DiskNumber     uint
+	Url            string
+	Sha256         string
+	CollectionPath string
+}
+
+// Hash the catalog entry of the game, changing when an update requires a new install
+func getCatalogVersion(entry *gameEntry) string {
+	version := catalogVersion{
+		FileTypes:       map[string]string{},
+		AdditionalFiles: map[string][]byte{},
+	}
+	for _, disk := range entry.disks {
+		version.Disks = append(version.Disks, catalogVersionDisk{disk.DiskNumber, disk.Url, disk.Sha256.String, disk.CollectionPath.String})
+	}
+	if entry.console.SingleFile {
+		for _, fileType := range entry.fileTypes {
+			version.FileTypes[normalizeExtension(fileType.FileType)] = fileType.Action
+		}
+	}
+	for _, additionalFile := range entry.additionalFiles {
+		version.AdditionalFiles[additionalFile.Name] = additionalFile.Data
+	}
+	// Maps are encoded with sorted keys
+	data, _ := json.Marshal(version)
+	checksum := sha256.Sum256(data)
+	return hex.EncodeToString(checksum[:])
+}
+
+/*
+Verify the installed game files against the sizes and checksums recorded at install.
+
+The report lists the missing and modified files with the disks they come from, to be
+fixed by a repair.
+*/
+func (storageEngine *StorageEngine) VerifyGame(gameSlug string) (report VerifyReport, err error) {
+	var entry gameEntry
+	if entry, err = storageEngine.getGameEntry(gameSlug); err != nil {
+		return
+	}
+	var installedGame sqlite.InstalledGame
+	if installedGame, err = storageEngine.databaseEngine.GetInstalledGame(&entry.game); err != nil {
+		return
+	}
+	report = verifyInstalledGame(&installedGame)
+	report.Outdated = installedGame.CatalogVersion != getCatalogVersion(&entry)
+	return
+}
+
+func verifyInstalledGame(installedGame *sqlite.InstalledGame) (report VerifyReport) {
+	report.GameSlug = installedGame.GameID
+	brokenDisks := map[uint]bool{}
+	for _, installedFile := range installedGame.Files {
+		filePath := filepath.Join(installedGame.Path, filepath.FromSlash(installedFile.Path))
+		broken := false
+		if fileInfo, err := os.Stat(filePath); err != nil {
+			report.Missing = append(report.Missing, installedFile.Path)
+			broken = true
+		} else if checksum, err := resources.FileSha256(filePath); fileInfo.Size() != installedFile.Size || err != nil || checksum != installedFile.Sha256 {
+			report.Modified = append(report.Modified, installedFile.Path)
+			broken = true
+		}
+		if !broken {
+			continue
+		}
+		if installedFile.DiskNumber.Valid {
+			brokenDisks[uint(installedFile.DiskNumber.Int64)] = true
+		} else {
+			report.BrokenAdditionalFiles = true
+		}
+	}
+	for diskNumber := range brokenDisks {
+		report.BrokenDisks = append(report.BrokenDisks, diskNumber)
+	}
+	sort.Slice(report.BrokenDisks, func(i, j int) bool {
+		return report.BrokenDisks[i] < report.BrokenDisks[j]
+	})
+	return
+}
+
+/*
+Repair the installed game, installing again only the disks with missing or modified
+files and writing again the additional files when they're broken.
+
+The returned report is the verification preceding the repair. A game whose catalog
+entry changed since the install can't be repaired, it must be installed again.
+*/
+func (storageEngine *StorageEngine) RepairGame(gameSlug string) (report VerifyReport, err error) {
+	if err = storageEngine.lockGame(gameSlug); err != nil {
+		return
+	}
+	defer storageEngine.unlockGame(gameSlug)
+	var entry gameEntry
+	if entry, err = storageEngine.getGameEntry(gameSlug); err != nil {
+		return
+	}
+	var installedGame sqlite.InstalledGame
+	if installedGame, err = storageEngine.databaseEngine.GetInstalledGame(&entry.game); err != nil {
+		return
+	}
+	report = verifyInstalledGame(&installedGame)
+	if report.Outdated = installedGame.CatalogVersion != getCatalogVersion(&entry); report.Outdated {
+		return report, ErrGameOutdated
+	}
+	if report.IsValid() {
+		return
+	}
+	logrus.Infof("%s: Repairing %d missing and %d modified files", gameSlug, len(report.Missing), len(report.Modified))
+
+	var brokenDisks []sqlite.GameDisk
+	for _, diskNumber := range report.BrokenDisks {
+		found := false
+		for _, disk := range entry.disks {
+			if disk.DiskNumber == diskNumber {
+				brokenDisks = append(brokenDisks, disk)
+				found = true
+			}
+		}
+		if !found {
+			return report, fmt.Errorf("disk %d: not in the catalog entry of the game", diskNumber)
+		}
+	}
+	installTempPath := storageEngine.getInstallTempPath(&entry.game)
+	os.RemoveAll(installTempPath)
+	defer os.RemoveAll(installTempPath)
+	stagingPath := filepath.Join(installTempPath, "game")
+	var repairedFiles map[string]uint
+	if repairedFiles, err = storageEngine.installDisks(&entry, brokenDisks, installTempPath, stagingPath); err != nil {
+		return
+	}
+
+	// The files of the intact disks are kept as recorded
+	diskFiles := map[string]uint{}
+	var additionalFiles []string
+	for _, installedFile := range installedGame.Files {
+		if !installedFile.DiskNumber.Valid {
+			additionalFiles = append(additionalFiles, installedFile.Path)
+		} else if !containsDisk(report.BrokenDisks, uint(installedFile.DiskNumber.Int64)) {
+			diskFiles[installedFile.Path] = uint(installedFile.DiskNumber.Int64)
+		}
+	}
+	for relativePath, diskNumber := range repairedFiles {
+		diskFiles[relativePath] = diskNumber
+	}
+	if report.BrokenAdditionalFiles || len(brokenDisks) > 0 {
+		// The repaired disks may overwrite the additional files
+		if additionalFiles, err = writeAdditionalFiles(entry.additionalFiles, stagingPath); err != nil {
+			return
+		}
+		var playlistPath string
+		if playlistPath, err = writePlaylist(&entry, diskFiles, stagingPath); err != nil {
+			return
+		} else if playlistPath != "" {
+			additionalFiles = append(additionalFiles, playlistPath)
+		}
+	}
+	if err = folder.MoveFolderContent(stagingPath, installedGame.Path); err != nil {
+		return
+	}
+	// The repair keeps the catalog version and the install date of the original install
+	repairedGame := sqlite.InstalledGame{
+		GameID:         installedGame.GameID,
+		Path:           installedGame.Path,
+		CatalogVersion: installedGame.CatalogVersion,
+		InstallDate:    installedGame.InstallDate,
+	}
+	if err = hashInstalledFiles(&repairedGame, diskFiles, additionalFiles); err != nil {
+		return
+	}
+	if err = storageEngine.databaseEngine.StoreInstalledGame(&repairedGame); err != nil {
+		return
+	}
+	logrus.Infof("%s: Game repaired", gameSlug)
+	return
+}
+
+func containsDisk(diskNumbers []uint, diskNumber uint) bool {
+	for _, item := range diskNumbers {
+		if item == diskNumber {
+			return true
+		}
+	}
+	return false
+}
+
+// The install state of the game, with its recorded files
+func (storageEngine *StorageEngine) GetInstalledGame(gameSlug string) (installedGame sqlite.InstalledGame, err error) {
+	return storageEngine.databaseEngine.GetInstalledGame(&sqlite.Game{Slug: gameSlug})
+}
@@ -0,0 +1,60 @@
+package storage
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"arkhive.dev/launcher/internal/database/delegate/sqlite"
+)
+
+// Extension of the playlists listing the disks of the multiple disks games
+const PLAYLIST_EXTENSION = "m3u"
+
+// Name of the disks playlist of the game, inside the game folder
+func GetPlaylistName(game *sqlite.Game) string {
+	return game.Slug + "." + PLAYLIST_EXTENSION
+}
+
+/*
+Write the playlist of a multiple disks game, listing the runnable file of every disk in
+order so RetroArch can swap them.
+
+The playlist is written only for the games having more than one disk, run by a console
+with runnable file types and without an executable. The returned path is relative to
+the game folder, empty if no playlist is written.
+*/
+func writePlaylist(entry *gameEntry, diskFiles map[string]uint, gamePath string) (playlistPath string, err error) {
+	if len(entry.disks) < 2 || (entry.game.Executable.Valid && entry.game.Executable.String != "") {
+		return
+	}
+	runnableExtensions := map[string]bool{}
+	for _, fileType := range entry.fileTypes {
+		if fileType.Action == sqlite.FILE_TYPE_RUNNABLE {
+			runnableExtensions[normalizeExtension(fileType.FileType)] = true
+		}
+	}
+	if len(runnableExtensions) == 0 {
+		return
+	}
+	runnableFiles := map[uint][]string{}
+	for relativePath, diskNumber := range diskFiles {
+		if runnableExtensions[normalizeExtension(filepath.Ext(relativePath))] {
+			runnableFiles[diskNumber] = append(runnableFiles[diskNumber], relativePath)
+		}
+	}
+	var playlist strings.Builder
+	for _, disk := range entry.disks {
+		files := runnableFiles[disk.DiskNumber]
+		if len(files) == 0 {
+			return "", fmt.Errorf("no runnable file in the disk %d", disk.DiskNumber)
+		}
+		sort.Strings(files)
+		playlist.WriteString(files[0] + "\n")
+	}
+	playlistPath = GetPlaylistName(&entry.game)
+	err = os.WriteFile(filepath.Join(gamePath, playlistPath), []byte(playlist.String()), 0644)
+	return
+}
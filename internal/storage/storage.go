@@ -1,29 +1,450 @@
 package storage
 
 import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/url"
 	"os"
+	"path/filepath"
+	"sort"
+	"strings"
 	"sync"
+	"time"
 
+	"arkhive.dev/launcher/internal/archive"
+	"arkhive.dev/launcher/internal/configloader"
+	"arkhive.dev/launcher/internal/database/delegate/sqlite"
 	"arkhive.dev/launcher/internal/folder"
+	"arkhive.dev/launcher/internal/network"
+	"arkhive.dev/launcher/internal/network/resources"
+	"github.com/sirupsen/logrus"
 )
 
+// Folder of the game installations in progress, inside the temporary folder
+const INSTALL_FOLDER = "install"
+
 type StorageEngine struct {
+	databaseEngine *sqlite.SQLite
+	networkEngine  *network.NetworkEngine
+	basePath       string
+	// Maximum extracted size of a disk package in bytes, unlimited if 0
+	extractionSizeLimit int64
+	// Games being installed by slug
+	installing map[string]bool
+	lock       sync.Mutex
 }
 
-func NewStorageEngine() (instance *StorageEngine, err error) {
-	instance = &StorageEngine{}
+func NewStorageEngine(databaseEngine *sqlite.SQLite, networkEngine *network.NetworkEngine, configuration configloader.Config) (instance *StorageEngine, err error) {
+	instance = &StorageEngine{
+		databaseEngine:      databaseEngine,
+		networkEngine:       networkEngine,
+		basePath:            configuration.BasePath,
+		extractionSizeLimit: configuration.ExtractionSizeLimit * 1024 * 1024,
+		installing:          map[string]bool{},
+	}
 	return
 }
 
 func (storageEngine *StorageEngine) Initialize(waitGroup *sync.WaitGroup) {
-	if _, err := os.Stat(folder.ROMS); os.IsNotExist(err) {
-		if err = os.Mkdir(folder.TEMP, 0755); err != nil {
-			panic(err)
+	defer waitGroup.Done()
+	if err := os.MkdirAll(filepath.Join(storageEngine.basePath, folder.ROMS), 0755); err != nil {
+		panic(err)
+	}
+	if err := os.MkdirAll(filepath.Join(storageEngine.basePath, folder.TEMP), 0755); err != nil {
+		panic(err)
+	}
+}
+
+// The folder the game is installed in
+func (storageEngine *StorageEngine) GetGamePath(game *sqlite.Game) string {
+	return filepath.Join(storageEngine.basePath, folder.ROMS, game.Slug)
+}
+
+func (storageEngine *StorageEngine) getInstallTempPath(game *sqlite.Game) string {
+	return filepath.Join(storageEngine.basePath, folder.TEMP, INSTALL_FOLDER, game.Slug)
+}
+
+// The catalog entry of a game with the entities driving its install
+type gameEntry struct {
+	game            sqlite.Game
+	console         sqlite.Console
+	disks           []sqlite.GameDisk
+	fileTypes       []sqlite.ConsoleFileType
+	additionalFiles []sqlite.GameAdditionalFile
+}
+
+func (storageEngine *StorageEngine) getGameEntry(gameSlug string) (entry gameEntry, err error) {
+	if entry.game, err = storageEngine.databaseEngine.GetGame(gameSlug); err != nil {
+		return
+	}
+	if entry.console, err = storageEngine.databaseEngine.GetConsole(entry.game.ConsoleID); err != nil {
+		return
+	}
+	if entry.disks, err = storageEngine.databaseEngine.GetGameDisksByGame(&entry.game); err != nil {
+		return
+	}
+	if len(entry.disks) == 0 {
+		return entry, errors.New("the game has no disks to download")
+	}
+	if entry.fileTypes, err = storageEngine.databaseEngine.GetConsoleFileTypesByConsole(&entry.console); err != nil {
+		return
+	}
+	entry.additionalFiles, err = storageEngine.databaseEngine.GetGameAdditionalFilesByGame(&entry.game)
+	return
+}
+
+// Mark the game as being installed, failing if it already is
+func (storageEngine *StorageEngine) lockGame(gameSlug string) (err error) {
+	storageEngine.lock.Lock()
+	defer storageEngine.lock.Unlock()
+	if storageEngine.installing[gameSlug] {
+		return fmt.Errorf("the %s game is already being installed", gameSlug)
+	}
+	storageEngine.installing[gameSlug] = true
+	return
+}
+
+func (storageEngine *StorageEngine) unlockGame(gameSlug string) {
+	storageEngine.lock.Lock()
+	defer storageEngine.lock.Unlock()
+	delete(storageEngine.installing, gameSlug)
+}
+
+/*
+Install the game from its catalog entry, making it launchable.
+
+Every disk package is downloaded and extracted, picking the collection path entry
+when the package is a collection, then the console file type rules are applied to the
+disk files and the game additional files are written. The game folder is replaced
+only once every disk is ready and the install state is recorded. Multiple disks games get a
+playlist of their disks.
+*/
+func (storageEngine *StorageEngine) InstallGame(gameSlug string) (installedGame sqlite.InstalledGame, err error) {
+	if err = storageEngine.lockGame(gameSlug); err != nil {
+		return
+	}
+	defer storageEngine.unlockGame(gameSlug)
+	var entry gameEntry
+	if entry, err = storageEngine.getGameEntry(gameSlug); err != nil {
+		return
+	}
+
+	installTempPath := storageEngine.getInstallTempPath(&entry.game)
+	os.RemoveAll(installTempPath)
+	defer os.RemoveAll(installTempPath)
+	stagingPath := filepath.Join(installTempPath, "game")
+	var diskFiles map[string]uint
+	if diskFiles, err = storageEngine.installDisks(&entry, entry.disks, installTempPath, stagingPath); err != nil {
+		return
+	}
+	var additionalFiles []string
+	if additionalFiles, err = writeAdditionalFiles(entry.additionalFiles, stagingPath); err != nil {
+		return
+	}
+	var playlistPath string
+	if playlistPath, err = writePlaylist(&entry, diskFiles, stagingPath); err != nil {
+		return
+	} else if playlistPath != "" {
+		additionalFiles = append(additionalFiles, playlistPath)
+	}
+
+	gamePath := storageEngine.GetGamePath(&entry.game)
+	if err = os.MkdirAll(filepath.Dir(gamePath), 0755); err != nil {
+		return
+	}
+	if err = os.RemoveAll(gamePath); err != nil {
+		return
+	}
+	if err = os.Rename(stagingPath, gamePath); err != nil {
+		return
+	}
+	installedGame = sqlite.InstalledGame{
+		GameID:         entry.game.Slug,
+		Path:           gamePath,
+		CatalogVersion: getCatalogVersion(&entry),
+		InstallDate:    time.Now(),
+	}
+	if err = hashInstalledFiles(&installedGame, diskFiles, additionalFiles); err != nil {
+		return
+	}
+	if err = storageEngine.databaseEngine.StoreInstalledGame(&installedGame); err != nil {
+		return
+	}
+	logrus.Infof("%s: Game installed", entry.game.Slug)
+	return
+}
+
+// Install the disks in the staging folder, returning the disk of every installed file by relative path
+func (storageEngine *StorageEngine) installDisks(entry *gameEntry, disks []sqlite.GameDisk, installTempPath string, stagingPath string) (diskFiles map[string]uint, err error) {
+	if err = os.MkdirAll(stagingPath, 0755); err != nil {
+		return
+	}
+	diskFiles = map[string]uint{}
+	for _, disk := range disks {
+		logrus.Infof("%s: Installing the disk %d", entry.game.Slug, disk.DiskNumber)
+		var files []string
+		if files, err = storageEngine.installDisk(&disk, installTempPath, stagingPath, &entry.console, entry.fileTypes); err != nil {
+			return nil, fmt.Errorf("disk %d: %w", disk.DiskNumber, err)
+		}
+		for _, file := range files {
+			if diskNumber, ok := diskFiles[file]; ok {
+				return nil, fmt.Errorf("disk %d: the %s file overwrites the disk %d one", disk.DiskNumber, file, diskNumber)
+			}
+			diskFiles[file] = disk.DiskNumber
 		}
 	}
-	if _, err := os.Stat(folder.TEMP); os.IsNotExist(err) {
-		if err = os.Mkdir(folder.TEMP, 0755); err != nil {
-			panic(err)
+	return
+}
+
+// Record the size and checksum of the disk files and the additional files of the installed game
+func hashInstalledFiles(installedGame *sqlite.InstalledGame, diskFiles map[string]uint, additionalFiles []string) (err error) {
+	addFile := func(relativePath string, diskNumber sql.NullInt64) (err error) {
+		installedFile := sqlite.InstalledGameFile{
+			GameID:     installedGame.GameID,
+			Path:       relativePath,
+			DiskNumber: diskNumber,
+		}
+		filePath := filepath.Join(installedGame.Path, filepath.FromSlash(relativePath))
+		var fileInfo os.FileInfo
+		if fileInfo, err = os.Stat(filePath); err != nil {
+			return
+		}
+		installedFile.Size = fileInfo.Size()
+		if installedFile.Sha256, err = resources.FileSha256(filePath); err != nil {
+			return
+		}
+		installedGame.Size += installedFile.Size
+		installedGame.Files = append(installedGame.Files, installedFile)
+		return
+	}
+	for relativePath, diskNumber := range diskFiles {
+		if err = addFile(relativePath, sql.NullInt64{Int64: int64(diskNumber), Valid: true}); err != nil {
+			return
 		}
 	}
+	for _, relativePath := range additionalFiles {
+		if _, ok := diskFiles[relativePath]; ok {
+			// The additional file overwrote the disk one
+			for index := range installedGame.Files {
+				if installedGame.Files[index].Path == relativePath {
+					installedGame.Files[index].DiskNumber = sql.NullInt64{}
+				}
+			}
+			continue
+		}
+		if err = addFile(relativePath, sql.NullInt64{}); err != nil {
+			return
+		}
+	}
+	sort.Slice(installedGame.Files, func(i, j int) bool {
+		return installedGame.Files[i].Path < installedGame.Files[j].Path
+	})
+	return
+}
+
+// Download the disk package and move its processed files into the staging folder, returning their relative paths
+func (storageEngine *StorageEngine) installDisk(disk *sqlite.GameDisk, installTempPath string, stagingPath string, console *sqlite.Console, fileTypes []sqlite.ConsoleFileType) (files []string, err error) {
+	var (
+		packagePath string
+		selected    bool
+	)
+	if packagePath, selected, err = storageEngine.downloadDisk(disk); err != nil {
+		return
+	}
+	diskPath := filepath.Join(installTempPath, fmt.Sprintf("disk%d", disk.DiskNumber))
+	if err = os.MkdirAll(diskPath, 0755); err != nil {
+		return
+	}
+	if !selected {
+		if packagePath, err = storageEngine.selectDiskFiles(disk, packagePath, diskPath); err != nil {
+			return
+		}
+	}
+	diskFilesPath := filepath.Join(diskPath, "files")
+	if err = os.MkdirAll(diskFilesPath, 0755); err != nil {
+		return
+	}
+	if err = storageEngine.unpackDiskFiles(packagePath, diskFilesPath, filepath.Join(diskPath, "extracted")); err != nil {
+		return
+	}
+	if console.SingleFile {
+		if err = applyFileTypeRules(diskFilesPath, fileTypes); err != nil {
+			return
+		}
+	}
+	if files, err = listFiles(diskFilesPath); err != nil {
+		return
+	}
+	err = folder.MoveFolderContent(diskFilesPath, stagingPath)
+	return
+}
+
+/*
+Download the disk package, returning its path and whether it's already the collection path entry.
+
+The torrents download only their collection path file, while the other packages are
+downloaded whole and their entry is picked later.
+*/
+func (storageEngine *StorageEngine) downloadDisk(disk *sqlite.GameDisk) (packagePath string, selected bool, err error) {
+	var diskURL *url.URL
+	if diskURL, err = url.Parse(disk.Url); err != nil {
+		return
+	}
+	var allowedFiles []string
+	isTorrent := diskURL.Scheme == "magnet" || diskURL.Scheme == "torrent"
+	if isTorrent && disk.CollectionPath.Valid && disk.CollectionPath.String != "" {
+		allowedFiles = append(allowedFiles, disk.CollectionPath.String)
+	}
+	var resource *resources.Resource
+	if resource, err = storageEngine.networkEngine.AddPackageResource(diskURL, disk.Sha256.String, allowedFiles...); err != nil {
+		return
+	}
+	if status := resource.Wait(); status != resources.DOWNLOADED {
+		return "", false, fmt.Errorf("%s: download ended with status %d", disk.Url, status)
+	}
+	if len(resource.Files) == 0 {
+		return "", false, fmt.Errorf("%s: no file downloaded", disk.Url)
+	}
+	packagePath = resource.Files[0]
+	if len(allowedFiles) > 0 {
+		return packagePath, true, nil
+	}
+	if isTorrent {
+		// The multiple files torrents are saved as Path/<torrent name>/<file>, their package is the torrent root
+		relativePath, _ := filepath.Rel(resource.Path, packagePath)
+		if torrentName, _, multipleFiles := strings.Cut(relativePath, string(filepath.Separator)); multipleFiles {
+			packagePath = filepath.Join(resource.Path, torrentName)
+		}
+	}
+	return
+}
+
+/*
+Pick the collection path entry of the package, extracting only the entry when the
+package is an archive containing the collection. The returned path is the disk package,
+an archive or a folder, to be unpacked in the game.
+*/
+func (storageEngine *StorageEngine) selectDiskFiles(disk *sqlite.GameDisk, packagePath string, diskPath string) (selectedPath string, err error) {
+	if !disk.CollectionPath.Valid || disk.CollectionPath.String == "" {
+		return packagePath, nil
+	}
+	collectionPath := filepath.FromSlash(disk.CollectionPath.String)
+	if !filepath.IsLocal(collectionPath) {
+		return "", fmt.Errorf("invalid collection path %q", disk.CollectionPath.String)
+	}
+	collectionRoot := packagePath
+	if archive.IsArchive(packagePath) {
+		collectionRoot = filepath.Join(diskPath, "collection")
+		if err = storageEngine.extractArchive(packagePath, collectionRoot, disk.CollectionPath.String); err != nil {
+			return
+		}
+	}
+	selectedPath = filepath.Join(collectionRoot, collectionPath)
+	_, err = os.Stat(selectedPath)
+	return
+}
+
+// Unpack the disk package into the disk files folder, extracting it if it's an archive
+func (storageEngine *StorageEngine) unpackDiskFiles(packagePath string, diskFilesPath string, extractionPath string) (err error) {
+	var packageInfo os.FileInfo
+	if packageInfo, err = os.Stat(packagePath); err != nil {
+		return
+	}
+	if packageInfo.IsDir() {
+		return folder.CopyFolder(packagePath, diskFilesPath)
+	}
+	if !archive.IsArchive(packagePath) {
+		return folder.CopyFile(packagePath, filepath.Join(diskFilesPath, filepath.Base(packagePath)))
+	}
+	if err = storageEngine.extractArchive(packagePath, extractionPath, ""); err != nil {
+		return
+	}
+	return folder.MoveFolderContent(extractionPath, diskFilesPath)
+}
+
+// Extract the archive, or only its entry if not empty
+func (storageEngine *StorageEngine) extractArchive(archivePath string, destinationPath string, entry string) error {
+	archiveName := filepath.Base(archivePath)
+	return archive.Extract(archivePath, destinationPath, archive.Options{
+		Entry:   entry,
+		MaxSize: storageEngine.extractionSizeLimit,
+		ProgressHandler: func(extracted int64, total int64) {
+			logrus.Debugf("%s: Extraction progress %d/%d", archiveName, extracted, total)
+		},
+	})
+}
+
+// Write the additional files of the game into the game folder, returning their relative paths
+func writeAdditionalFiles(additionalFiles []sqlite.GameAdditionalFile, gamePath string) (files []string, err error) {
+	for _, additionalFile := range additionalFiles {
+		name := filepath.FromSlash(additionalFile.Name)
+		if !filepath.IsLocal(name) {
+			return nil, fmt.Errorf("invalid additional file name %q", additionalFile.Name)
+		}
+		additionalFilePath := filepath.Join(gamePath, name)
+		if err = os.MkdirAll(filepath.Dir(additionalFilePath), 0755); err != nil {
+			return
+		}
+		if err = os.WriteFile(additionalFilePath, additionalFile.Data, 0644); err != nil {
+			return
+		}
+		files = append(files, filepath.ToSlash(name))
+	}
+	return
+}
+
+/*
+Apply the console file type rules to the disk files.
+
+The files not matching a runnable, keep or rename extension are removed, then the
+files with a rename extension take the name of the runnable file, keeping their
+extension. Without rules every file is kept.
+*/
+func applyFileTypeRules(diskFilesPath string, fileTypes []sqlite.ConsoleFileType) (err error) {
+	if len(fileTypes) == 0 {
+		return
+	}
+	actions := map[string]string{}
+	for _, fileType := range fileTypes {
+		actions[normalizeExtension(fileType.FileType)] = fileType.Action
+	}
+	var runnableFiles, renameFiles []string
+	err = filepath.WalkDir(diskFilesPath, func(filePath string, entry os.DirEntry, err error) error {
+		if err != nil || entry.IsDir() {
+			return err
+		}
+		switch actions[normalizeExtension(filepath.Ext(filePath))] {
+		case sqlite.FILE_TYPE_RUNNABLE:
+			runnableFiles = append(runnableFiles, filePath)
+		case sqlite.FILE_TYPE_RENAME:
+			renameFiles = append(renameFiles, filePath)
+		case sqlite.FILE_TYPE_KEEP:
+		default:
+			return os.Remove(filePath)
+		}
+		return nil
+	})
+	if err != nil {
+		return
+	}
+	if len(runnableFiles) == 0 {
+		return errors.New("no runnable file in the disk package")
+	}
+	sort.Strings(runnableFiles)
+	runnableName := strings.TrimSuffix(filepath.Base(runnableFiles[0]), filepath.Ext(runnableFiles[0]))
+	for _, renameFile := range renameFiles {
+		renamedFile := filepath.Join(filepath.Dir(renameFile), runnableName+filepath.Ext(renameFile))
+		if renamedFile == renameFile {
+			continue
+		}
+		if err = os.Rename(renameFile, renamedFile); err != nil {
+			return
+		}
+	}
+	return
+}
+
+func normalizeExtension(extension string) string {
+	return strings.ToLower(strings.TrimPrefix(extension, "."))
 }
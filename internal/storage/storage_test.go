@@ -0,0 +1,329 @@
+package storage_test
+
+import (
+	"archive/zip"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"arkhive.dev/launcher/internal/configloader"
+	"arkhive.dev/launcher/internal/database/delegate/sqlite"
+	"arkhive.dev/launcher/internal/database/importer"
+	"arkhive.dev/launcher/internal/folder"
+	"arkhive.dev/launcher/internal/network"
+	"arkhive.dev/launcher/internal/network/resources"
+	"arkhive.dev/launcher/internal/storage"
+	"github.com/anacrolix/torrent"
+	"github.com/anacrolix/torrent/bencode"
+	"github.com/anacrolix/torrent/metainfo"
+	"github.com/stretchr/testify/assert"
+)
+
+type testStorage struct {
+	*storage.StorageEngine
+	database      *sqlite.SQLite
+	configuration configloader.Config
+}
+
+func newTestStorageEngine(t *testing.T, games ...importer.Game) testStorage {
+	configuration := configloader.Config{BasePath: t.TempDir()}
+	database := &sqlite.SQLite{BasePath: configuration.BasePath}
+	assert.Nil(t, database.Open())
+	assert.Nil(t, database.Migrate())
+	t.Cleanup(func() { database.Close() })
+	console := importer.Console{
+		Slug:         "snes",
+		CoreLocation: "snes9x_libretro",
+		Name:         "Super Nintendo",
+		SingleFile:   true,
+		FileTypes: []importer.ConsoleFileType{
+			{FileType: "sfc", Action: sqlite.FILE_TYPE_RUNNABLE},
+			{FileType: "txt", Action: sqlite.FILE_TYPE_KEEP},
+			{FileType: "srm", Action: sqlite.FILE_TYPE_RENAME},
+		},
+	}
+	assert.Nil(t, database.StoreImported([]importer.Console{console}, games, []importer.Tool{}))
+
+	networkEngine, err := network.NewNetworkEngine(configuration)
+	assert.Nil(t, err)
+	storageEngine, err := storage.NewStorageEngine(database, networkEngine, configuration)
+	assert.Nil(t, err)
+	waitGroup := sync.WaitGroup{}
+	waitGroup.Add(1)
+	storageEngine.Initialize(&waitGroup)
+	waitGroup.Wait()
+	return testStorage{storageEngine, database, configuration}
+}
+
+// Write the catalog package file, returning its file URL and checksum
+func newTestPackage(t *testing.T, name string, data []byte) (string, string) {
+	packagePath := filepath.Join(t.TempDir(), name)
+	assert.Nil(t, os.WriteFile(packagePath, data, 0644))
+	checksum, err := resources.FileSha256(packagePath)
+	assert.Nil(t, err)
+	packageURL := url.URL{Scheme: "file", Path: filepath.ToSlash(packagePath)}
+	return packageURL.String(), checksum
+}
+
+func newTestGame(disks ...importer.GameDisk) importer.Game {
+	return importer.Game{
+		Slug:        "super_mario_world",
+		Name:        "Super Mario World",
+		ConsoleSlug: "snes",
+		Disks:       disks,
+		AdditionalFiles: []importer.GameAdditionalFile{
+			{Name: "config/CONFIG.DAT", Data: []byte("config")},
+		},
+	}
+}
+
+func TestInstallGame(t *testing.T) {
+	packageURL, checksum := newTestPackage(t, "smw.sfc", []byte("rom"))
+	testEngine := newTestStorageEngine(t, newTestGame(importer.GameDisk{Url: packageURL, Sha256: &checksum}))
+
+	installedGame, err := testEngine.InstallGame("super_mario_world")
+	assert.Nil(t, err)
+	gamePath := filepath.Join(testEngine.configuration.BasePath, folder.ROMS, "super_mario_world")
+	assert.Equal(t, gamePath, installedGame.Path)
+	rom, err := os.ReadFile(filepath.Join(gamePath, "smw.sfc"))
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("rom"), rom)
+	additionalFile, err := os.ReadFile(filepath.Join(gamePath, "config", "CONFIG.DAT"))
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("config"), additionalFile)
+	_, err = os.Stat(filepath.Join(testEngine.configuration.BasePath, folder.PACKAGES, checksum, "smw.sfc"))
+	assert.Nil(t, err)
+
+	storedGame, err := testEngine.GetInstalledGame("super_mario_world")
+	assert.Nil(t, err)
+	assert.Equal(t, gamePath, storedGame.Path)
+	assert.Equal(t, int64(len("rom")+len("config")), storedGame.Size)
+	assert.NotEmpty(t, storedGame.CatalogVersion)
+	if assert.Len(t, storedGame.Files, 2) {
+		assert.Equal(t, "config/CONFIG.DAT", storedGame.Files[0].Path)
+		assert.False(t, storedGame.Files[0].DiskNumber.Valid)
+		assert.Equal(t, "smw.sfc", storedGame.Files[1].Path)
+		assert.Equal(t, int64(0), storedGame.Files[1].DiskNumber.Int64)
+		assert.Equal(t, checksum, storedGame.Files[1].Sha256)
+	}
+}
+
+func TestInstallGameChecksumMismatch(t *testing.T) {
+	packageURL, _ := newTestPackage(t, "smw.sfc", []byte("rom"))
+	checksum := "9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08"
+	testEngine := newTestStorageEngine(t, newTestGame(importer.GameDisk{Url: packageURL, Sha256: &checksum}))
+
+	_, err := testEngine.InstallGame("super_mario_world")
+	assert.NotNil(t, err)
+	_, err = os.Stat(filepath.Join(testEngine.configuration.BasePath, folder.ROMS, "super_mario_world"))
+	assert.True(t, os.IsNotExist(err))
+	_, err = testEngine.database.GetInstalledGame(&sqlite.Game{Slug: "super_mario_world"})
+	assert.NotNil(t, err)
+}
+
+// Write a zip archive of the files, returning its file URL
+func newTestArchive(t *testing.T, name string, files map[string]string) string {
+	archivePath := filepath.Join(t.TempDir(), name)
+	archiveFile, err := os.Create(archivePath)
+	assert.Nil(t, err)
+	writer := zip.NewWriter(archiveFile)
+	for fileName, content := range files {
+		fileWriter, err := writer.Create(fileName)
+		assert.Nil(t, err)
+		_, err = fileWriter.Write([]byte(content))
+		assert.Nil(t, err)
+	}
+	assert.Nil(t, writer.Close())
+	assert.Nil(t, archiveFile.Close())
+	archiveURL := url.URL{Scheme: "file", Path: filepath.ToSlash(archivePath)}
+	return archiveURL.String()
+}
+
+func TestInstallGameFileTypeRules(t *testing.T) {
+	collectionPath := "Collection/smw"
+	firstDisk := newTestArchive(t, "disk1.zip", map[string]string{
+		"Collection/smw/smw (USA).sfc": "rom",
+		"Collection/smw/save.srm":      "save",
+		"Collection/smw/readme.txt":    "readme",
+		"Collection/smw/cover.jpg":     "cover",
+		"Collection/other/other.sfc":   "other",
+	})
+	secondDisk := newTestArchive(t, "disk2.zip", map[string]string{"smw2.sfc": "rom2"})
+	testEngine := newTestStorageEngine(t, newTestGame(
+		importer.GameDisk{DiskNumber: 0, Url: firstDisk, CollectionPath: &collectionPath},
+		importer.GameDisk{DiskNumber: 1, Url: secondDisk},
+	))
+
+	installedGame, err := testEngine.InstallGame("super_mario_world")
+	assert.Nil(t, err)
+	entries, err := os.ReadDir(installedGame.Path)
+	assert.Nil(t, err)
+	var names []string
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+	assert.ElementsMatch(t, []string{"config", "readme.txt", "smw (USA).sfc", "smw (USA).srm", "smw2.sfc", "super_mario_world.m3u"}, names)
+}
+
+func TestVerifyAndRepairGame(t *testing.T) {
+	firstDisk, firstChecksum := newTestPackage(t, "smw.sfc", []byte("rom"))
+	secondDisk, secondChecksum := newTestPackage(t, "smw2.sfc", []byte("rom2"))
+	testEngine := newTestStorageEngine(t, newTestGame(
+		importer.GameDisk{DiskNumber: 0, Url: firstDisk, Sha256: &firstChecksum},
+		importer.GameDisk{DiskNumber: 1, Url: secondDisk, Sha256: &secondChecksum},
+	))
+	installedGame, err := testEngine.InstallGame("super_mario_world")
+	assert.Nil(t, err)
+
+	report, err := testEngine.VerifyGame("super_mario_world")
+	assert.Nil(t, err)
+	assert.True(t, report.IsValid())
+	assert.False(t, report.Outdated)
+
+	assert.Nil(t, os.WriteFile(filepath.Join(installedGame.Path, "smw2.sfc"), []byte("patched"), 0644))
+	assert.Nil(t, os.Remove(filepath.Join(installedGame.Path, "config", "CONFIG.DAT")))
+	report, err = testEngine.VerifyGame("super_mario_world")
+	assert.Nil(t, err)
+	assert.False(t, report.IsValid())
+	assert.Equal(t, []string{"config/CONFIG.DAT"}, report.Missing)
+	assert.Equal(t, []string{"smw2.sfc"}, report.Modified)
+	assert.Equal(t, []uint{1}, report.BrokenDisks)
+	assert.True(t, report.BrokenAdditionalFiles)
+
+	firstRom, err := os.Stat(filepath.Join(installedGame.Path, "smw.sfc"))
+	assert.Nil(t, err)
+	report, err = testEngine.RepairGame("super_mario_world")
+	assert.Nil(t, err)
+	assert.Equal(t, []uint{1}, report.BrokenDisks)
+	rom, err := os.ReadFile(filepath.Join(installedGame.Path, "smw2.sfc"))
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("rom2"), rom)
+	additionalFile, err := os.ReadFile(filepath.Join(installedGame.Path, "config", "CONFIG.DAT"))
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("config"), additionalFile)
+	// The intact disk is not installed again
+	repairedRom, err := os.Stat(filepath.Join(installedGame.Path, "smw.sfc"))
+	assert.Nil(t, err)
+	assert.True(t, os.SameFile(firstRom, repairedRom))
+
+	report, err = testEngine.VerifyGame("super_mario_world")
+	assert.Nil(t, err)
+	assert.True(t, report.IsValid())
+	repairedGame, err := testEngine.GetInstalledGame("super_mario_world")
+	assert.Nil(t, err)
+	assert.Equal(t, installedGame.InstallDate.Unix(), repairedGame.InstallDate.Unix())
+	assert.Len(t, repairedGame.Files, 4)
+}
+
+func TestVerifyGameNotInstalled(t *testing.T) {
+	packageURL, checksum := newTestPackage(t, "smw.sfc", []byte("rom"))
+	testEngine := newTestStorageEngine(t, newTestGame(importer.GameDisk{Url: packageURL, Sha256: &checksum}))
+
+	_, err := testEngine.VerifyGame("super_mario_world")
+	assert.NotNil(t, err)
+}
+
+func TestInstallGamePlaylist(t *testing.T) {
+	firstDisk, firstChecksum := newTestPackage(t, "ff7 (disc 1).sfc", []byte("rom"))
+	secondDisk, secondChecksum := newTestPackage(t, "ff7 (disc 2).sfc", []byte("rom2"))
+	testEngine := newTestStorageEngine(t, newTestGame(
+		importer.GameDisk{DiskNumber: 0, Url: firstDisk, Sha256: &firstChecksum},
+		importer.GameDisk{DiskNumber: 1, Url: secondDisk, Sha256: &secondChecksum},
+	))
+
+	installedGame, err := testEngine.InstallGame("super_mario_world")
+	assert.Nil(t, err)
+	playlist, err := os.ReadFile(filepath.Join(installedGame.Path, storage.GetPlaylistName(&sqlite.Game{Slug: "super_mario_world"})))
+	assert.Nil(t, err)
+	assert.Equal(t, "ff7 (disc 1).sfc\nff7 (disc 2).sfc\n", string(playlist))
+}
+
+func TestInstallGameDisksOverwrite(t *testing.T) {
+	firstDisk, firstChecksum := newTestPackage(t, "smw.sfc", []byte("rom"))
+	secondDisk, secondChecksum := newTestPackage(t, "smw.sfc", []byte("rom2"))
+	testEngine := newTestStorageEngine(t, newTestGame(
+		importer.GameDisk{DiskNumber: 0, Url: firstDisk, Sha256: &firstChecksum},
+		importer.GameDisk{DiskNumber: 1, Url: secondDisk, Sha256: &secondChecksum},
+	))
+
+	_, err := testEngine.InstallGame("super_mario_world")
+	assert.NotNil(t, err)
+}
+
+// Seed a multiple files torrent of the files, returning its magnet URL with the seeder address
+func newTestTorrent(t *testing.T, name string, files map[string]string) string {
+	seederPath := t.TempDir()
+	for fileName, content := range files {
+		filePath := filepath.Join(seederPath, name, filepath.FromSlash(fileName))
+		assert.Nil(t, os.MkdirAll(filepath.Dir(filePath), 0755))
+		assert.Nil(t, os.WriteFile(filePath, []byte(content), 0644))
+	}
+	info := metainfo.Info{PieceLength: 16 * 1024}
+	assert.Nil(t, info.BuildFromFilePath(filepath.Join(seederPath, name)))
+	metaInfo := metainfo.MetaInfo{}
+	var err error
+	metaInfo.InfoBytes, err = bencode.Marshal(info)
+	assert.Nil(t, err)
+
+	clientConfig := torrent.NewDefaultClientConfig()
+	clientConfig.DataDir = seederPath
+	clientConfig.Seed = true
+	clientConfig.NoDHT = true
+	clientConfig.DisableTrackers = true
+	clientConfig.NoDefaultPortForwarding = true
+	clientConfig.DisableIPv6 = true
+	clientConfig.ListenHost = func(string) string { return "127.0.0.1" }
+	clientConfig.ListenPort = 0
+	seeder, err := torrent.NewClient(clientConfig)
+	assert.Nil(t, err)
+	t.Cleanup(func() { seeder.Close() })
+	seedingTorrent, err := seeder.AddTorrent(&metaInfo)
+	assert.Nil(t, err)
+	<-seedingTorrent.GotInfo()
+	assert.Nil(t, seedingTorrent.VerifyData())
+
+	magnetLink := metaInfo.Magnet(nil, &info)
+	magnetLink.Params = url.Values{"x.pe": {seeder.ListenAddrs()[0].String()}}
+	return magnetLink.String()
+}
+
+func TestInstallGameFromMultipleFilesTorrent(t *testing.T) {
+	collectionPath := "snes/smw (USA).sfc"
+	magnet := newTestTorrent(t, "collection", map[string]string{
+		collectionPath:         "rom",
+		"snes/other (USA).sfc": "other",
+	})
+	hash := sha256.Sum256([]byte("rom"))
+	checksum := hex.EncodeToString(hash[:])
+	testEngine := newTestStorageEngine(t, newTestGame(importer.GameDisk{Url: magnet, Sha256: &checksum, CollectionPath: &collectionPath}))
+
+	installedGame, err := testEngine.InstallGame("super_mario_world")
+	assert.Nil(t, err)
+	rom, err := os.ReadFile(filepath.Join(installedGame.Path, "smw (USA).sfc"))
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("rom"), rom)
+	_, err = os.Stat(filepath.Join(installedGame.Path, "other (USA).sfc"))
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestRepairOutdatedGame(t *testing.T) {
+	packageURL, checksum := newTestPackage(t, "smw.sfc", []byte("rom"))
+	testEngine := newTestStorageEngine(t, newTestGame(importer.GameDisk{Url: packageURL, Sha256: &checksum}))
+	installedGame, err := testEngine.InstallGame("super_mario_world")
+	assert.Nil(t, err)
+	assert.Nil(t, os.WriteFile(filepath.Join(installedGame.Path, "smw.sfc"), []byte("patched"), 0644))
+
+	// The game was installed from a previous catalog entry
+	installedGame.CatalogVersion = "previous"
+	assert.Nil(t, testEngine.database.StoreInstalledGame(&installedGame))
+	report, err := testEngine.RepairGame("super_mario_world")
+	assert.ErrorIs(t, err, storage.ErrGameOutdated)
+	assert.True(t, report.Outdated)
+	rom, err := os.ReadFile(filepath.Join(installedGame.Path, "smw.sfc"))
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("patched"), rom)
+}
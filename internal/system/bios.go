@@ -0,0 +1,162 @@
+package system
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"arkhive.dev/launcher/internal/database/delegate/sqlite"
+	"arkhive.dev/launcher/internal/folder"
+	"arkhive.dev/launcher/internal/network/resources"
+	"arkhive.dev/launcher/internal/plugins"
+	"github.com/sirupsen/logrus"
+)
+
+var ErrMissingBios = errors.New("required BIOS missing")
+
+// A BIOS file of a console, as declared by the catalog
+type BiosFile struct {
+	// Path of the file inside the RetroArch system directory
+	Path     string
+	Required bool
+}
+
+// The BIOS files of a console found in the system directory
+type BiosReport struct {
+	ConsoleSlug string
+	Present     []BiosFile
+	Missing     []BiosFile
+	// Files with a checksum different from the catalog one
+	Mismatched []BiosFile
+}
+
+// Whether the required BIOS files are all present
+func (report *BiosReport) IsComplete() bool {
+	return report.CheckRequired() == nil
+}
+
+// Fail with ErrMissingBios listing the required files missing or mismatched
+func (report *BiosReport) CheckRequired() error {
+	var missing []string
+	for _, biosFile := range report.Missing {
+		if biosFile.Required {
+			missing = append(missing, biosFile.Path)
+		}
+	}
+	for _, biosFile := range report.Mismatched {
+		if biosFile.Required {
+			missing = append(missing, biosFile.Path+" (mismatched)")
+		}
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("%w for %s: %s", ErrMissingBios, report.ConsoleSlug, strings.Join(missing, ", "))
+	}
+	return nil
+}
+
+/*
+Scan the system directory for the BIOS files of the console, comparing them with the
+catalog checksums.
+*/
+func CheckBios(databaseEngine *sqlite.SQLite, systemPath string, consoleEntry *sqlite.Console) (report BiosReport, err error) {
+	report.ConsoleSlug = consoleEntry.Slug
+	var consolePlugins []sqlite.ConsolePlugin
+	if consolePlugins, err = databaseEngine.GetConsolePluginsByConsole(consoleEntry); err != nil {
+		return
+	}
+	for consolePluginIndex := range consolePlugins {
+		if err = checkPluginBios(databaseEngine, systemPath, &consolePlugins[consolePluginIndex], &report); err != nil {
+			return
+		}
+	}
+	return
+}
+
+// Add the BIOS files of the plugin to the report, if its files are verified
+func checkPluginBios(databaseEngine *sqlite.SQLite, systemPath string, consolePlugin *sqlite.ConsolePlugin, report *BiosReport) (err error) {
+	if pluginType, typeErr := plugins.Get(consolePlugin.Type); typeErr != nil || !pluginType.Verified {
+		return
+	}
+	var consolePluginHashes []sqlite.ConsolePluginHash
+	if consolePluginHashes, err = databaseEngine.GetConsolePluginHashesByConsolePlugin(consolePlugin); err != nil {
+		return
+	}
+	for _, consolePluginHash := range consolePluginHashes {
+		biosFile := BiosFile{Path: consolePluginHash.Path, Required: consolePluginHash.Required}
+		sha256, hashErr := resources.FileSha256(filepath.Join(systemPath, filepath.FromSlash(consolePluginHash.Path)))
+		switch {
+		case errors.Is(hashErr, os.ErrNotExist):
+			report.Missing = append(report.Missing, biosFile)
+		case hashErr != nil:
+			return hashErr
+		case !strings.EqualFold(sha256, consolePluginHash.Sha256):
+			report.Mismatched = append(report.Mismatched, biosFile)
+		default:
+			report.Present = append(report.Present, biosFile)
+		}
+	}
+	return
+}
+
+/*
+Check the BIOS files written by the plugin, failing with ErrMissingBios if a required
+one is missing or if any has a checksum different from the catalog one.
+*/
+func (systemEngine *SystemEngine) verifyPluginBios(consolePlugin *sqlite.ConsolePlugin) (err error) {
+	report := BiosReport{ConsoleSlug: consolePlugin.ConsoleID}
+	if err = checkPluginBios(systemEngine.databaseEngine, systemEngine.getSystemPath(), consolePlugin, &report); err != nil {
+		return
+	}
+	if err = report.CheckRequired(); err != nil {
+		return
+	}
+	if len(report.Mismatched) > 0 {
+		var mismatched []string
+		for _, biosFile := range report.Mismatched {
+			mismatched = append(mismatched, biosFile.Path)
+		}
+		return fmt.Errorf("%w for %s: %s (mismatched)", ErrMissingBios, consolePlugin.ConsoleID, strings.Join(mismatched, ", "))
+	}
+	return
+}
+
+// The RetroArch system directory, inside the base path
+func (systemEngine *SystemEngine) getSystemPath() string {
+	return filepath.Join(systemEngine.basePath, folder.SYSTEM)
+}
+
+// Scan the system folder for the BIOS files of every console
+func (systemEngine *SystemEngine) VerifyBios() (reports []BiosReport, err error) {
+	var consoles []sqlite.Console
+	if consoles, err = systemEngine.databaseEngine.GetConsoles(); err != nil {
+		return
+	}
+	for consoleIndex := range consoles {
+		var report BiosReport
+		if report, err = CheckBios(systemEngine.databaseEngine, systemEngine.getSystemPath(), &consoles[consoleIndex]); err != nil {
+			return
+		}
+		reports = append(reports, report)
+	}
+	return
+}
+
+// Log the consoles missing BIOS files
+func (systemEngine *SystemEngine) logBiosReports() {
+	reports, err := systemEngine.VerifyBios()
+	if err != nil {
+		logrus.Error("Cannot verify the BIOS files")
+		logrus.Errorf("%+v", err)
+		return
+	}
+	for _, report := range reports {
+		for _, biosFile := range report.Missing {
+			logrus.Warnf("%s: BIOS %s missing", report.ConsoleSlug, biosFile.Path)
+		}
+		for _, biosFile := range report.Mismatched {
+			logrus.Warnf("%s: BIOS %s checksum mismatch", report.ConsoleSlug, biosFile.Path)
+		}
+	}
+}
@@ -0,0 +1,126 @@
+package system_test
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"arkhive.dev/launcher/internal/configloader"
+	"arkhive.dev/launcher/internal/database/delegate/sqlite"
+	"arkhive.dev/launcher/internal/database/importer"
+	"arkhive.dev/launcher/internal/folder"
+	"arkhive.dev/launcher/internal/network"
+	"arkhive.dev/launcher/internal/plugins"
+	"arkhive.dev/launcher/internal/system"
+	"github.com/stretchr/testify/assert"
+)
+
+func testSha256(data string) string {
+	checksum := sha256.Sum256([]byte(data))
+	return hex.EncodeToString(checksum[:])
+}
+
+func TestVerifyBios(t *testing.T) {
+	systemEngine, database := newTestSystemEngine(t)
+	assert.Nil(t, database.StoreImported([]importer.Console{{
+		Slug:         "psx",
+		CoreLocation: "swanstation_libretro",
+		Name:         "PlayStation",
+		FileTypes:    []importer.ConsoleFileType{{FileType: "cue", Action: sqlite.FILE_TYPE_RUNNABLE}},
+		Plugins: []importer.ConsolePlugin{{
+			Type: plugins.BIOS,
+			Hashes: []importer.ConsolePluginHash{
+				{Path: "scph5501.bin", Sha256: testSha256("usa"), Required: true},
+				{Path: "scph5502.bin", Sha256: testSha256("europe"), Required: true},
+				{Path: "psx/scph5500.bin", Sha256: testSha256("japan"), Required: false},
+			},
+		}},
+	}}, []importer.Game{}, []importer.Tool{}))
+	assert.Nil(t, os.MkdirAll(folder.SYSTEM, 0755))
+	assert.Nil(t, os.WriteFile(filepath.Join(folder.SYSTEM, "scph5501.bin"), []byte("usa"), 0644))
+	assert.Nil(t, os.WriteFile(filepath.Join(folder.SYSTEM, "scph5502.bin"), []byte("corrupted"), 0644))
+
+	reports, err := systemEngine.VerifyBios()
+	assert.Nil(t, err)
+	assert.Len(t, reports, 2)
+	for _, report := range reports {
+		if report.ConsoleSlug == "snes" {
+			assert.True(t, report.IsComplete())
+			continue
+		}
+		assert.Equal(t, []system.BiosFile{{Path: "scph5501.bin", Required: true}}, report.Present)
+		assert.Equal(t, []system.BiosFile{{Path: "scph5502.bin", Required: true}}, report.Mismatched)
+		assert.Equal(t, []system.BiosFile{{Path: "psx/scph5500.bin", Required: false}}, report.Missing)
+		assert.False(t, report.IsComplete())
+		err = report.CheckRequired()
+		assert.ErrorIs(t, err, system.ErrMissingBios)
+		assert.Contains(t, err.Error(), "scph5502.bin")
+		assert.NotContains(t, err.Error(), "scph5500.bin")
+	}
+
+	// The optional BIOS missing doesn't prevent the games from running
+	assert.Nil(t, os.WriteFile(filepath.Join(folder.SYSTEM, "scph5502.bin"), []byte("europe"), 0644))
+	console, err := database.GetConsole("psx")
+	assert.Nil(t, err)
+	report, err := system.CheckBios(database, folder.SYSTEM, &console)
+	assert.Nil(t, err)
+	assert.Len(t, report.Present, 2)
+	assert.True(t, report.IsComplete())
+}
+
+func TestPrepareBiosPlugin(t *testing.T) {
+	bios := "corrupted"
+	var biosRequests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		biosRequests.Add(1)
+		http.ServeContent(writer, request, "scph5501.bin", time.Now(), strings.NewReader(bios))
+	}))
+	t.Cleanup(server.Close)
+	_, database := newTestSystemEngine(t)
+	destination := folder.SYSTEM
+	assert.Nil(t, database.StoreImported([]importer.Console{{
+		Slug:         "psx",
+		CoreLocation: "swanstation_libretro",
+		Name:         "PlayStation",
+		Plugins: []importer.ConsolePlugin{{
+			Type:  plugins.BIOS,
+			Files: []importer.ConsolePluginsFile{{Url: server.URL + "/scph5501.bin", Destination: &destination}},
+			Hashes: []importer.ConsolePluginHash{
+				{Path: "scph5501.bin", Sha256: testSha256("usa"), Required: true},
+			},
+		}},
+	}}, []importer.Game{}, []importer.Tool{}))
+	networkEngine, err := network.NewNetworkEngine(configloader.Config{})
+	assert.Nil(t, err)
+	systemEngine, err := system.NewSystemEngine(database, networkEngine, configloader.Config{BuildbotURL: "http://127.0.0.1", PreparationRetries: 1})
+	assert.Nil(t, err)
+	var waitGroup sync.WaitGroup
+	waitGroup.Add(1)
+	systemEngine.Initialize(&waitGroup)
+	waitGroup.Wait()
+
+	// The mismatched BIOS fails the job, retried
+	assert.Nil(t, systemEngine.Prepare(nil))
+	assert.Equal(t, int32(2), biosRequests.Load())
+
+	// The plugin of the incomplete console is queued again, even if its core is not downloaded
+	bios = "usa"
+	assert.Nil(t, systemEngine.Prepare(nil))
+	assert.Equal(t, int32(3), biosRequests.Load())
+	console, err := database.GetConsole("psx")
+	assert.Nil(t, err)
+	report, err := system.CheckBios(database, folder.SYSTEM, &console)
+	assert.Nil(t, err)
+	assert.True(t, report.IsComplete())
+
+	assert.Nil(t, systemEngine.Prepare(nil))
+	assert.Equal(t, int32(3), biosRequests.Load())
+}
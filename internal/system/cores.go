@@ -0,0 +1,221 @@
+package system
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"time"
+
+	"arkhive.dev/launcher/internal/buildbot"
+	"arkhive.dev/launcher/internal/database/delegate/sqlite"
+	"arkhive.dev/launcher/internal/folder"
+	"arkhive.dev/launcher/internal/network/resources"
+	"github.com/sirupsen/logrus"
+)
+
+// Folder of the replaced cores kept for the rollback, inside the cores folder
+const PREVIOUS_CORES_FOLDER = "previous"
+
+var ErrNoPreviousCore = errors.New("no previous core to roll back to")
+
+// The buildbot folder of the console core, the stable release one if the console pins a version
+func (systemEngine *SystemEngine) GetCoreIndexPath(consoleEntry *sqlite.Console) string {
+	if consoleEntry.CoreVersion.Valid && consoleEntry.CoreVersion.String != "" {
+		return systemEngine.platform.GetStableCoresPath(consoleEntry.CoreVersion.String)
+	}
+	return systemEngine.platform.GetNightlyCoresPath()
+}
+
+// Name of the core archive on the buildbot
+func (systemEngine *SystemEngine) GetCoreArchiveName(consoleEntry *sqlite.Console) string {
+	return consoleEntry.CoreLocation + "." + systemEngine.platform.CoreExtension + ".zip"
+}
+
+// The core replaced by the last update
+func (systemEngine *SystemEngine) GetPreviousCorePath(consoleEntry *sqlite.Console) string {
+	return filepath.Join(
+		systemEngine.basePath,
+		folder.CORES,
+		PREVIOUS_CORES_FOLDER,
+		consoleEntry.CoreLocation+"."+systemEngine.platform.CoreExtension)
+}
+
+/*
+Whether the installed core is up to date with the buildbot build.
+
+The core is outdated if it was never recorded, if the console pins another version or
+if the build is newer than the installed one. The build rolled back from and the older
+ones are never installed again.
+*/
+func (systemEngine *SystemEngine) coreIsUpdated(consoleEntry *sqlite.Console, item *buildbot.Item) bool {
+	installedCore, err := systemEngine.databaseEngine.GetInstalledCore(consoleEntry.CoreLocation)
+	if err != nil {
+		return false
+	}
+	if installedCore.Build.Version != consoleEntry.CoreVersion.String {
+		return false
+	}
+	buildTime := item.GetModTime()
+	return !buildTime.After(installedCore.Build.BuildTime) || !buildTime.After(installedCore.RolledBackBuildTime)
+}
+
+// The build of the buildbot item, for the console pinned version
+func getCoreBuild(consoleEntry *sqlite.Console, item *buildbot.Item) (build sqlite.CoreBuild) {
+	build.Version = consoleEntry.CoreVersion.String
+	build.BuildTime = item.GetModTime()
+	if item.Size != nil {
+		build.Size = *item.Size
+	}
+	return
+}
+
+/*
+Install the core file of the build as the console core, recording its checksum.
+
+The replaced core is moved to the previous cores folder, so a broken build can be
+rolled back once.
+*/
+func (systemEngine *SystemEngine) InstallCore(consoleEntry *sqlite.Console, build sqlite.CoreBuild, coreFilePath string) (err error) {
+	if build.Sha256, err = resources.FileSha256(coreFilePath); err != nil {
+		return
+	}
+	installedCore, err := systemEngine.databaseEngine.GetInstalledCore(consoleEntry.CoreLocation)
+	if err != nil {
+		installedCore = sqlite.InstalledCore{CoreLocation: consoleEntry.CoreLocation}
+	}
+	corePath := filepath.Join(systemEngine.basePath, GetCorePath(consoleEntry, &systemEngine.platform))
+	if _, statErr := os.Stat(corePath); statErr == nil {
+		previousCorePath := systemEngine.GetPreviousCorePath(consoleEntry)
+		if err = os.MkdirAll(filepath.Dir(previousCorePath), 0755); err != nil {
+			return
+		}
+		if err = os.Rename(corePath, previousCorePath); err != nil {
+			return
+		}
+		installedCore.Previous = installedCore.Build
+	} else {
+		installedCore.Previous = sqlite.CoreBuild{}
+	}
+	if err = os.MkdirAll(filepath.Dir(corePath), 0755); err != nil {
+		return
+	}
+	if err = os.Rename(coreFilePath, corePath); err != nil {
+		return
+	}
+	installedCore.Build = build
+	installedCore.InstallDate = time.Now().UTC()
+	if err = systemEngine.databaseEngine.StoreInstalledCore(&installedCore); err != nil {
+		return
+	}
+	logrus.Infof("Core %s build of %s installed", consoleEntry.CoreLocation, build.BuildTime.Format(time.DateTime))
+	return
+}
+
+/*
+Restore the core replaced by the last update of the console core.
+
+The build rolled back from is not installed again, the next newer build is.
+*/
+func (systemEngine *SystemEngine) RollbackCore(consoleSlug string) (err error) {
+	var consoleEntry sqlite.Console
+	if consoleEntry, err = systemEngine.databaseEngine.GetConsole(consoleSlug); err != nil {
+		return
+	}
+	var installedCore sqlite.InstalledCore
+	if installedCore, err = systemEngine.databaseEngine.GetInstalledCore(consoleEntry.CoreLocation); err != nil || !installedCore.Previous.IsValid() {
+		return fmt.Errorf("%w: %s", ErrNoPreviousCore, consoleEntry.CoreLocation)
+	}
+	previousCorePath := systemEngine.GetPreviousCorePath(&consoleEntry)
+	if _, err = os.Stat(previousCorePath); err != nil {
+		return fmt.Errorf("%w: %w", ErrNoPreviousCore, err)
+	}
+	if err = os.Rename(previousCorePath, filepath.Join(systemEngine.basePath, GetCorePath(&consoleEntry, &systemEngine.platform))); err != nil {
+		return
+	}
+	installedCore.RolledBackBuildTime = installedCore.Build.BuildTime
+	installedCore.Build = installedCore.Previous
+	installedCore.Previous = sqlite.CoreBuild{}
+	if err = systemEngine.databaseEngine.StoreInstalledCore(&installedCore); err != nil {
+		return
+	}
+	logrus.Infof("Core %s rolled back to the build of %s", consoleEntry.CoreLocation, installedCore.Build.BuildTime.Format(time.DateTime))
+	return
+}
+
+// The tool file reported by the server
+type toolRemoteInfo struct {
+	ModTime time.Time
+	// Negative if unknown
+	Size int64
+}
+
+// The last modification time and the size of the tool file reported by the server
+func (systemEngine *SystemEngine) getToolRemoteInfo(toolEntry *sqlite.Tool) (remoteInfo *toolRemoteInfo, err error) {
+	var toolURL *url.URL
+	if toolURL, err = url.Parse(toolEntry.Url); err != nil {
+		return
+	}
+	if toolURL.Scheme != "http" && toolURL.Scheme != "https" {
+		return nil, fmt.Errorf("cannot check the updates of the %s URL", toolURL.Scheme)
+	}
+	var response *http.Response
+	if response, err = systemEngine.networkEngine.HTTPClient().Head(toolEntry.Url); err != nil {
+		return
+	}
+	response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("tool %s request failed with status %s", toolEntry.Slug, response.Status)
+	}
+	var modTime time.Time
+	if lastModified := response.Header.Get("Last-Modified"); lastModified != "" {
+		if modTime, err = http.ParseTime(lastModified); err != nil {
+			return
+		}
+	}
+	return &toolRemoteInfo{ModTime: modTime.UTC(), Size: response.ContentLength}, nil
+}
+
+/*
+Whether the installed tool is up to date with the file of its URL.
+
+The tool is outdated if it was never recorded, if its catalog URL changed or if the
+server reports a newer or different file. The installed tool is kept when the server
+can't be reached, the remote info being nil.
+*/
+func (systemEngine *SystemEngine) toolIsUpdated(toolEntry *sqlite.Tool, remoteInfo *toolRemoteInfo) bool {
+	installedTool, err := systemEngine.databaseEngine.GetInstalledTool(toolEntry)
+	if err != nil || installedTool.Url != toolEntry.Url {
+		return false
+	}
+	if remoteInfo == nil {
+		return true
+	}
+	return !remoteInfo.ModTime.After(installedTool.ModTime) && (remoteInfo.Size < 0 || remoteInfo.Size == installedTool.Size)
+}
+
+// Record the downloaded tool file, before its elaboration, with the remote info checked before the download
+func (systemEngine *SystemEngine) recordInstalledTool(toolEntry *sqlite.Tool, remoteInfo *toolRemoteInfo) (err error) {
+	installedTool := sqlite.InstalledTool{
+		ToolID:      toolEntry.Slug,
+		Url:         toolEntry.Url,
+		InstallDate: time.Now().UTC(),
+	}
+	downloadPath := systemEngine.GetDownloadToolPath(toolEntry)
+	var fileInfo os.FileInfo
+	if fileInfo, err = os.Stat(downloadPath); err != nil {
+		return
+	}
+	installedTool.Size = fileInfo.Size()
+	if installedTool.Sha256, err = resources.FileSha256(downloadPath); err != nil {
+		return
+	}
+	if remoteInfo != nil {
+		installedTool.ModTime = remoteInfo.ModTime
+	} else {
+		installedTool.ModTime = fileInfo.ModTime().UTC()
+	}
+	return systemEngine.databaseEngine.StoreInstalledTool(&installedTool)
+}
@@ -0,0 +1,241 @@
+package system_test
+
+import (
+	"archive/zip"
+	"bytes"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"arkhive.dev/launcher/internal/buildbot"
+	"arkhive.dev/launcher/internal/configloader"
+	"arkhive.dev/launcher/internal/database/delegate/sqlite"
+	"arkhive.dev/launcher/internal/database/importer"
+	"arkhive.dev/launcher/internal/folder"
+	"arkhive.dev/launcher/internal/network"
+	"arkhive.dev/launcher/internal/system"
+	"github.com/BurntSushi/toml"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestSystemEngine(t *testing.T, tools ...importer.Tool) (*system.SystemEngine, *sqlite.SQLite) {
+	basePath := t.TempDir()
+	t.Chdir(basePath)
+	return newBasePathSystemEngine(t, basePath, "", tools...)
+}
+
+// Create the engine with the configuration base path, the database being in the database path
+func newBasePathSystemEngine(t *testing.T, databasePath string, basePath string, tools ...importer.Tool) (*system.SystemEngine, *sqlite.SQLite) {
+	database := &sqlite.SQLite{BasePath: databasePath}
+	assert.Nil(t, database.Open())
+	assert.Nil(t, database.Migrate())
+	t.Cleanup(func() { database.Close() })
+	console := importer.Console{
+		Slug:         "snes",
+		CoreLocation: "snes9x_libretro",
+		Name:         "Super Nintendo",
+		FileTypes:    []importer.ConsoleFileType{{FileType: "sfc", Action: sqlite.FILE_TYPE_RUNNABLE}},
+	}
+	assert.Nil(t, database.StoreImported([]importer.Console{console}, []importer.Game{}, tools))
+	networkEngine, err := network.NewNetworkEngine(configloader.Config{})
+	assert.Nil(t, err)
+	systemEngine, err := system.NewSystemEngine(database, networkEngine, configloader.Config{BasePath: basePath, BuildbotURL: "http://127.0.0.1"})
+	assert.Nil(t, err)
+	return systemEngine, database
+}
+
+// The core path of the platform the test engines detect
+func getTestCorePath(t *testing.T, console *sqlite.Console) string {
+	platform, err := buildbot.DetectPlatform("")
+	assert.Nil(t, err)
+	return system.GetCorePath(console, &platform)
+}
+
+// Write a core file as the extracted core of the build
+func writeTestCore(t *testing.T, data string) string {
+	coreFilePath := filepath.Join(t.TempDir(), "core")
+	assert.Nil(t, os.WriteFile(coreFilePath, []byte(data), 0644))
+	return coreFilePath
+}
+
+func TestInstallCoreRollback(t *testing.T) {
+	systemEngine, database := newTestSystemEngine(t)
+	console, err := database.GetConsole("snes")
+	assert.Nil(t, err)
+	firstBuild := sqlite.CoreBuild{BuildTime: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC), Size: 10}
+	secondBuild := sqlite.CoreBuild{BuildTime: time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC), Size: 20}
+
+	assert.Nil(t, systemEngine.InstallCore(&console, firstBuild, writeTestCore(t, "first")))
+	err = systemEngine.RollbackCore("snes")
+	assert.ErrorIs(t, err, system.ErrNoPreviousCore)
+
+	assert.Nil(t, systemEngine.InstallCore(&console, secondBuild, writeTestCore(t, "second")))
+	data, err := os.ReadFile(getTestCorePath(t, &console))
+	assert.Nil(t, err)
+	assert.Equal(t, "second", string(data))
+	data, err = os.ReadFile(systemEngine.GetPreviousCorePath(&console))
+	assert.Nil(t, err)
+	assert.Equal(t, "first", string(data))
+	installedCore, err := database.GetInstalledCore(console.CoreLocation)
+	assert.Nil(t, err)
+	assert.True(t, secondBuild.BuildTime.Equal(installedCore.Build.BuildTime))
+	assert.True(t, firstBuild.BuildTime.Equal(installedCore.Previous.BuildTime))
+	assert.NotEmpty(t, installedCore.Build.Sha256)
+
+	assert.Nil(t, systemEngine.RollbackCore("snes"))
+	data, err = os.ReadFile(getTestCorePath(t, &console))
+	assert.Nil(t, err)
+	assert.Equal(t, "first", string(data))
+	installedCore, err = database.GetInstalledCore(console.CoreLocation)
+	assert.Nil(t, err)
+	assert.True(t, firstBuild.BuildTime.Equal(installedCore.Build.BuildTime))
+	assert.True(t, secondBuild.BuildTime.Equal(installedCore.RolledBackBuildTime))
+	assert.False(t, installedCore.Previous.IsValid())
+	err = systemEngine.RollbackCore("snes")
+	assert.ErrorIs(t, err, system.ErrNoPreviousCore)
+}
+
+func TestPrepare(t *testing.T) {
+	modTime := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	headRequests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		if request.Method == http.MethodHead {
+			headRequests++
+		}
+		http.ServeContent(writer, request, "tool.txt", modTime, strings.NewReader("tool"))
+	}))
+	t.Cleanup(server.Close)
+	systemEngine, database := newTestSystemEngine(t, importer.Tool{Slug: "tool", Url: server.URL + "/tool.txt"})
+	var waitGroup sync.WaitGroup
+	waitGroup.Add(1)
+	systemEngine.Initialize(&waitGroup)
+	waitGroup.Wait()
+
+	var progress [][2]int
+	assert.Nil(t, systemEngine.Prepare(func(completed int, total int) {
+		progress = append(progress, [2]int{completed, total})
+	}))
+	assert.Equal(t, [][2]int{{1, 1}}, progress)
+	assert.Equal(t, 1, headRequests)
+	data, err := os.ReadFile(filepath.Join(folder.TOOLS, "tool.txt"))
+	assert.Nil(t, err)
+	assert.Equal(t, "tool", string(data))
+	installedTool, err := database.GetInstalledTool(&sqlite.Tool{Slug: "tool"})
+	assert.Nil(t, err)
+	assert.True(t, modTime.Equal(installedTool.ModTime))
+
+	// The updated tool is not prepared again
+	progress = nil
+	assert.Nil(t, systemEngine.Prepare(func(completed int, total int) {
+		progress = append(progress, [2]int{completed, total})
+	}))
+	assert.Empty(t, progress)
+	modTime = modTime.Add(time.Hour)
+	assert.Nil(t, systemEngine.Prepare(func(completed int, total int) {
+		progress = append(progress, [2]int{completed, total})
+	}))
+	assert.Equal(t, [][2]int{{1, 1}}, progress)
+}
+
+func TestPrepareInBasePath(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		http.ServeContent(writer, request, "tool.txt", time.Now(), strings.NewReader("tool"))
+	}))
+	t.Cleanup(server.Close)
+	workingPath := t.TempDir()
+	t.Chdir(workingPath)
+	basePath := t.TempDir()
+	systemEngine, database := newBasePathSystemEngine(t, basePath, basePath, importer.Tool{Slug: "tool", Url: server.URL + "/tool.txt"})
+	var waitGroup sync.WaitGroup
+	waitGroup.Add(1)
+	systemEngine.Initialize(&waitGroup)
+	waitGroup.Wait()
+
+	assert.Nil(t, systemEngine.Prepare(nil))
+	data, err := os.ReadFile(filepath.Join(basePath, folder.TOOLS, "tool.txt"))
+	assert.Nil(t, err)
+	assert.Equal(t, "tool", string(data))
+	settings := map[string]interface{}{}
+	_, err = toml.DecodeFile(filepath.Join(basePath, system.GetDefaultConfigPath()), &settings)
+	assert.Nil(t, err)
+	systemFolder, err := filepath.Abs(filepath.Join(basePath, folder.SYSTEM))
+	assert.Nil(t, err)
+	assert.Equal(t, systemFolder, settings["system_directory"])
+	assert.Equal(t, "f2", settings["input_save_state"])
+
+	console, err := database.GetConsole("snes")
+	assert.Nil(t, err)
+	assert.Nil(t, systemEngine.InstallCore(&console, sqlite.CoreBuild{BuildTime: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}, writeTestCore(t, "first")))
+	assert.Nil(t, systemEngine.InstallCore(&console, sqlite.CoreBuild{BuildTime: time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC)}, writeTestCore(t, "second")))
+	assert.Nil(t, systemEngine.RollbackCore("snes"))
+	data, err = os.ReadFile(filepath.Join(basePath, getTestCorePath(t, &console)))
+	assert.Nil(t, err)
+	assert.Equal(t, "first", string(data))
+	entries, err := os.ReadDir(workingPath)
+	assert.Nil(t, err)
+	assert.Empty(t, entries)
+}
+
+func TestPrepareSharedCore(t *testing.T) {
+	coreArchiveName := "genesis_plus_gx_libretro." + buildbot.GetCoreExtension() + ".zip"
+	var coreArchive bytes.Buffer
+	zipWriter := zip.NewWriter(&coreArchive)
+	coreWriter, err := zipWriter.Create("genesis_plus_gx_libretro." + buildbot.GetCoreExtension())
+	assert.Nil(t, err)
+	coreWriter.Write([]byte("core"))
+	assert.Nil(t, zipWriter.Close())
+	var coreRequests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		if request.Method == http.MethodPost {
+			fmt.Fprintf(writer, `{"items": [{"href": "%s%s", "time": 1700000000000, "size": %d}]}`, request.URL.Path, coreArchiveName, coreArchive.Len())
+			return
+		}
+		coreRequests.Add(1)
+		http.ServeContent(writer, request, coreArchiveName, time.Now(), bytes.NewReader(coreArchive.Bytes()))
+	}))
+	t.Cleanup(server.Close)
+	basePath := t.TempDir()
+	t.Chdir(basePath)
+	database := &sqlite.SQLite{BasePath: basePath}
+	assert.Nil(t, database.Open())
+	assert.Nil(t, database.Migrate())
+	t.Cleanup(func() { database.Close() })
+	assert.Nil(t, database.StoreImported([]importer.Console{
+		{Slug: "genesis", CoreLocation: "genesis_plus_gx_libretro", Name: "Sega Genesis"},
+		{Slug: "mastersystem", CoreLocation: "genesis_plus_gx_libretro", Name: "Sega Master System"},
+	}, []importer.Game{}, nil))
+	networkEngine, err := network.NewNetworkEngine(configloader.Config{})
+	assert.Nil(t, err)
+	systemEngine, err := system.NewSystemEngine(database, networkEngine, configloader.Config{BuildbotURL: server.URL, BuildbotPlatform: "linux/x86_64"})
+	assert.Nil(t, err)
+	var waitGroup sync.WaitGroup
+	waitGroup.Add(1)
+	systemEngine.Initialize(&waitGroup)
+	waitGroup.Wait()
+
+	var progress [][2]int
+	assert.Nil(t, systemEngine.Prepare(func(completed int, total int) {
+		progress = append(progress, [2]int{completed, total})
+	}))
+	assert.Equal(t, [][2]int{{1, 1}}, progress)
+	assert.Equal(t, int32(1), coreRequests.Load())
+	console, err := database.GetConsole("mastersystem")
+	assert.Nil(t, err)
+	data, err := os.ReadFile(getTestCorePath(t, &console))
+	assert.Nil(t, err)
+	assert.Equal(t, "core", string(data))
+}
+
+func TestGetPluginTempPath(t *testing.T) {
+	systemEngine, _ := newTestSystemEngine(t)
+	genesisPath := systemEngine.GetCorePluginTempPath(&sqlite.ConsolePlugin{Id: 1, ConsoleID: "genesis"}, 0)
+	assert.NotEqual(t, genesisPath, systemEngine.GetCorePluginTempPath(&sqlite.ConsolePlugin{Id: 2, ConsoleID: "genesis"}, 0))
+	assert.NotEqual(t, genesisPath, systemEngine.GetCorePluginTempPath(&sqlite.ConsolePlugin{Id: 1, ConsoleID: "mastersystem"}, 0))
+}
@@ -0,0 +1,218 @@
+package system
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+var ErrDuplicateJob = errors.New("job already added")
+var ErrUnknownDependency = errors.New("job dependency not added")
+var ErrDependencyCycle = errors.New("job dependencies cycle")
+
+type JobStatus int
+
+const (
+	JOB_PENDING JobStatus = iota
+	JOB_COMPLETED
+	JOB_FAILED
+	// Not run as one of its dependencies failed
+	JOB_SKIPPED
+)
+
+// A preparation task of the system engine, like the download of a core
+type Job struct {
+	ID string
+	// Jobs to complete before running this one
+	Dependencies []string
+	Run          func() error
+}
+
+// The progress of the job graph run
+type JobProgress struct {
+	Completed int
+	Failed    int
+	Skipped   int
+	Total     int
+}
+
+// The number of ended jobs, completed or not
+func (progress *JobProgress) Ended() int {
+	return progress.Completed + progress.Failed + progress.Skipped
+}
+
+// The outcome of the job graph run
+type JobReport struct {
+	Statuses map[string]JobStatus
+	// Error of the last attempt of the failed jobs
+	Errors map[string]error
+}
+
+/*
+Jobs run in dependency order.
+
+Up to Concurrency jobs run at the same time, every failed job is retried Retries times,
+waiting RetryDelay more at every attempt, and the jobs depending on a failed one are
+skipped. The progress handler is called every time a job ends.
+*/
+type JobGraph struct {
+	Concurrency     int
+	Retries         int
+	RetryDelay      time.Duration
+	ProgressHandler func(progress JobProgress)
+	jobs            []Job
+	jobIndexes      map[string]int
+}
+
+type jobResult struct {
+	index int
+	err   error
+}
+
+func NewJobGraph(concurrency int, retries int) *JobGraph {
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	return &JobGraph{
+		Concurrency: concurrency,
+		Retries:     retries,
+		RetryDelay:  time.Second,
+		jobIndexes:  map[string]int{},
+	}
+}
+
+// Add the job, its dependencies could be added later
+func (graph *JobGraph) Add(job Job) error {
+	if _, ok := graph.jobIndexes[job.ID]; ok {
+		return fmt.Errorf("%w: %s", ErrDuplicateJob, job.ID)
+	}
+	graph.jobIndexes[job.ID] = len(graph.jobs)
+	graph.jobs = append(graph.jobs, job)
+	return nil
+}
+
+// Whether the job is added
+func (graph *JobGraph) Has(id string) bool {
+	_, ok := graph.jobIndexes[id]
+	return ok
+}
+
+/*
+Run the jobs, returning once all of them ended.
+
+The graph is checked before running any job, failing if a dependency is missing or the
+dependencies form a cycle. The failed jobs are reported, not returned as error.
+*/
+func (graph *JobGraph) Run() (report JobReport, err error) {
+	var dependents [][]int
+	var pendingDependencies []int
+	if dependents, pendingDependencies, err = graph.resolveDependencies(); err != nil {
+		return
+	}
+	report = JobReport{Statuses: map[string]JobStatus{}, Errors: map[string]error{}}
+	statuses := make([]JobStatus, len(graph.jobs))
+	progress := JobProgress{Total: len(graph.jobs)}
+	var ready []int
+	for index := range graph.jobs {
+		if pendingDependencies[index] == 0 {
+			ready = append(ready, index)
+		}
+	}
+	var skip func(index int)
+	skip = func(index int) {
+		for _, dependent := range dependents[index] {
+			if statuses[dependent] == JOB_PENDING {
+				statuses[dependent] = JOB_SKIPPED
+				progress.Skipped++
+				logrus.Warnf("Job %s skipped as %s did not complete", graph.jobs[dependent].ID, graph.jobs[index].ID)
+				skip(dependent)
+			}
+		}
+	}
+	results := make(chan jobResult)
+	running := 0
+	for progress.Ended() < progress.Total {
+		for running < graph.Concurrency && len(ready) > 0 {
+			go graph.runJob(ready[0], results)
+			ready = ready[1:]
+			running++
+		}
+		result := <-results
+		running--
+		if result.err != nil {
+			statuses[result.index] = JOB_FAILED
+			report.Errors[graph.jobs[result.index].ID] = result.err
+			progress.Failed++
+			skip(result.index)
+		} else {
+			statuses[result.index] = JOB_COMPLETED
+			progress.Completed++
+			for _, dependent := range dependents[result.index] {
+				if pendingDependencies[dependent]--; pendingDependencies[dependent] == 0 && statuses[dependent] == JOB_PENDING {
+					ready = append(ready, dependent)
+				}
+			}
+		}
+		if graph.ProgressHandler != nil {
+			graph.ProgressHandler(progress)
+		}
+	}
+	for index, job := range graph.jobs {
+		report.Statuses[job.ID] = statuses[index]
+	}
+	return
+}
+
+// The dependents and the dependencies count of every job, checking the graph is acyclic
+func (graph *JobGraph) resolveDependencies() (dependents [][]int, pendingDependencies []int, err error) {
+	dependents = make([][]int, len(graph.jobs))
+	pendingDependencies = make([]int, len(graph.jobs))
+	for index, job := range graph.jobs {
+		for _, dependency := range job.Dependencies {
+			dependencyIndex, ok := graph.jobIndexes[dependency]
+			if !ok {
+				return nil, nil, fmt.Errorf("%w: %s of %s", ErrUnknownDependency, dependency, job.ID)
+			}
+			dependents[dependencyIndex] = append(dependents[dependencyIndex], index)
+			pendingDependencies[index]++
+		}
+	}
+	// Every job of an acyclic graph is reached removing the jobs without dependencies
+	remainingDependencies := append([]int{}, pendingDependencies...)
+	var reachable []int
+	for index, count := range remainingDependencies {
+		if count == 0 {
+			reachable = append(reachable, index)
+		}
+	}
+	for reached := 0; reached < len(reachable); reached++ {
+		for _, dependent := range dependents[reachable[reached]] {
+			if remainingDependencies[dependent]--; remainingDependencies[dependent] == 0 {
+				reachable = append(reachable, dependent)
+			}
+		}
+	}
+	if len(reachable) < len(graph.jobs) {
+		return nil, nil, ErrDependencyCycle
+	}
+	return
+}
+
+// Run the job, retrying it until it completes or the retries are over
+func (graph *JobGraph) runJob(index int, results chan<- jobResult) {
+	job := &graph.jobs[index]
+	var err error
+	for attempt := 0; ; attempt++ {
+		if err = job.Run(); err == nil || attempt >= graph.Retries {
+			break
+		}
+		logrus.Warnf("Job %s failed, retrying: %+v", job.ID, err)
+		time.Sleep(graph.RetryDelay * time.Duration(attempt+1))
+	}
+	if err != nil {
+		logrus.Errorf("Job %s failed: %+v", job.ID, err)
+	}
+	results <- jobResult{index: index, err: err}
+}
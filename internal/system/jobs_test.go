@@ -0,0 +1,112 @@
+package system_test
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"arkhive.dev/launcher/internal/system"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestJobGraphRun(t *testing.T) {
+	var (
+		lock    sync.Mutex
+		order   []string
+		running atomic.Int32
+		peak    atomic.Int32
+	)
+	newJob := func(id string, dependencies ...string) system.Job {
+		return system.Job{ID: id, Dependencies: dependencies, Run: func() error {
+			if current := running.Add(1); current > peak.Load() {
+				peak.Store(current)
+			}
+			time.Sleep(10 * time.Millisecond)
+			running.Add(-1)
+			lock.Lock()
+			order = append(order, id)
+			lock.Unlock()
+			return nil
+		}}
+	}
+	graph := system.NewJobGraph(2, 0)
+	var progress []system.JobProgress
+	graph.ProgressHandler = func(jobProgress system.JobProgress) {
+		progress = append(progress, jobProgress)
+	}
+	// The dependencies could be added after their dependents
+	assert.Nil(t, graph.Add(newJob("plugin:snes", "core:snes")))
+	assert.Nil(t, graph.Add(newJob("core:snes", "tool:7z", "tool:retroarch")))
+	assert.Nil(t, graph.Add(newJob("core:psx", "tool:7z", "tool:retroarch")))
+	assert.Nil(t, graph.Add(newJob("tool:7z")))
+	assert.Nil(t, graph.Add(newJob("tool:retroarch")))
+	assert.ErrorIs(t, graph.Add(newJob("tool:7z")), system.ErrDuplicateJob)
+
+	report, err := graph.Run()
+	assert.Nil(t, err)
+	assert.Len(t, order, 5)
+	assert.ElementsMatch(t, []string{"tool:7z", "tool:retroarch"}, order[:2])
+	assert.Equal(t, "plugin:snes", order[4])
+	assert.LessOrEqual(t, peak.Load(), int32(2))
+	assert.Empty(t, report.Errors)
+	for _, status := range report.Statuses {
+		assert.Equal(t, system.JOB_COMPLETED, status)
+	}
+	if assert.Len(t, progress, 5) {
+		assert.Equal(t, system.JobProgress{Completed: 5, Total: 5}, progress[4])
+	}
+}
+
+func TestJobGraphRetries(t *testing.T) {
+	attempts := map[string]int{}
+	var lock sync.Mutex
+	failingJob := func(id string, failures int, dependencies ...string) system.Job {
+		return system.Job{ID: id, Dependencies: dependencies, Run: func() error {
+			lock.Lock()
+			defer lock.Unlock()
+			if attempts[id]++; attempts[id] <= failures {
+				return errors.New("download failed")
+			}
+			return nil
+		}}
+	}
+	graph := system.NewJobGraph(4, 2)
+	graph.RetryDelay = time.Millisecond
+	assert.Nil(t, graph.Add(failingJob("core:snes", 2)))
+	assert.Nil(t, graph.Add(failingJob("core:psx", 5)))
+	assert.Nil(t, graph.Add(failingJob("plugin:psx", 0, "core:psx")))
+	assert.Nil(t, graph.Add(failingJob("plugin:psx:shaders", 0, "plugin:psx")))
+
+	report, err := graph.Run()
+	assert.Nil(t, err)
+	assert.Equal(t, 3, attempts["core:snes"])
+	assert.Equal(t, 3, attempts["core:psx"])
+	assert.Equal(t, 0, attempts["plugin:psx"])
+	assert.Equal(t, map[string]system.JobStatus{
+		"core:snes":          system.JOB_COMPLETED,
+		"core:psx":           system.JOB_FAILED,
+		"plugin:psx":         system.JOB_SKIPPED,
+		"plugin:psx:shaders": system.JOB_SKIPPED,
+	}, report.Statuses)
+	assert.Len(t, report.Errors, 1)
+	assert.NotNil(t, report.Errors["core:psx"])
+}
+
+func TestJobGraphInvalid(t *testing.T) {
+	run := func() error { return nil }
+	graph := system.NewJobGraph(1, 0)
+	assert.Nil(t, graph.Add(system.Job{ID: "core:snes", Dependencies: []string{"tool:7z"}, Run: run}))
+	_, err := graph.Run()
+	assert.ErrorIs(t, err, system.ErrUnknownDependency)
+
+	assert.Nil(t, graph.Add(system.Job{ID: "tool:7z", Dependencies: []string{"plugin:snes"}, Run: run}))
+	assert.Nil(t, graph.Add(system.Job{ID: "plugin:snes", Dependencies: []string{"core:snes"}, Run: run}))
+	_, err = graph.Run()
+	assert.ErrorIs(t, err, system.ErrDependencyCycle)
+
+	report, err := system.NewJobGraph(1, 0).Run()
+	assert.Nil(t, err)
+	assert.Empty(t, report.Statuses)
+}
@@ -2,413 +2,434 @@ package system
 
 import (
 	"bufio"
-	"bytes"
-	"encoding/json"
-	"io"
+	"fmt"
 	"io/fs"
-	"net/http"
 	"net/url"
 	"os"
-	"os/exec"
 	"path"
 	"path/filepath"
 	"runtime"
 	"strconv"
-	"strings"
 	"sync"
 
+	"arkhive.dev/launcher/internal/archive"
 	"arkhive.dev/launcher/internal/buildbot"
-	"arkhive.dev/launcher/internal/database"
+	"arkhive.dev/launcher/internal/configloader"
+	"arkhive.dev/launcher/internal/database/delegate/sqlite"
 	"arkhive.dev/launcher/internal/folder"
 	"arkhive.dev/launcher/internal/network"
 	"arkhive.dev/launcher/internal/network/resources"
-	"arkhive.dev/launcher/internal/osconstants"
+	"arkhive.dev/launcher/internal/plugins"
 	"arkhive.dev/launcher/internal/undertow"
 	"github.com/BurntSushi/toml"
 	"github.com/sirupsen/logrus"
 )
 
 type ConsoleEntryDownload struct {
-	ConsoleEntry *console.Console
+	ConsoleEntry *sqlite.Console
 	URL          url.URL
+	Build        sqlite.CoreBuild
+	// Consoles sharing the core, the console entry included, whose plugins are prepared after it
+	Consoles []*sqlite.Console
 }
 
 type SystemEngine struct {
-	databaseEngine       database.DatabaseEngine
-	networkEngine        network.NetworkEngine
-	settings             map[string]interface{}
-	preparingConsoleList []ConsoleEntryDownload
-	preparingToolsList   []Tool
-	preparingPluginsList []ConsolePlugin
-	extractingExtensions []string
-}
-
-func NewSystemEngine() (instance *SystemEngine, err error) {
+	basePath       string
+	databaseEngine *sqlite.SQLite
+	networkEngine  *network.NetworkEngine
+	buildbotClient *buildbot.Client
+	platform       buildbot.Platform
+	// Whether the cores are available for the platform, the cores and their plugins being prepared
+	coresEnabled bool
+	settings     map[string]interface{}
+	// Preparation jobs run at the same time and retries of the failed ones
+	concurrency int
+	retries     int
+	// Maximum extracted size of the core, plugin and tool archives in bytes, 0 for unlimited
+	extractionSizeLimit int64
+}
+
+func NewSystemEngine(databaseEngine *sqlite.SQLite, networkEngine *network.NetworkEngine, configuration configloader.Config) (instance *SystemEngine, err error) {
+	platform, platformErr := buildbot.DetectPlatform(configuration.BuildbotPlatform)
+	if platformErr != nil {
+		logrus.Error("Cannot detect the buildbot platform, the cores will not be prepared")
+		logrus.Errorf("%+v", platformErr)
+	}
+	var buildbotClient *buildbot.Client
+	if buildbotClient, err = buildbot.NewClient(configuration.BuildbotURL, networkEngine.HTTPClient(), filepath.Join(configuration.BasePath, folder.SYSTEM, buildbot.INDEX_CACHE_FILE)); err != nil {
+		return
+	}
 	instance = &SystemEngine{
-		extractingExtensions: []string{"zip", "rar", "7z"},
+		basePath:            configuration.BasePath,
+		databaseEngine:      databaseEngine,
+		networkEngine:       networkEngine,
+		buildbotClient:      buildbotClient,
+		platform:            platform,
+		coresEnabled:        platformErr == nil,
+		concurrency:         configuration.PreparationConcurrency,
+		retries:             configuration.PreparationRetries,
+		extractionSizeLimit: configuration.ExtractionSizeLimit * 1024 * 1024,
 	}
 	return
 }
 
 func (systemEngine *SystemEngine) Initialize(waitGroup *sync.WaitGroup) {
-	if _, err := os.Stat(folder.SYSTEM); os.IsNotExist(err) {
-		if err = os.Mkdir(folder.SYSTEM, 0755); err != nil {
-			panic(err)
-		}
-	}
-	if _, err := os.Stat(folder.CORES); os.IsNotExist(err) {
-		if err = os.Mkdir(folder.CORES, 0755); err != nil {
-			panic(err)
-		}
-	}
-	if _, err := os.Stat(folder.TOOLS); os.IsNotExist(err) {
-		if err = os.Mkdir(folder.CORES, 0755); err != nil {
-			panic(err)
-		}
-	}
-	if _, err := os.Stat(folder.TEMP); os.IsNotExist(err) {
-		if err = os.Mkdir(folder.TEMP, 0755); err != nil {
+	defer waitGroup.Done()
+	for _, folderName := range []string{folder.SYSTEM, folder.CORES, folder.TOOLS, folder.TEMP} {
+		if err := os.MkdirAll(filepath.Join(systemEngine.basePath, folderName), 0755); err != nil {
 			panic(err)
 		}
 	}
 }
 
-func (systemEngine *SystemEngine) startEngine(_ bool) (err error) {
+/*
+Prepare the tools, the cores and their plugins, notifying the progress of the jobs.
+
+The tools are prepared first, then the outdated cores followed by their console
+plugins. The jobs failing after their retries are logged and don't stop the others.
+The missing and mismatched BIOS files are logged once the jobs ended.
+*/
+func (systemEngine *SystemEngine) Prepare(progressHandler func(completed int, total int)) (err error) {
 	systemEngine.settings = make(map[string]interface{})
 	systemEngine.syncSettings()
 
-	if _, err := os.Stat(GetDefaultConfigPath()); os.IsNotExist(err) {
+	if _, err := os.Stat(filepath.Join(systemEngine.basePath, GetDefaultConfigPath())); os.IsNotExist(err) {
 		systemEngine.setDefaultConfiguration()
 	}
 	systemEngine.setFixedConfiguration()
 
-	//systemEngine.ToolsPreparedEventEmitter.Subscribe(systemEngine.prepareLaunchers)
-	err = systemEngine.prepareTools()
-
-	return err
+	graph := NewJobGraph(systemEngine.concurrency, systemEngine.retries)
+	if progressHandler != nil {
+		graph.ProgressHandler = func(progress JobProgress) {
+			progressHandler(progress.Ended(), progress.Total)
+		}
+	}
+	var toolJobs []string
+	if toolJobs, err = systemEngine.addToolJobs(graph); err != nil {
+		return
+	}
+	queuedConsoles := map[string]bool{}
+	if systemEngine.coresEnabled {
+		if queuedConsoles, err = systemEngine.addCoreJobs(graph, toolJobs); err != nil {
+			return
+		}
+	}
+	if err = systemEngine.addBiosPluginJobs(graph, toolJobs, queuedConsoles); err != nil {
+		return
+	}
+	var report JobReport
+	if report, err = graph.Run(); err != nil {
+		return
+	}
+	if len(report.Errors) > 0 {
+		logrus.Warnf("System prepared, %d jobs failed", len(report.Errors))
+	} else {
+		logrus.Info("System prepared")
+	}
+	systemEngine.logBiosReports()
+	return
 }
 
+// The RetroArch configuration path, relative to the base path
 func GetDefaultConfigPath() string {
 	return filepath.Join(folder.SYSTEM, "system.cfg")
 }
 
-func (systemEngine *SystemEngine) prepareLaunchers(_ bool) {
-	requestURL := url.URL{
-		Scheme: buildbot.BUILDBOT_URL_SCHEME,
-		Host:   buildbot.BUILDBOT_URL_HOST,
-		Path:   buildbot.BUILDBOT_UPDATE_URL_PATH,
-	}
+func getToolJobID(toolEntry *sqlite.Tool) string {
+	return "tool:" + toolEntry.Slug
+}
+
+func getCoreJobID(consoleEntry *sqlite.Console) string {
+	return "core:" + consoleEntry.CoreLocation
+}
 
-	requestObject := make(map[string]interface{})
-	requestObject["action"] = "get"
-	requestObject["items"] = make(map[string]interface{})
-	requestObject["items"].(map[string]interface{})["href"] = requestURL.Path
-	requestObject["items"].(map[string]interface{})["what"] = 1
+func getPluginJobID(consolePlugin *sqlite.ConsolePlugin) string {
+	return "plugin:" + consolePlugin.ConsoleID + ":" + strconv.FormatUint(uint64(consolePlugin.Id), 10)
+}
 
-	var (
-		requestObjectBytes []byte
-		err                error
-	)
-	if requestObjectBytes, err = json.Marshal(requestObject); err != nil {
+// Add the jobs of the missing and outdated tools, returning their IDs
+func (systemEngine *SystemEngine) addToolJobs(graph *JobGraph) (jobs []string, err error) {
+	var tools []sqlite.Tool
+	if tools, err = systemEngine.databaseEngine.GetTools(); err != nil {
+		logrus.Error("Cannot get tools from database")
+		logrus.Errorf("%+v", err)
 		return
 	}
-	go func() {
-		var (
-			response *http.Response
-			err      error
-		)
-		if response, err = http.Post(requestURL.String(), "application/json", bytes.NewReader(requestObjectBytes)); err != nil {
-			logrus.Error("Buildbot request failed")
-			logrus.Errorf("%+v", err)
+	for toolIndex := range tools {
+		toolEntry := &tools[toolIndex]
+		remoteInfo, remoteErr := systemEngine.getToolRemoteInfo(toolEntry)
+		if systemEngine.toolIsDownloaded(toolEntry) {
+			if remoteErr != nil {
+				logrus.Warnf("%s: Cannot check the tool updates: %+v", toolEntry.Slug, remoteErr)
+			}
+			if systemEngine.toolIsUpdated(toolEntry, remoteInfo) {
+				continue
+			}
+		}
+		job := Job{
+			ID:  getToolJobID(toolEntry),
+			Run: func() error { return systemEngine.prepareTool(toolEntry, remoteInfo) },
+		}
+		if err = graph.Add(job); err != nil {
 			return
 		}
-		systemEngine.collectRetroArchCoresInfoFinished(response.Body)
-	}()
+		jobs = append(jobs, job.ID)
+	}
+	return
 }
 
-func (systemEngine *SystemEngine) prepareTools() (err error) {
-	var tools []tool.Tool
-	if tools, err = systemEngine.databaseEngine.GetTools(); err != nil {
-		logrus.Error("Cannot get tools from database")
-		logrus.Errorf("%+v", err)
+// Add the jobs of the missing and outdated cores, after the tools, and of their plugins, returning the queued consoles
+func (systemEngine *SystemEngine) addCoreJobs(graph *JobGraph, toolJobs []string) (queuedConsoles map[string]bool, err error) {
+	queuedConsoles = map[string]bool{}
+	var consoleEntryDownloads []ConsoleEntryDownload
+	if consoleEntryDownloads, err = systemEngine.collectRetroArchCoresInfo(); err != nil {
 		return
 	}
-	for _, toolEntry := range tools {
-		if !systemEngine.toolIsDownloaded(&toolEntry) || !systemEngine.toolIsUpdated(&toolEntry) {
-			systemEngine.preparingToolsList = append(
-				systemEngine.preparingToolsList, toolEntry)
+	for downloadIndex := range consoleEntryDownloads {
+		consoleEntryDownload := &consoleEntryDownloads[downloadIndex]
+		coreJob := Job{
+			ID:           getCoreJobID(consoleEntryDownload.ConsoleEntry),
+			Dependencies: toolJobs,
+			Run:          func() error { return systemEngine.prepareCore(consoleEntryDownload) },
+		}
+		if err = graph.Add(coreJob); err != nil {
+			return
+		}
+		for _, consoleEntry := range consoleEntryDownload.Consoles {
+			if err = systemEngine.addPluginJobs(graph, consoleEntry, []string{coreJob.ID}, false); err != nil {
+				return
+			}
+			queuedConsoles[consoleEntry.Slug] = true
 		}
 	}
-	//systemEngine.ToolElaborationCompletedEventEmitter.Subscribe(systemEngine.prepareNextTool)
-	systemEngine.prepareNextTool(true)
 	return
 }
 
-func (systemEngine *SystemEngine) collectRetroArchCoresInfoFinished(reader io.Reader) {
-	buffer := &bytes.Buffer{}
-	if _, err := buffer.ReadFrom(reader); err != nil {
-		logrus.Error("Buildbot request failed")
+/*
+Add the jobs of the verified plugins of the consoles missing required BIOS files, after
+the tools, skipping the consoles already queued.
+*/
+func (systemEngine *SystemEngine) addBiosPluginJobs(graph *JobGraph, toolJobs []string, queuedConsoles map[string]bool) (err error) {
+	var consoles []sqlite.Console
+	if consoles, err = systemEngine.databaseEngine.GetConsoles(); err != nil {
+		logrus.Error("Cannot get consoles from database")
 		logrus.Errorf("%+v", err)
 		return
 	}
+	for consoleIndex := range consoles {
+		consoleEntry := &consoles[consoleIndex]
+		if queuedConsoles[consoleEntry.Slug] {
+			continue
+		}
+		var report BiosReport
+		if report, err = CheckBios(systemEngine.databaseEngine, systemEngine.getSystemPath(), consoleEntry); err != nil {
+			return
+		}
+		if report.IsComplete() {
+			continue
+		}
+		if err = systemEngine.addPluginJobs(graph, consoleEntry, toolJobs, true); err != nil {
+			return
+		}
+	}
+	return
+}
 
-	decoder := json.NewDecoder(bytes.NewReader(buffer.Bytes()))
-	decoder.UseNumber()
-	remoteInfo := make(map[string]interface{})
-	if err := decoder.Decode(&remoteInfo); err != nil {
-		logrus.Error("Buildbot JSON parsing error")
+// Add the jobs of the console plugins, only of the verified ones if requested
+func (systemEngine *SystemEngine) addPluginJobs(graph *JobGraph, consoleEntry *sqlite.Console, dependencies []string, onlyVerified bool) (err error) {
+	var consolePlugins []sqlite.ConsolePlugin
+	if consolePlugins, err = systemEngine.databaseEngine.GetConsolePluginsByConsole(consoleEntry); err != nil {
+		logrus.Error("Cannot get console plugins from database")
 		logrus.Errorf("%+v", err)
 		return
 	}
+	for pluginIndex := range consolePlugins {
+		consolePlugin := &consolePlugins[pluginIndex]
+		if onlyVerified {
+			if pluginType, typeErr := plugins.Get(consolePlugin.Type); typeErr != nil || !pluginType.Verified {
+				continue
+			}
+		}
+		if err = graph.Add(Job{
+			ID:           getPluginJobID(consolePlugin),
+			Dependencies: dependencies,
+			Run:          func() error { return systemEngine.preparePlugin(consolePlugin) },
+		}); err != nil {
+			return
+		}
+	}
+	return
+}
 
-	var (
-		consoles []console.Console
-		err      error
-	)
+// List the cores to download, reading the buildbot folder of every pinned core version
+func (systemEngine *SystemEngine) collectRetroArchCoresInfo() (consoleEntryDownloads []ConsoleEntryDownload, err error) {
+	var consoles []sqlite.Console
 	if consoles, err = systemEngine.databaseEngine.GetConsoles(); err != nil {
 		logrus.Error("Cannot get consoles from database")
 		logrus.Errorf("%+v", err)
 		return
 	}
+	indexes := map[string]*buildbot.Index{}
+	// Index of the download of every core location, downloaded once for the consoles sharing it
+	downloadIndexes := map[string]int{}
 	for consoleEntryIndex, consoleEntry := range consoles {
-		if !systemEngine.coreIsDownloaded(&consoleEntry) || !systemEngine.coreIsUpdated(&consoleEntry) {
-			for _, item := range remoteInfo["items"].([]interface{}) {
-				href := item.(map[string]interface{})["href"].(string)
-				suffix := consoleEntry.CoreLocation + "." + osconstants.CORES_EXTENSION + ".zip"
-				if strings.HasSuffix(href, suffix) {
-					systemEngine.preparingConsoleList = append(
-						systemEngine.preparingConsoleList,
-						ConsoleEntryDownload{
-							ConsoleEntry: &consoles[consoleEntryIndex],
-							URL: url.URL{
-								Scheme: buildbot.BUILDBOT_URL_SCHEME,
-								Host:   buildbot.BUILDBOT_URL_HOST,
-								Path:   href,
-							},
-						})
-					break
-				}
+		if downloadIndex, ok := downloadIndexes[consoleEntry.CoreLocation]; ok {
+			consoleEntryDownload := &consoleEntryDownloads[downloadIndex]
+			if consoleEntry.CoreVersion.String != consoleEntryDownload.ConsoleEntry.CoreVersion.String {
+				logrus.Warnf("Core %s pinned to different versions, the %s console one is kept", consoleEntry.CoreLocation, consoleEntryDownload.ConsoleEntry.Slug)
+			}
+			consoleEntryDownload.Consoles = append(consoleEntryDownload.Consoles, &consoles[consoleEntryIndex])
+			continue
+		}
+		indexPath := systemEngine.GetCoreIndexPath(&consoleEntry)
+		index, ok := indexes[indexPath]
+		if !ok {
+			if fetchedIndex, indexErr := systemEngine.buildbotClient.GetIndex(indexPath); indexErr != nil {
+				logrus.Error("Buildbot request failed")
+				logrus.Errorf("%+v", indexErr)
+			} else {
+				index = &fetchedIndex
 			}
+			indexes[indexPath] = index
 		}
-	}
-
-	//systemEngine.CoreElaborationCompletedEventEmitter.Subscribe(func(_ bool) {
-	//	systemEngine.getPlugins(systemEngine.preparingConsoleList[0].ConsoleEntry)
-	//})
-	//systemEngine.PluginElaborationCompletedEventEmitter.Subscribe(systemEngine.prepareNextPlugin)
-	//systemEngine.PluginsElaborationCompletedEventEmitter.Subscribe(systemEngine.prepareNextCore)
-	systemEngine.prepareNextCore(true)
-}
-
-func (systemEngine *SystemEngine) prepareNextCore(first bool) {
-	if len(systemEngine.preparingConsoleList) > 0 {
-		if !first {
-			systemEngine.preparingConsoleList = systemEngine.preparingConsoleList[1:]
+		if index == nil {
+			continue
 		}
-		if len(systemEngine.preparingConsoleList) > 0 {
-			systemEngine.getCore(&systemEngine.preparingConsoleList[0])
-			return
+		item, ok := index.Find(systemEngine.GetCoreArchiveName(&consoleEntry))
+		if !ok {
+			logrus.Warnf("Core %s not available on the buildbot", consoleEntry.CoreLocation)
+			continue
+		}
+		if !systemEngine.coreIsDownloaded(&consoleEntry) || !systemEngine.coreIsUpdated(&consoleEntry, &item) {
+			downloadIndexes[consoleEntry.CoreLocation] = len(consoleEntryDownloads)
+			consoleEntryDownloads = append(
+				consoleEntryDownloads,
+				ConsoleEntryDownload{
+					ConsoleEntry: &consoles[consoleEntryIndex],
+					URL:          systemEngine.buildbotClient.GetURL(&item),
+					Build:        getCoreBuild(&consoleEntry, &item),
+					Consoles:     []*sqlite.Console{&consoles[consoleEntryIndex]},
+				})
 		}
-	} else {
-		//systemEngine.BootedEventEmitter.Emit(true)
 	}
+	return
 }
 
-func (systemEngine *SystemEngine) prepareNextPlugin(first bool) {
-	if len(systemEngine.preparingPluginsList) > 0 {
-		if !first {
-			systemEngine.preparingPluginsList = systemEngine.preparingPluginsList[1:]
-		}
-		if len(systemEngine.preparingPluginsList) > 0 {
-			systemEngine.getPlugin(&systemEngine.preparingPluginsList[0])
-			return
-		}
+// Download the resource in background to the folder, waiting for its end
+func (systemEngine *SystemEngine) download(resourceURL *url.URL, destinationPath string) (err error) {
+	var resource *resources.Resource
+	if resource, err = systemEngine.networkEngine.AddLowPriorityResource(resourceURL, destinationPath); err != nil {
+		logrus.Error("Cannot add the download resource to the network engine")
+		return
 	}
-	//systemEngine.PluginsElaborationCompletedEventEmitter.Emit(false)
-}
-
-func (systemEngine *SystemEngine) getCore(consoleEntryDownload *ConsoleEntryDownload) {
-	if !systemEngine.coreIsDownloaded(consoleEntryDownload.ConsoleEntry) ||
-		!systemEngine.coreIsUpdated(consoleEntryDownload.ConsoleEntry) {
-		//var (
-		//	err error
-		//)
-		//var resource *resources.Resource
-		//if resource, err = systemEngine.networkEngine.AddResource(&consoleEntryDownload.URL, folder.TEMP); err != nil {
-		//	logrus.Error("Cannot add the download resource to the network engine")
-		//	logrus.Errorf("%+v", err)
-		//	return
-		//}
-		//resource.AvailableEventEmitter.Subscribe(func(_ *resources.Resource) {
-		//	systemEngine.saveCoreFile(consoleEntryDownload.ConsoleEntry)
-		//})
-		//resource.ProgressUpdatedEventEmitter.Subscribe(func(resource *resources.Resource) {
-		//	url := resource.Handler.GetURL()
-		//	logrus.Debugf("%s: Core download progress %d/%d (%d%%)", url.String(), resource.Available, resource.Total, resource.Available*100/resource.Total)
-		//})
-	} else {
-		//systemEngine.CoreElaborationCompletedEventEmitter.Emit(true)
+	if status := resource.Wait(); status != resources.DOWNLOADED {
+		return fmt.Errorf("%s: download ended with status %d", resourceURL.String(), status)
 	}
+	return
 }
 
-func (systemEngine *SystemEngine) getPlugins(consoleEntry *console.Console) {
-	var err error
-	if systemEngine.preparingPluginsList, err = systemEngine.databaseEngine.GetConsolePluginsByConsole(consoleEntry); err != nil {
-		logrus.Error("Cannot get console plugins from database")
-		logrus.Errorf("%+v", err)
+func (systemEngine *SystemEngine) prepareCore(consoleEntryDownload *ConsoleEntryDownload) (err error) {
+	if err = systemEngine.download(&consoleEntryDownload.URL, filepath.Join(systemEngine.basePath, folder.TEMP)); err != nil {
 		return
 	}
-	systemEngine.prepareNextPlugin(true)
+	return systemEngine.saveCoreFile(consoleEntryDownload)
 }
 
-func (systemEngine *SystemEngine) getPlugin(consolePlugin *console.ConsolePlugin) {
-	if consolePlugin.Type == "bios" {
-		var (
-			err                 error
-			consolePluginsFiles []console.ConsolePluginsFile
-		)
-		if consolePluginsFiles, err = systemEngine.databaseEngine.GetConsolePluginsFilesByConsolePlugin(consolePlugin); err != nil {
-			logrus.Error("Cannot get console plugins files from database")
-			logrus.Errorf("%+v", err)
+func (systemEngine *SystemEngine) preparePlugin(consolePlugin *sqlite.ConsolePlugin) (err error) {
+	if _, err = plugins.Get(consolePlugin.Type); err != nil {
+		return
+	}
+	var consolePluginsFiles []sqlite.ConsolePluginsFile
+	if consolePluginsFiles, err = systemEngine.databaseEngine.GetConsolePluginsFilesByConsolePlugin(consolePlugin); err != nil {
+		logrus.Error("Cannot get console plugins files from database")
+		return
+	}
+	if len(consolePluginsFiles) == 0 {
+		logrus.Warnf("No files for console plugin in %s console", consolePlugin.ConsoleID)
+		return
+	}
+	for consolePluginsFileIndex := range consolePluginsFiles {
+		consolePluginsFile := &consolePluginsFiles[consolePluginsFileIndex]
+		var consolePluginFileUrl *url.URL
+		if consolePluginFileUrl, err = url.Parse(consolePluginsFile.Url); err != nil {
 			return
 		}
-		//for consolePluginsFileIndex, consolePluginsFile := range consolePluginsFiles {
-		//var consolePluginFileUrl *url.URL
-		//if consolePluginFileUrl, err = url.Parse(consolePluginsFile.Url); err != nil {
-		//	logrus.Error("Cannot parse tool URL")
-		//	logrus.Errorf("%+v", err)
-		//	return
-		//}
-		//var resource *resources.Resource
-		//if resource, err = systemEngine.networkEngine.AddResource(
-		//	consolePluginFileUrl,
-		//	path.Dir(
-		//		GetDownloadCorePluginPath(consolePlugin, &consolePluginsFile))); err != nil {
-		//	logrus.Error("Cannot add the download resource to the network engine")
-		//	logrus.Errorf("%+v", err)
-		//	return
-		//}
-		//currentConsolePluginFileIndex := consolePluginsFileIndex
-		//resource.AvailableEventEmitter.Subscribe(func(_ *resources.Resource) {
-		//	systemEngine.savePluginFile(consolePlugin, &consolePluginsFiles[currentConsolePluginFileIndex], currentConsolePluginFileIndex)
-		//})
-		//resource.ProgressUpdatedEventEmitter.Subscribe(func(resource *resources.Resource) {
-		//	url := resource.Handler.GetURL()
-		//	logrus.Debugf("%s: Console plugin file download progress %d/%d (%d%%)", url.String(), resource.Available, resource.Total, resource.Available*100/resource.Total)
-		//})
-		//}
-		if len(consolePluginsFiles) == 0 {
-			var console console.Console
-			if console, err = systemEngine.databaseEngine.GetConsoleByConsolePlugin(consolePlugin); err != nil {
-				return
-			}
-			logrus.Warnf("No files for console plugin in %s console", console.Slug)
-			//systemEngine.PluginElaborationCompletedEventEmitter.Emit(false)
+		if err = systemEngine.download(consolePluginFileUrl, path.Dir(systemEngine.GetDownloadCorePluginPath(consolePlugin, consolePluginsFile))); err != nil {
+			return
 		}
-	} else {
-		panic("console plugin type not handled")
-	}
-}
-
-func (systemEngine *SystemEngine) getTool(toolEntry *tool.Tool) {
-	//var (
-	//	toolUrl *url.URL
-	//	err     error
-	//)
-	//if toolUrl, err = url.Parse(toolEntry.Url); err != nil {
-	//	logrus.Error("Cannot parse tool URL")
-	//	logrus.Errorf("%+v", err)
-	//	return
-	//}
-	//var resource *resources.Resource
-	//if resource, err = systemEngine.networkEngine.AddResource(toolUrl, folder.TEMP); err != nil {
-	//	logrus.Error("Cannot add the download resource to the network engine")
-	//	logrus.Errorf("%+v", err)
-	//	return
-	//}
-	//resource.AvailableEventEmitter.Subscribe(func(_ *resources.Resource) {
-	//	systemEngine.saveToolFile(toolEntry)
-	//})
-	//resource.ProgressUpdatedEventEmitter.Subscribe(func(resource *resources.Resource) {
-	//	url := resource.Handler.GetURL()
-	//	logrus.Debugf("%s: Tool download progress %d/%d (%d%%)", url.String(), resource.Available, resource.Total, resource.Available*100/resource.Total)
-	//})
-}
-
-func (systemEngine *SystemEngine) prepareNextTool(first bool) {
-	if len(systemEngine.preparingToolsList) > 0 {
-		if !first {
-			systemEngine.preparingToolsList = systemEngine.preparingToolsList[1:]
-		}
-		if len(systemEngine.preparingToolsList) > 0 {
-			systemEngine.getTool(&systemEngine.preparingToolsList[0])
+		if err = systemEngine.savePluginFile(consolePlugin, consolePluginsFile, consolePluginsFileIndex); err != nil {
 			return
 		}
 	}
-	//systemEngine.ToolsPreparedEventEmitter.Emit(true)
+	return systemEngine.verifyPluginBios(consolePlugin)
 }
 
-func (systemEngine *SystemEngine) saveCoreFile(consoleEntry *console.Console) {
-	logrus.Infof("Core %s downloaded", consoleEntry.Slug)
-	if err := systemEngine.extractCoreArchive(consoleEntry); err != nil {
+func (systemEngine *SystemEngine) prepareTool(toolEntry *sqlite.Tool, remoteInfo *toolRemoteInfo) (err error) {
+	var toolUrl *url.URL
+	if toolUrl, err = url.Parse(toolEntry.Url); err != nil {
 		return
 	}
-	if err := systemEngine.elaborateCoreArchive(consoleEntry); err != nil {
+	if err = systemEngine.download(toolUrl, filepath.Join(systemEngine.basePath, folder.TEMP)); err != nil {
 		return
 	}
-	logrus.Infof("Core %s completed", consoleEntry.Slug)
-	//systemEngine.CoreElaborationCompletedEventEmitter.Emit(true)
+	return systemEngine.saveToolFile(toolEntry, remoteInfo)
 }
 
-func (systemEngine *SystemEngine) savePluginFile(consolePlugin *console.ConsolePlugin, consolePluginsFile *console.ConsolePluginsFile, consolePluginsFileIndex int) {
-	var (
-		err     error
-		console console.Console
-	)
-	if console, err = systemEngine.databaseEngine.GetConsoleByConsolePlugin(consolePlugin); err != nil {
+func (systemEngine *SystemEngine) saveCoreFile(consoleEntryDownload *ConsoleEntryDownload) (err error) {
+	consoleEntry := consoleEntryDownload.ConsoleEntry
+	logrus.Infof("Core %s downloaded", consoleEntry.Slug)
+	if err = systemEngine.extractCoreArchive(consoleEntry); err != nil {
+		return
+	}
+	if err = systemEngine.elaborateCoreArchive(consoleEntryDownload); err != nil {
+		logrus.Error("Error installing the core")
 		return
 	}
-	logrus.Infof("Console plugin file for %s downloaded", console.Slug)
+	logrus.Infof("Core %s completed", consoleEntry.Slug)
+	return
+}
+
+func (systemEngine *SystemEngine) savePluginFile(consolePlugin *sqlite.ConsolePlugin, consolePluginsFile *sqlite.ConsolePluginsFile, consolePluginsFileIndex int) (err error) {
+	logrus.Infof("Console plugin file for %s downloaded", consolePlugin.ConsoleID)
 	if err = systemEngine.extractPluginArchive(consolePlugin, consolePluginsFile, consolePluginsFileIndex); err != nil {
 		return
 	}
 	if err = systemEngine.elaboratePluginArchive(consolePlugin, consolePluginsFile, consolePluginsFileIndex); err != nil {
 		return
 	}
-	logrus.Infof("Console plugin file for %s completed", console.Slug)
-	//systemEngine.PluginElaborationCompletedEventEmitter.Emit(false)
+	logrus.Infof("Console plugin file for %s completed", consolePlugin.ConsoleID)
+	return
 }
 
-func (systemEngine *SystemEngine) saveToolFile(toolEntry *tool.Tool) {
-	logrus.Info("Tool %s downloaded", toolEntry.Slug)
-	if err := systemEngine.extractToolArchive(toolEntry); err != nil {
+func (systemEngine *SystemEngine) saveToolFile(toolEntry *sqlite.Tool, remoteInfo *toolRemoteInfo) (err error) {
+	logrus.Infof("Tool %s downloaded", toolEntry.Slug)
+	if recordErr := systemEngine.recordInstalledTool(toolEntry, remoteInfo); recordErr != nil {
+		logrus.Error("Cannot record the installed tool")
+		logrus.Errorf("%+v", recordErr)
+	}
+	if err = systemEngine.extractToolArchive(toolEntry); err != nil {
 		return
 	}
-	if err := systemEngine.elaborateToolArchive(toolEntry); err != nil {
+	if err = systemEngine.elaborateToolArchive(toolEntry); err != nil {
 		return
 	}
-	logrus.Info("Tool %s completed", toolEntry.Slug)
-	//systemEngine.ToolElaborationCompletedEventEmitter.Emit(false)
+	logrus.Infof("Tool %s completed", toolEntry.Slug)
+	return
 }
 
-func (systemEngine *SystemEngine) coreIsDownloaded(consoleEntry *console.Console) bool {
-	coreLocation := consoleEntry.CoreLocation + "." + osconstants.CORES_EXTENSION
-	if _, err := os.Stat(filepath.Join(folder.CORES, coreLocation)); os.IsNotExist(err) {
+func (systemEngine *SystemEngine) coreIsDownloaded(consoleEntry *sqlite.Console) bool {
+	if _, err := os.Stat(filepath.Join(systemEngine.basePath, GetCorePath(consoleEntry, &systemEngine.platform))); os.IsNotExist(err) {
 		return false
 	}
 	return true
 }
 
-func (systemEngine *SystemEngine) coreIsUpdated(_ *console.Console) bool {
-	return true
-}
-
-func (systemEngine *SystemEngine) toolIsDownloaded(toolEntry *tool.Tool) bool {
+func (systemEngine *SystemEngine) toolIsDownloaded(toolEntry *sqlite.Tool) bool {
 	var toolLocation string
 	if toolEntry.Destination.Valid && toolEntry.Destination.String != "" {
-		toolLocation = filepath.Join(folder.TOOLS, toolEntry.Destination.String)
+		toolLocation = filepath.Join(systemEngine.basePath, folder.TOOLS, toolEntry.Destination.String)
 	} else if toolEntry.CollectionPath.Valid && toolEntry.CollectionPath.String != "" {
-		toolLocation = filepath.Join(folder.TOOLS, filepath.Base(toolEntry.CollectionPath.String))
+		toolLocation = filepath.Join(systemEngine.basePath, folder.TOOLS, filepath.Base(toolEntry.CollectionPath.String))
 	} else {
 		var (
 			toolUrl *url.URL
@@ -417,7 +438,7 @@ func (systemEngine *SystemEngine) toolIsDownloaded(toolEntry *tool.Tool) bool {
 		if toolUrl, err = url.Parse(toolEntry.Url); err != nil {
 			return false
 		}
-		toolLocation = filepath.Join(folder.TOOLS, filepath.Base(toolUrl.Path))
+		toolLocation = filepath.Join(systemEngine.basePath, folder.TOOLS, filepath.Base(toolUrl.Path))
 	}
 	if _, err := os.Stat(toolLocation); os.IsNotExist(err) {
 		return false
@@ -425,158 +446,133 @@ func (systemEngine *SystemEngine) toolIsDownloaded(toolEntry *tool.Tool) bool {
 	return true
 }
 
-func (systemEngine *SystemEngine) toolIsUpdated(_ *tool.Tool) bool {
-	return true
-}
-
-func (systemEngine *SystemEngine) extractCoreArchive(consoleEntry *console.Console) error {
-	process := exec.Command(
-		osconstants.SEVENZ_EXE_PATH,
-		"x",
-		GetDownloadCorePath(consoleEntry),
-		"-o"+GetCoreTempPath(consoleEntry))
-	if err := process.Run(); err != nil {
-		logrus.Error("Error starting the extraction process")
+func (systemEngine *SystemEngine) extractCoreArchive(consoleEntry *sqlite.Console) error {
+	if err := systemEngine.extractArchive(systemEngine.GetDownloadCorePath(consoleEntry), systemEngine.GetCoreTempPath(consoleEntry), ""); err != nil {
+		logrus.Error("Error extracting the core archive")
 		logrus.Errorf("%+v", err)
 		return err
 	}
 	return nil
 }
 
-func (systemEngine *SystemEngine) elaborateCoreArchive(consoleEntry *console.Console) (err error) {
-	coreTempPath := GetCoreTempPath(consoleEntry)
+func (systemEngine *SystemEngine) elaborateCoreArchive(consoleEntryDownload *ConsoleEntryDownload) (err error) {
+	consoleEntry := consoleEntryDownload.ConsoleEntry
+	coreTempPath := systemEngine.GetCoreTempPath(consoleEntry)
+	var coreFilePath string
 	filepath.Walk(coreTempPath, func(filePath string, info fs.FileInfo, err error) error {
-		if path.Ext(info.Name()) != "" && path.Ext(info.Name())[1:] == osconstants.CORES_EXTENSION {
-			os.Rename(filePath, GetCorePath(consoleEntry))
+		if err == nil && path.Ext(info.Name()) != "" && path.Ext(info.Name())[1:] == systemEngine.platform.CoreExtension {
+			coreFilePath = filePath
 		}
 		return nil
 	})
-	os.Remove(GetDownloadCorePath(consoleEntry))
+	if coreFilePath == "" {
+		err = fmt.Errorf("core %s not found in the archive", consoleEntry.CoreLocation)
+	} else {
+		err = systemEngine.InstallCore(consoleEntry, consoleEntryDownload.Build, coreFilePath)
+	}
+	os.Remove(systemEngine.GetDownloadCorePath(consoleEntry))
 	os.RemoveAll(coreTempPath)
 	return
 }
 
-func (systemEngine *SystemEngine) extractPluginArchive(consolePlugin *console.ConsolePlugin, consolePluginsFiles *console.ConsolePluginsFile, consolePluginsFileIndex int) error {
-	if consolePlugin.Type == "bios" {
-		consolePluginFilePath := GetDownloadCorePluginPath(consolePlugin, consolePluginsFiles)
-		isExtractingExtension := false
-		for _, item := range systemEngine.extractingExtensions {
-			if item == path.Ext(consolePluginFilePath)[1:] {
-				isExtractingExtension = true
-				break
-			}
-		}
-		if !isExtractingExtension {
-			return nil
-		}
-		process := exec.Command(
-			osconstants.SEVENZ_EXE_PATH,
-			"x",
-			GetDownloadCorePluginPath(consolePlugin, consolePluginsFiles),
-			"-o"+GetCorePluginTempPath(consolePlugin, consolePluginsFileIndex))
-		if err := process.Run(); err != nil {
-			logrus.Error("Error starting the extraction process")
-			logrus.Errorf("%+v", err)
-			return err
-		}
+func (systemEngine *SystemEngine) extractPluginArchive(consolePlugin *sqlite.ConsolePlugin, consolePluginsFiles *sqlite.ConsolePluginsFile, consolePluginsFileIndex int) (err error) {
+	var pluginType plugins.Type
+	if pluginType, err = plugins.Get(consolePlugin.Type); err != nil {
+		return
+	}
+	consolePluginFilePath := systemEngine.GetDownloadCorePluginPath(consolePlugin, consolePluginsFiles)
+	if !pluginType.Extract || !archive.IsArchive(consolePluginFilePath) {
+		return nil
+	}
+	if err = systemEngine.extractArchive(
+		consolePluginFilePath,
+		systemEngine.GetCorePluginTempPath(consolePlugin, consolePluginsFileIndex),
+		consolePluginsFiles.CollectionPath.String); err != nil {
+		logrus.Error("Error extracting the console plugin archive")
+		logrus.Errorf("%+v", err)
+		return
 	}
 	return nil
 }
 
-func (systemEngine *SystemEngine) elaboratePluginArchive(consolePlugin *console.ConsolePlugin, consolePluginsFile *console.ConsolePluginsFile, consolePluginsFileIndex int) (err error) {
-	if consolePlugin.Type == "bios" {
-		consolePluginFilePath := GetDownloadCorePluginPath(consolePlugin, consolePluginsFile)
-		destinationFolder := ""
-		if consolePluginsFile.Destination.Valid {
-			destinationFolder = consolePluginsFile.Destination.String
-		}
-		if _, err := os.Stat(destinationFolder); os.IsNotExist(err) {
-			os.MkdirAll(destinationFolder, 0755)
-		}
-		isExtractingExtension := false
-		for _, item := range systemEngine.extractingExtensions {
-			if item == path.Ext(consolePluginFilePath)[1:] {
-				isExtractingExtension = true
-				break
-			}
-		}
-		if !isExtractingExtension {
-			destinationPath := path.Join(destinationFolder, path.Base(consolePluginFilePath))
-			os.MkdirAll(destinationFolder, 0755)
-			os.Rename(consolePluginFilePath, destinationPath)
-		} else {
-			extractionDir := GetCorePluginTempPath(consolePlugin, consolePluginsFileIndex)
-			collectionPath := extractionDir
-			if consolePluginsFile.CollectionPath.Valid {
-				collectionPath = path.Join(collectionPath, consolePluginsFile.CollectionPath.String)
-			}
-			var collectionFileInfo fs.FileInfo
-			if collectionFileInfo, err = os.Stat(collectionPath); err != nil {
-				return
-			}
-			if collectionFileInfo.IsDir() {
-				os.Rename(collectionPath, destinationFolder)
-			} else {
-				destinationPath := path.Join(destinationFolder, path.Base(collectionPath))
-				os.Rename(collectionPath, destinationPath)
-			}
-			os.RemoveAll(collectionPath)
-			os.RemoveAll(extractionDir)
+/*
+Move the plugin file to the folder of its type and destination.
+
+The extracted folders are merged into the destination, as the shaders and overlays
+packs sharing their folders.
+*/
+func (systemEngine *SystemEngine) elaboratePluginArchive(consolePlugin *sqlite.ConsolePlugin, consolePluginsFile *sqlite.ConsolePluginsFile, consolePluginsFileIndex int) (err error) {
+	var pluginType plugins.Type
+	if pluginType, err = plugins.Get(consolePlugin.Type); err != nil {
+		return
+	}
+	var destinationFolder string
+	if destinationFolder, err = pluginType.GetDestinationPath(consolePluginsFile.Destination.String); err != nil {
+		return
+	}
+	destinationFolder = filepath.Join(systemEngine.basePath, destinationFolder)
+	if destinationFolder != "" {
+		if err = os.MkdirAll(destinationFolder, 0755); err != nil {
+			return
 		}
 	}
-	return
+	consolePluginFilePath := systemEngine.GetDownloadCorePluginPath(consolePlugin, consolePluginsFile)
+	if !pluginType.Extract || !archive.IsArchive(consolePluginFilePath) {
+		destinationPath := path.Join(destinationFolder, path.Base(consolePluginFilePath))
+		return os.Rename(consolePluginFilePath, destinationPath)
+	}
+	extractionDir := systemEngine.GetCorePluginTempPath(consolePlugin, consolePluginsFileIndex)
+	defer os.RemoveAll(extractionDir)
+	defer os.Remove(consolePluginFilePath)
+	collectionPath := extractionDir
+	if consolePluginsFile.CollectionPath.Valid {
+		collectionPath = path.Join(collectionPath, consolePluginsFile.CollectionPath.String)
+	}
+	var collectionFileInfo fs.FileInfo
+	if collectionFileInfo, err = os.Stat(collectionPath); err != nil {
+		return
+	}
+	if collectionFileInfo.IsDir() {
+		return folder.MoveFolderContent(collectionPath, destinationFolder)
+	}
+	return os.Rename(collectionPath, path.Join(destinationFolder, path.Base(collectionPath)))
 }
 
-func (systemEngine *SystemEngine) extractToolArchive(toolEntry *tool.Tool) error {
-	isExtractingExtension := false
-	for _, item := range systemEngine.extractingExtensions {
-		if item == path.Ext(toolEntry.Url)[1:] {
-			isExtractingExtension = true
-			break
-		}
-	}
-	if !isExtractingExtension {
+func (systemEngine *SystemEngine) extractToolArchive(toolEntry *sqlite.Tool) error {
+	if !archive.IsArchive(toolEntry.Url) {
 		return nil
 	}
-	process := exec.Command(
-		osconstants.SEVENZ_EXE_PATH,
-		"x",
-		GetDownloadToolPath(toolEntry),
-		"-o"+GetToolTempPath(toolEntry))
-	if err := process.Run(); err != nil {
-		logrus.Error("Error starting the extraction process")
+	if err := systemEngine.extractArchive(systemEngine.GetDownloadToolPath(toolEntry), systemEngine.GetToolTempPath(toolEntry), toolEntry.CollectionPath.String); err != nil {
+		logrus.Error("Error extracting the tool archive")
 		logrus.Errorf("%+v", err)
 		return err
 	}
 	return nil
 }
 
-func (systemEngine *SystemEngine) elaborateToolArchive(toolEntry *tool.Tool) (err error) {
-	destinationFolder := folder.TOOLS
+func (systemEngine *SystemEngine) elaborateToolArchive(toolEntry *sqlite.Tool) (err error) {
+	destinationFolder := filepath.Join(systemEngine.basePath, folder.TOOLS)
 	if _, err := os.Stat(destinationFolder); os.IsNotExist(err) {
 		os.Mkdir(destinationFolder, 0755)
 	}
 	if toolEntry.Destination.Valid && toolEntry.Destination.String != "" {
 		destinationFolder = path.Join(destinationFolder, toolEntry.Destination.String)
 	}
-	isExtractingExtension := false
-	for _, item := range systemEngine.extractingExtensions {
-		if item == path.Ext(toolEntry.Url)[1:] {
-			isExtractingExtension = true
-			break
-		}
-	}
-	if !isExtractingExtension {
+	if !archive.IsArchive(toolEntry.Url) {
 		destinationPath := path.Join(destinationFolder, path.Base(toolEntry.Url))
-		os.Rename(GetDownloadToolPath(toolEntry), destinationPath)
+		os.Rename(systemEngine.GetDownloadToolPath(toolEntry), destinationPath)
 	} else {
-		extractionDir := GetToolTempPath(toolEntry)
+		extractionDir := systemEngine.GetToolTempPath(toolEntry)
 		collectionPath := extractionDir
 		if toolEntry.CollectionPath.Valid && toolEntry.CollectionPath.String != "" {
 			collectionPath = path.Join(collectionPath, toolEntry.CollectionPath.String)
 		}
 		var collectionFileInfo fs.FileInfo
-		collectionFileInfo, err = os.Stat(collectionPath)
+		if collectionFileInfo, err = os.Stat(collectionPath); err != nil {
+			logrus.Errorf("Cannot find the %s collection path of the tool %s", collectionPath, toolEntry.Slug)
+			os.RemoveAll(extractionDir)
+			return
+		}
 		if collectionFileInfo.IsDir() {
 			os.Rename(collectionPath, destinationFolder)
 		} else {
@@ -585,35 +581,45 @@ func (systemEngine *SystemEngine) elaborateToolArchive(toolEntry *tool.Tool) (er
 		}
 		os.RemoveAll(extractionDir)
 	}
-	os.Remove(GetDownloadToolPath(toolEntry))
+	os.Remove(systemEngine.GetDownloadToolPath(toolEntry))
 	return
 }
 
-func GetDownloadCorePath(consoleEntry *console.Console) string {
-	fileName := consoleEntry.CoreLocation + "." + osconstants.CORES_EXTENSION + ".zip"
-	return path.Join(folder.TEMP, fileName)
+// Extract the archive, or only its entry if not empty
+func (systemEngine *SystemEngine) extractArchive(archivePath string, destinationPath string, entry string) error {
+	archiveName := filepath.Base(archivePath)
+	return archive.Extract(archivePath, destinationPath, archive.Options{
+		Entry:   entry,
+		MaxSize: systemEngine.extractionSizeLimit,
+		ProgressHandler: func(extracted int64, total int64) {
+			logrus.Debugf("%s: Extraction progress %d/%d", archiveName, extracted, total)
+		},
+	})
 }
 
-func GetDownloadCorePluginPath(consolePlugin *console.ConsolePlugin, consolePluginFile *console.ConsolePluginsFile) string {
-	tempDownloadDir := GetPluginTempPath()
+func (systemEngine *SystemEngine) GetDownloadCorePath(consoleEntry *sqlite.Console) string {
+	return path.Join(systemEngine.basePath, folder.TEMP, systemEngine.GetCoreArchiveName(consoleEntry))
+}
+
+func (systemEngine *SystemEngine) GetDownloadCorePluginPath(consolePlugin *sqlite.ConsolePlugin, consolePluginFile *sqlite.ConsolePluginsFile) string {
+	tempDownloadDir := systemEngine.GetPluginTempPath(consolePlugin)
 	return path.Join(tempDownloadDir, GetDownloadCorePluginFileName(consolePlugin, consolePluginFile))
 }
 
-func GetDownloadCorePluginFileName(consolePlugin *console.ConsolePlugin, consolePluginFile *console.ConsolePluginsFile) string {
-	if consolePlugin.Type == "bios" {
-		if url, err := url.Parse(consolePluginFile.Url); err == nil {
-			if url.Fragment != "" {
-				return url.Fragment
-			} else {
-				return path.Base(url.Path)
-			}
-		}
+// Name of the downloaded plugin file, the URL fragment if set
+func GetDownloadCorePluginFileName(consolePlugin *sqlite.ConsolePlugin, consolePluginFile *sqlite.ConsolePluginsFile) string {
+	url, err := url.Parse(consolePluginFile.Url)
+	if err != nil {
+		return path.Base(consolePluginFile.Url)
 	}
-	panic("plugin file name unavailable")
+	if url.Fragment != "" {
+		return url.Fragment
+	}
+	return path.Base(url.Path)
 }
 
-func GetDownloadToolPath(toolEntry *tool.Tool) (toolPath string) {
-	toolPath = folder.TEMP
+func (systemEngine *SystemEngine) GetDownloadToolPath(toolEntry *sqlite.Tool) (toolPath string) {
+	toolPath = path.Join(systemEngine.basePath, folder.TEMP)
 	if _, err := os.Stat(toolPath); os.IsNotExist(err) {
 		os.Mkdir(toolPath, 0755)
 	}
@@ -622,8 +628,8 @@ func GetDownloadToolPath(toolEntry *tool.Tool) (toolPath string) {
 	return
 }
 
-func GetCoreTempPath(consoleEntry *console.Console) (tempDownloadDir string) {
-	tempDownloadDir = folder.TEMP
+func (systemEngine *SystemEngine) GetCoreTempPath(consoleEntry *sqlite.Console) (tempDownloadDir string) {
+	tempDownloadDir = path.Join(systemEngine.basePath, folder.TEMP)
 	tempDownloadDir = path.Join(tempDownloadDir, consoleEntry.Slug)
 	if _, err := os.Stat(tempDownloadDir); os.IsNotExist(err) {
 		os.Mkdir(tempDownloadDir, 0755)
@@ -631,32 +637,34 @@ func GetCoreTempPath(consoleEntry *console.Console) (tempDownloadDir string) {
 	return
 }
 
-func GetCorePluginTempPath(consolePlugin *console.ConsolePlugin, fileIndex int) string {
-	tempDownloadDir := GetPluginTempPath()
+func (systemEngine *SystemEngine) GetCorePluginTempPath(consolePlugin *sqlite.ConsolePlugin, fileIndex int) string {
+	tempDownloadDir := systemEngine.GetPluginTempPath(consolePlugin)
 	return path.Join(tempDownloadDir, strconv.Itoa(fileIndex))
 }
 
-func GetToolTempPath(toolEntry *tool.Tool) (tempDownloadDir string) {
-	tempDownloadDir = path.Join(folder.TEMP, toolEntry.Slug)
+func (systemEngine *SystemEngine) GetToolTempPath(toolEntry *sqlite.Tool) (tempDownloadDir string) {
+	tempDownloadDir = path.Join(systemEngine.basePath, folder.TEMP, toolEntry.Slug)
 	if _, err := os.Stat(tempDownloadDir); os.IsNotExist(err) {
 		os.Mkdir(tempDownloadDir, 0755)
 	}
 	return
 }
 
-func GetPluginTempPath() string {
-	tempDownloadDir := folder.TEMP
-	tempDownloadDir = path.Join(tempDownloadDir, folder.PLUGIN)
+// The temporary folder of the plugin, keyed by its console and ID
+func (systemEngine *SystemEngine) GetPluginTempPath(consolePlugin *sqlite.ConsolePlugin) string {
+	tempDownloadDir := path.Join(systemEngine.basePath, folder.TEMP)
+	tempDownloadDir = path.Join(tempDownloadDir, folder.PLUGIN, consolePlugin.ConsoleID, strconv.FormatUint(uint64(consolePlugin.Id), 10))
 	if _, err := os.Stat(tempDownloadDir); os.IsNotExist(err) {
 		os.MkdirAll(tempDownloadDir, 0755)
 	}
 	return tempDownloadDir
 }
 
-func GetCorePath(consoleEntry *console.Console) string {
+// The core path of the platform, relative to the base path
+func GetCorePath(consoleEntry *sqlite.Console, platform *buildbot.Platform) string {
 	return path.Join(
 		folder.CORES,
-		consoleEntry.CoreLocation+"."+osconstants.CORES_EXTENSION)
+		consoleEntry.CoreLocation+"."+platform.CoreExtension)
 }
 
 func GetUndertow() resources.StorjResource {
@@ -694,16 +702,18 @@ func (systemEngine *SystemEngine) setDefaultConfiguration() {
 
 func (systemEngine *SystemEngine) setFixedConfiguration() (err error) {
 	var systemFolder string
-	if systemFolder, err = filepath.Abs(folder.SYSTEM); err != nil {
+	if systemFolder, err = filepath.Abs(filepath.Join(systemEngine.basePath, folder.SYSTEM)); err != nil {
 		logrus.Error("Cannot get absolute shader folder")
 		logrus.Errorf("%+v", err)
 		return
 	}
 
-	shadersFolderPath := filepath.Join(systemFolder, "shaders")
 	systemEngine.settings["system_directory"] = systemFolder
 	systemEngine.settings["global_core_options"] = true
-	systemEngine.settings["video_shader_dir"] = shadersFolderPath
+	systemEngine.settings["video_shader_dir"] = filepath.Join(systemFolder, plugins.SHADERS)
+	systemEngine.settings["overlay_directory"] = filepath.Join(systemFolder, plugins.OVERLAYS)
+	systemEngine.settings["cheat_database_path"] = filepath.Join(systemFolder, plugins.CHEATS)
+	systemEngine.settings["input_remapping_directory"] = filepath.Join(systemFolder, plugins.REMAPS)
 	systemEngine.settings["video_windowed_fullscreen"] = true
 	systemEngine.settings["input_audio_mute"] = "nul"
 	systemEngine.settings["input_cheat_index_minus"] = "nul"
@@ -715,7 +725,7 @@ func (systemEngine *SystemEngine) setFixedConfiguration() (err error) {
 	systemEngine.settings["input_grab_mouse_toggle"] = "nul"
 	systemEngine.settings["input_hold_fast_forward"] = "nul"
 	systemEngine.settings["input_hold_slowmotion"] = "nul"
-	systemEngine.settings["input_load_state"] = "nul"
+	systemEngine.settings["input_load_state"] = "f4"
 	systemEngine.settings["input_menu_toggle"] = "nul"
 	systemEngine.settings["input_movie_record_toggle"] = "nul"
 	systemEngine.settings["input_netplay_game_watch"] = "nul"
@@ -723,13 +733,13 @@ func (systemEngine *SystemEngine) setFixedConfiguration() (err error) {
 	systemEngine.settings["input_pause_toggle"] = "nul"
 	systemEngine.settings["input_reset"] = "nul"
 	systemEngine.settings["input_rewind"] = "nul"
-	systemEngine.settings["input_save_state"] = "nul"
+	systemEngine.settings["input_save_state"] = "f2"
 	systemEngine.settings["input_screenshot"] = "nul"
 	systemEngine.settings["input_send_debug_info"] = "nul"
 	systemEngine.settings["input_shader_next"] = "nul"
 	systemEngine.settings["input_shader_prev"] = "nul"
-	systemEngine.settings["input_state_slot_decrease"] = "nul"
-	systemEngine.settings["input_state_slot_increase"] = "nul"
+	systemEngine.settings["input_state_slot_decrease"] = "f6"
+	systemEngine.settings["input_state_slot_increase"] = "f7"
 	systemEngine.settings["input_toggle_fast_forward"] = "nul"
 	systemEngine.settings["input_toggle_fullscreen"] = "nul"
 	systemEngine.settings["input_volume_down"] = "nul"
@@ -751,7 +761,7 @@ func (systemEngine *SystemEngine) setFixedConfiguration() (err error) {
 	systemEngine.settings["video_scale_integer"] = false
 
 	// Language handling
-	var databaseLanguage database.Locale
+	var databaseLanguage sqlite.Locale
 	databaseLanguage, _ = systemEngine.databaseEngine.GetLanguage()
 	language := systemEngine.languageToRetroArchIndex(databaseLanguage)
 	systemEngine.settings["user_language"] = language
@@ -760,15 +770,15 @@ func (systemEngine *SystemEngine) setFixedConfiguration() (err error) {
 	return
 }
 
-func (systemEngine *SystemEngine) languageToRetroArchIndex(databaseLanguage database.Locale) int {
+func (systemEngine *SystemEngine) languageToRetroArchIndex(databaseLanguage sqlite.Locale) int {
 	switch databaseLanguage {
-	case database.FRENCH:
+	case sqlite.FRENCH:
 		return 2
-	case database.SPANISH:
+	case sqlite.SPANISH:
 		return 3
-	case database.GERMAN:
+	case sqlite.GERMAN:
 		return 4
-	case database.ITALIAN:
+	case sqlite.ITALIAN:
 		return 5
 	}
 	return 0
@@ -776,7 +786,7 @@ func (systemEngine *SystemEngine) languageToRetroArchIndex(databaseLanguage data
 
 func (systemEngine *SystemEngine) syncSettings() (err error) {
 	savedSettingsMap := make(map[string]interface{})
-	configFilePath := GetDefaultConfigPath()
+	configFilePath := filepath.Join(systemEngine.basePath, GetDefaultConfigPath())
 	if _, err = os.Stat(configFilePath); !os.IsNotExist(err) {
 		var configFileData []byte
 		if configFileData, err = os.ReadFile(configFilePath); err != nil {
@@ -795,5 +805,14 @@ func (systemEngine *SystemEngine) syncSettings() (err error) {
 	if file, err = os.OpenFile(configFilePath, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0644); err != nil {
 		return
 	}
-	return toml.NewEncoder(bufio.NewWriter(file)).Encode(systemEngine.settings)
+	defer func() {
+		if closeErr := file.Close(); err == nil {
+			err = closeErr
+		}
+	}()
+	writer := bufio.NewWriter(file)
+	if err = toml.NewEncoder(writer).Encode(systemEngine.settings); err != nil {
+		return
+	}
+	return writer.Flush()
 }
@@ -0,0 +1,247 @@
+package undertow
+
+import (
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+
+	"arkhive.dev/launcher/pkg/encryption"
+)
+
+var ErrUndertowRollback = errors.New("the undertow bundle is older than the pinned one")
+var ErrUndertowKeyMismatch = errors.New("the undertow bundle key differs from the pinned one without a valid rotation sign")
+
+/*
+The undertow bundle, the signed description of the network stored as a JSON object:
+
+	{
+	  "version": Bundle version, increased on every publication,
+	  "public_key": "base64url encoding of the root PEM public key.",
+	  "bootstrap_peers": ["host:port addresses of the bootstrap peers."],
+	  "catalogs": ["URLs of the catalog databases."],
+	  "sign": "base64url encoding of the sign made with the root key.",
+	  "rotation_sign": "(optional) base64url encoding of the sign made with the previous root key.",
+	  "rotations": [{
+	    "public_key": "base64url encoding of a former root PEM public key.",
+	    "sign": "base64url encoding of the sign of the next root public_key made with this key."
+	  }]
+	}
+
+The signs are RSA-PSS SHA-256 signatures of the bundle JSON object without the sign and
+rotations keys, serialized in the above key order. The rotations are the chain of the
+former root keys, oldest first, each one signing the base64url public key following it,
+and the last one signing the bundle root key.
+*/
+type Bundle struct {
+	Version        int64      `json:"version"`
+	PublicKey      string     `json:"public_key"`
+	BootstrapPeers []string   `json:"bootstrap_peers"`
+	Catalogs       []string   `json:"catalogs"`
+	Sign           string     `json:"sign,omitempty"`
+	RotationSign   string     `json:"rotation_sign,omitempty"`
+	Rotations      []Rotation `json:"rotations,omitempty"`
+}
+
+// A former root key, trusting the root key following it in the rotations chain
+type Rotation struct {
+	PublicKey string `json:"public_key"`
+	Sign      string `json:"sign"`
+}
+
+// Create an unsigned bundle of the root public key
+func NewBundle(version int64, publicKey *rsa.PublicKey, bootstrapPeers []string, catalogs []string) (bundle *Bundle, err error) {
+	var publicKeyBytes []byte
+	if publicKeyBytes, err = encryption.ExportPublicKey(publicKey); err != nil {
+		return
+	}
+	bundle = &Bundle{
+		Version:        version,
+		PublicKey:      base64.URLEncoding.EncodeToString(publicKeyBytes),
+		BootstrapPeers: bootstrapPeers,
+		Catalogs:       catalogs,
+	}
+	return
+}
+
+// Parse the JSON bundle, verifying its sign against its root key
+func ParseBundle(jsonBundleData []byte) (bundle *Bundle, err error) {
+	bundle = &Bundle{}
+	if err = json.Unmarshal(jsonBundleData, bundle); err != nil {
+		return nil, err
+	}
+	if bundle.Version <= 0 {
+		return nil, errors.New("invalid undertow bundle version")
+	}
+	var publicKey *rsa.PublicKey
+	if publicKey, err = bundle.GetPublicKey(); err != nil {
+		return nil, err
+	}
+	if err = bundle.verify(bundle.Sign, publicKey); err != nil {
+		return nil, fmt.Errorf("invalid undertow bundle sign: %w", err)
+	}
+	return
+}
+
+// Read the bundle file
+func ReadBundleFile(bundleFilePath string) (bundle *Bundle, err error) {
+	var jsonBundleData []byte
+	if jsonBundleData, err = os.ReadFile(bundleFilePath); err != nil {
+		return
+	}
+	return ParseBundle(jsonBundleData)
+}
+
+// Write the bundle file
+func (bundle *Bundle) WriteFile(bundleFilePath string) (err error) {
+	var jsonBundleData []byte
+	if jsonBundleData, err = json.Marshal(bundle); err != nil {
+		return
+	}
+	return os.WriteFile(bundleFilePath, jsonBundleData, 0644)
+}
+
+// Get the root public key of the bundle
+func (bundle *Bundle) GetPublicKey() (publicKey *rsa.PublicKey, err error) {
+	return parsePublicKey(bundle.PublicKey)
+}
+
+func parsePublicKey(base64PublicKey string) (publicKey *rsa.PublicKey, err error) {
+	var publicKeyBytes []byte
+	if publicKeyBytes, err = base64.URLEncoding.DecodeString(base64PublicKey); err != nil {
+		return
+	}
+	return encryption.ParsePublicKey(publicKeyBytes)
+}
+
+// Get the bundle data covered by the signs
+func (bundle *Bundle) GetSignedData() ([]byte, error) {
+	unsignedBundle := *bundle
+	unsignedBundle.Sign = ""
+	unsignedBundle.RotationSign = ""
+	unsignedBundle.Rotations = nil
+	return json.Marshal(unsignedBundle)
+}
+
+// Sign the bundle with the root private key
+func (bundle *Bundle) SignWith(rootPrivateKey *rsa.PrivateKey) (err error) {
+	bundle.Sign, err = bundle.sign(rootPrivateKey)
+	return
+}
+
+/*
+Sign the bundle with the previous root private key, allowing the clients to trust the new root key.
+
+The previous rotations are the chain of the previous bundle, extended with the previous root
+key so that the clients that missed some rotations can still walk up to the new root key.
+*/
+func (bundle *Bundle) RotateFrom(previousRootPrivateKey *rsa.PrivateKey, previousRotations []Rotation) (err error) {
+	if bundle.RotationSign, err = bundle.sign(previousRootPrivateKey); err != nil {
+		return
+	}
+	var previousPublicKeyBytes []byte
+	if previousPublicKeyBytes, err = encryption.ExportPublicKey(&previousRootPrivateKey.PublicKey); err != nil {
+		return
+	}
+	rotation := Rotation{PublicKey: base64.URLEncoding.EncodeToString(previousPublicKeyBytes)}
+	if rotation.Sign, err = signData(previousRootPrivateKey, []byte(bundle.PublicKey)); err != nil {
+		return
+	}
+	bundle.Rotations = append(append([]Rotation{}, previousRotations...), rotation)
+	return
+}
+
+func (bundle *Bundle) sign(privateKey *rsa.PrivateKey) (base64Sign string, err error) {
+	var signedData []byte
+	if signedData, err = bundle.GetSignedData(); err != nil {
+		return
+	}
+	return signData(privateKey, signedData)
+}
+
+func (bundle *Bundle) verify(base64Sign string, publicKey *rsa.PublicKey) (err error) {
+	var signedData []byte
+	if signedData, err = bundle.GetSignedData(); err != nil {
+		return
+	}
+	return verifyData(publicKey, signedData, base64Sign)
+}
+
+func signData(privateKey *rsa.PrivateKey, data []byte) (base64Sign string, err error) {
+	var sign []byte
+	if sign, err = encryption.Sign(privateKey, data); err != nil {
+		return
+	}
+	base64Sign = base64.URLEncoding.EncodeToString(sign)
+	return
+}
+
+func verifyData(publicKey *rsa.PublicKey, data []byte, base64Sign string) (err error) {
+	if base64Sign == "" {
+		return errors.New("missing sign")
+	}
+	var sign []byte
+	if sign, err = base64.URLEncoding.DecodeString(base64Sign); err != nil {
+		return
+	}
+	return encryption.Verify(publicKey, data, sign)
+}
+
+// Walk the rotations chain from the pinned root key up to the bundle root key
+func (bundle *Bundle) verifyRotations(pinnedPublicKey string) (err error) {
+	start := -1
+	for index, rotation := range bundle.Rotations {
+		if rotation.PublicKey == pinnedPublicKey {
+			start = index
+		}
+	}
+	if start < 0 {
+		return errors.New("the pinned root key is not in the rotations chain")
+	}
+	for index := start; index < len(bundle.Rotations); index++ {
+		nextPublicKey := bundle.PublicKey
+		if index+1 < len(bundle.Rotations) {
+			nextPublicKey = bundle.Rotations[index+1].PublicKey
+		}
+		var publicKey *rsa.PublicKey
+		if publicKey, err = parsePublicKey(bundle.Rotations[index].PublicKey); err != nil {
+			return
+		}
+		if err = verifyData(publicKey, []byte(nextPublicKey), bundle.Rotations[index].Sign); err != nil {
+			return
+		}
+	}
+	return
+}
+
+/*
+Verify that the fetched bundle could replace the pinned one.
+
+Every bundle is trusted when nothing is pinned. Otherwise the bundle must not be older
+than the pinned one and must have the same root key, or a newer version with a
+rotation sign made by the pinned root key, or with a rotations chain starting from it.
+*/
+func VerifyUpdate(pinned *Bundle, fetched *Bundle) (err error) {
+	if pinned == nil {
+		return
+	}
+	if fetched.Version < pinned.Version {
+		return ErrUndertowRollback
+	}
+	if fetched.PublicKey == pinned.PublicKey {
+		return
+	}
+	var pinnedPublicKey *rsa.PublicKey
+	if pinnedPublicKey, err = pinned.GetPublicKey(); err != nil {
+		return
+	}
+	if fetched.Version == pinned.Version {
+		return ErrUndertowKeyMismatch
+	}
+	if fetched.verify(fetched.RotationSign, pinnedPublicKey) != nil && fetched.verifyRotations(pinned.PublicKey) != nil {
+		return ErrUndertowKeyMismatch
+	}
+	return
+}
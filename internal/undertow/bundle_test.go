@@ -0,0 +1,85 @@
+package undertow_test
+
+import (
+	"crypto/rsa"
+	"encoding/json"
+	"testing"
+
+	"arkhive.dev/launcher/internal/undertow"
+	"arkhive.dev/launcher/pkg/encryption"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestBundle(t *testing.T, version int64, rootKey *rsa.PrivateKey, previousRootKey *rsa.PrivateKey) *undertow.Bundle {
+	bundle, err := undertow.NewBundle(version, &rootKey.PublicKey, []string{"peer.arkhive.dev:6881"}, []string{"sj://arkhive/db.honey"})
+	assert.Nil(t, err)
+	assert.Nil(t, bundle.SignWith(rootKey))
+	if previousRootKey != nil {
+		assert.Nil(t, bundle.RotateFrom(previousRootKey, nil))
+	}
+	return bundle
+}
+
+func TestParseBundle(t *testing.T) {
+	rootKey, err := encryption.GeneratePairKey(encryption.MIN_KEY_BITS)
+	assert.Nil(t, err)
+	bundle := newTestBundle(t, 1, rootKey, nil)
+	bundleData, err := json.Marshal(bundle)
+	assert.Nil(t, err)
+	parsedBundle, err := undertow.ParseBundle(bundleData)
+	assert.Nil(t, err)
+	assert.Equal(t, bundle, parsedBundle)
+
+	tamperedBundle := *bundle
+	tamperedBundle.Catalogs = []string{"https://attacker.invalid/db.honey"}
+	bundleData, _ = json.Marshal(tamperedBundle)
+	_, err = undertow.ParseBundle(bundleData)
+	assert.NotNil(t, err)
+
+	unsignedBundle := *bundle
+	unsignedBundle.Sign = ""
+	bundleData, _ = json.Marshal(unsignedBundle)
+	_, err = undertow.ParseBundle(bundleData)
+	assert.NotNil(t, err)
+}
+
+func TestVerifyUpdate(t *testing.T) {
+	rootKey, err := encryption.GeneratePairKey(encryption.MIN_KEY_BITS)
+	assert.Nil(t, err)
+	nextRootKey, err := encryption.GeneratePairKey(encryption.MIN_KEY_BITS)
+	assert.Nil(t, err)
+	lastRootKey, err := encryption.GeneratePairKey(encryption.MIN_KEY_BITS)
+	assert.Nil(t, err)
+	pinned := newTestBundle(t, 2, rootKey, nil)
+	// Rotated twice, the clients pinning the version 2 missed the version 3
+	rotatedBundle := newTestBundle(t, 3, nextRootKey, rootKey)
+	chainedBundle := newTestBundle(t, 4, lastRootKey, nil)
+	assert.Nil(t, chainedBundle.RotateFrom(nextRootKey, rotatedBundle.Rotations))
+	unchainedBundle := newTestBundle(t, 4, lastRootKey, nextRootKey)
+	forgedBundle := newTestBundle(t, 4, lastRootKey, nil)
+	assert.Nil(t, forgedBundle.RotateFrom(nextRootKey, []undertow.Rotation{{PublicKey: pinned.PublicKey, Sign: rotatedBundle.Rotations[0].Sign[1:]}}))
+
+	tests := []struct {
+		name     string
+		pinned   *undertow.Bundle
+		fetched  *undertow.Bundle
+		expected error
+	}{
+		{"first use", nil, newTestBundle(t, 1, rootKey, nil), nil},
+		{"same version", pinned, newTestBundle(t, 2, rootKey, nil), nil},
+		{"newer version", pinned, newTestBundle(t, 3, rootKey, nil), nil},
+		{"rollback", pinned, newTestBundle(t, 1, rootKey, nil), undertow.ErrUndertowRollback},
+		{"rotation", pinned, newTestBundle(t, 3, nextRootKey, rootKey), nil},
+		{"rotation without sign", pinned, newTestBundle(t, 3, nextRootKey, nil), undertow.ErrUndertowKeyMismatch},
+		{"rotation signed by itself", pinned, newTestBundle(t, 3, nextRootKey, nextRootKey), undertow.ErrUndertowKeyMismatch},
+		{"rotation at the same version", pinned, newTestBundle(t, 2, nextRootKey, rootKey), undertow.ErrUndertowKeyMismatch},
+		{"missed rotation", pinned, chainedBundle, nil},
+		{"missed rotation without chain", pinned, unchainedBundle, undertow.ErrUndertowKeyMismatch},
+		{"forged rotation chain", pinned, forgedBundle, undertow.ErrUndertowKeyMismatch},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			assert.Equal(t, test.expected, undertow.VerifyUpdate(test.pinned, test.fetched))
+		})
+	}
+}
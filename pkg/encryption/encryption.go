@@ -3,16 +3,24 @@ package encryption
 
 import (
 	"bytes"
+	"crypto"
 	"crypto/rand"
 	"crypto/rsa"
 	"crypto/sha256"
 	"crypto/x509"
 	"encoding/pem"
 	"errors"
+	"fmt"
 	"os"
 )
 
+// Minimum size in bits of the generated keys
+const MIN_KEY_BITS = 2048
+
 func GeneratePairKey(bitSize int) (*rsa.PrivateKey, error) {
+	if bitSize < MIN_KEY_BITS {
+		return nil, fmt.Errorf("key size %d is lower than %d bits", bitSize, MIN_KEY_BITS)
+	}
 	reader := rand.Reader
 	return rsa.GenerateKey(reader, bitSize)
 }
@@ -44,18 +52,56 @@ func ParsePrivateKeyFile(path string) (privateKey *rsa.PrivateKey, err error) {
 	return
 }
 
+// Parse a PEM private key in PKCS#1 or PKCS#8 format, failing with ErrEncryptedPrivateKey
+// when the key is encrypted with a passphrase
 func ParsePrivateKey(privatePEM []byte) (*rsa.PrivateKey, error) {
+	return ParsePrivateKeyWithPassphrase(privatePEM, "")
+}
+
+// Parse a PEM private key in PKCS#1 or PKCS#8 format, or encrypted with the passphrase in
+// the arkHive or the PKCS#8 format
+func ParsePrivateKeyWithPassphrase(privatePEM []byte, passphrase string) (*rsa.PrivateKey, error) {
 	block, _ := pem.Decode([]byte(privatePEM))
 	if block == nil {
 		return nil, errors.New("failed to parse PEM block containing the key")
 	}
 
-	privateKey, err := x509.ParsePKCS1PrivateKey(block.Bytes)
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		return x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "PRIVATE KEY":
+		return parsePKCS8PrivateKey(block.Bytes)
+	case ENCRYPTED_PRIVATE_KEY_TYPE:
+		if passphrase == "" {
+			return nil, ErrEncryptedPrivateKey
+		}
+		privateKeyBytes, err := decryptPEMBlock(block, passphrase)
+		if err != nil {
+			return nil, err
+		}
+		return parsePKCS8PrivateKey(privateKeyBytes)
+	case PKCS8_ENCRYPTED_PRIVATE_KEY_TYPE:
+		if passphrase == "" {
+			return nil, ErrEncryptedPrivateKey
+		}
+		privateKeyBytes, err := decryptPKCS8PrivateKey(block.Bytes, passphrase)
+		if err != nil {
+			return nil, err
+		}
+		return parsePKCS8PrivateKey(privateKeyBytes)
+	}
+	return nil, fmt.Errorf("unsupported private key type %q", block.Type)
+}
+
+func parsePKCS8PrivateKey(der []byte) (*rsa.PrivateKey, error) {
+	privateKey, err := x509.ParsePKCS8PrivateKey(der)
 	if err != nil {
 		return nil, err
 	}
-
-	return privateKey, nil
+	if rsaPrivateKey, ok := privateKey.(*rsa.PrivateKey); ok {
+		return rsaPrivateKey, nil
+	}
+	return nil, errors.New("key type is not RSA")
 }
 
 func ExportPublicKey(publicKey *rsa.PublicKey) ([]byte, error) {
@@ -140,3 +186,15 @@ func Decrypt(private *rsa.PrivateKey, msg []byte) ([]byte, error) {
 
 	return decryptedBytes, nil
 }
+
+// Sign the SHA-256 digest of the message with RSA-PSS
+func Sign(private *rsa.PrivateKey, msg []byte) ([]byte, error) {
+	digest := sha256.Sum256(msg)
+	return rsa.SignPSS(rand.Reader, private, crypto.SHA256, digest[:], nil)
+}
+
+// Verify the RSA-PSS sign of the SHA-256 digest of the message
+func Verify(public *rsa.PublicKey, msg []byte, sign []byte) error {
+	digest := sha256.Sum256(msg)
+	return rsa.VerifyPSS(public, crypto.SHA256, digest[:], sign, nil)
+}
@@ -0,0 +1,72 @@
+package encryption
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"errors"
+)
+
+var ErrInvalidEnvelope = errors.New("invalid or corrupted envelope")
+
+/*
+Encrypt a message of any size for the owner of the public key.
+
+The message is encrypted with AES-256-GCM using a random key, itself encrypted with
+RSA-OAEP and prepended to the nonce and the ciphertext.
+*/
+func EncryptEnvelope(public *rsa.PublicKey, msg []byte) ([]byte, error) {
+	key := make([]byte, aesKeySize)
+	if _, err := rand.Read(key); err != nil {
+		return nil, err
+	}
+	encryptedKey, err := rsa.EncryptOAEP(sha256.New(), rand.Reader, public, key, nil)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := newEnvelopeAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err = rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	envelope := append(encryptedKey, nonce...)
+	return aead.Seal(envelope, nonce, msg, nil), nil
+}
+
+// Decrypt the envelope encrypted for the public key of the private key
+func DecryptEnvelope(private *rsa.PrivateKey, envelope []byte) ([]byte, error) {
+	keySize := private.PublicKey.Size()
+	if len(envelope) < keySize {
+		return nil, ErrInvalidEnvelope
+	}
+	key, err := rsa.DecryptOAEP(sha256.New(), rand.Reader, private, envelope[:keySize], nil)
+	if err != nil {
+		return nil, ErrInvalidEnvelope
+	}
+	aead, err := newEnvelopeAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+	envelope = envelope[keySize:]
+	if len(envelope) < aead.NonceSize() {
+		return nil, ErrInvalidEnvelope
+	}
+	msg, err := aead.Open(nil, envelope[:aead.NonceSize()], envelope[aead.NonceSize():], nil)
+	if err != nil {
+		return nil, ErrInvalidEnvelope
+	}
+	return msg, nil
+}
+
+func newEnvelopeAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
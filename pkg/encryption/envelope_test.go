@@ -0,0 +1,32 @@
+package encryption_test
+
+import (
+	"bytes"
+	"testing"
+
+	"arkhive.dev/launcher/pkg/encryption"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEnvelope(t *testing.T) {
+	privateKey, err := encryption.GeneratePairKey(encryption.MIN_KEY_BITS)
+	assert.Nil(t, err)
+	otherKey, err := encryption.GeneratePairKey(encryption.MIN_KEY_BITS)
+	assert.Nil(t, err)
+	message := bytes.Repeat([]byte("savestate"), 100000)
+
+	envelope, err := encryption.EncryptEnvelope(&privateKey.PublicKey, message)
+	assert.Nil(t, err)
+	assert.False(t, bytes.Contains(envelope, []byte("savestate")))
+	decrypted, err := encryption.DecryptEnvelope(privateKey, envelope)
+	assert.Nil(t, err)
+	assert.Equal(t, message, decrypted)
+
+	_, err = encryption.DecryptEnvelope(otherKey, envelope)
+	assert.ErrorIs(t, err, encryption.ErrInvalidEnvelope)
+	envelope[len(envelope)-1] ^= 1
+	_, err = encryption.DecryptEnvelope(privateKey, envelope)
+	assert.ErrorIs(t, err, encryption.ErrInvalidEnvelope)
+	_, err = encryption.DecryptEnvelope(privateKey, []byte("short"))
+	assert.ErrorIs(t, err, encryption.ErrInvalidEnvelope)
+}
@@ -0,0 +1,147 @@
+package encryption
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"strconv"
+
+	"golang.org/x/crypto/scrypt"
+)
+
+// PEM type of the private keys encrypted by arkHive with a passphrase
+const ENCRYPTED_PRIVATE_KEY_TYPE = "ARKHIVE ENCRYPTED PRIVATE KEY"
+
+// scrypt cost parameters of the newly encrypted keys
+const (
+	SCRYPT_N = 1 << 15
+	SCRYPT_R = 8
+	SCRYPT_P = 1
+)
+
+// Bounds of the scrypt cost parameters of the keys to decrypt, read from the untrusted file
+const (
+	// Memory used by the derivation, 128 * N * r bytes
+	MAX_SCRYPT_MEMORY = 256 * 1024 * 1024
+	MAX_SCRYPT_P      = 16
+)
+
+const scryptSaltSize = 16
+const aesKeySize = 32
+
+var ErrEncryptedPrivateKey = errors.New("the private key is encrypted with a passphrase")
+
+/*
+Export the private key encrypted with the passphrase, in the arkHive format.
+
+The PKCS#8 key is encrypted with AES-256-GCM, using a key derived from the passphrase
+with scrypt. The PEM headers hold the scrypt parameters, the salt and the nonce. This
+is not the PKCS#8 "ENCRYPTED PRIVATE KEY" format, which is only read.
+*/
+func ExportEncryptedPrivateKey(privateKey *rsa.PrivateKey, passphrase string) ([]byte, error) {
+	if passphrase == "" {
+		return nil, errors.New("empty passphrase")
+	}
+	privateKeyBytes, err := x509.MarshalPKCS8PrivateKey(privateKey)
+	if err != nil {
+		return nil, err
+	}
+	salt := make([]byte, scryptSaltSize)
+	if _, err = rand.Read(salt); err != nil {
+		return nil, err
+	}
+	aead, err := newPassphraseAEAD(passphrase, salt, SCRYPT_N, SCRYPT_R, SCRYPT_P)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err = rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return pem.EncodeToMemory(&pem.Block{
+		Type: ENCRYPTED_PRIVATE_KEY_TYPE,
+		Headers: map[string]string{
+			"KDF":      "scrypt",
+			"Scrypt-N": strconv.Itoa(SCRYPT_N),
+			"Scrypt-R": strconv.Itoa(SCRYPT_R),
+			"Scrypt-P": strconv.Itoa(SCRYPT_P),
+			"Salt":     hex.EncodeToString(salt),
+			"Cipher":   "AES-256-GCM",
+			"Nonce":    hex.EncodeToString(nonce),
+		},
+		Bytes: aead.Seal(nil, nonce, privateKeyBytes, nil),
+	}), nil
+}
+
+// Whether the PEM private key is encrypted with a passphrase, in the arkHive or PKCS#8 format
+func IsEncryptedPrivateKey(privatePEM []byte) bool {
+	block, _ := pem.Decode(privatePEM)
+	return block != nil && (block.Type == ENCRYPTED_PRIVATE_KEY_TYPE || block.Type == PKCS8_ENCRYPTED_PRIVATE_KEY_TYPE)
+}
+
+// Check the scrypt cost parameters are valid and within the memory and time bounds
+func checkScryptParameters(n int, r int, p int) error {
+	if n < 2 || n&(n-1) != 0 || r < 1 || p < 1 {
+		return errors.New("invalid scrypt parameters")
+	}
+	if p > MAX_SCRYPT_P || n > MAX_SCRYPT_MEMORY/128/r {
+		return fmt.Errorf("scrypt parameters N=%d r=%d p=%d exceed the allowed cost", n, r, p)
+	}
+	return nil
+}
+
+// Decrypt the PKCS#8 key of an encrypted PEM block
+func decryptPEMBlock(block *pem.Block, passphrase string) ([]byte, error) {
+	if block.Headers["KDF"] != "scrypt" || block.Headers["Cipher"] != "AES-256-GCM" {
+		return nil, errors.New("unsupported private key encryption")
+	}
+	var costParameters [3]int
+	for index, header := range []string{"Scrypt-N", "Scrypt-R", "Scrypt-P"} {
+		value, err := strconv.Atoi(block.Headers[header])
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s header: %w", header, err)
+		}
+		costParameters[index] = value
+	}
+	if err := checkScryptParameters(costParameters[0], costParameters[1], costParameters[2]); err != nil {
+		return nil, err
+	}
+	salt, err := hex.DecodeString(block.Headers["Salt"])
+	if err != nil {
+		return nil, err
+	}
+	nonce, err := hex.DecodeString(block.Headers["Nonce"])
+	if err != nil {
+		return nil, err
+	}
+	aead, err := newPassphraseAEAD(passphrase, salt, costParameters[0], costParameters[1], costParameters[2])
+	if err != nil {
+		return nil, err
+	}
+	if len(nonce) != aead.NonceSize() {
+		return nil, errors.New("invalid nonce size")
+	}
+	privateKeyBytes, err := aead.Open(nil, nonce, block.Bytes, nil)
+	if err != nil {
+		return nil, errors.New("wrong passphrase or corrupted private key")
+	}
+	return privateKeyBytes, nil
+}
+
+func newPassphraseAEAD(passphrase string, salt []byte, n int, r int, p int) (cipher.AEAD, error) {
+	key, err := scrypt.Key([]byte(passphrase), salt, n, r, p, aesKeySize)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,89 @@
+package encryption_test
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"arkhive.dev/launcher/pkg/encryption"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParsePrivateKeyFormats(t *testing.T) {
+	privateKey, err := encryption.GeneratePairKey(encryption.MIN_KEY_BITS)
+	assert.Nil(t, err)
+	pkcs8Bytes, err := x509.MarshalPKCS8PrivateKey(privateKey)
+	assert.Nil(t, err)
+	encryptedPEM, err := encryption.ExportEncryptedPrivateKey(privateKey, "secret")
+	assert.Nil(t, err)
+
+	for name, privatePEM := range map[string][]byte{
+		"pkcs1":     encryption.ExportPrivateKey(privateKey),
+		"pkcs8":     pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: pkcs8Bytes}),
+		"encrypted": encryptedPEM,
+	} {
+		parsedKey, err := encryption.ParsePrivateKeyWithPassphrase(privatePEM, "secret")
+		assert.Nil(t, err, name)
+		assert.True(t, privateKey.Equal(parsedKey), name)
+	}
+
+	assert.True(t, encryption.IsEncryptedPrivateKey(encryptedPEM))
+	assert.False(t, encryption.IsEncryptedPrivateKey(encryption.ExportPrivateKey(privateKey)))
+	_, err = encryption.ParsePrivateKey(encryptedPEM)
+	assert.ErrorIs(t, err, encryption.ErrEncryptedPrivateKey)
+	_, err = encryption.ParsePrivateKeyWithPassphrase(encryptedPEM, "wrong")
+	assert.NotNil(t, err)
+}
+
+func TestGeneratePairKeyMinimumSize(t *testing.T) {
+	_, err := encryption.GeneratePairKey(1024)
+	assert.NotNil(t, err)
+}
+
+func TestSignVerify(t *testing.T) {
+	privateKey, err := encryption.GeneratePairKey(encryption.MIN_KEY_BITS)
+	assert.Nil(t, err)
+	sign, err := encryption.Sign(privateKey, []byte("message"))
+	assert.Nil(t, err)
+	assert.Nil(t, encryption.Verify(&privateKey.PublicKey, []byte("message"), sign))
+	assert.NotNil(t, encryption.Verify(&privateKey.PublicKey, []byte("tampered"), sign))
+}
+
+func TestParsePKCS8EncryptedPrivateKey(t *testing.T) {
+	plainPEM, err := os.ReadFile(filepath.Join("testdata", "plain.pem"))
+	assert.Nil(t, err)
+	privateKey, err := encryption.ParsePrivateKey(plainPEM)
+	assert.Nil(t, err)
+
+	// Keys encrypted by openssl pkcs8 -topk8 with the passphrase "secret"
+	for _, name := range []string{"pbkdf2.pem", "pbkdf2-sha1.pem", "scrypt.pem"} {
+		encryptedPEM, err := os.ReadFile(filepath.Join("testdata", name))
+		assert.Nil(t, err, name)
+		assert.True(t, encryption.IsEncryptedPrivateKey(encryptedPEM), name)
+		_, err = encryption.ParsePrivateKey(encryptedPEM)
+		assert.ErrorIs(t, err, encryption.ErrEncryptedPrivateKey, name)
+		parsedKey, err := encryption.ParsePrivateKeyWithPassphrase(encryptedPEM, "secret")
+		assert.Nil(t, err, name)
+		assert.True(t, privateKey.Equal(parsedKey), name)
+		_, err = encryption.ParsePrivateKeyWithPassphrase(encryptedPEM, "wrong")
+		assert.NotNil(t, err, name)
+	}
+}
+
+func TestEncryptedPrivateKeyCostBound(t *testing.T) {
+	privateKey, err := encryption.GeneratePairKey(encryption.MIN_KEY_BITS)
+	assert.Nil(t, err)
+	encryptedPEM, err := encryption.ExportEncryptedPrivateKey(privateKey, "secret")
+	assert.Nil(t, err)
+	block, _ := pem.Decode(encryptedPEM)
+	block.Headers["Scrypt-N"] = strconv.Itoa(1 << 30)
+	_, err = encryption.ParsePrivateKeyWithPassphrase(pem.EncodeToMemory(block), "secret")
+	assert.ErrorContains(t, err, "exceed")
+	block.Headers["Scrypt-N"] = strconv.Itoa(encryption.SCRYPT_N)
+	block.Headers["Scrypt-P"] = "1000"
+	_, err = encryption.ParsePrivateKeyWithPassphrase(pem.EncodeToMemory(block), "secret")
+	assert.ErrorContains(t, err, "exceed")
+}
@@ -0,0 +1,166 @@
+package encryption
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/pbkdf2"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/asn1"
+	"errors"
+	"fmt"
+	"hash"
+
+	"golang.org/x/crypto/scrypt"
+)
+
+// PEM type of the PKCS#8 private keys encrypted with a password, like the openssl ones
+const PKCS8_ENCRYPTED_PRIVATE_KEY_TYPE = "ENCRYPTED PRIVATE KEY"
+
+// Maximum PBKDF2 iterations of the keys to decrypt, openssl uses 2048
+const MAX_PBKDF2_ITERATIONS = 10_000_000
+
+var (
+	oidPBES2      = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 5, 13}
+	oidPBKDF2     = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 5, 12}
+	oidScrypt     = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 11591, 4, 11}
+	oidHMACSHA1   = asn1.ObjectIdentifier{1, 2, 840, 113549, 2, 7}
+	oidHMACSHA256 = asn1.ObjectIdentifier{1, 2, 840, 113549, 2, 9}
+	oidHMACSHA512 = asn1.ObjectIdentifier{1, 2, 840, 113549, 2, 11}
+	oidAES128CBC  = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 2}
+	oidAES192CBC  = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 22}
+	oidAES256CBC  = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 42}
+)
+
+type algorithmIdentifier struct {
+	Algorithm  asn1.ObjectIdentifier
+	Parameters asn1.RawValue `asn1:"optional"`
+}
+
+type encryptedPrivateKeyInfo struct {
+	EncryptionAlgorithm algorithmIdentifier
+	EncryptedData       []byte
+}
+
+type pbes2Parameters struct {
+	KeyDerivationFunc algorithmIdentifier
+	EncryptionScheme  algorithmIdentifier
+}
+
+type pbkdf2Parameters struct {
+	Salt           []byte
+	IterationCount int
+	KeyLength      int                 `asn1:"optional"`
+	PRF            algorithmIdentifier `asn1:"optional"`
+}
+
+type scryptParameters struct {
+	Salt                     []byte
+	CostParameter            int
+	BlockSize                int
+	ParallelizationParameter int
+	KeyLength                int `asn1:"optional"`
+}
+
+/*
+Decrypt a PKCS#8 EncryptedPrivateKeyInfo, returning the PKCS#8 private key.
+
+Only the PBES2 scheme is supported, with a PBKDF2 (HMAC-SHA1, SHA-256 or SHA-512) or
+scrypt key derivation and AES-CBC encryption, as written by `openssl pkcs8 -topk8`
+and `openssl genpkey` with a cipher.
+*/
+func decryptPKCS8PrivateKey(der []byte, passphrase string) ([]byte, error) {
+	var info encryptedPrivateKeyInfo
+	if _, err := asn1.Unmarshal(der, &info); err != nil {
+		return nil, err
+	}
+	if !info.EncryptionAlgorithm.Algorithm.Equal(oidPBES2) {
+		return nil, fmt.Errorf("unsupported private key encryption scheme %s", info.EncryptionAlgorithm.Algorithm)
+	}
+	var parameters pbes2Parameters
+	if _, err := asn1.Unmarshal(info.EncryptionAlgorithm.Parameters.FullBytes, &parameters); err != nil {
+		return nil, err
+	}
+	var keySize int
+	switch encryptionScheme := parameters.EncryptionScheme.Algorithm; {
+	case encryptionScheme.Equal(oidAES128CBC):
+		keySize = 16
+	case encryptionScheme.Equal(oidAES192CBC):
+		keySize = 24
+	case encryptionScheme.Equal(oidAES256CBC):
+		keySize = 32
+	default:
+		return nil, fmt.Errorf("unsupported private key cipher %s", encryptionScheme)
+	}
+	var iv []byte
+	if _, err := asn1.Unmarshal(parameters.EncryptionScheme.Parameters.FullBytes, &iv); err != nil {
+		return nil, err
+	}
+	key, err := derivePKCS8Key(&parameters.KeyDerivationFunc, passphrase, keySize)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(iv) != block.BlockSize() || len(info.EncryptedData) == 0 || len(info.EncryptedData)%block.BlockSize() != 0 {
+		return nil, errors.New("invalid encrypted private key size")
+	}
+	privateKeyBytes := make([]byte, len(info.EncryptedData))
+	cipher.NewCBCDecrypter(block, iv).CryptBlocks(privateKeyBytes, info.EncryptedData)
+	// A wrong passphrase is detected by the padding, or later by the PKCS#8 parsing
+	padding := int(privateKeyBytes[len(privateKeyBytes)-1])
+	if padding == 0 || padding > block.BlockSize() {
+		return nil, errors.New("wrong passphrase or corrupted private key")
+	}
+	for _, paddingByte := range privateKeyBytes[len(privateKeyBytes)-padding:] {
+		if int(paddingByte) != padding {
+			return nil, errors.New("wrong passphrase or corrupted private key")
+		}
+	}
+	return privateKeyBytes[:len(privateKeyBytes)-padding], nil
+}
+
+// Derive the cipher key from the passphrase, bounding the cost parameters of the file
+func derivePKCS8Key(keyDerivationFunc *algorithmIdentifier, passphrase string, keySize int) ([]byte, error) {
+	switch {
+	case keyDerivationFunc.Algorithm.Equal(oidPBKDF2):
+		var parameters pbkdf2Parameters
+		if _, err := asn1.Unmarshal(keyDerivationFunc.Parameters.FullBytes, &parameters); err != nil {
+			return nil, err
+		}
+		if parameters.IterationCount < 1 || parameters.IterationCount > MAX_PBKDF2_ITERATIONS {
+			return nil, fmt.Errorf("unsupported PBKDF2 iteration count %d", parameters.IterationCount)
+		}
+		if parameters.KeyLength != 0 && parameters.KeyLength != keySize {
+			return nil, errors.New("invalid PBKDF2 key length")
+		}
+		var newHash func() hash.Hash
+		switch prf := parameters.PRF.Algorithm; {
+		case len(prf) == 0 || prf.Equal(oidHMACSHA1):
+			newHash = sha1.New
+		case prf.Equal(oidHMACSHA256):
+			newHash = sha256.New
+		case prf.Equal(oidHMACSHA512):
+			newHash = sha512.New
+		default:
+			return nil, fmt.Errorf("unsupported PBKDF2 function %s", prf)
+		}
+		return pbkdf2.Key(newHash, passphrase, parameters.Salt, parameters.IterationCount, keySize)
+	case keyDerivationFunc.Algorithm.Equal(oidScrypt):
+		var parameters scryptParameters
+		if _, err := asn1.Unmarshal(keyDerivationFunc.Parameters.FullBytes, &parameters); err != nil {
+			return nil, err
+		}
+		if parameters.KeyLength != 0 && parameters.KeyLength != keySize {
+			return nil, errors.New("invalid scrypt key length")
+		}
+		if err := checkScryptParameters(parameters.CostParameter, parameters.BlockSize, parameters.ParallelizationParameter); err != nil {
+			return nil, err
+		}
+		return scrypt.Key([]byte(passphrase), parameters.Salt, parameters.CostParameter, parameters.BlockSize, parameters.ParallelizationParameter, keySize)
+	}
+	return nil, fmt.Errorf("unsupported key derivation function %s", keyDerivationFunc.Algorithm)
+}